@@ -0,0 +1,345 @@
+// Package client calls the TritonTube HTTP API. Its types follow the
+// schemas of the OpenAPI document the server publishes at
+// /api/openapi.json.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiPrefix = "/api/v1"
+
+type Visibility string
+
+const (
+	VisibilityPublic   Visibility = "public"
+	VisibilityUnlisted Visibility = "unlisted"
+	VisibilityPrivate  Visibility = "private"
+)
+
+type Video struct {
+	Id          string `json:"id"`
+	UploadedAt  string `json:"uploadedAt"` // server local time, YYYY-MM-DD hh:mm:ss
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// Duration is in seconds.
+	Duration   float64    `json:"duration"`
+	Views      int64      `json:"views"`
+	Category   string     `json:"category,omitempty"`
+	Tags       []string   `json:"tags"`
+	OwnerId    string     `json:"ownerId,omitempty"`
+	Visibility Visibility `json:"visibility"`
+	// PlaybackToken must be passed to Content for videos that are not
+	// public.
+	PlaybackToken string `json:"playbackToken,omitempty"`
+	// Live is set while the video is a live stream.
+	Live bool `json:"live,omitempty"`
+	// Poster and Thumbnails are the URLs of the poster frame and of the
+	// WebVTT track of scrub preview thumbnails. Only GetVideo sets
+	// Thumbnails.
+	Poster     string `json:"poster"`
+	Thumbnails string `json:"thumbnails,omitempty"`
+	// Subtitles are only set by GetVideo.
+	Subtitles []Subtitle `json:"subtitles,omitempty"`
+}
+
+// Subtitle is a WebVTT subtitle track of a video.
+type Subtitle struct {
+	Language string `json:"language"` // lowercase BCP 47 tag
+	URL      string `json:"url"`
+}
+
+// ListOptions filter and order ListVideos. Zero values use the server's
+// defaults.
+type ListOptions struct {
+	Search   string
+	Tag      string
+	Category string
+	Sort     string // uploadedAt, title, duration or views
+	Order    string // asc or desc
+	Limit    int
+	// Cursor is NextCursor of the previous page.
+	Cursor string
+	// All includes other users' unlisted and private videos; it needs the
+	// operator role.
+	All bool
+}
+
+type VideoPage struct {
+	Videos []Video
+	// NextCursor is empty on the last page.
+	NextCursor string
+}
+
+// Upload is a video file and the details to store with it.
+type Upload struct {
+	// Filename without its extension becomes the video ID.
+	Filename    string
+	Content     io.Reader
+	Title       string
+	Description string
+	Category    string
+	Tags        []string
+	Visibility  Visibility
+}
+
+// Error is a failed request, with the message from the server's error
+// envelope.
+type Error struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is how long to wait before retrying a request rejected
+	// with 429.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("tritontube: %s (HTTP %d)", e.Message, e.StatusCode)
+}
+
+// IsNotFound reports whether err is a 404 from the server.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	token      string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests with hc instead of http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithToken authenticates requests with an API token, as created by
+// POST /api/v1/auth/tokens.
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// New returns a client for the server at baseURL, e.g.
+// "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ListVideos returns one page of the videos the caller may see.
+func (c *Client) ListVideos(ctx context.Context, opts ListOptions) (*VideoPage, error) {
+	query := url.Values{}
+	for name, value := range map[string]string{
+		"q": opts.Search, "tag": opts.Tag, "category": opts.Category,
+		"sort": opts.Sort, "order": opts.Order, "cursor": opts.Cursor,
+	} {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.All {
+		query.Set("all", "true")
+	}
+
+	page := &VideoPage{}
+	resp, err := c.call(ctx, http.MethodGet, "/videos?"+query.Encode(), nil, "", &page.Videos)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = resp.NextCursor
+	return page, nil
+}
+
+func (c *Client) GetVideo(ctx context.Context, videoId string) (*Video, error) {
+	var video Video
+	if _, err := c.call(ctx, http.MethodGet, "/videos/"+url.PathEscape(videoId), nil, "", &video); err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// UploadVideo uploads and transcodes a video and returns its ID. The file
+// is streamed, not buffered.
+func (c *Client) UploadVideo(ctx context.Context, upload Upload) (string, error) {
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeUploadForm(form, upload))
+	}()
+	defer body.Close()
+
+	var data struct {
+		VideoId string `json:"videoId"`
+	}
+	if _, err := c.call(ctx, http.MethodPost, "/videos", body, form.FormDataContentType(), &data); err != nil {
+		return "", err
+	}
+	return data.VideoId, nil
+}
+
+func writeUploadForm(form *multipart.Writer, upload Upload) error {
+	for name, value := range map[string]string{
+		"title": upload.Title, "description": upload.Description, "category": upload.Category,
+		"tags": strings.Join(upload.Tags, ","), "visibility": string(upload.Visibility),
+	} {
+		if value == "" {
+			continue
+		}
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	part, err := form.CreateFormFile("file", upload.Filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, upload.Content); err != nil {
+		return fmt.Errorf("failed to read upload: %w", err)
+	}
+	return form.Close()
+}
+
+// DeleteVideo deletes a video and its files. Only its owner and admins
+// may.
+func (c *Client) DeleteVideo(ctx context.Context, videoId string) error {
+	_, err := c.call(ctx, http.MethodDelete, "/videos/"+url.PathEscape(videoId), nil, "", nil)
+	return err
+}
+
+// ListSubtitles returns the subtitle tracks of a video.
+func (c *Client) ListSubtitles(ctx context.Context, videoId string) ([]Subtitle, error) {
+	var subtitles []Subtitle
+	if _, err := c.call(ctx, http.MethodGet, "/videos/"+url.PathEscape(videoId)+"/subtitles", nil, "", &subtitles); err != nil {
+		return nil, err
+	}
+	return subtitles, nil
+}
+
+// PutSubtitles adds or replaces the subtitles of a video in language. The
+// content may be SRT, which the server converts, or WebVTT. Only the
+// video's owner and admins may.
+func (c *Client) PutSubtitles(ctx context.Context, videoId, language string, content io.Reader) (*Subtitle, error) {
+	var subtitle Subtitle
+	path := "/videos/" + url.PathEscape(videoId) + "/subtitles/" + url.PathEscape(language)
+	if _, err := c.call(ctx, http.MethodPut, path, content, "text/plain; charset=utf-8", &subtitle); err != nil {
+		return nil, err
+	}
+	return &subtitle, nil
+}
+
+// DeleteSubtitles removes the subtitles of a video in language.
+func (c *Client) DeleteSubtitles(ctx context.Context, videoId, language string) error {
+	path := "/videos/" + url.PathEscape(videoId) + "/subtitles/" + url.PathEscape(language)
+	_, err := c.call(ctx, http.MethodDelete, path, nil, "", nil)
+	return err
+}
+
+// Content fetches a file of a video: manifest.mpd, a segment it names,
+// thumbnail.jpg, thumbnails.vtt and the sprite sheets it names, or a
+// subtitle track. playbackToken is the video's PlaybackToken, or empty for
+// public videos. The caller must close the returned body.
+func (c *Client) Content(ctx context.Context, videoId, filename, playbackToken string) (io.ReadCloser, error) {
+	path := "/content/" + url.PathEscape(videoId) + "/" + url.PathEscape(filename)
+	if playbackToken != "" {
+		path += "?token=" + url.QueryEscape(playbackToken)
+	}
+	resp, err := c.do(ctx, http.MethodGet, path, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp.Body, nil
+}
+
+// envelope is the body of every JSON response.
+type envelope struct {
+	Success    bool            `json:"success"`
+	Data       json.RawMessage `json:"data"`
+	Error      string          `json:"error"`
+	NextCursor string          `json:"nextCursor"`
+}
+
+// call sends a request to the API endpoint at path, relative to the API
+// version prefix, and decodes the data of a successful response into out
+// unless it is nil.
+func (c *Client) call(ctx context.Context, method, path string, body io.Reader, contentType string, out any) (*envelope, error) {
+	resp, err := c.do(ctx, method, path, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, readError(resp)
+	}
+
+	var env envelope
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if !env.Success {
+		return nil, &Error{StatusCode: resp.StatusCode, Message: env.Error}
+	}
+	if out != nil && len(env.Data) > 0 {
+		if err := json.Unmarshal(env.Data, out); err != nil {
+			return nil, fmt.Errorf("failed to decode response data: %w", err)
+		}
+	}
+	return &env, nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+apiPrefix+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s %s: %w", method, req.URL.Path, err)
+	}
+	return resp, nil
+}
+
+// readError turns a failed response into an *Error, using the message of
+// its error envelope when it has one.
+func readError(resp *http.Response) error {
+	apiErr := &Error{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	var env envelope
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&env); err == nil && env.Error != "" {
+		apiErr.Message = env.Error
+	}
+	return apiErr
+}
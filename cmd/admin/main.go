@@ -2,50 +2,95 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 	"tritontube/internal/proto"
+	"tritontube/internal/security"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 func main() {
-	if len(os.Args) < 3 { // Minimum 3 args: program, command, server_address
+	tlsCert := flag.String("tls-cert", "", "PEM client certificate (enables mutual TLS)")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	tlsCA := flag.String("tls-ca", "", "PEM CA bundle the admin server certificate must chain to")
+	serverName := flag.String("server-name", "", "Name to verify in the admin server certificate (defaults to the host in server_address)")
+	token := flag.String("token", os.Getenv("TRITONTUBE_TOKEN"), "API token to authenticate with instead of the client certificate (default $TRITONTUBE_TOKEN)")
+	auditLimit := flag.Int("limit", 50, "Maximum number of entries printed by audit")
+	auditActor := flag.String("actor", "", "Only print audit entries of this actor")
+	auditSince := flag.Duration("since", 0, "Only print audit entries younger than this (e.g. 24h)")
+	flag.Usage = printUsageAndExit
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) < 2 { // Minimum 2 args: command, server_address
 		printUsageAndExit()
 	}
 
-	cmd := os.Args[1]
-	serverAddr := os.Args[2]
+	cmd := args[0]
+	serverAddr := args[1]
 
-	conn, err := grpc.NewClient(serverAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	creds, err := security.ClientCredentials(security.TLSFiles{CertFile: *tlsCert, KeyFile: *tlsKey, CAFile: *tlsCA}, *serverName)
+	if err != nil {
+		log.Fatalf("Failed to load TLS credentials: %v", err)
+	}
+
+	conn, err := grpc.NewClient(serverAddr, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		log.Fatalf("Failed to connect to server: %v", err)
 	}
 	defer conn.Close()
 
 	client := proto.NewVideoContentAdminServiceClient(conn)
+	// Interrupting cancels the call; a migration already started by add or
+	// remove still runs to completion on the server.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+*token)
+	}
 
 	switch cmd {
 	case "add":
-		if len(os.Args) != 4 {
+		if len(args) != 3 {
 			fmt.Println("Usage: add <server_address> <node_address>")
 			os.Exit(1)
 		}
-		addNode(client, os.Args[3])
+		addNode(ctx, client, args[2])
 	case "remove":
-		if len(os.Args) != 4 {
+		if len(args) != 3 {
 			fmt.Println("Usage: remove <server_address> <node_address>")
 			os.Exit(1)
 		}
-		removeNode(client, os.Args[3])
+		removeNode(ctx, client, args[2])
 	case "list":
-		if len(os.Args) != 3 {
+		if len(args) != 2 {
 			fmt.Println("Usage: list <server_address>")
 			os.Exit(1)
 		}
-		listNodes(client)
+		listNodes(ctx, client)
+	case "audit":
+		if len(args) != 2 {
+			fmt.Println("Usage: audit <server_address>")
+			os.Exit(1)
+		}
+		req := &proto.ListAuditLogRequest{Limit: int32(*auditLimit), Actor: *auditActor}
+		if *auditSince > 0 {
+			req.SinceUnix = time.Now().Add(-*auditSince).Unix()
+		}
+		listAuditLog(ctx, client, req)
+	case "reload":
+		if len(args) != 2 {
+			fmt.Println("Usage: reload <server_address>")
+			os.Exit(1)
+		}
+		reloadConfig(ctx, client)
 	default:
 		fmt.Printf("Unknown command: %s\n", cmd)
 		printUsageAndExit()
@@ -53,16 +98,21 @@ func main() {
 }
 
 func printUsageAndExit() {
-	fmt.Println("Usage:")
+	fmt.Println("Usage: admin [OPTIONS] <command> <server_address> [args]")
+	fmt.Println()
+	fmt.Println("Commands:")
 	fmt.Println("  add <server_address> <node_address>     - Add a node to the cluster")
 	fmt.Println("  remove <server_address> <node_address>  - Remove a node from the cluster")
 	fmt.Println("  list <server_address>                   - List all nodes in the cluster")
+	fmt.Println("  audit <server_address>                  - Show privileged actions, newest first")
+	fmt.Println("  reload <server_address>                 - Reload the web server configuration")
+	fmt.Println()
+	fmt.Println("Options:")
+	flag.PrintDefaults()
 	os.Exit(1)
 }
 
-func addNode(client proto.VideoContentAdminServiceClient, nodeAddr string) {
-	ctx := context.Background()
-
+func addNode(ctx context.Context, client proto.VideoContentAdminServiceClient, nodeAddr string) {
 	response, err := client.AddNode(ctx, &proto.AddNodeRequest{
 		NodeAddress: nodeAddr,
 	})
@@ -74,9 +124,7 @@ func addNode(client proto.VideoContentAdminServiceClient, nodeAddr string) {
 	fmt.Printf("Number of files migrated: %d\n", response.MigratedFileCount)
 }
 
-func removeNode(client proto.VideoContentAdminServiceClient, nodeAddr string) {
-	ctx := context.Background()
-
+func removeNode(ctx context.Context, client proto.VideoContentAdminServiceClient, nodeAddr string) {
 	response, err := client.RemoveNode(ctx, &proto.RemoveNodeRequest{
 		NodeAddress: nodeAddr,
 	})
@@ -88,9 +136,7 @@ func removeNode(client proto.VideoContentAdminServiceClient, nodeAddr string) {
 	fmt.Printf("Number of files migrated: %d\n", response.MigratedFileCount)
 }
 
-func listNodes(client proto.VideoContentAdminServiceClient) {
-	ctx := context.Background()
-
+func listNodes(ctx context.Context, client proto.VideoContentAdminServiceClient) {
 	response, err := client.ListNodes(ctx, &proto.ListNodesRequest{})
 	if err != nil {
 		log.Fatalf("ListNodes RPC failed: %v", err)
@@ -105,3 +151,38 @@ func listNodes(client proto.VideoContentAdminServiceClient) {
 		}
 	}
 }
+
+func listAuditLog(ctx context.Context, client proto.VideoContentAdminServiceClient, req *proto.ListAuditLogRequest) {
+	response, err := client.ListAuditLog(ctx, req)
+	if err != nil {
+		log.Fatalf("ListAuditLog RPC failed: %v", err)
+	}
+
+	if len(response.Entries) == 0 {
+		fmt.Println("No audit entries")
+		return
+	}
+	for _, entry := range response.Entries {
+		fmt.Printf("%s  %-16s %-8s %-40s %-24s %s\n",
+			time.Unix(entry.TimeUnix, 0).Format(time.RFC3339), entry.Actor, entry.Role, entry.Action, entry.Target, entry.Outcome)
+	}
+}
+
+func reloadConfig(ctx context.Context, client proto.VideoContentAdminServiceClient) {
+	response, err := client.ReloadConfig(ctx, &proto.ReloadConfigRequest{})
+	if err != nil {
+		log.Fatalf("ReloadConfig RPC failed: %v", err)
+	}
+
+	if len(response.Applied) == 0 && len(response.RestartRequired) == 0 {
+		fmt.Println("Configuration reloaded, nothing changed")
+		return
+	}
+	fmt.Println("Configuration reloaded")
+	for _, key := range response.Applied {
+		fmt.Printf("  applied:          %s\n", key)
+	}
+	for _, key := range response.RestartRequired {
+		fmt.Printf("  needs a restart:  %s\n", key)
+	}
+}
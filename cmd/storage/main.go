@@ -1,20 +1,44 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"tritontube/internal/logging"
+	"tritontube/internal/metrics"
 	"tritontube/internal/proto"
+	"tritontube/internal/security"
 	"tritontube/internal/storage"
+	"tritontube/internal/tracing"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func main() {
 	host := flag.String("host", "localhost", "Host address for the server")
 	port := flag.Int("port", 8090, "Port number for the server")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate presented to clients (enables mutual TLS)")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	tlsCA := flag.String("tls-ca", "", "PEM CA bundle that client certificates must chain to")
+	allowedClients := flag.String("allowed-clients", "", "Comma-separated client certificate names allowed to call this node (required with -tls-cert)")
+	otlpEndpoint := flag.String("otlp-endpoint", "", "host:port of an OTLP/gRPC collector to send traces to (tracing disabled if empty)")
+	otlpInsecure := flag.Bool("otlp-insecure", false, "Connect to the OTLP collector without TLS")
+	logFormat := flag.String("log-format", "text", "Log output format: text or json")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	shutdownTimeout := flag.Duration("shutdown-timeout", time.Minute, "How long to wait for in-flight reads and writes on SIGTERM")
+	metricsAddr := flag.String("metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, e.g. :9090 (disabled if empty)")
+	httpAddr := flag.String("http-addr", "", "Address to serve files on over HTTP to clients with URLs signed by the web server, e.g. :8190 (disabled if empty)")
+	urlKey := flag.String("url-key", os.Getenv("TRITONTUBE_URL_KEY"), "Key shared with the web server for signing -http-addr URLs (default $TRITONTUBE_URL_KEY)")
 	flag.Parse()
 
 	// Validate arguments
@@ -22,6 +46,11 @@ func main() {
 		panic("Error: Port number must be positive")
 	}
 
+	if *httpAddr != "" && *urlKey == "" {
+		fmt.Println("Error: -http-addr requires -url-key")
+		os.Exit(2)
+	}
+
 	if flag.NArg() < 1 {
 		fmt.Println("Usage: storage [OPTIONS] <baseDir>")
 		fmt.Println("Error: Base directory argument is required")
@@ -29,27 +58,118 @@ func main() {
 	}
 	baseDir := flag.Arg(0)
 
-	fmt.Println("Starting storage server...")
-	fmt.Printf("Host: %s\n", *host)
-	fmt.Printf("Port: %d\n", *port)
-	fmt.Printf("Base Directory: %s\n", baseDir)
+	if err := logging.Setup(os.Stderr, *logFormat, *logLevel); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(2)
+	}
+
+	slog.Info("Starting storage server", "host", *host, "port", *port, "dir", baseDir)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), "tritontube-storage", *otlpEndpoint, *otlpInsecure)
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+	defer shutdownTracing(context.Background())
 
 	addr := fmt.Sprintf("%s:%d", *host, *port)
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		fatal("Failed to listen", err)
+	}
+
+	tlsFiles := security.TLSFiles{CertFile: *tlsCert, KeyFile: *tlsKey, CAFile: *tlsCA}
+	creds, err := security.ServerCredentials(tlsFiles)
+	if err != nil {
+		fatal("Failed to load TLS credentials", err)
+	}
+	if !tlsFiles.Enabled() {
+		slog.Warn("Serving without TLS, any client on the network can read and delete files")
+	} else if *allowedClients == "" {
+		fatal("Failed to configure mutual TLS", fmt.Errorf("-allowed-clients must name the clients allowed to call this node"))
+	}
+	authorizer := &security.Authorizer{
+		Prefix:     "/tritontube.VideoContentStorageService/",
+		Allowed:    security.ParseIdentities(*allowedClients),
+		RequireTLS: tlsFiles.Enabled(),
 	}
 
 	// Set maximum possible message size limits for the gRPC server
 	grpcServer := grpc.NewServer(
+		grpc.Creds(creds),
+		tracing.ServerOption(),
 		grpc.MaxRecvMsgSize(math.MaxInt32),
 		grpc.MaxSendMsgSize(math.MaxInt32),
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(), metrics.UnaryServerInterceptor(), authorizer.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(), metrics.StreamServerInterceptor(), authorizer.StreamInterceptor()),
 	)
 	storageServer := storage.NewStorageServer(baseDir, *port)
 	proto.RegisterVideoContentStorageServiceServer(grpcServer, storageServer)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+
+	if *metricsAddr != "" {
+		go func() {
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", metrics.Handler())
+			slog.Info("Metrics listening", "addr", *metricsAddr)
+			if err := http.ListenAndServe(*metricsAddr, mux); err != nil {
+				slog.Error("Metrics server error", "err", err)
+			}
+		}()
+	}
 
-	fmt.Printf("Storage server listening on %s\n", addr)
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("Failed to serve: %v", err)
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		sampler := &logging.Sampler{Prefixes: []string{storage.ContentPathPrefix}, Every: 100}
+		handler := storageServer.HTTPHandler(security.URLSigner{Key: []byte(*urlKey)})
+		handler = metrics.HTTPMiddleware(func(*http.Request) string { return storage.ContentPathPrefix }, handler)
+		httpServer = &http.Server{Addr: *httpAddr, Handler: logging.HTTPMiddleware(sampler, handler)}
+		go func() {
+			slog.Info("Serving files over HTTP", "addr", *httpAddr)
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Failed to serve HTTP", err)
+			}
+		}()
 	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Storage server listening", "addr", addr)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- grpcServer.Serve(lis) }()
+
+	select {
+	case err := <-serveErr:
+		fatal("Failed to serve", err)
+	case <-ctx.Done():
+	}
+
+	// Report not serving first so the web server stops counting this node
+	// as ready, then let in-flight calls finish.
+	slog.Info("Shutting down, draining in-flight calls", "timeout", *shutdownTimeout)
+	healthServer.Shutdown()
+	done := make(chan struct{})
+	go func() {
+		if httpServer != nil {
+			httpServer.Shutdown(context.Background())
+		}
+		grpcServer.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(*shutdownTimeout):
+		slog.Warn("In-flight calls did not finish in time, closing connections")
+		grpcServer.Stop()
+		if httpServer != nil {
+			httpServer.Close()
+		}
+	}
+	slog.Info("Shutdown complete")
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
@@ -1,64 +1,324 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"net"
+	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
+	"tritontube/internal/config"
+	"tritontube/internal/logging"
+	"tritontube/internal/metrics"
 	"tritontube/internal/proto"
+	"tritontube/internal/security"
+	"tritontube/internal/tracing"
 	"tritontube/internal/web"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 // printUsage prints the usage information for the application
 func printUsage() {
 	fmt.Println("Usage: ./program [OPTIONS] METADATA_TYPE METADATA_OPTIONS CONTENT_TYPE CONTENT_OPTIONS")
+	fmt.Println("       ./program -config FILE [OPTIONS]")
 	fmt.Println()
 	fmt.Println("Arguments:")
-	fmt.Println("  METADATA_TYPE         Metadata service type (sqlite, etcd)")
+	fmt.Println("  METADATA_TYPE         Metadata service type (sqlite)")
 	fmt.Println("  METADATA_OPTIONS      Options for metadata service (e.g., db path)")
 	fmt.Println("  CONTENT_TYPE          Content service type (fs, nw)")
 	fmt.Println("  CONTENT_OPTIONS       Options for content service (e.g., base dir, network addresses)")
 	fmt.Println()
+	fmt.Println("Settings come from the config file, then TRITONTUBE_* environment variables,")
+	fmt.Println("then options, then arguments, each overriding the one before.")
+	fmt.Println()
 	fmt.Println("Options:")
 	flag.PrintDefaults()
 	fmt.Println()
 	fmt.Println("Example: ./program sqlite db.db fs /path/to/videos")
 }
 
-func startAdminServer(networkService *web.NetworkVideoContentService, grpcServerAddr string) error {
+// flagSettings maps command-line flags to the config settings they set.
+// -host and -port are handled separately as they share http.listen.
+var flagSettings = map[string]string{
+	"playback-key":             "playback.key",
+	"playback-ttl":             "playback.ttl",
+	"tls-cert":                 "tls.cert",
+	"tls-key":                  "tls.key",
+	"tls-ca":                   "tls.ca",
+	"otlp-endpoint":            "tracing.otlp_endpoint",
+	"otlp-insecure":            "tracing.otlp_insecure",
+	"log-format":               "log.format",
+	"log-level":                "log.level",
+	"log-content-sample":       "log.content_sample",
+	"max-upload-size":          "limits.max_upload_size",
+	"cors-origins":             "cors.allowed_origins",
+	"shutdown-timeout":         "shutdown_timeout",
+	"admin-roles":              "admin.roles",
+	"admin-allowed-clients":    "admin.allowed_clients",
+	"admin-anonymous-role":     "admin.anonymous_role",
+	"admin-insecure-anonymous": "admin.insecure_anonymous",
+}
+
+// loadConfig builds the configuration from the defaults, the config file,
+// the environment, the flags set on the command line and the positional
+// arguments, in that order.
+func loadConfig(configPath string, args []string) (*config.Config, error) {
+	cfg := config.Default()
+	if configPath != "" {
+		if err := cfg.Load(configPath); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	var err error
+	flag.Visit(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		switch f.Name {
+		case "host", "port":
+			host, port, splitErr := net.SplitHostPort(cfg.HTTP.Listen)
+			if splitErr != nil {
+				err = fmt.Errorf("invalid -%s: %w", f.Name, splitErr)
+				return
+			}
+			if f.Name == "host" {
+				host = f.Value.String()
+			} else {
+				port = f.Value.String()
+			}
+			cfg.HTTP.Listen = net.JoinHostPort(host, port)
+		default:
+			if key, ok := flagSettings[f.Name]; ok {
+				err = cfg.Set(key, f.Value.String())
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(args) {
+	case 0:
+	case 4:
+		cfg.Metadata.Type, cfg.Metadata.Path = args[0], args[1]
+		cfg.Content.Type = args[2]
+		switch args[2] {
+		case "fs":
+			cfg.Content.Dir = args[3]
+		case "nw":
+			// The first address is where the admin server listens.
+			addresses := strings.Split(args[3], ",")
+			cfg.Admin.Listen, cfg.Content.Nodes = addresses[0], addresses[1:]
+		}
+	default:
+		return nil, errors.New("incorrect number of arguments")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// reloader re-reads the configuration from the same file, environment,
+// flags and arguments as at startup and applies the settings that can
+// change while running. Reloads are serialized.
+type reloader struct {
+	configPath string
+	args       []string
+	server     interface {
+		SetMaxUploadSize(int64)
+		SetCORSPolicy(web.CORSPolicy)
+		SetRateLimits(web.RateLimits)
+		SetUserQuota(int64)
+	}
+	content web.VideoContentService
+
+	mu      sync.Mutex
+	running *config.Config
+}
+
+// reload implements web.ReloadFunc. An invalid configuration changes
+// nothing.
+func (r *reloader) reload() (applied, restartRequired []string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	loaded, err := loadConfig(r.configPath, r.args)
+	if err != nil {
+		slog.Error("Failed to reload configuration, keeping the running one", "err", err)
+		return nil, nil, err
+	}
+	next, applied, restartRequired := config.Reload(r.running, loaded)
+
+	if err := logging.SetLevel(next.Log.Level); err != nil {
+		return nil, nil, err
+	}
+	r.server.SetMaxUploadSize(int64(next.Limits.MaxUploadSize))
+	r.server.SetCORSPolicy(next.CORSPolicy())
+	r.server.SetRateLimits(next.WebRateLimits())
+	r.server.SetUserQuota(int64(next.Limits.UserQuota))
+	if content, ok := r.content.(interface{ SetEncoding(web.Encoding) }); ok {
+		content.SetEncoding(next.WebEncoding())
+	}
+	r.running = next
+	warnAnonymousAdmin(next)
+
+	slog.Info("Configuration reloaded", "applied", applied)
+	if len(restartRequired) > 0 {
+		slog.Warn("Changed settings take effect only after a restart", "settings", restartRequired)
+	}
+	return applied, restartRequired, nil
+}
+
+// warnAnonymousAdmin logs a warning if the admin API runs and grants
+// unauthenticated callers any role.
+func warnAnonymousAdmin(cfg *config.Config) {
+	if cfg.Content.Type == "nw" && cfg.Admin.AnonymousRole > security.RoleNone {
+		slog.Warn("Admin API grants a role to callers without a token or certificate", "role", cfg.Admin.AnonymousRole)
+	}
+	if cfg.TLSFiles().Enabled() && len(cfg.Admin.Roles) == 0 && len(cfg.Admin.AllowedClients) == 0 {
+		slog.Warn("No client certificate is mapped to a role, admin callers need an API token")
+	}
+}
+
+// adminMethodRoles gives the role each admin RPC requires.
+var adminMethodRoles = map[string]security.Role{
+	proto.VideoContentAdminService_ListNodes_FullMethodName:    security.RoleViewer,
+	proto.VideoContentAdminService_AddNode_FullMethodName:      security.RoleOperator,
+	proto.VideoContentAdminService_RemoveNode_FullMethodName:   security.RoleOperator,
+	proto.VideoContentAdminService_ListAuditLog_FullMethodName: security.RoleAdmin,
+	proto.VideoContentAdminService_ReloadConfig_FullMethodName: security.RoleAdmin,
+}
+
+// startAdminServer serves the admin API and the gRPC health service on
+// grpcServerAddr. The returned function stops it gracefully.
+func startAdminServer(adminServer *web.AdminServer, grpcServerAddr string, tlsFiles security.TLSFiles, rbac *security.RBAC) (func(context.Context), error) {
+	creds, err := security.ServerCredentials(tlsFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS credentials: %w", err)
+	}
+
 	lis, err := net.Listen("tcp", grpcServerAddr)
 	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %w", grpcServerAddr, err)
+		return nil, fmt.Errorf("failed to listen on %s: %w", grpcServerAddr, err)
 	}
 
 	grpcServer := grpc.NewServer(
+		grpc.Creds(creds),
+		tracing.ServerOption(),
 		grpc.MaxRecvMsgSize(math.MaxInt32),
 		grpc.MaxSendMsgSize(math.MaxInt32),
+		grpc.ChainUnaryInterceptor(logging.UnaryServerInterceptor(), metrics.UnaryServerInterceptor(), rbac.UnaryInterceptor()),
+		grpc.ChainStreamInterceptor(logging.StreamServerInterceptor(), metrics.StreamServerInterceptor(), rbac.StreamInterceptor()),
 	)
 
-	// Register the network service as the admin service implementation
-	proto.RegisterVideoContentAdminServiceServer(grpcServer, networkService)
+	proto.RegisterVideoContentAdminServiceServer(grpcServer, adminServer)
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
 
 	// Start the gRPC server in a goroutine
 	go func() {
-		log.Printf("Admin gRPC server listening on %s", grpcServerAddr)
+		slog.Info("Admin gRPC server listening", "addr", grpcServerAddr)
 		if err := grpcServer.Serve(lis); err != nil {
-			log.Printf("Admin gRPC server error: %v", err)
+			slog.Error("Admin gRPC server error", "err", err)
 		}
 	}()
 
-	return nil
+	return func(ctx context.Context) { stopGRPC(ctx, grpcServer, healthServer) }, nil
+}
+
+// stopGRPC reports srv as not serving, then waits for in-flight calls such
+// as migrations to finish, cutting them off when ctx is done.
+func stopGRPC(ctx context.Context, srv *grpc.Server, healthServer *health.Server) {
+	healthServer.Shutdown()
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// newAdminRBAC builds the admin server's role checks. Verified client
+// certificates that no mapping names get no role.
+func newAdminRBAC(admin config.Admin, users web.UserService, auditLog web.AuditLog) *security.RBAC {
+	identities := make(map[string]security.Role)
+	for name, role := range admin.Roles {
+		identities[name] = role
+	}
+	for _, name := range admin.AllowedClients {
+		identities[name] = security.RoleAdmin
+	}
+
+	return &security.RBAC{
+		Prefix:          "/tritontube.VideoContentAdminService/",
+		MethodRoles:     adminMethodRoles,
+		Identities:      identities,
+		CertificateRole: security.RoleNone,
+		ResolveToken:    web.TokenRoleResolver(users),
+		AnonymousRole:   admin.AnonymousRole,
+		Audit:           web.AuditGRPC(auditLog),
+	}
+}
+
+// promoteToAdmin gives the admin role to the account named username. The
+// first account registered is only an admin on a new deployment, so this is
+// how one that already has videos gets its first admin.
+func promoteToAdmin(users web.UserService, username string) error {
+	user, err := users.ReadUserByName(username)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("no account named %q, register it first", username)
+	}
+	return users.SetUserRole(user.Id, security.RoleAdmin)
 }
 
 func main() {
-	// Define flags
-	port := flag.Int("port", 8080, "Port number for the web server")
-	host := flag.String("host", "localhost", "Host address for the web server")
+	// Define flags. Their defaults are only shown in the usage message;
+	// unset flags leave the config file and environment in effect.
+	defaults := config.Default()
+	configPath := flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "YAML config file (also $"+config.EnvPrefix+"CONFIG)")
+	flag.Int("port", 8080, "Port number for the web server")
+	flag.String("host", "localhost", "Host address for the web server")
+	flag.String("playback-key", "", "Secret for signing playback tokens of unlisted and private videos (random if empty)")
+	flag.Duration("playback-ttl", defaults.Playback.TTL, "How long playback tokens stay valid")
+	flag.String("tls-cert", "", "PEM certificate for the admin server and storage connections (enables mutual TLS)")
+	flag.String("tls-key", "", "PEM private key for -tls-cert")
+	flag.String("tls-ca", "", "PEM CA bundle that storage nodes and admin clients must chain to")
+	flag.String("otlp-endpoint", "", "host:port of an OTLP/gRPC collector to send traces to (tracing disabled if empty)")
+	flag.Bool("otlp-insecure", false, "Connect to the OTLP collector without TLS")
+	flag.String("log-format", defaults.Log.Format, "Log output format: text or json")
+	flag.String("log-level", defaults.Log.Level, "Minimum log level: debug, info, warn or error")
+	flag.Duration("shutdown-timeout", defaults.ShutdownTimeout, "How long to wait for in-flight requests, uploads and migrations on SIGTERM")
+	flag.Uint64("log-content-sample", defaults.Log.ContentSample, "Log one in N successful content requests (1 logs all)")
+	flag.String("max-upload-size", "0", "Largest accepted upload, e.g. 2GiB (0 for no limit)")
+	flag.String("cors-origins", "*", "Comma-separated browser origins allowed to call the API, e.g. https://app.example.com")
+	flag.String("admin-roles", "", "Comma-separated name=role pairs (viewer, operator, admin) for admin client certificates")
+	flag.String("admin-allowed-clients", "", "Comma-separated client certificate names granted the admin role (shorthand for -admin-roles name=admin)")
+	promoteAdmin := flag.String("promote-admin", "", "Make this registered account an admin at startup, e.g. on a deployment that had videos before accounts existed")
+	flag.String("admin-anonymous-role", defaults.Admin.AnonymousRole.String(), "Role of admin callers with neither an API token nor a client certificate (only possible without TLS)")
+	flag.Bool("admin-insecure-anonymous", false, "Allow -admin-anonymous-role operator or admin, letting anyone who can reach the admin port change the cluster")
 
 	// Set custom usage message
 	flag.Usage = printUsage
@@ -66,95 +326,177 @@ func main() {
 	// Parse flags
 	flag.Parse()
 
-	// Check if the correct number of positional arguments is provided
-	if len(flag.Args()) != 4 {
-		fmt.Println("Error: Incorrect number of arguments")
+	cfg, err := loadConfig(*configPath, flag.Args())
+	if err != nil {
+		fmt.Println("Error:", err)
 		printUsage()
 		return
 	}
 
-	// Parse positional arguments
-	metadataServiceType := flag.Arg(0)
-	metadataServiceOptions := flag.Arg(1)
-	contentServiceType := flag.Arg(2)
-	contentServiceOptions := flag.Arg(3)
+	if err := logging.Setup(os.Stderr, cfg.Log.Format, cfg.Log.Level); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
 
-	// Validate port number (already an int from flag, check if positive)
-	if *port <= 0 {
-		fmt.Println("Error: Invalid port number:", *port)
-		printUsage()
+	shutdownTracing, err := tracing.Setup(context.Background(), "tritontube-web", cfg.Tracing.OTLPEndpoint, cfg.Tracing.OTLPInsecure)
+	if err != nil {
+		slog.Error("Failed to set up tracing", "err", err)
 		return
 	}
+	defer shutdownTracing(context.Background())
 
 	// Construct metadata service
 	var metadataService web.VideoMetadataService
-	fmt.Println("Creating metadata service of type", metadataServiceType, "with options", metadataServiceOptions)
-	// TODO: Implement metadata service creation logic
-	switch metadataServiceType {
+	var playlistService web.PlaylistService
+	var userService web.UserService
+	var auditLog web.AuditLog
+	slog.Info("Creating metadata service", "type", cfg.Metadata.Type, "path", cfg.Metadata.Path)
+	switch cfg.Metadata.Type {
 	case "sqlite":
-		dbInstance, err := sql.Open("sqlite3", metadataServiceOptions)
+		dbInstance, err := sql.Open("sqlite3", cfg.Metadata.Path)
 		if err != nil {
-			fmt.Println("Error: Initializing sqlite3", metadataServiceType)
+			slog.Error("Failed to open sqlite3 database", "path", cfg.Metadata.Path, "err", err)
 			return
 		}
 		defer dbInstance.Close()
-		metadataService = &web.SQLiteVideoMetadataService{Instance: dbInstance}
-	default:
-		fmt.Println("Error: Unsupported metadata service type:", metadataServiceType)
-		printUsage()
-		return
+		sqliteService := &web.SQLiteVideoMetadataService{Instance: dbInstance}
+		metadataService = sqliteService
+		playlistService = sqliteService
+		userService = sqliteService
+		auditLog = sqliteService
+	}
+
+	if *promoteAdmin != "" {
+		if err := promoteToAdmin(userService, *promoteAdmin); err != nil {
+			slog.Error("Failed to promote account to admin", "user", *promoteAdmin, "err", err)
+			return
+		}
+		slog.Info("Promoted account to admin", "user", *promoteAdmin)
 	}
 
 	// Construct content service
 	var contentService web.VideoContentService
-	fmt.Println("Creating content service of type", contentServiceType, "with options", contentServiceOptions)
-	switch contentServiceType {
+	var networkService *web.NetworkVideoContentService
+	var adminServer *web.AdminServer
+	slog.Info("Creating content service", "type", cfg.Content.Type)
+	switch cfg.Content.Type {
 	case "fs":
-		contentService = &web.FSVideoContentService{BaseDir: contentServiceOptions}
+		fsService := &web.FSVideoContentService{BaseDir: cfg.Content.Dir}
+		fsService.SetEncoding(cfg.WebEncoding())
+		contentService = fsService
 	case "nw":
-		addresses := strings.Split(contentServiceOptions, ",")
-		if len(addresses) < 2 {
-			fmt.Println("Error: Network content service requires at least two addresses (gRPC server and one storage server)")
-			printUsage()
+		tlsFiles := cfg.TLSFiles()
+		storageCreds, err := security.ClientCredentials(tlsFiles, "")
+		if err != nil {
+			slog.Error("Failed to load TLS credentials", "err", err)
 			return
 		}
+		if !tlsFiles.Enabled() {
+			slog.Warn("Admin and storage traffic is not encrypted or authenticated")
+		}
 
-		grpcServerAddr := addresses[0]
-		storageServers := addresses[1:]
-
-		networkService := web.NewNetworkVideoContentService(
-			storageServers,
+		networkService = web.NewNetworkVideoContentService(
+			cfg.Content.Nodes,
+			metadataService,
+			storageCreds,
 		)
+		networkService.SetEncoding(cfg.WebEncoding())
+		adminServer = web.NewAdminServer(networkService, auditLog)
+		contentService = networkService
+		slog.Info("Network content service initialized", "storage_servers", len(cfg.Content.Nodes))
+	}
 
-		fmt.Printf("Starting admin gRPC server on %s...\n", grpcServerAddr)
-		if err := startAdminServer(networkService, grpcServerAddr); err != nil {
-			fmt.Printf("Error: Failed to start admin gRPC server: %v\n", err)
+	// The server reads through the cache; reloads reach the service itself.
+	servedContent := contentService
+	if cfg.Cache.MemorySize > 0 {
+		cached, err := web.NewCachedContentService(contentService, cfg.ContentCache())
+		if err != nil {
+			slog.Error("Failed to create content cache", "err", err)
 			return
 		}
-		contentService = networkService
-		fmt.Printf("Network content service initialized with gRPC server at %s and %d storage servers\n",
-			grpcServerAddr, len(storageServers))
-
-	default:
-		fmt.Println("Error: Unsupported content service type:", contentServiceType)
-		printUsage()
-		return
+		if networkService != nil {
+			networkService.OnFileMoved = cached.Invalidate
+		}
+		servedContent = cached
+		slog.Info("Content cache enabled", "memory_bytes", int64(cfg.Cache.MemorySize), "disk_dir", cfg.Cache.DiskDir)
 	}
 
 	// Start the server
-	server := web.NewServer(metadataService, contentService)
-	listenAddr := fmt.Sprintf("%s:%d", *host, *port)
-	lis, err := net.Listen("tcp", listenAddr)
+	if cfg.Playback.Key == "" {
+		slog.Warn("No playback key configured, playback tokens will not survive a restart")
+	}
+	opts := []web.ServerOption{
+		web.WithPlaybackKey([]byte(cfg.Playback.Key)),
+		web.WithPlaybackTokenTTL(cfg.Playback.TTL),
+		web.WithAuditLog(auditLog),
+		web.WithContentLogSample(cfg.Log.ContentSample),
+		web.WithMaxUploadSize(int64(cfg.Limits.MaxUploadSize)),
+		web.WithCORSPolicy(cfg.CORSPolicy()),
+		web.WithRateLimits(cfg.WebRateLimits()),
+		web.WithUserQuota(int64(cfg.Limits.UserQuota)),
+		web.WithManifestBaseURLs(cfg.Content.BaseURLs),
+	}
+	if len(cfg.Content.Direct.URLs) > 0 {
+		opts = append(opts, web.WithDirectContent(cfg.DirectContent(networkService.NodeFor)))
+		slog.Info("Serving segments directly from storage nodes", "nodes", len(cfg.Content.Direct.URLs))
+	}
+	if cfg.Live.FirstPort != 0 {
+		opts = append(opts, web.WithLive(cfg.LiveConfig()))
+		slog.Info("Live streaming enabled", "protocol", cfg.Live.Protocol, "ports", fmt.Sprintf("%d-%d", cfg.Live.FirstPort, cfg.Live.LastPort))
+	}
+	server := web.NewServer(metadataService, servedContent, playlistService, userService, opts...)
+	reload := &reloader{configPath: *configPath, args: flag.Args(), running: cfg, server: server, content: contentService}
+
+	stopAdmin := func(context.Context) {}
+	if adminServer != nil {
+		adminServer.Reload = reload.reload
+		warnAnonymousAdmin(cfg)
+		rbac := newAdminRBAC(cfg.Admin, userService, auditLog)
+		stopAdmin, err = startAdminServer(adminServer, cfg.Admin.Listen, cfg.TLSFiles(), rbac)
+		if err != nil {
+			slog.Error("Failed to start admin gRPC server", "err", err)
+			return
+		}
+	}
+
+	lis, err := net.Listen("tcp", cfg.HTTP.Listen)
 	if err != nil {
-		fmt.Println("Error starting listener:", err)
+		slog.Error("Failed to start listener", "err", err)
+		stopAdmin(context.Background())
 		return
 	}
 	defer lis.Close()
 
-	fmt.Println("Starting web server on", listenAddr)
-	err = server.Start(lis)
-	if err != nil {
-		fmt.Println("Error starting server:", err)
-		return
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("Starting web server", "addr", cfg.HTTP.Listen)
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Start(lis) }()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+wait:
+	for {
+		select {
+		case err := <-serveErr:
+			slog.Error("Web server error", "err", err)
+			return
+		case <-hangup:
+			reload.reload()
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	slog.Info("Shutting down, draining in-flight requests", "timeout", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Web server did not drain in time", "err", err)
 	}
+	stopAdmin(shutdownCtx)
+	slog.Info("Shutdown complete")
 }
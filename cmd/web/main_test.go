@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"tritontube/internal/web"
+)
+
+// settings records what a reload sets on the server.
+type settings struct {
+	maxUploadSize int64
+	cors          web.CORSPolicy
+	rateLimits    web.RateLimits
+	userQuota     int64
+}
+
+func (s *settings) SetMaxUploadSize(n int64)       { s.maxUploadSize = n }
+func (s *settings) SetCORSPolicy(p web.CORSPolicy) { s.cors = p }
+func (s *settings) SetRateLimits(l web.RateLimits) { s.rateLimits = l }
+func (s *settings) SetUserQuota(n int64)           { s.userQuota = n }
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(yaml string) {
+		if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("metadata:\n  type: sqlite\n  path: metadata.db\ncontent:\n  type: fs\n  dir: videos\n")
+	running, err := loadConfig(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &settings{}
+	r := &reloader{configPath: path, running: running, server: server}
+
+	write("metadata:\n  type: sqlite\n  path: metadata.db\ncontent:\n  type: fs\n  dir: other\nlimits:\n  max_upload_size: 1MiB\n")
+	applied, restartRequired, err := r.reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(applied, []string{"limits.max_upload_size"}) || !slices.Equal(restartRequired, []string{"content.dir"}) {
+		t.Errorf("reload = %v, %v", applied, restartRequired)
+	}
+	if server.maxUploadSize != 1<<20 || r.running.Content.Dir != "videos" {
+		t.Errorf("upload limit %d, content dir %q after reload", server.maxUploadSize, r.running.Content.Dir)
+	}
+
+	// An invalid configuration changes nothing.
+	write("metadata:\n  type: sqlite\n  path: metadata.db\ncontent:\n  type: fs\n  dir: videos\nlimits:\n  max_upload_size: 2MiB\nlog:\n  level: loud\n")
+	if _, _, err := r.reload(); err == nil {
+		t.Fatal("invalid configuration reloaded")
+	}
+	if server.maxUploadSize != 1<<20 || r.running.Limits.MaxUploadSize != 1<<20 {
+		t.Errorf("upload limit %d after a failed reload", server.maxUploadSize)
+	}
+}
@@ -20,7 +20,7 @@ export default function HomePage() {
 
   const fetchVideos = async () => {
     try {
-      const response = await fetch('/api/videos')
+      const response = await fetch('/api/v1/videos')
       if (response.ok) {
         const data = await response.json()
         if (data.success) {
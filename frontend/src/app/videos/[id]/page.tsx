@@ -19,7 +19,7 @@ export default function VideoPage({ params }: VideoPageProps) {
 
   const fetchVideo = useCallback(async () => {
     try {
-      const response = await fetch(`/api/videos/${id}`)
+      const response = await fetch(`/api/v1/videos/${id}`)
       if (response.ok) {
         const data = await response.json()
         if (data.success) {
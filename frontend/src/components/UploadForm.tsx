@@ -29,7 +29,7 @@ export default function UploadForm() {
     const formData = new FormData(e.currentTarget)
     
     try {
-      const response = await fetch('/api/upload', {
+      const response = await fetch('/api/v1/videos', {
         method: 'POST',
         body: formData,
       })
@@ -16,7 +16,7 @@ export default function VideoCard({ id, uploadedAt }: VideoCardProps) {
     }
 
     try {
-      const response = await fetch(`/api/delete/${id}`, {
+      const response = await fetch(`/api/v1/videos/${id}`, {
         method: 'DELETE',
       })
 
@@ -37,7 +37,7 @@ export default function VideoCard({ id, uploadedAt }: VideoCardProps) {
       <Link href={`/videos/${id}`} className="block">
         <div className="aspect-video bg-gray-100 dark:bg-yt-hover rounded-xl mb-3 overflow-hidden">
           <img 
-            src={`/api/content/${id}/thumbnail.jpg`} 
+            src={`/api/v1/content/${id}/thumbnail.jpg`} 
             className="w-full h-full object-cover" 
             onError={(e) => {
               const target = e.target as HTMLImageElement
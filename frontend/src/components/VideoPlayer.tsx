@@ -42,7 +42,7 @@ export default function VideoPlayer({ videoId, uploadedAt }: VideoPlayerProps) {
         
         // Create new player
         playerRef.current = window.dashjs.MediaPlayer().create()
-        playerRef.current.initialize(videoRef.current, `/api/content/${videoId}/manifest.mpd`, false)
+        playerRef.current.initialize(videoRef.current, `/api/v1/content/${videoId}/manifest.mpd`, false)
         // Ensure video starts from the beginning
         playerRef.current.on('streamInitialized', function () {
           if (videoRef.current) {
@@ -76,7 +76,7 @@ export default function VideoPlayer({ videoId, uploadedAt }: VideoPlayerProps) {
     }
 
     try {
-      const response = await fetch(`/api/delete/${videoId}`, {
+      const response = await fetch(`/api/v1/videos/${videoId}`, {
         method: 'DELETE',
       })
 
@@ -0,0 +1,527 @@
+// Package config describes the settings of cmd/web. They come from a YAML
+// file, TRITONTUBE_* environment variables and command-line flags, in
+// increasing order of precedence.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"tritontube/internal/security"
+	"tritontube/internal/web"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	HTTP            HTTP          `yaml:"http"`
+	Admin           Admin         `yaml:"admin"`
+	Metadata        Metadata      `yaml:"metadata"`
+	Content         Content       `yaml:"content"`
+	Cache           Cache         `yaml:"cache"`
+	Encoding        Encoding      `yaml:"encoding"`
+	Limits          Limits        `yaml:"limits"`
+	CORS            CORS          `yaml:"cors"`
+	TLS             TLS           `yaml:"tls"`
+	Playback        Playback      `yaml:"playback"`
+	Live            Live          `yaml:"live"`
+	Log             Log           `yaml:"log"`
+	Tracing         Tracing       `yaml:"tracing"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+type HTTP struct {
+	Listen string `yaml:"listen"`
+}
+
+// Admin configures the admin gRPC server, which runs only with the nw
+// content service.
+type Admin struct {
+	Listen string                   `yaml:"listen"`
+	Roles  map[string]security.Role `yaml:"roles"`
+	// AllowedClients are client certificate names granted the admin role.
+	AllowedClients []string `yaml:"allowed_clients"`
+	// AnonymousRole is granted to callers with neither an API token nor a
+	// client certificate, which is only possible without TLS. Roles that can
+	// change the cluster also need InsecureAnonymous.
+	AnonymousRole     security.Role `yaml:"anonymous_role"`
+	InsecureAnonymous bool          `yaml:"insecure_anonymous"`
+}
+
+type Metadata struct {
+	Type string `yaml:"type"` // sqlite
+	Path string `yaml:"path"`
+}
+
+type Content struct {
+	Type  string   `yaml:"type"`  // fs or nw
+	Dir   string   `yaml:"dir"`   // fs only
+	Nodes []string `yaml:"nodes"` // nw only
+	// Replication is how many storage nodes hold each file. Only 1 is
+	// supported.
+	Replication int `yaml:"replication"`
+	// BaseURLs are origins, such as CDN hosts, that manifests send players
+	// to for segments, in order of preference. Each is a prefix of
+	// "<videoId>/<filename>", e.g. "https://cdn.example.com/api/v1/content".
+	BaseURLs []string `yaml:"base_urls"`
+	// Direct lets storage nodes serve segments to clients themselves. nw
+	// only.
+	Direct Direct `yaml:"direct"`
+}
+
+// Direct maps storage nodes to the base URL of their HTTP endpoint (see
+// the -http-addr flag of cmd/storage). Segments on the listed nodes are
+// redirected there with URLs signed by Key, which the nodes must share.
+type Direct struct {
+	URLs map[string]string `yaml:"urls"`
+	Key  string            `yaml:"key"`
+	TTL  time.Duration     `yaml:"ttl"`
+}
+
+// Cache sizes the web server's cache of video files. MemorySize 0 turns it
+// off.
+type Cache struct {
+	MemorySize ByteSize `yaml:"memory_size"`
+	// DiskDir, if set, keeps files evicted from memory, up to DiskSize.
+	DiskDir  string   `yaml:"disk_dir"`
+	DiskSize ByteSize `yaml:"disk_size"`
+	// PrefetchSegments segments after each requested one are read ahead,
+	// with at most PrefetchPerVideo prefetches running per video and
+	// PrefetchTotal in all. 0 segments turns prefetching off.
+	PrefetchSegments int `yaml:"prefetch_segments"`
+	PrefetchPerVideo int `yaml:"prefetch_per_video"`
+	PrefetchTotal    int `yaml:"prefetch_total"`
+}
+
+type Encoding struct {
+	Renditions       []Rendition `yaml:"renditions"`
+	AudioBitrate     string      `yaml:"audio_bitrate"`
+	Preset           string      `yaml:"preset"`
+	SegmentDuration  int         `yaml:"segment_duration"`
+	KeyframeInterval int         `yaml:"keyframe_interval"`
+	PosterPosition   int         `yaml:"poster_position"`
+	Thumbnails       Thumbnails  `yaml:"thumbnails"`
+}
+
+type Thumbnails struct {
+	Interval int `yaml:"interval"`
+	Width    int `yaml:"width"`
+	Height   int `yaml:"height"`
+	Columns  int `yaml:"columns"`
+}
+
+type Rendition struct {
+	Height  int    `yaml:"height"`
+	Bitrate string `yaml:"bitrate"`
+}
+
+type Limits struct {
+	// MaxUploadSize is the largest accepted upload; 0 means unlimited.
+	MaxUploadSize ByteSize `yaml:"max_upload_size"`
+	// UserQuota caps the stored size of each user's videos; 0 means
+	// unlimited.
+	UserQuota ByteSize   `yaml:"user_quota"`
+	Rate      RateLimits `yaml:"rate"`
+}
+
+// RateLimits are the request budgets of each client, an API token or an
+// IP address, per class of endpoint.
+type RateLimits struct {
+	Upload   RateLimit `yaml:"upload"`
+	Metadata RateLimit `yaml:"metadata"`
+	Content  RateLimit `yaml:"content"`
+}
+
+// RateLimit allows Burst requests at once and PerMinute after that;
+// PerMinute 0 disables the limit.
+type RateLimit struct {
+	PerMinute float64 `yaml:"per_minute"`
+	Burst     int     `yaml:"burst"`
+}
+
+// CORS says which browser origins may call the HTTP API.
+type CORS struct {
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	AllowedMethods []string `yaml:"allowed_methods"`
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// AllowCredentials lets browsers send the session cookie. It needs
+	// explicit origins.
+	AllowCredentials bool          `yaml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age"`
+}
+
+type TLS struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	CA   string `yaml:"ca"`
+}
+
+type Playback struct {
+	Key string        `yaml:"key"`
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Live enables live streaming when FirstPort is set. Each stream listens
+// on a port of its own between FirstPort and LastPort for its encoder.
+type Live struct {
+	Protocol   string `yaml:"protocol"` // srt
+	ListenHost string `yaml:"listen_host"`
+	// PublicHost is the host encoders reach the ports on.
+	PublicHost string `yaml:"public_host"`
+	FirstPort  int    `yaml:"first_port"`
+	LastPort   int    `yaml:"last_port"`
+	// Window is how many segments the live manifest lists.
+	Window         int           `yaml:"window"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	WorkDir        string        `yaml:"work_dir"`
+	// LowLatency sends segments to players in chunks of ChunkDuration as
+	// they are encoded.
+	LowLatency    bool          `yaml:"low_latency"`
+	ChunkDuration time.Duration `yaml:"chunk_duration"`
+	TargetLatency time.Duration `yaml:"target_latency"`
+}
+
+type Log struct {
+	Format        string `yaml:"format"`
+	Level         string `yaml:"level"`
+	ContentSample uint64 `yaml:"content_sample"`
+}
+
+type Tracing struct {
+	OTLPEndpoint string `yaml:"otlp_endpoint"`
+	OTLPInsecure bool   `yaml:"otlp_insecure"`
+}
+
+// Default returns the settings used where nothing else is given.
+func Default() *Config {
+	var renditions []Rendition
+	for _, r := range web.DefaultEncoding.Renditions {
+		renditions = append(renditions, Rendition{Height: r.Height, Bitrate: r.Bitrate})
+	}
+	return &Config{
+		HTTP:    HTTP{Listen: "localhost:8080"},
+		Admin:   Admin{AnonymousRole: security.RoleNone},
+		Content: Content{Replication: 1, Direct: Direct{TTL: 5 * time.Minute}},
+		Cache:   Cache{MemorySize: 256 << 20, PrefetchSegments: 3, PrefetchPerVideo: 2, PrefetchTotal: 64},
+		Encoding: Encoding{
+			Renditions:       renditions,
+			AudioBitrate:     web.DefaultEncoding.AudioBitrate,
+			Preset:           web.DefaultEncoding.Preset,
+			SegmentDuration:  web.DefaultEncoding.SegmentDuration,
+			KeyframeInterval: web.DefaultEncoding.KeyframeInterval,
+			PosterPosition:   web.DefaultEncoding.PosterPosition,
+			Thumbnails:       Thumbnails(web.DefaultEncoding.Thumbnails),
+		},
+		Limits: Limits{
+			Rate: RateLimits{
+				Upload:   RateLimit(web.DefaultRateLimits.Upload),
+				Metadata: RateLimit(web.DefaultRateLimits.Metadata),
+				Content:  RateLimit(web.DefaultRateLimits.Content),
+			},
+		},
+		CORS: CORS{
+			AllowedOrigins:   web.DefaultCORSPolicy.AllowedOrigins,
+			AllowedMethods:   web.DefaultCORSPolicy.AllowedMethods,
+			AllowedHeaders:   web.DefaultCORSPolicy.AllowedHeaders,
+			AllowCredentials: web.DefaultCORSPolicy.AllowCredentials,
+			MaxAge:           web.DefaultCORSPolicy.MaxAge,
+		},
+		Playback: Playback{TTL: 6 * time.Hour},
+		Live: Live{
+			Protocol:       "srt",
+			ListenHost:     "0.0.0.0",
+			PublicHost:     "localhost",
+			Window:         5,
+			ConnectTimeout: 2 * time.Minute,
+			ChunkDuration:  500 * time.Millisecond,
+			TargetLatency:  3 * time.Second,
+		},
+		Log:             Log{Format: "text", Level: "info", ContentSample: 100},
+		ShutdownTimeout: 5 * time.Minute,
+	}
+}
+
+// Load reads the YAML file at path over the settings in c. Keys the file
+// does not mention keep their value; unknown keys are an error.
+func (c *Config) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// DirectContent converts the direct serving settings for the web server,
+// locating files with locate.
+func (c *Config) DirectContent(locate func(videoId, filename string) string) web.DirectContent {
+	return web.DirectContent{
+		Locate: locate,
+		URLs:   c.Content.Direct.URLs,
+		Key:    []byte(c.Content.Direct.Key),
+		TTL:    c.Content.Direct.TTL,
+	}
+}
+
+// LiveConfig converts the live streaming settings for the web server.
+func (c *Config) LiveConfig() web.LiveConfig {
+	return web.LiveConfig{
+		Protocol:       c.Live.Protocol,
+		ListenHost:     c.Live.ListenHost,
+		PublicHost:     c.Live.PublicHost,
+		FirstPort:      c.Live.FirstPort,
+		LastPort:       c.Live.LastPort,
+		ConnectTimeout: c.Live.ConnectTimeout,
+		Window:         c.Live.Window,
+		WorkDir:        c.Live.WorkDir,
+		LowLatency:     c.Live.LowLatency,
+		ChunkDuration:  c.Live.ChunkDuration,
+		TargetLatency:  c.Live.TargetLatency,
+	}
+}
+
+// ContentCache converts the cache settings for the content services.
+func (c *Config) ContentCache() web.ContentCacheConfig {
+	return web.ContentCacheConfig{
+		MemoryBytes: int64(c.Cache.MemorySize),
+		DiskDir:     c.Cache.DiskDir,
+		DiskBytes:   int64(c.Cache.DiskSize),
+
+		PrefetchSegments: c.Cache.PrefetchSegments,
+		PrefetchPerVideo: c.Cache.PrefetchPerVideo,
+		PrefetchTotal:    c.Cache.PrefetchTotal,
+	}
+}
+
+// WebEncoding converts the encoding settings for the content services.
+func (c *Config) WebEncoding() web.Encoding {
+	e := web.Encoding{
+		AudioBitrate:     c.Encoding.AudioBitrate,
+		Preset:           c.Encoding.Preset,
+		SegmentDuration:  c.Encoding.SegmentDuration,
+		KeyframeInterval: c.Encoding.KeyframeInterval,
+		PosterPosition:   c.Encoding.PosterPosition,
+		Thumbnails:       web.Thumbnails(c.Encoding.Thumbnails),
+	}
+	for _, r := range c.Encoding.Renditions {
+		e.Renditions = append(e.Renditions, web.Rendition{Height: r.Height, Bitrate: r.Bitrate})
+	}
+	return e
+}
+
+// CORSPolicy converts the CORS settings for the web server.
+func (c *Config) CORSPolicy() web.CORSPolicy {
+	return web.CORSPolicy{
+		AllowedOrigins:   c.CORS.AllowedOrigins,
+		AllowedMethods:   c.CORS.AllowedMethods,
+		AllowedHeaders:   c.CORS.AllowedHeaders,
+		AllowCredentials: c.CORS.AllowCredentials,
+		MaxAge:           c.CORS.MaxAge,
+	}
+}
+
+// WebRateLimits converts the rate limits for the web server.
+func (c *Config) WebRateLimits() web.RateLimits {
+	return web.RateLimits{
+		Upload:   web.RateLimit(c.Limits.Rate.Upload),
+		Metadata: web.RateLimit(c.Limits.Rate.Metadata),
+		Content:  web.RateLimit(c.Limits.Rate.Content),
+	}
+}
+
+// TLSFiles returns the TLS settings in the form package security takes.
+func (c *Config) TLSFiles() security.TLSFiles {
+	return security.TLSFiles{CertFile: c.TLS.Cert, KeyFile: c.TLS.Key, CAFile: c.TLS.CA}
+}
+
+// Validate checks every setting and reports all problems at once, each
+// prefixed with its key in the config file.
+func (c *Config) Validate() error {
+	var errs []error
+	fail := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if err := checkAddress(c.HTTP.Listen); err != nil {
+		fail("http.listen", "%v", err)
+	}
+
+	switch c.Metadata.Type {
+	case "sqlite":
+		if c.Metadata.Path == "" {
+			fail("metadata.path", "required for sqlite")
+		}
+	case "":
+		fail("metadata.type", "required")
+	default:
+		fail("metadata.type", "unsupported type %q, want sqlite", c.Metadata.Type)
+	}
+
+	switch c.Content.Type {
+	case "fs":
+		if c.Content.Dir == "" {
+			fail("content.dir", "required for fs")
+		}
+	case "nw":
+		if len(c.Content.Nodes) == 0 {
+			fail("content.nodes", "at least one storage node is required for nw")
+		}
+		seen := make(map[string]bool)
+		for i, node := range c.Content.Nodes {
+			if err := checkAddress(node); err != nil {
+				fail(fmt.Sprintf("content.nodes[%d]", i), "%v", err)
+			}
+			if seen[node] {
+				fail(fmt.Sprintf("content.nodes[%d]", i), "duplicate node %s", node)
+			}
+			seen[node] = true
+		}
+		if c.Admin.Listen == "" {
+			fail("admin.listen", "required for nw")
+		} else if err := checkAddress(c.Admin.Listen); err != nil {
+			fail("admin.listen", "%v", err)
+		}
+		if c.Admin.AnonymousRole > security.RoleViewer && (c.TLSFiles().Enabled() || !c.Admin.InsecureAnonymous) {
+			fail("admin.anonymous_role", "%s for unauthenticated callers requires TLS to be off and admin.insecure_anonymous to be set", c.Admin.AnonymousRole)
+		}
+	case "":
+		fail("content.type", "required")
+	default:
+		fail("content.type", "unsupported type %q, want fs or nw", c.Content.Type)
+	}
+	if c.Content.Replication != 1 {
+		fail("content.replication", "only 1 is supported, got %d", c.Content.Replication)
+	}
+
+	for i, base := range c.Content.BaseURLs {
+		if u, err := url.Parse(base); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail(fmt.Sprintf("content.base_urls[%d]", i), "invalid URL %q", base)
+		}
+	}
+	if len(c.Content.Direct.URLs) > 0 {
+		if c.Content.Type != "nw" {
+			fail("content.direct.urls", "requires content type nw")
+		}
+		if err := c.DirectContent(nil).Validate(); err != nil {
+			fail("content.direct", "%v", err)
+		}
+		if c.Content.Direct.TTL <= 0 {
+			fail("content.direct.ttl", "must be positive")
+		}
+	}
+
+	if c.Cache.MemorySize < 0 {
+		fail("cache.memory_size", "must not be negative")
+	}
+	if c.Cache.DiskDir != "" {
+		if c.Cache.MemorySize == 0 {
+			fail("cache.disk_dir", "requires cache.memory_size")
+		}
+		if c.Cache.DiskSize <= 0 {
+			fail("cache.disk_size", "must be positive with cache.disk_dir")
+		}
+	}
+	if c.Cache.PrefetchSegments < 0 {
+		fail("cache.prefetch_segments", "must not be negative")
+	}
+	if c.Cache.PrefetchSegments > 0 {
+		if c.Cache.PrefetchPerVideo < 1 {
+			fail("cache.prefetch_per_video", "must be at least 1 with cache.prefetch_segments")
+		}
+		if c.Cache.PrefetchTotal < 1 {
+			fail("cache.prefetch_total", "must be at least 1 with cache.prefetch_segments")
+		}
+	}
+
+	if err := c.WebEncoding().Validate(); err != nil {
+		fail("encoding", "%v", err)
+	}
+	if c.Live.FirstPort != 0 {
+		if err := c.LiveConfig().Validate(); err != nil {
+			fail("live", "%v", err)
+		}
+	}
+	if c.Limits.MaxUploadSize < 0 {
+		fail("limits.max_upload_size", "must not be negative")
+	}
+	if c.Limits.UserQuota < 0 {
+		fail("limits.user_quota", "must not be negative")
+	}
+	if err := c.WebRateLimits().Validate(); err != nil {
+		fail("limits.rate", "%v", err)
+	}
+
+	for i, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				fail("cors.allow_credentials", "requires explicit cors.allowed_origins, not \"*\"")
+			}
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			fail(fmt.Sprintf("cors.allowed_origins[%d]", i), "invalid origin %q, want e.g. https://app.example.com", origin)
+		}
+	}
+	for i, method := range c.CORS.AllowedMethods {
+		if method == "" || strings.ToUpper(method) != method || strings.ContainsAny(method, " ,") {
+			fail(fmt.Sprintf("cors.allowed_methods[%d]", i), "invalid method %q, want e.g. GET", method)
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		fail("cors.max_age", "must not be negative")
+	}
+
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		fail("tls", "cert and key must be given together")
+	}
+	if c.TLS.CA != "" && c.TLS.Cert == "" {
+		fail("tls.ca", "requires tls.cert and tls.key")
+	}
+	for _, path := range []struct{ key, file string }{{"tls.cert", c.TLS.Cert}, {"tls.key", c.TLS.Key}, {"tls.ca", c.TLS.CA}} {
+		if path.file == "" {
+			continue
+		}
+		if _, err := os.Stat(path.file); err != nil {
+			fail(path.key, "%v", err)
+		}
+	}
+
+	if c.Playback.TTL <= 0 {
+		fail("playback.ttl", "must be positive")
+	}
+	if f := strings.ToLower(c.Log.Format); f != "text" && f != "json" {
+		fail("log.format", "invalid format %q, want text or json", c.Log.Format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		fail("log.level", "invalid level %q, want debug, info, warn or error", c.Log.Level)
+	}
+	if c.ShutdownTimeout <= 0 {
+		fail("shutdown_timeout", "must be positive")
+	}
+	return errors.Join(errs...)
+}
+
+// checkAddress reports whether addr is a usable host:port.
+func checkAddress(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return fmt.Errorf("invalid port %q in %q", port, addr)
+	}
+	return nil
+}
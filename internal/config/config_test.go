@@ -0,0 +1,114 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"tritontube/internal/security"
+)
+
+// nwConfig returns a valid configuration using storage nodes.
+func nwConfig() *Config {
+	c := Default()
+	c.Metadata.Type, c.Metadata.Path = "sqlite", "metadata.db"
+	c.Content.Type, c.Content.Nodes = "nw", []string{"localhost:8090"}
+	c.Admin.Listen = "localhost:8081"
+	return c
+}
+
+func TestExampleConfigIsValid(t *testing.T) {
+	c := Default()
+	if err := c.Load("../../config.example.yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAnonymousAdminRole(t *testing.T) {
+	if role := Default().Admin.AnonymousRole; role != security.RoleNone {
+		t.Errorf("default anonymous role = %s, want none", role)
+	}
+
+	tests := []struct {
+		name        string
+		role        security.Role
+		acknowledge bool
+		tls         bool
+		ok          bool
+	}{
+		{"viewer", security.RoleViewer, false, false, true},
+		{"admin", security.RoleAdmin, false, false, false},
+		{"acknowledged admin", security.RoleAdmin, true, false, true},
+		{"acknowledged operator with TLS", security.RoleOperator, true, true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := nwConfig()
+			c.Admin.AnonymousRole = test.role
+			c.Admin.InsecureAnonymous = test.acknowledge
+			if test.tls {
+				c.TLS.Cert, c.TLS.Key, c.TLS.CA = "web.pem", "web-key.pem", "ca.pem"
+			}
+			err := c.Validate()
+			if (err == nil) != test.ok {
+				t.Fatalf("Validate() = %v, want ok %v", err, test.ok)
+			}
+			if err != nil && !strings.Contains(err.Error(), "admin.anonymous_role") {
+				t.Errorf("error does not name the key: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnvOverridesFile(t *testing.T) {
+	c := nwConfig()
+	env := map[string]string{
+		EnvName("admin.anonymous_role"):     "admin",
+		EnvName("admin.insecure_anonymous"): "true",
+		EnvName("limits.max_upload_size"):   "2GiB",
+		EnvName("content.nodes"):            "a:1, b:2",
+	}
+	err := c.ApplyEnv(func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Admin.AnonymousRole != security.RoleAdmin || !c.Admin.InsecureAnonymous {
+		t.Errorf("admin = %+v", c.Admin)
+	}
+	if c.Limits.MaxUploadSize != 2<<30 {
+		t.Errorf("max upload size = %d", c.Limits.MaxUploadSize)
+	}
+	if len(c.Content.Nodes) != 2 || c.Content.Nodes[1] != "b:2" {
+		t.Errorf("nodes = %q", c.Content.Nodes)
+	}
+
+	if err := c.Set("admin.anonymous_role", "root"); err == nil {
+		t.Errorf("unknown role accepted")
+	}
+}
+
+func TestCORSValidation(t *testing.T) {
+	c := nwConfig()
+	c.CORS.AllowCredentials = true
+	c.CORS.AllowedOrigins = []string{"*", "app.example.com", "https://app.example.com/path"}
+	c.CORS.AllowedMethods = []string{"get"}
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("invalid CORS settings accepted")
+	}
+	for _, key := range []string{"cors.allow_credentials", "cors.allowed_origins[1]", "cors.allowed_origins[2]", "cors.allowed_methods[0]"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s: %v", key, err)
+		}
+	}
+
+	c.CORS.AllowedOrigins = []string{"https://app.example.com", "http://localhost:3000"}
+	c.CORS.AllowedMethods = []string{"GET"}
+	if err := c.Validate(); err != nil {
+		t.Errorf("valid CORS settings rejected: %v", err)
+	}
+}
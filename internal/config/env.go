@@ -0,0 +1,195 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"tritontube/internal/security"
+)
+
+// EnvPrefix starts the name of every environment variable read by ApplyEnv.
+const EnvPrefix = "TRITONTUBE_"
+
+// setters change one setting from its string form. Keys are the dotted
+// path of the setting in the config file; the environment variable is
+// EnvPrefix followed by the key in upper case with dots as underscores.
+var setters = map[string]func(c *Config, value string) error{
+	"http.listen":           func(c *Config, v string) error { c.HTTP.Listen = v; return nil },
+	"admin.listen":          func(c *Config, v string) error { c.Admin.Listen = v; return nil },
+	"admin.roles":           func(c *Config, v string) (err error) { c.Admin.Roles, err = security.ParseRoleMap(v); return err },
+	"admin.allowed_clients": func(c *Config, v string) error { c.Admin.AllowedClients = security.ParseIdentities(v); return nil },
+	"admin.anonymous_role":  func(c *Config, v string) error { return c.Admin.AnonymousRole.UnmarshalText([]byte(v)) },
+	"admin.insecure_anonymous": func(c *Config, v string) (err error) {
+		c.Admin.InsecureAnonymous, err = strconv.ParseBool(v)
+		return err
+	},
+	"metadata.type": func(c *Config, v string) error { c.Metadata.Type = v; return nil },
+	"metadata.path": func(c *Config, v string) error { c.Metadata.Path = v; return nil },
+	"content.type":  func(c *Config, v string) error { c.Content.Type = v; return nil },
+	"content.dir":   func(c *Config, v string) error { c.Content.Dir = v; return nil },
+	"content.nodes": func(c *Config, v string) error { c.Content.Nodes = splitList(v); return nil },
+	"content.replication": func(c *Config, v string) (err error) {
+		c.Content.Replication, err = strconv.Atoi(v)
+		return err
+	},
+	"content.base_urls": func(c *Config, v string) error { c.Content.BaseURLs = splitList(v); return nil },
+	"content.direct.urls": func(c *Config, v string) (err error) {
+		c.Content.Direct.URLs, err = parseURLMap(v)
+		return err
+	},
+	"content.direct.key":           func(c *Config, v string) error { c.Content.Direct.Key = v; return nil },
+	"content.direct.ttl":           durationSetter(func(c *Config) *time.Duration { return &c.Content.Direct.TTL }),
+	"cache.memory_size":            func(c *Config, v string) error { return c.Cache.MemorySize.UnmarshalText([]byte(v)) },
+	"cache.disk_dir":               func(c *Config, v string) error { c.Cache.DiskDir = v; return nil },
+	"cache.disk_size":              func(c *Config, v string) error { return c.Cache.DiskSize.UnmarshalText([]byte(v)) },
+	"cache.prefetch_segments":      intSetter(func(c *Config) *int { return &c.Cache.PrefetchSegments }),
+	"cache.prefetch_per_video":     intSetter(func(c *Config) *int { return &c.Cache.PrefetchPerVideo }),
+	"cache.prefetch_total":         intSetter(func(c *Config) *int { return &c.Cache.PrefetchTotal }),
+	"encoding.audio_bitrate":       func(c *Config, v string) error { c.Encoding.AudioBitrate = v; return nil },
+	"encoding.preset":              func(c *Config, v string) error { c.Encoding.Preset = v; return nil },
+	"encoding.segment_duration":    intSetter(func(c *Config) *int { return &c.Encoding.SegmentDuration }),
+	"encoding.keyframe_interval":   intSetter(func(c *Config) *int { return &c.Encoding.KeyframeInterval }),
+	"encoding.poster_position":     intSetter(func(c *Config) *int { return &c.Encoding.PosterPosition }),
+	"encoding.thumbnails.interval": intSetter(func(c *Config) *int { return &c.Encoding.Thumbnails.Interval }),
+	"encoding.thumbnails.width":    intSetter(func(c *Config) *int { return &c.Encoding.Thumbnails.Width }),
+	"encoding.thumbnails.height":   intSetter(func(c *Config) *int { return &c.Encoding.Thumbnails.Height }),
+	"encoding.thumbnails.columns":  intSetter(func(c *Config) *int { return &c.Encoding.Thumbnails.Columns }),
+	"limits.max_upload_size": func(c *Config, v string) error {
+		return c.Limits.MaxUploadSize.UnmarshalText([]byte(v))
+	},
+	"limits.user_quota": func(c *Config, v string) error {
+		return c.Limits.UserQuota.UnmarshalText([]byte(v))
+	},
+	"limits.rate.upload.per_minute":   rateSetter(func(c *Config) *RateLimit { return &c.Limits.Rate.Upload }, false),
+	"limits.rate.upload.burst":        rateSetter(func(c *Config) *RateLimit { return &c.Limits.Rate.Upload }, true),
+	"limits.rate.metadata.per_minute": rateSetter(func(c *Config) *RateLimit { return &c.Limits.Rate.Metadata }, false),
+	"limits.rate.metadata.burst":      rateSetter(func(c *Config) *RateLimit { return &c.Limits.Rate.Metadata }, true),
+	"limits.rate.content.per_minute":  rateSetter(func(c *Config) *RateLimit { return &c.Limits.Rate.Content }, false),
+	"limits.rate.content.burst":       rateSetter(func(c *Config) *RateLimit { return &c.Limits.Rate.Content }, true),
+	"cors.allowed_origins":            func(c *Config, v string) error { c.CORS.AllowedOrigins = splitList(v); return nil },
+	"cors.allowed_methods":            func(c *Config, v string) error { c.CORS.AllowedMethods = splitList(v); return nil },
+	"cors.allowed_headers":            func(c *Config, v string) error { c.CORS.AllowedHeaders = splitList(v); return nil },
+	"cors.allow_credentials": func(c *Config, v string) (err error) {
+		c.CORS.AllowCredentials, err = strconv.ParseBool(v)
+		return err
+	},
+	"cors.max_age":         durationSetter(func(c *Config) *time.Duration { return &c.CORS.MaxAge }),
+	"tls.cert":             func(c *Config, v string) error { c.TLS.Cert = v; return nil },
+	"tls.key":              func(c *Config, v string) error { c.TLS.Key = v; return nil },
+	"tls.ca":               func(c *Config, v string) error { c.TLS.CA = v; return nil },
+	"playback.key":         func(c *Config, v string) error { c.Playback.Key = v; return nil },
+	"playback.ttl":         durationSetter(func(c *Config) *time.Duration { return &c.Playback.TTL }),
+	"live.protocol":        func(c *Config, v string) error { c.Live.Protocol = v; return nil },
+	"live.listen_host":     func(c *Config, v string) error { c.Live.ListenHost = v; return nil },
+	"live.public_host":     func(c *Config, v string) error { c.Live.PublicHost = v; return nil },
+	"live.first_port":      intSetter(func(c *Config) *int { return &c.Live.FirstPort }),
+	"live.last_port":       intSetter(func(c *Config) *int { return &c.Live.LastPort }),
+	"live.window":          intSetter(func(c *Config) *int { return &c.Live.Window }),
+	"live.connect_timeout": durationSetter(func(c *Config) *time.Duration { return &c.Live.ConnectTimeout }),
+	"live.work_dir":        func(c *Config, v string) error { c.Live.WorkDir = v; return nil },
+	"live.low_latency": func(c *Config, v string) (err error) {
+		c.Live.LowLatency, err = strconv.ParseBool(v)
+		return err
+	},
+	"live.chunk_duration": durationSetter(func(c *Config) *time.Duration { return &c.Live.ChunkDuration }),
+	"live.target_latency": durationSetter(func(c *Config) *time.Duration { return &c.Live.TargetLatency }),
+	"log.format":          func(c *Config, v string) error { c.Log.Format = v; return nil },
+	"log.level":           func(c *Config, v string) error { c.Log.Level = v; return nil },
+	"log.content_sample": func(c *Config, v string) (err error) {
+		c.Log.ContentSample, err = strconv.ParseUint(v, 10, 64)
+		return err
+	},
+	"tracing.otlp_endpoint": func(c *Config, v string) error { c.Tracing.OTLPEndpoint = v; return nil },
+	"tracing.otlp_insecure": func(c *Config, v string) (err error) {
+		c.Tracing.OTLPInsecure, err = strconv.ParseBool(v)
+		return err
+	},
+	"shutdown_timeout": durationSetter(func(c *Config) *time.Duration { return &c.ShutdownTimeout }),
+}
+
+func intSetter(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) (err error) {
+		*field(c), err = strconv.Atoi(v)
+		return err
+	}
+}
+
+func durationSetter(field func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) (err error) {
+		*field(c), err = time.ParseDuration(v)
+		return err
+	}
+}
+
+// rateSetter sets the burst or, if burst is false, the per-minute rate of
+// the limit field returns.
+func rateSetter(field func(*Config) *RateLimit, burst bool) func(*Config, string) error {
+	return func(c *Config, v string) (err error) {
+		if burst {
+			field(c).Burst, err = strconv.Atoi(v)
+		} else {
+			field(c).PerMinute, err = strconv.ParseFloat(v, 64)
+		}
+		return err
+	}
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseURLMap parses comma-separated node=url pairs.
+func parseURLMap(v string) (map[string]string, error) {
+	urls := make(map[string]string)
+	for _, entry := range splitList(v) {
+		node, url, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid URL mapping %q, want node=url", entry)
+		}
+		urls[strings.TrimSpace(node)] = strings.TrimSpace(url)
+	}
+	return urls, nil
+}
+
+// Set changes the setting at key, e.g. "playback.ttl", from its string
+// form. Lists are comma-separated, role maps are name=role pairs and
+// URL maps node=url pairs.
+func (c *Config) Set(key, value string) error {
+	set, ok := setters[key]
+	if !ok {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	if err := set(c, value); err != nil {
+		return fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return nil
+}
+
+// EnvName returns the environment variable overriding key.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// ApplyEnv overrides settings with the environment variables lookup finds,
+// usually os.LookupEnv.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, key := range slices.Sorted(maps.Keys(setters)) {
+		value, ok := lookup(EnvName(key))
+		if !ok {
+			continue
+		}
+		if err := setters[key](c, value); err != nil {
+			return fmt.Errorf("invalid %s %q: %w", EnvName(key), value, err)
+		}
+	}
+	return nil
+}
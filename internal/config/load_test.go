@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, yaml string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKeepsDefaultsOfUnsetKeys(t *testing.T) {
+	c := Default()
+	path := writeConfig(t, "playback:\n  ttl: 90s\nlimits:\n  max_upload_size: 512MiB\n")
+	if err := c.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if c.Playback.TTL != 90*time.Second || c.Limits.MaxUploadSize != 512<<20 {
+		t.Errorf("loaded playback %+v, limits %+v", c.Playback, c.Limits)
+	}
+	if c.Log.Level != Default().Log.Level {
+		t.Errorf("log level = %q, want the default", c.Log.Level)
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	err := Default().Load(writeConfig(t, "playback:\n  tll: 90s\n"))
+	if err == nil || !strings.Contains(err.Error(), "tll") {
+		t.Errorf("Load = %v, want an error naming the key", err)
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	c := nwConfig()
+	c.Metadata.Type = "mysql"
+	c.Content.Type = ""
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("invalid configuration accepted")
+	}
+	for _, key := range []string{"metadata.type", "content.type"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s: %v", key, err)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]ByteSize{
+		"0":      0,
+		"100":    100,
+		"64KiB":  64 << 10,
+		"2G":     2 << 30,
+		"1.5GB":  -1,
+		"512 MB": 512e6,
+		"-1":     -1,
+		"lots":   -1,
+	}
+	for text, want := range tests {
+		got, err := ParseByteSize(text)
+		if want < 0 {
+			if err == nil {
+				t.Errorf("ParseByteSize(%q) = %d, want an error", text, got)
+			}
+			continue
+		}
+		if err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", text, got, err, want)
+		}
+	}
+}
+
+// TestEveryKeyHasAnEnvironmentVariable keeps the environment overrides in
+// step with the config file. Lists of sections only come from the file.
+func TestEveryKeyHasAnEnvironmentVariable(t *testing.T) {
+	for _, key := range yamlKeys("", reflect.TypeOf(Config{})) {
+		if _, ok := setters[key]; !ok && key != "encoding.renditions" {
+			t.Errorf("no environment variable for %s", key)
+		}
+	}
+}
+
+// yamlKeys returns the dotted keys of the scalar and list settings of typ.
+func yamlKeys(prefix string, typ reflect.Type) []string {
+	var keys []string
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Duration(0)) {
+			keys = append(keys, yamlKeys(key+".", field.Type)...)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
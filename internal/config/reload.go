@@ -0,0 +1,39 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// Reload returns the configuration to run with after loaded was read while
+// running with running: the settings that can change without a restart
+// (limits, encoding ladder, CORS policy, log level) come from loaded, all
+// others stay. It lists the keys of changed settings that were applied and
+// of those that need a restart.
+func Reload(running, loaded *Config) (next *Config, applied, restartRequired []string) {
+	merged := *running
+	merged.Limits = loaded.Limits
+	merged.Encoding = loaded.Encoding
+	merged.CORS = loaded.CORS
+	merged.Log.Level = loaded.Log.Level
+	return &merged, changedKeys("", reflect.ValueOf(*running), reflect.ValueOf(merged)),
+		changedKeys("", reflect.ValueOf(merged), reflect.ValueOf(*loaded))
+}
+
+// changedKeys lists the config file keys of the fields that differ
+// between the structs a and b.
+func changedKeys(prefix string, a, b reflect.Value) []string {
+	var keys []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		key := prefix + strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if field.Type.Kind() == reflect.Struct && field.Type.NumField() > 0 && field.Type.PkgPath() == a.Type().PkgPath() {
+			keys = append(keys, changedKeys(key+".", a.Field(i), b.Field(i))...)
+			continue
+		}
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
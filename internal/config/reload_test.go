@@ -0,0 +1,40 @@
+package config
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReloadAppliesOnlyLiveSettings(t *testing.T) {
+	running := Default()
+	loaded := Default()
+	loaded.Limits.MaxUploadSize = 1 << 20
+	loaded.Log.Level = "debug"
+	loaded.HTTP.Listen = "localhost:9090"
+	loaded.Playback.TTL = time.Minute
+
+	next, applied, restartRequired := Reload(running, loaded)
+	if !slices.Equal(applied, []string{"limits.max_upload_size", "log.level"}) {
+		t.Errorf("applied = %v", applied)
+	}
+	if !slices.Equal(restartRequired, []string{"http.listen", "playback.ttl"}) {
+		t.Errorf("restartRequired = %v", restartRequired)
+	}
+	if next.Limits.MaxUploadSize != 1<<20 || next.Log.Level != "debug" {
+		t.Errorf("live settings not applied: %+v, %+v", next.Limits, next.Log)
+	}
+	if next.HTTP.Listen != running.HTTP.Listen || next.Playback.TTL != running.Playback.TTL {
+		t.Errorf("restart-only settings changed: %+v, %+v", next.HTTP, next.Playback)
+	}
+	if running.Log.Level == "debug" {
+		t.Error("Reload changed the running configuration")
+	}
+}
+
+func TestReloadWithoutChanges(t *testing.T) {
+	_, applied, restartRequired := Reload(Default(), Default())
+	if len(applied) != 0 || len(restartRequired) != 0 {
+		t.Errorf("Reload of the same configuration = %v, %v", applied, restartRequired)
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a number of bytes written as a plain integer or with a unit,
+// e.g. "512MB" or "2GiB".
+type ByteSize int64
+
+var sizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	// Longest suffixes first so "MiB" is not read as "B".
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as "100", "64KiB" or "2G". Single-letter
+// units are binary, like ffmpeg and curl use them.
+func ParseByteSize(s string) (ByteSize, error) {
+	text := strings.TrimSpace(s)
+	multiplier := int64(1)
+	for _, unit := range sizeUnits {
+		if len(text) > len(unit.suffix) && strings.EqualFold(text[len(text)-len(unit.suffix):], unit.suffix) {
+			multiplier = unit.multiplier
+			text = strings.TrimSpace(text[:len(text)-len(unit.suffix)])
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("invalid size %q, want e.g. 512MiB", s)
+	}
+	return ByteSize(n * multiplier), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using ParseByteSize.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
@@ -0,0 +1,70 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadata is the gRPC metadata key carrying the request ID.
+const requestIDMetadata = "x-request-id"
+
+// UnaryClientInterceptor sends the request ID of the call's context along.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := RequestID(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadata, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func incomingRequestID(ctx context.Context) context.Context {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDMetadata); len(ids) > 0 && validRequestID(ids[0]) {
+			return WithRequestID(ctx, ids[0])
+		}
+	}
+	return WithRequestID(ctx, NewRequestID())
+}
+
+// UnaryServerInterceptor continues the caller's request ID, or starts a new
+// one, and logs each call at debug level, or at warn level if it failed.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx = incomingRequestID(ctx)
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		level, attrs := slog.LevelDebug, []any{
+			"method", info.FullMethod,
+			"code", status.Code(err).String(),
+			"duration", time.Since(start),
+		}
+		if err != nil {
+			level, attrs = slog.LevelWarn, append(attrs, "err", err)
+		}
+		slog.Log(ctx, level, "gRPC call", attrs...)
+		return resp, err
+	}
+}
+
+type requestIDStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s requestIDStream) Context() context.Context {
+	return s.ctx
+}
+
+// StreamServerInterceptor continues the caller's request ID in streaming calls.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, requestIDStream{ss, incomingRequestID(ss.Context())})
+	}
+}
@@ -0,0 +1,80 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// RequestIDHeader carries the request ID in HTTP requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// Sampler decides which requests under the path prefixes get an access log
+// line: one in Every, plus every failed request.
+type Sampler struct {
+	Prefixes []string
+	Every    uint64
+	count    atomic.Uint64
+}
+
+func (s *Sampler) sample(r *http.Request, status int) bool {
+	if s == nil || s.Every <= 1 || status >= 400 {
+		return true
+	}
+	for _, prefix := range s.Prefixes {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return s.count.Add(1)%s.Every == 1
+		}
+	}
+	return true
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController flush streamed responses.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// HTTPMiddleware gives each request an ID, taken from the X-Request-ID
+// header if the client sent a usable one, echoes it in the response and
+// writes an access log line, sampled by sampler (which may be nil).
+func HTTPMiddleware(sampler *Sampler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		r = r.WithContext(WithRequestID(r.Context(), id))
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if !sampler.sample(r, rec.status) {
+			return
+		}
+		level := slog.LevelInfo
+		if rec.status >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "HTTP request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+		)
+	})
+}
@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// syncBuffer is a buffer that logging goroutines can share.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// lines returns the JSON log records written so far.
+func (b *syncBuffer) lines(t *testing.T) []map[string]any {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q is not JSON: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// captureLogs sends JSON logs at level to the returned buffer for the rest
+// of the test.
+func captureLogs(t *testing.T, level string) *syncBuffer {
+	t.Helper()
+	previous := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	out := &syncBuffer{}
+	if err := Setup(out, "json", level); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestSetupRejectsUnknownSettings(t *testing.T) {
+	if err := Setup(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Errorf("unknown format accepted")
+	}
+	if err := SetLevel("loud"); err == nil {
+		t.Errorf("unknown level accepted")
+	}
+}
+
+func TestHTTPMiddlewareRequestID(t *testing.T) {
+	logs := captureLogs(t, "info")
+	handler := HTTPMiddleware(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "handled")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	for _, test := range []struct{ sent, want string }{
+		{"client-id-1", "client-id-1"},
+		{"forged\nline", ""},
+		{strings.Repeat("x", 65), ""},
+	} {
+		r := httptest.NewRequest("GET", "/api/v1/videos", nil)
+		r.Header.Set(RequestIDHeader, test.sent)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		id := w.Header().Get(RequestIDHeader)
+		if test.want != "" && id != test.want {
+			t.Errorf("sent %q: response ID = %q, want %q", test.sent, id, test.want)
+		}
+		if test.want == "" && (id == test.sent || len(id) != 16) {
+			t.Errorf("sent %q: response ID = %q, want a new one", test.sent, id)
+		}
+	}
+
+	records := logs.lines(t)
+	if len(records) != 6 {
+		t.Fatalf("got %d log lines, want 6", len(records))
+	}
+	handled, access := records[0], records[1]
+	if handled["request_id"] != "client-id-1" || access["request_id"] != "client-id-1" {
+		t.Errorf("records do not carry the request ID: %v, %v", handled, access)
+	}
+	if access["msg"] != "HTTP request" || access["status"] != float64(http.StatusNotFound) || access["path"] != "/api/v1/videos" {
+		t.Errorf("access log = %v", access)
+	}
+}
+
+func TestSamplerLogsFailuresAndOneInEvery(t *testing.T) {
+	sampler := &Sampler{Prefixes: []string{"/api/v1/content/"}, Every: 3}
+	content := httptest.NewRequest("GET", "/api/v1/content/v/seg.m4s", nil)
+	other := httptest.NewRequest("GET", "/api/v1/videos", nil)
+
+	logged := 0
+	for range 9 {
+		if sampler.sample(content, http.StatusOK) {
+			logged++
+		}
+	}
+	if logged != 3 {
+		t.Errorf("logged %d of 9 content requests, want 3", logged)
+	}
+	if !sampler.sample(content, http.StatusInternalServerError) {
+		t.Errorf("failed content request not logged")
+	}
+	if !sampler.sample(other, http.StatusOK) {
+		t.Errorf("request outside the prefixes not logged")
+	}
+}
+
+func TestRequestIDCrossesGRPC(t *testing.T) {
+	logs := captureLogs(t, "debug")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(UnaryServerInterceptor()))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := WithRequestID(context.Background(), "web-request")
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, record := range logs.lines(t) {
+		if record["msg"] == "gRPC call" {
+			if record["request_id"] != "web-request" || record["code"] != "OK" {
+				t.Errorf("gRPC log = %v", record)
+			}
+			return
+		}
+	}
+	t.Errorf("no gRPC call logged")
+}
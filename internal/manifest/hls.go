@@ -0,0 +1,162 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// uriAttribute matches the quoted URI attribute of an HLS tag.
+var uriAttribute = regexp.MustCompile(`([:,])URI="([^"]*)"`)
+
+// uriTags are the HLS tags whose URI attribute names a playlist or segment.
+// EXT-X-KEY is left out: key servers are not segment origins.
+var uriTags = map[string]bool{
+	"#EXT-X-MAP":                true,
+	"#EXT-X-MEDIA":              true,
+	"#EXT-X-I-FRAME-STREAM-INF": true,
+	"#EXT-X-PART":               true,
+	"#EXT-X-PRELOAD-HINT":       true,
+	"#EXT-X-RENDITION-REPORT":   true,
+}
+
+// subtitleGroup is the GROUP-ID of the subtitle renditions RewriteHLS adds.
+const subtitleGroup = "subtitles"
+
+// RewriteHLS rewrites an HLS playlist. URIs of a master playlist resolve
+// against the first of BaseURLs, every further base URL adds a redundant
+// copy of each variant stream, which players switch to when the first
+// fails, and Subtitles become renditions every variant stream refers to.
+// Media playlists keep relative URIs, so their segments come from the
+// origin the playlist was fetched from. Query is added to every URI.
+func RewriteHLS(data []byte, opts Options) ([]byte, error) {
+	lines, err := parseHLS(data)
+	if err != nil {
+		return nil, err
+	}
+	master := slices.ContainsFunc(lines, func(line string) bool {
+		return strings.HasPrefix(line, "#EXT-X-STREAM-INF:")
+	})
+	bases := []string{""}
+	if master {
+		lines = addSubtitles(lines, opts.Subtitles)
+		if len(opts.BaseURLs) > 0 {
+			bases = opts.BaseURLs
+		}
+	}
+
+	var out bytes.Buffer
+	var variants [][2]string // EXT-X-STREAM-INF lines and the URI after them
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			if i+1 == len(lines) || lines[i+1] == "" || strings.HasPrefix(lines[i+1], "#") {
+				return nil, fmt.Errorf("failed to parse HLS playlist: EXT-X-STREAM-INF without a URI")
+			}
+			variants = append(variants, [2]string{line, lines[i+1]})
+			uri, err := rewriteURI(lines[i+1], bases[0], opts.Query)
+			if err != nil {
+				return nil, err
+			}
+			out.WriteString(line + "\n" + uri + "\n")
+			i++
+			continue
+		case strings.HasPrefix(line, "#"):
+			tag, _, _ := strings.Cut(line, ":")
+			if uriTags[tag] {
+				line, err = rewriteTagURI(line, bases[0], opts.Query)
+			}
+		case line != "":
+			line, err = rewriteURI(line, bases[0], opts.Query)
+		}
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString(line + "\n")
+	}
+
+	for _, base := range bases[1:] {
+		for _, v := range variants {
+			uri, err := rewriteURI(v[1], base, opts.Query)
+			if err != nil {
+				return nil, err
+			}
+			out.WriteString(v[0] + "\n" + uri + "\n")
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// addSubtitles adds subtitle renditions to the lines of a master playlist,
+// ahead of its first variant stream.
+func addSubtitles(lines []string, subtitles []Subtitle) []string {
+	first := slices.IndexFunc(lines, func(line string) bool {
+		return strings.HasPrefix(line, "#EXT-X-STREAM-INF:")
+	})
+	if len(subtitles) == 0 {
+		return lines
+	}
+	out := slices.Clone(lines[:first])
+	for _, sub := range subtitles {
+		out = append(out, fmt.Sprintf(`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="%s",NAME="%s",LANGUAGE="%[2]s",DEFAULT=NO,AUTOSELECT=YES,URI="%s"`,
+			subtitleGroup, sub.Language, sub.PlaylistURI))
+	}
+	for _, line := range lines[first:] {
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF:") && !strings.Contains(line, "SUBTITLES=") {
+			line += `,SUBTITLES="` + subtitleGroup + `"`
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+func parseHLS(data []byte) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse HLS playlist: %w", err)
+	}
+	if len(lines) == 0 || lines[0] != "#EXTM3U" {
+		return nil, fmt.Errorf("failed to parse HLS playlist: missing #EXTM3U header")
+	}
+	return lines, nil
+}
+
+func rewriteTagURI(line, base string, query url.Values) (string, error) {
+	var err error
+	line = uriAttribute.ReplaceAllStringFunc(line, func(attr string) string {
+		m := uriAttribute.FindStringSubmatch(attr)
+		uri, uriErr := rewriteURI(m[2], base, query)
+		if uriErr != nil {
+			err = uriErr
+			return attr
+		}
+		return m[1] + `URI="` + uri + `"`
+	})
+	return line, err
+}
+
+// rewriteURI resolves uri against base, unless base is empty, and adds
+// query.
+func rewriteURI(uri, base string, query url.Values) (string, error) {
+	if base != "" {
+		baseURL, err := url.Parse(base)
+		if err != nil {
+			return "", fmt.Errorf("invalid base URL %q: %w", base, err)
+		}
+		ref, err := url.Parse(uri)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse HLS playlist: invalid URI %q: %w", uri, err)
+		}
+		uri = baseURL.ResolveReference(ref).String()
+	}
+	return addQuery(uri, query), nil
+}
@@ -0,0 +1,104 @@
+package manifest
+
+import (
+	"net/url"
+	"testing"
+)
+
+// The playlists ffmpeg's DASH muxer writes with -hls_playlist 1 for two
+// video renditions and an audio stream.
+const (
+	ffmpegMaster = `#EXTM3U
+#EXT-X-VERSION:7
+
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="group_A1",NAME="audio_0",DEFAULT=YES,URI="media_2.m3u8"
+
+#EXT-X-STREAM-INF:BANDWIDTH=3294000,RESOLUTION=1280x720,CODECS="avc1.64001f,mp4a.40.2",AUDIO="group_A1"
+media_0.m3u8
+
+#EXT-X-STREAM-INF:BANDWIDTH=1394000,RESOLUTION=640x360,CODECS="avc1.64001e,mp4a.40.2",AUDIO="group_A1"
+media_1.m3u8
+
+`
+	ffmpegMedia = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:1
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init-0.m4s"
+#EXTINF:4.000000,
+chunk-0-00001.m4s
+#EXTINF:1.500000,
+chunk-0-00002.m4s
+#EXT-X-ENDLIST
+`
+)
+
+var testOptions = Options{
+	BaseURLs:  []string{"https://a.example.com/content/v1/", "https://b.example.com/content/v1/"},
+	Query:     url.Values{"token": {"t"}},
+	Subtitles: []Subtitle{{Language: "en", URI: "subtitles-en.vtt", PlaylistURI: "subtitles-en.m3u8"}},
+}
+
+func TestRewriteHLSMaster(t *testing.T) {
+	got, err := Rewrite("master.m3u8", []byte(ffmpegMaster), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `#EXTM3U
+#EXT-X-VERSION:7
+
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="group_A1",NAME="audio_0",DEFAULT=YES,URI="https://a.example.com/content/v1/media_2.m3u8?token=t"
+
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subtitles",NAME="en",LANGUAGE="en",DEFAULT=NO,AUTOSELECT=YES,URI="https://a.example.com/content/v1/subtitles-en.m3u8?token=t"
+#EXT-X-STREAM-INF:BANDWIDTH=3294000,RESOLUTION=1280x720,CODECS="avc1.64001f,mp4a.40.2",AUDIO="group_A1",SUBTITLES="subtitles"
+https://a.example.com/content/v1/media_0.m3u8?token=t
+
+#EXT-X-STREAM-INF:BANDWIDTH=1394000,RESOLUTION=640x360,CODECS="avc1.64001e,mp4a.40.2",AUDIO="group_A1",SUBTITLES="subtitles"
+https://a.example.com/content/v1/media_1.m3u8?token=t
+
+#EXT-X-STREAM-INF:BANDWIDTH=3294000,RESOLUTION=1280x720,CODECS="avc1.64001f,mp4a.40.2",AUDIO="group_A1",SUBTITLES="subtitles"
+https://b.example.com/content/v1/media_0.m3u8?token=t
+#EXT-X-STREAM-INF:BANDWIDTH=1394000,RESOLUTION=640x360,CODECS="avc1.64001e,mp4a.40.2",AUDIO="group_A1",SUBTITLES="subtitles"
+https://b.example.com/content/v1/media_1.m3u8?token=t
+`
+	if string(got) != want {
+		t.Errorf("rewritten master playlist:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRewriteHLSMedia(t *testing.T) {
+	got, err := Rewrite("media_0.m3u8", []byte(ffmpegMedia), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Segments stay relative to the origin the playlist came from, and no
+	// subtitles are added.
+	want := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:4
+#EXT-X-MEDIA-SEQUENCE:1
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init-0.m4s?token=t"
+#EXTINF:4.000000,
+chunk-0-00001.m4s?token=t
+#EXTINF:1.500000,
+chunk-0-00002.m4s?token=t
+#EXT-X-ENDLIST
+`
+	if string(got) != want {
+		t.Errorf("rewritten media playlist:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRewriteHLSRejectsMalformedPlaylists(t *testing.T) {
+	for name, data := range map[string]string{
+		"no header":       "#EXT-X-VERSION:7\nmedia_0.m3u8\n",
+		"variant, no URI": "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n",
+		"unparseable URI": "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1\n%zz\n",
+	} {
+		if _, err := RewriteHLS([]byte(data), testOptions); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
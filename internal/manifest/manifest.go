@@ -0,0 +1,76 @@
+// Package manifest rewrites DASH manifests and HLS playlists at serve time,
+// so segments can be fetched from other origins than the one serving the
+// manifest and carry per-request query parameters such as playback tokens.
+package manifest
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Options say how to rewrite a manifest. The zero value leaves its
+// references unchanged.
+type Options struct {
+	// BaseURLs are where segments are fetched from, in order of preference.
+	// Relative segment names resolve against them. Players fall back to a
+	// later one when an earlier one fails.
+	BaseURLs []string
+	// Query is added to every segment URL.
+	Query url.Values
+	// Subtitles are added to DASH manifests as text adaptation sets of the
+	// first period, and to HLS master playlists as subtitle renditions.
+	Subtitles []Subtitle
+}
+
+// Subtitle is a WebVTT subtitle track.
+type Subtitle struct {
+	Language string // BCP 47 tag
+	// URI is the WebVTT file, for DASH. PlaylistURI is an HLS media
+	// playlist of it.
+	URI, PlaylistURI string
+}
+
+func (o Options) empty() bool {
+	return len(o.BaseURLs) == 0 && len(o.Query) == 0 && len(o.Subtitles) == 0
+}
+
+// IsManifest reports whether filename is a manifest Rewrite understands.
+func IsManifest(filename string) bool {
+	switch path.Ext(filename) {
+	case ".mpd", ".m3u8", ".vtt":
+		return true
+	}
+	return false
+}
+
+// Rewrite rewrites the manifest data of filename, a DASH MPD, an HLS
+// playlist or a WebVTT thumbnails track, as opts say.
+func Rewrite(filename string, data []byte, opts Options) ([]byte, error) {
+	if opts.empty() {
+		return data, nil
+	}
+	switch path.Ext(filename) {
+	case ".mpd":
+		return RewriteMPD(data, opts)
+	case ".m3u8":
+		return RewriteHLS(data, opts)
+	case ".vtt":
+		return RewriteVTT(data, opts)
+	}
+	return nil, fmt.Errorf("%s is not a manifest", filename)
+}
+
+// addQuery appends query to ref. ref may be a DASH URL template, whose
+// $identifiers$ and format tags would not survive URL parsing.
+func addQuery(ref string, query url.Values) string {
+	if len(query) == 0 {
+		return ref
+	}
+	sep := "?"
+	if strings.Contains(ref, "?") {
+		sep = "&"
+	}
+	return ref + sep + query.Encode()
+}
@@ -0,0 +1,270 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// segmentRefs lists the attributes of each MPD element that hold segment
+// URLs or URL templates.
+var segmentRefs = map[string][]string{
+	"SegmentTemplate":     {"media", "initialization", "index", "bitstreamSwitching"},
+	"SegmentURL":          {"media", "index"},
+	"Initialization":      {"sourceURL"},
+	"RepresentationIndex": {"sourceURL"},
+	"BitstreamSwitching":  {"sourceURL"},
+}
+
+// RewriteMPD rewrites a DASH manifest. BaseURLs replace the BaseURL
+// elements of the MPD element, each with its own serviceLocation so players
+// treat them as alternatives. Query is added to every segment reference.
+// Subtitles follow the adaptation sets of the first Period. Everything else
+// is copied token by token.
+func RewriteMPD(data []byte, opts Options) ([]byte, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var w mpdWriter
+
+	var (
+		depth     int
+		root      xml.Name
+		indent    xml.CharData // whitespace before the last child of MPD
+		pending   bool         // whether indent is yet to be written
+		inserted  = len(opts.BaseURLs) == 0
+		skipUntil = -1 // depth whose end ends a dropped element
+
+		periods     int
+		tail        xml.CharData // whitespace before the last child of the first Period
+		tailPending bool
+		setIndent   xml.CharData // whitespace before its adaptation sets
+	)
+	insertBaseURLs := func() {
+		inserted = true
+		for i, base := range opts.BaseURLs {
+			el := xml.StartElement{
+				Name: xml.Name{Local: prefixed(root.Space, "BaseURL")},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "serviceLocation"}, Value: serviceLocation(base, i)}},
+			}
+			w.write(indent)
+			w.write(el)
+			w.write(xml.CharData(base))
+			w.write(el.End())
+		}
+	}
+
+	insertSubtitles := func() {
+		// Compact manifests stay compact.
+		unit := ""
+		if bytes.HasSuffix(setIndent, []byte("\t")) {
+			unit = "\t"
+		} else if len(setIndent) > 0 {
+			unit = "  "
+		}
+		inner := xml.CharData(string(setIndent) + unit)
+		innermost := xml.CharData(string(inner) + unit)
+		el := func(name string, attrs ...string) xml.StartElement {
+			el := xml.StartElement{Name: xml.Name{Local: prefixed(root.Space, name)}}
+			for i := 0; i < len(attrs); i += 2 {
+				el.Attr = append(el.Attr, xml.Attr{Name: xml.Name{Local: attrs[i]}, Value: attrs[i+1]})
+			}
+			return el
+		}
+		for _, sub := range opts.Subtitles {
+			set := el("AdaptationSet", "contentType", "text", "mimeType", "text/vtt", "lang", sub.Language)
+			role := el("Role", "schemeIdUri", "urn:mpeg:dash:role:2011", "value", "subtitle")
+			rep := el("Representation", "id", "subtitles-"+sub.Language, "bandwidth", "256")
+			base := el("BaseURL")
+			w.write(setIndent)
+			w.write(set)
+			w.write(inner)
+			w.write(role)
+			w.write(role.End())
+			w.write(inner)
+			w.write(rep)
+			w.write(innermost)
+			w.write(base)
+			w.write(xml.CharData(addQuery(sub.URI, opts.Query)))
+			w.write(base.End())
+			w.write(inner)
+			w.write(rep.End())
+			w.write(setIndent)
+			w.write(set.End())
+		}
+	}
+
+	for {
+		tok, err := dec.RawToken()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse MPD: %w", err)
+		}
+		if skipUntil >= 0 {
+			switch tok.(type) {
+			case xml.StartElement:
+				depth++
+			case xml.EndElement:
+				depth--
+				if depth == skipUntil {
+					skipUntil = -1
+				}
+			}
+			continue
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				if t.Name.Local != "MPD" {
+					return nil, fmt.Errorf("failed to parse MPD: root element is %s", t.Name.Local)
+				}
+				root = t.Name
+			}
+			if depth == 1 && !inserted {
+				switch t.Name.Local {
+				case "ProgramInformation":
+				case "BaseURL":
+					pending = false
+					skipUntil = depth
+					depth++
+					continue
+				default:
+					insertBaseURLs()
+				}
+			}
+			if depth == 1 && t.Name.Local == "Period" {
+				periods++
+			}
+			if depth == 2 && periods == 1 && t.Name.Local == "AdaptationSet" && tailPending {
+				setIndent = tail
+			}
+			depth++
+			tok = rewriteRefs(t, opts.Query)
+		case xml.EndElement:
+			depth--
+			if depth == 0 && !inserted {
+				insertBaseURLs()
+			}
+			if depth == 1 && periods == 1 && t.Name.Local == "Period" {
+				periods++ // Only the first Period gets subtitles.
+				insertSubtitles()
+			}
+		case xml.CharData:
+			if depth == 1 && len(bytes.TrimSpace(t)) == 0 {
+				// Held back in case the next element is dropped.
+				indent, pending = t.Copy(), true
+				continue
+			}
+			if depth == 2 && periods == 1 && len(bytes.TrimSpace(t)) == 0 {
+				// Held back so subtitles go before the end tag's indent.
+				if tailPending {
+					w.write(tail)
+				}
+				tail, tailPending = t.Copy(), true
+				continue
+			}
+		}
+		if pending {
+			w.write(indent)
+			pending = false
+		}
+		if tailPending {
+			w.write(tail)
+			tailPending = false
+		}
+		w.write(tok)
+	}
+	if depth != 0 || root.Local == "" {
+		return nil, fmt.Errorf("failed to parse MPD: unexpected end of document")
+	}
+	return w.bytes(), nil
+}
+
+// rewriteRefs adds query to the segment references of el.
+func rewriteRefs(el xml.StartElement, query url.Values) xml.StartElement {
+	attrs, ok := segmentRefs[el.Name.Local]
+	if !ok || len(query) == 0 {
+		return el
+	}
+	el = el.Copy()
+	for i, attr := range el.Attr {
+		for _, name := range attrs {
+			if attr.Name.Space == "" && attr.Name.Local == name {
+				el.Attr[i].Value = addQuery(attr.Value, query)
+			}
+		}
+	}
+	return el
+}
+
+// mpdWriter writes the tokens of RawToken back out the way they were
+// read: namespace prefixes stay as written, whitespace is not escaped and
+// empty elements stay self-closing.
+type mpdWriter struct {
+	buf bytes.Buffer
+	// open is a start tag whose ">" is held back until it is known whether
+	// the element is empty.
+	open bool
+}
+
+func (w *mpdWriter) write(tok xml.Token) {
+	if _, ok := tok.(xml.EndElement); ok && w.open {
+		w.open = false
+		w.buf.WriteString("/>")
+		return
+	}
+	if w.open {
+		w.open = false
+		w.buf.WriteByte('>')
+	}
+
+	switch t := tok.(type) {
+	case xml.StartElement:
+		w.buf.WriteString("<" + prefixed(t.Name.Space, t.Name.Local))
+		for _, attr := range t.Attr {
+			w.buf.WriteString(" " + prefixed(attr.Name.Space, attr.Name.Local) + `="`)
+			xml.EscapeText(&w.buf, []byte(attr.Value))
+			w.buf.WriteByte('"')
+		}
+		w.open = true
+	case xml.EndElement:
+		w.buf.WriteString("</" + prefixed(t.Name.Space, t.Name.Local) + ">")
+	case xml.CharData:
+		if len(bytes.TrimSpace(t)) == 0 {
+			w.buf.Write(t)
+		} else {
+			xml.EscapeText(&w.buf, t)
+		}
+	case xml.Comment:
+		w.buf.WriteString("<!--" + string(t) + "-->")
+	case xml.ProcInst:
+		w.buf.WriteString("<?" + t.Target + " " + string(t.Inst) + "?>")
+	case xml.Directive:
+		w.buf.WriteString("<!" + string(t) + ">")
+	}
+}
+
+func (w *mpdWriter) bytes() []byte {
+	return w.buf.Bytes()
+}
+
+func prefixed(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+// serviceLocation names the i-th base URL after its host, which is what
+// tells CDNs apart.
+func serviceLocation(base string, i int) string {
+	if u, err := url.Parse(base); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host)
+	}
+	return fmt.Sprintf("origin%d", i+1)
+}
@@ -0,0 +1,75 @@
+package manifest
+
+import "testing"
+
+// ffmpegStaticMPD is indented with tabs, as ffmpeg's DASH muxer writes it.
+const ffmpegStaticMPD = `<?xml version="1.0" encoding="utf-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT5.5S">
+	<Period id="0" start="PT0.0S">
+		<AdaptationSet id="0" contentType="video">
+			<Representation id="0" bandwidth="3000000">
+				<SegmentTemplate initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="1"/>
+			</Representation>
+		</AdaptationSet>
+	</Period>
+</MPD>
+`
+
+var testSubtitles = []Subtitle{
+	{Language: "en", URI: "subtitles-en.vtt", PlaylistURI: "subtitles-en.m3u8"},
+	{Language: "pt-br", URI: "subtitles-pt-br.vtt", PlaylistURI: "subtitles-pt-br.m3u8"},
+}
+
+func TestRewriteMPDAddsSubtitles(t *testing.T) {
+	got, err := Rewrite("manifest.mpd", []byte(ffmpegStaticMPD), Options{Query: testOptions.Query, Subtitles: testSubtitles})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="utf-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT5.5S">
+	<Period id="0" start="PT0.0S">
+		<AdaptationSet id="0" contentType="video">
+			<Representation id="0" bandwidth="3000000">
+				<SegmentTemplate initialization="init-$RepresentationID$.m4s?token=t" media="chunk-$RepresentationID$-$Number%05d$.m4s?token=t" startNumber="1"/>
+			</Representation>
+		</AdaptationSet>
+		<AdaptationSet contentType="text" mimeType="text/vtt" lang="en">
+			<Role schemeIdUri="urn:mpeg:dash:role:2011" value="subtitle"/>
+			<Representation id="subtitles-en" bandwidth="256">
+				<BaseURL>subtitles-en.vtt?token=t</BaseURL>
+			</Representation>
+		</AdaptationSet>
+		<AdaptationSet contentType="text" mimeType="text/vtt" lang="pt-br">
+			<Role schemeIdUri="urn:mpeg:dash:role:2011" value="subtitle"/>
+			<Representation id="subtitles-pt-br" bandwidth="256">
+				<BaseURL>subtitles-pt-br.vtt?token=t</BaseURL>
+			</Representation>
+		</AdaptationSet>
+	</Period>
+</MPD>
+`
+	if string(got) != want {
+		t.Errorf("rewritten manifest:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRewriteMPDSubtitlesInFirstPeriod(t *testing.T) {
+	compact := `<MPD xmlns="urn:mpeg:dash:schema:mpd:2011"><Period id="0"><AdaptationSet/></Period><Period id="1"><AdaptationSet/></Period></MPD>`
+	got, err := RewriteMPD([]byte(compact), Options{Subtitles: testSubtitles[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<MPD xmlns="urn:mpeg:dash:schema:mpd:2011"><Period id="0"><AdaptationSet/>` +
+		`<AdaptationSet contentType="text" mimeType="text/vtt" lang="en"><Role schemeIdUri="urn:mpeg:dash:role:2011" value="subtitle"/>` +
+		`<Representation id="subtitles-en" bandwidth="256"><BaseURL>subtitles-en.vtt</BaseURL></Representation></AdaptationSet>` +
+		`</Period><Period id="1"><AdaptationSet/></Period></MPD>`
+	if string(got) != want {
+		t.Errorf("rewritten manifest:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Without options the manifest is left as it is.
+	got, err = Rewrite("manifest.mpd", []byte(ffmpegStaticMPD), Options{})
+	if err != nil || string(got) != ffmpegStaticMPD {
+		t.Errorf("Rewrite without options = %s, %v", got, err)
+	}
+}
@@ -0,0 +1,189 @@
+package manifest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SegmentTemplate is the numbered segment naming of one representation of
+// a DASH manifest.
+type SegmentTemplate struct {
+	RepresentationID string
+	Bandwidth        int
+	// Media is the URL template, e.g. "chunk-$RepresentationID$-$Number%05d$.m4s".
+	Media string
+	// Initialization names the initialization segment, if there is one.
+	Initialization string
+	StartNumber    int
+	// EndNumber is the number of the last segment, or 0 if the manifest
+	// does not tell.
+	EndNumber int
+}
+
+type mpdDocument struct {
+	Duration string `xml:"mediaPresentationDuration,attr"`
+	Periods  []struct {
+		AdaptationSets []struct {
+			Template        *mpdSegmentTemplate `xml:"SegmentTemplate"`
+			Representations []struct {
+				Id        string              `xml:"id,attr"`
+				Bandwidth int                 `xml:"bandwidth,attr"`
+				Template  *mpdSegmentTemplate `xml:"SegmentTemplate"`
+			} `xml:"Representation"`
+		} `xml:"AdaptationSet"`
+	} `xml:"Period"`
+}
+
+type mpdSegmentTemplate struct {
+	Media          string `xml:"media,attr"`
+	Initialization string `xml:"initialization,attr"`
+	StartNumber    *int   `xml:"startNumber,attr"`
+	Timescale      int    `xml:"timescale,attr"`
+	Duration       int    `xml:"duration,attr"`
+	Timeline       []struct {
+		R int `xml:"r,attr"`
+	} `xml:"SegmentTimeline>S"`
+}
+
+// SegmentTemplates returns the numbered segment templates of a DASH
+// manifest, one per representation. Representations named by time rather
+// than number are left out.
+func SegmentTemplates(mpd []byte) ([]SegmentTemplate, error) {
+	var doc mpdDocument
+	if err := xml.Unmarshal(mpd, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse MPD: %w", err)
+	}
+	duration, _ := ParseDuration(doc.Duration)
+
+	var templates []SegmentTemplate
+	for _, period := range doc.Periods {
+		for _, set := range period.AdaptationSets {
+			for _, rep := range set.Representations {
+				tmpl := rep.Template
+				if tmpl == nil {
+					tmpl = set.Template
+				}
+				if tmpl == nil || !strings.Contains(tmpl.Media, "$Number") {
+					continue
+				}
+				t := SegmentTemplate{
+					RepresentationID: rep.Id,
+					Bandwidth:        rep.Bandwidth,
+					Media:            tmpl.Media,
+					Initialization:   tmpl.Initialization,
+					StartNumber:      1,
+				}
+				if tmpl.StartNumber != nil {
+					t.StartNumber = *tmpl.StartNumber
+				}
+				if count := tmpl.segmentCount(duration); count > 0 {
+					t.EndNumber = t.StartNumber + count - 1
+				}
+				templates = append(templates, t)
+			}
+		}
+	}
+	return templates, nil
+}
+
+// segmentCount returns how many segments the template describes, or 0 if
+// it cannot tell.
+func (t *mpdSegmentTemplate) segmentCount(duration time.Duration) int {
+	if len(t.Timeline) > 0 {
+		count := 0
+		for _, s := range t.Timeline {
+			if s.R < 0 {
+				return 0
+			}
+			count += s.R + 1
+		}
+		return count
+	}
+	if t.Duration > 0 && duration > 0 {
+		timescale := t.Timescale
+		if timescale <= 0 {
+			timescale = 1
+		}
+		return int(math.Ceil(duration.Seconds() / (float64(t.Duration) / float64(timescale))))
+	}
+	return 0
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// ParseDuration parses the xs:duration subset used by DASH manifests, e.g.
+// "PT1M3.5S".
+func ParseDuration(s string) (time.Duration, error) {
+	m := isoDuration.FindStringSubmatch(s)
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		total += time.Duration(v * float64(unit))
+	}
+	return total, nil
+}
+
+// numberIdentifier matches $Number$ with an optional width, as in
+// $Number%05d$.
+var numberIdentifier = regexp.MustCompile(`\$Number(?:%0(\d+)d)?\$`)
+
+// Name returns the name of segment number n.
+func (t SegmentTemplate) Name(n int) string {
+	return t.expand(t.Media, n)
+}
+
+// InitializationName returns the name of the initialization segment, or ""
+// if there is none.
+func (t SegmentTemplate) InitializationName() string {
+	return t.expand(t.Initialization, 0)
+}
+
+func (t SegmentTemplate) expand(template string, n int) string {
+	name := numberIdentifier.ReplaceAllStringFunc(template, func(id string) string {
+		width, _ := strconv.Atoi(numberIdentifier.FindStringSubmatch(id)[1])
+		return fmt.Sprintf("%0*d", width, n)
+	})
+	name = strings.ReplaceAll(name, "$RepresentationID$", t.RepresentationID)
+	name = strings.ReplaceAll(name, "$Bandwidth$", strconv.Itoa(t.Bandwidth))
+	return strings.ReplaceAll(name, "$$", "$")
+}
+
+// Number returns the number of the segment called name, or ok false if
+// name does not follow the template.
+func (t SegmentTemplate) Number(name string) (n int, ok bool) {
+	loc := numberIdentifier.FindStringIndex(t.Media)
+	if loc == nil {
+		return 0, false
+	}
+	prefix := t.expand(t.Media[:loc[0]], 0)
+	suffix := t.expand(t.Media[loc[1]:], 0)
+	digits, found := strings.CutPrefix(name, prefix)
+	if !found {
+		return 0, false
+	}
+	digits, found = strings.CutSuffix(digits, suffix)
+	if !found || digits == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
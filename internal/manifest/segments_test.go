@@ -0,0 +1,102 @@
+package manifest
+
+import (
+	"testing"
+	"time"
+)
+
+// ffmpegMPD is the manifest ffmpeg writes for 9.5 seconds of video in two
+// renditions and audio, in 4 second segments.
+const ffmpegMPD = `<?xml version="1.0" encoding="utf-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT9.5S" minBufferTime="PT8.0S">
+	<Period id="0" start="PT0.0S">
+		<AdaptationSet id="0" contentType="video" segmentAlignment="true">
+			<Representation id="0" mimeType="video/mp4" codecs="avc1.64001f" bandwidth="3000000" width="1280" height="720">
+				<SegmentTemplate timescale="15360" initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="1">
+					<SegmentTimeline>
+						<S t="0" d="61440" r="1" />
+						<S d="23040" />
+					</SegmentTimeline>
+				</SegmentTemplate>
+			</Representation>
+			<Representation id="1" mimeType="video/mp4" codecs="avc1.64001e" bandwidth="800000" width="640" height="360">
+				<SegmentTemplate timescale="15360" initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="1">
+					<SegmentTimeline>
+						<S t="0" d="61440" r="1" />
+						<S d="23040" />
+					</SegmentTimeline>
+				</SegmentTemplate>
+			</Representation>
+		</AdaptationSet>
+		<AdaptationSet id="1" contentType="audio">
+			<SegmentTemplate timescale="48000" duration="192000" initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="0"/>
+			<Representation id="2" mimeType="audio/mp4" codecs="mp4a.40.2" bandwidth="128000" />
+		</AdaptationSet>
+		<AdaptationSet id="2" contentType="video">
+			<Representation id="3" bandwidth="1">
+				<SegmentTemplate media="chunk-$RepresentationID$-$Time$.m4s" />
+			</Representation>
+		</AdaptationSet>
+	</Period>
+</MPD>
+`
+
+func TestSegmentTemplates(t *testing.T) {
+	templates, err := SegmentTemplates([]byte(ffmpegMPD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(templates) != 3 {
+		t.Fatalf("%d templates, want 3 (time-based ones left out): %+v", len(templates), templates)
+	}
+	for i, want := range []struct {
+		id                string
+		bandwidth         int
+		start, end        int
+		init, first, last string
+	}{
+		{"0", 3000000, 1, 3, "init-0.m4s", "chunk-0-00001.m4s", "chunk-0-00003.m4s"},
+		{"1", 800000, 1, 3, "init-1.m4s", "chunk-1-00001.m4s", "chunk-1-00003.m4s"},
+		// The audio template is shared by the adaptation set and counted
+		// from the duration.
+		{"2", 128000, 0, 2, "init-2.m4s", "chunk-2-00000.m4s", "chunk-2-00002.m4s"},
+	} {
+		tmpl := templates[i]
+		if tmpl.RepresentationID != want.id || tmpl.Bandwidth != want.bandwidth || tmpl.StartNumber != want.start || tmpl.EndNumber != want.end {
+			t.Errorf("template %d = %+v", i, tmpl)
+		}
+		if got := tmpl.InitializationName(); got != want.init {
+			t.Errorf("template %d: initialization %q, want %q", i, got, want.init)
+		}
+		if first, last := tmpl.Name(tmpl.StartNumber), tmpl.Name(tmpl.EndNumber); first != want.first || last != want.last {
+			t.Errorf("template %d: segments %q to %q", i, first, last)
+		}
+	}
+
+	if n, ok := templates[1].Number("chunk-1-00002.m4s"); !ok || n != 2 {
+		t.Errorf("Number(chunk-1-00002.m4s) = %d, %v", n, ok)
+	}
+	for _, name := range []string{"chunk-0-00002.m4s", "init-1.m4s", "chunk-1-0000x.m4s"} {
+		if n, ok := templates[1].Number(name); ok {
+			t.Errorf("Number(%s) = %d for representation 1", name, n)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, want := range map[string]time.Duration{
+		"PT9.5S":   9500 * time.Millisecond,
+		"PT1M3.5S": 63500 * time.Millisecond,
+		"P1DT2H":   26 * time.Hour,
+		"PT0S":     0,
+	} {
+		if got, err := ParseDuration(s); err != nil || got != want {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "P", "PT", "9.5S", "PT-1S"} {
+		if _, err := ParseDuration(s); err == nil {
+			t.Errorf("ParseDuration(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// imageCue matches the payload of a thumbnails track cue: an image URL with
+// a media fragment selecting a sprite from a sheet.
+var imageCue = regexp.MustCompile(`^\S+\.(?:jpg|jpeg|png|webp)(?:\?\S*)?#xywh=\d+,\d+,\d+,\d+$`)
+
+// RewriteVTT rewrites the image URLs of a WebVTT thumbnails track. They
+// resolve against the first of BaseURLs, and Query is added to each ahead of
+// its fragment. Other tracks, such as captions, come back unchanged.
+func RewriteVTT(data []byte, opts Options) ([]byte, error) {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse WebVTT track: %w", err)
+	}
+	if len(lines) == 0 || !strings.HasPrefix(strings.TrimPrefix(lines[0], "\ufeff"), "WEBVTT") {
+		return nil, fmt.Errorf("failed to parse WebVTT track: missing WEBVTT header")
+	}
+	base := ""
+	if len(opts.BaseURLs) > 0 {
+		base = opts.BaseURLs[0]
+	}
+
+	var out bytes.Buffer
+	for i, line := range lines {
+		// A cue payload follows its timing line.
+		if i > 0 && strings.Contains(lines[i-1], "-->") && imageCue.MatchString(line) {
+			ref, fragment, _ := strings.Cut(line, "#")
+			uri, err := rewriteURI(ref, base, opts.Query)
+			if err != nil {
+				return nil, err
+			}
+			if fragment != "" {
+				uri += "#" + fragment
+			}
+			line = uri
+		}
+		out.WriteString(line + "\n")
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+)
+
+// thumbnailsVTT is a track as the web server writes it, with two thumbnails
+// on a sheet of 2x1.
+const thumbnailsVTT = `WEBVTT
+
+00:00:00.000 --> 00:00:10.000
+thumbnails-001.jpg#xywh=0,0,160,90
+
+00:00:10.000 --> 00:00:15.500
+thumbnails-001.jpg#xywh=160,0,160,90
+`
+
+func TestRewriteVTT(t *testing.T) {
+	got, err := RewriteVTT([]byte(thumbnailsVTT), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.NewReplacer(
+		"thumbnails-001.jpg#", "https://a.example.com/content/v1/thumbnails-001.jpg?token=t#",
+	).Replace(thumbnailsVTT)
+	if string(got) != want {
+		t.Errorf("RewriteVTT =\n%s\nwant\n%s", got, want)
+	}
+
+	// Without base URLs the sheets stay relative to the track.
+	got, err = RewriteVTT([]byte(strings.ReplaceAll(thumbnailsVTT, "\n", "\r\n")), Options{Query: testOptions.Query})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "\nthumbnails-001.jpg?token=t#xywh=160,0,160,90\n") || strings.Contains(string(got), "\r") {
+		t.Errorf("relative track:\n%q", got)
+	}
+}
+
+func TestRewriteVTTLeavesCaptionsAlone(t *testing.T) {
+	captions := "\ufeffWEBVTT\n\n1\n00:00:01.000 --> 00:00:02.000\nsee photo.jpg#xywh=0,0,1,1 below\n\nNOTE photo.jpg#xywh=0,0,1,1\n"
+	got, err := RewriteVTT([]byte(captions), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != captions {
+		t.Errorf("captions rewritten:\n%s", got)
+	}
+	if _, err := RewriteVTT([]byte("00:00:00.000 --> 00:00:01.000\nthumbnails-001.jpg#xywh=0,0,1,1\n"), testOptions); err == nil {
+		t.Errorf("track without WEBVTT header accepted")
+	}
+}
+
+func TestRewriteDispatchesOnExtension(t *testing.T) {
+	got, err := Rewrite("thumbnails.vtt", []byte(thumbnailsVTT), testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), "https://a.example.com/content/v1/thumbnails-001.jpg?token=t#xywh=0,0,160,90") {
+		t.Errorf("Rewrite of a track:\n%s", got)
+	}
+	for name, want := range map[string]bool{"thumbnails.vtt": true, "master.m3u8": true, "manifest.mpd": true, "thumbnail.jpg": false} {
+		if IsManifest(name) != want {
+			t.Errorf("IsManifest(%q) = %v", name, !want)
+		}
+	}
+}
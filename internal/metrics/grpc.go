@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+var (
+	rpcServerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_handling_seconds",
+		Help:      "Latency of gRPC calls handled, by method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "code"})
+	rpcServerMessageSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_server_message_size_bytes",
+		Help:      "Size of gRPC messages handled, by method and direction (received, sent).",
+		Buckets:   sizeBuckets,
+	}, []string{"method", "direction"})
+
+	rpcClientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grpc_client_handling_seconds",
+		Help:      "Latency of gRPC calls made to storage nodes, by node, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"node", "method", "code"})
+	nodeBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_node_bytes_total",
+		Help:      "Bytes of gRPC messages exchanged with each storage node, by direction (sent, received).",
+	}, []string{"node", "direction"})
+)
+
+func messageSize(m any) int {
+	if msg, ok := m.(protobuf.Message); ok {
+		return protobuf.Size(msg)
+	}
+	return 0
+}
+
+// UnaryServerInterceptor records latency and message sizes of unary calls.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+
+		rpcServerDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		rpcServerMessageSize.WithLabelValues(info.FullMethod, "received").Observe(float64(messageSize(req)))
+		if err == nil {
+			rpcServerMessageSize.WithLabelValues(info.FullMethod, "sent").Observe(float64(messageSize(resp)))
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records the latency of streaming calls.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		rpcServerDuration.WithLabelValues(info.FullMethod, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// UnaryClientInterceptor records latency and bytes exchanged per storage node.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		node := cc.Target()
+		rpcClientDuration.WithLabelValues(node, method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		nodeBytes.WithLabelValues(node, "sent").Add(float64(messageSize(req)))
+		if err == nil {
+			nodeBytes.WithLabelValues(node, "received").Add(float64(messageSize(reply)))
+		}
+		return err
+	}
+}
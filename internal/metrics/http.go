@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests, by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+	httpRequestSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_size_bytes",
+		Help:      "Size of HTTP request bodies, by route and method.",
+		Buckets:   sizeBuckets,
+	}, []string{"route", "method"})
+	httpResponseSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_response_size_bytes",
+		Help:      "Size of HTTP response bodies, by route and method.",
+		Buckets:   sizeBuckets,
+	}, []string{"route", "method"})
+)
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController flush streamed responses.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// HTTPMiddleware records latency and sizes of every request. route maps a
+// request to a bounded label, such as the mux pattern that serves it, so that
+// video IDs in paths do not become separate series.
+func HTTPMiddleware(route func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		name := route(r)
+		httpDuration.WithLabelValues(name, r.Method, strconv.Itoa(rec.status)).Observe(time.Since(start).Seconds())
+		if r.ContentLength >= 0 {
+			httpRequestSize.WithLabelValues(name, r.Method).Observe(float64(r.ContentLength))
+		}
+		httpResponseSize.WithLabelValues(name, r.Method).Observe(float64(rec.size))
+	})
+}
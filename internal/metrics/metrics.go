@@ -0,0 +1,89 @@
+// Package metrics defines the Prometheus metrics exported by the web server
+// and storage nodes, along with the middleware that records them.
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "tritontube"
+
+// sizeBuckets span 256 B manifests to 256 MiB uploads.
+var sizeBuckets = prometheus.ExponentialBuckets(256, 4, 11)
+
+var (
+	FFmpegDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_job_duration_seconds",
+		Help:      "Duration of ffmpeg jobs by stage.",
+		Buckets:   prometheus.ExponentialBuckets(0.25, 2, 12),
+	}, []string{"stage"})
+	FFmpegFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ffmpeg_job_failures_total",
+		Help:      "Number of ffmpeg jobs that exited with an error, by stage.",
+	}, []string{"stage"})
+
+	RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_rate_limited_total",
+		Help:      "Number of HTTP requests rejected with 429, by endpoint class (upload, metadata, content).",
+	}, []string{"class"})
+	QuotaRejections = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_quota_rejections_total",
+		Help:      "Number of uploads rejected because they would exceed the user's storage quota.",
+	})
+
+	ContentCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "content_cache_requests_total",
+		Help:      "Content reads through the segment cache, by result (memory, disk, miss).",
+	}, []string{"result"})
+	ContentCacheBytes = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "content_cache_bytes",
+		Help:      "Size of the files held by the segment cache, by tier (memory, disk).",
+	}, []string{"tier"})
+	ContentPrefetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "content_prefetches_total",
+		Help:      "Segments prefetched (fetched), found already cached (cached) or failed to prefetch (failed), and segment reads that started no prefetch because too many were running (skipped).",
+	}, []string{"result"})
+	ContentPrefetchHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "content_prefetch_hits_total",
+		Help:      "Prefetched segments later read from the cache. Divided by fetched prefetches, the prefetch hit ratio.",
+	})
+
+	RingNodes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ring_nodes",
+		Help:      "Number of storage nodes in the consistent-hash ring.",
+	})
+
+	Migrations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "migrations_total",
+		Help:      "Number of ring changes, by operation (add, remove) and result.",
+	}, []string{"operation", "result"})
+	MigrationFiles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "migration_files_total",
+		Help:      "Number of files moved between nodes by ring changes, by result.",
+	}, []string{"result"})
+	MigrationPending = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "migration_files_pending",
+		Help:      "Files the running ring change still has to move.",
+	})
+)
+
+// Handler serves all registered metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
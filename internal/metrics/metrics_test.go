@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// scrape returns the text exposition of every registered metric.
+func scrape(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func assertMetric(t *testing.T, exposition, line string) {
+	t.Helper()
+	if !strings.Contains(exposition, line+"\n") {
+		t.Errorf("metrics do not contain %q", line)
+	}
+}
+
+func TestHTTPMiddlewareLabelsByRoute(t *testing.T) {
+	handler := HTTPMiddleware(func(*http.Request) string { return "/api/v1/content/{videoId}/{filename}" },
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			io.WriteString(w, "0123456789")
+		}))
+	for _, id := range []string{"a", "b"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/content/"+id+"/manifest.mpd", nil))
+	}
+
+	exposition := scrape(t)
+	assertMetric(t, exposition, `tritontube_http_request_duration_seconds_count{code="418",method="GET",route="/api/v1/content/{videoId}/{filename}"} 2`)
+	assertMetric(t, exposition, `tritontube_http_response_size_bytes_sum{method="GET",route="/api/v1/content/{videoId}/{filename}"} 20`)
+	if strings.Contains(exposition, "manifest.mpd") {
+		t.Errorf("request paths leaked into labels")
+	}
+}
+
+func TestUnaryServerInterceptorRecordsCodes(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Fail"}
+	_, err := interceptor(context.Background(), wrapperspb.String("request"), info, func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.NotFound, "missing")
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("err = %v, want the handler's", err)
+	}
+
+	exposition := scrape(t)
+	assertMetric(t, exposition, `tritontube_grpc_server_handling_seconds_count{code="NotFound",method="/test.Service/Fail"} 1`)
+	assertMetric(t, exposition, `tritontube_grpc_server_message_size_bytes_count{direction="received",method="/test.Service/Fail"} 1`)
+	if strings.Contains(exposition, `direction="sent",method="/test.Service/Fail"`) {
+		t.Errorf("failed call recorded a sent message")
+	}
+}
@@ -277,6 +277,300 @@ func (x *ListNodesResponse) GetNodes() []string {
 	return nil
 }
 
+type ListAuditLogRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Limit         int32                  `protobuf:"varint,1,opt,name=limit,proto3" json:"limit,omitempty"`
+	Actor         string                 `protobuf:"bytes,2,opt,name=actor,proto3" json:"actor,omitempty"`
+	SinceUnix     int64                  `protobuf:"varint,3,opt,name=since_unix,json=sinceUnix,proto3" json:"since_unix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAuditLogRequest) Reset() {
+	*x = ListAuditLogRequest{}
+	mi := &file_proto_admin_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAuditLogRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAuditLogRequest) ProtoMessage() {}
+
+func (x *ListAuditLogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAuditLogRequest.ProtoReflect.Descriptor instead.
+func (*ListAuditLogRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListAuditLogRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ListAuditLogRequest) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *ListAuditLogRequest) GetSinceUnix() int64 {
+	if x != nil {
+		return x.SinceUnix
+	}
+	return 0
+}
+
+type AuditEntry struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int64                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	TimeUnix      int64                  `protobuf:"varint,2,opt,name=time_unix,json=timeUnix,proto3" json:"time_unix,omitempty"`
+	Actor         string                 `protobuf:"bytes,3,opt,name=actor,proto3" json:"actor,omitempty"`
+	Role          string                 `protobuf:"bytes,4,opt,name=role,proto3" json:"role,omitempty"`
+	Action        string                 `protobuf:"bytes,5,opt,name=action,proto3" json:"action,omitempty"`
+	Target        string                 `protobuf:"bytes,6,opt,name=target,proto3" json:"target,omitempty"`
+	Outcome       string                 `protobuf:"bytes,7,opt,name=outcome,proto3" json:"outcome,omitempty"`
+	Source        string                 `protobuf:"bytes,8,opt,name=source,proto3" json:"source,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AuditEntry) Reset() {
+	*x = AuditEntry{}
+	mi := &file_proto_admin_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuditEntry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuditEntry) ProtoMessage() {}
+
+func (x *AuditEntry) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuditEntry.ProtoReflect.Descriptor instead.
+func (*AuditEntry) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AuditEntry) GetId() int64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetTimeUnix() int64 {
+	if x != nil {
+		return x.TimeUnix
+	}
+	return 0
+}
+
+func (x *AuditEntry) GetActor() string {
+	if x != nil {
+		return x.Actor
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetRole() string {
+	if x != nil {
+		return x.Role
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetOutcome() string {
+	if x != nil {
+		return x.Outcome
+	}
+	return ""
+}
+
+func (x *AuditEntry) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+type ListAuditLogResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Entries       []*AuditEntry          `protobuf:"bytes,1,rep,name=entries,proto3" json:"entries,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListAuditLogResponse) Reset() {
+	*x = ListAuditLogResponse{}
+	mi := &file_proto_admin_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListAuditLogResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListAuditLogResponse) ProtoMessage() {}
+
+func (x *ListAuditLogResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListAuditLogResponse.ProtoReflect.Descriptor instead.
+func (*ListAuditLogResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ListAuditLogResponse) GetEntries() []*AuditEntry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+type ReloadConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReloadConfigRequest) Reset() {
+	*x = ReloadConfigRequest{}
+	mi := &file_proto_admin_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadConfigRequest) ProtoMessage() {}
+
+func (x *ReloadConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadConfigRequest.ProtoReflect.Descriptor instead.
+func (*ReloadConfigRequest) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{9}
+}
+
+type ReloadConfigResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Settings that changed and took effect.
+	Applied []string `protobuf:"bytes,1,rep,name=applied,proto3" json:"applied,omitempty"`
+	// Settings that changed but only take effect after a restart.
+	RestartRequired []string `protobuf:"bytes,2,rep,name=restart_required,json=restartRequired,proto3" json:"restart_required,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ReloadConfigResponse) Reset() {
+	*x = ReloadConfigResponse{}
+	mi := &file_proto_admin_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadConfigResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadConfigResponse) ProtoMessage() {}
+
+func (x *ReloadConfigResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_admin_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadConfigResponse.ProtoReflect.Descriptor instead.
+func (*ReloadConfigResponse) Descriptor() ([]byte, []int) {
+	return file_proto_admin_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ReloadConfigResponse) GetApplied() []string {
+	if x != nil {
+		return x.Applied
+	}
+	return nil
+}
+
+func (x *ReloadConfigResponse) GetRestartRequired() []string {
+	if x != nil {
+		return x.RestartRequired
+	}
+	return nil
+}
+
 var File_proto_admin_proto protoreflect.FileDescriptor
 
 const file_proto_admin_proto_rawDesc = "" +
@@ -293,12 +587,35 @@ const file_proto_admin_proto_rawDesc = "" +
 	"\x13migrated_file_count\x18\x01 \x01(\x05R\x11migratedFileCount\"\x12\n" +
 	"\x10ListNodesRequest\")\n" +
 	"\x11ListNodesResponse\x12\x14\n" +
-	"\x05nodes\x18\x01 \x03(\tR\x05nodes2\xf5\x01\n" +
+	"\x05nodes\x18\x01 \x03(\tR\x05nodes\"`\n" +
+	"\x13ListAuditLogRequest\x12\x14\n" +
+	"\x05limit\x18\x01 \x01(\x05R\x05limit\x12\x14\n" +
+	"\x05actor\x18\x02 \x01(\tR\x05actor\x12\x1d\n" +
+	"\n" +
+	"since_unix\x18\x03 \x01(\x03R\tsinceUnix\"\xc5\x01\n" +
+	"\n" +
+	"AuditEntry\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x03R\x02id\x12\x1b\n" +
+	"\ttime_unix\x18\x02 \x01(\x03R\btimeUnix\x12\x14\n" +
+	"\x05actor\x18\x03 \x01(\tR\x05actor\x12\x12\n" +
+	"\x04role\x18\x04 \x01(\tR\x04role\x12\x16\n" +
+	"\x06action\x18\x05 \x01(\tR\x06action\x12\x16\n" +
+	"\x06target\x18\x06 \x01(\tR\x06target\x12\x18\n" +
+	"\aoutcome\x18\a \x01(\tR\aoutcome\x12\x16\n" +
+	"\x06source\x18\b \x01(\tR\x06source\"H\n" +
+	"\x14ListAuditLogResponse\x120\n" +
+	"\aentries\x18\x01 \x03(\v2\x16.tritontube.AuditEntryR\aentries\"\x15\n" +
+	"\x13ReloadConfigRequest\"[\n" +
+	"\x14ReloadConfigResponse\x12\x18\n" +
+	"\aapplied\x18\x01 \x03(\tR\aapplied\x12)\n" +
+	"\x10restart_required\x18\x02 \x03(\tR\x0frestartRequired2\x9b\x03\n" +
 	"\x18VideoContentAdminService\x12B\n" +
 	"\aAddNode\x12\x1a.tritontube.AddNodeRequest\x1a\x1b.tritontube.AddNodeResponse\x12K\n" +
 	"\n" +
 	"RemoveNode\x12\x1d.tritontube.RemoveNodeRequest\x1a\x1e.tritontube.RemoveNodeResponse\x12H\n" +
-	"\tListNodes\x12\x1c.tritontube.ListNodesRequest\x1a\x1d.tritontube.ListNodesResponseB\x16Z\x14internal/proto;protob\x06proto3"
+	"\tListNodes\x12\x1c.tritontube.ListNodesRequest\x1a\x1d.tritontube.ListNodesResponse\x12Q\n" +
+	"\fListAuditLog\x12\x1f.tritontube.ListAuditLogRequest\x1a .tritontube.ListAuditLogResponse\x12Q\n" +
+	"\fReloadConfig\x12\x1f.tritontube.ReloadConfigRequest\x1a .tritontube.ReloadConfigResponseB\x16Z\x14internal/proto;protob\x06proto3"
 
 var (
 	file_proto_admin_proto_rawDescOnce sync.Once
@@ -312,27 +629,37 @@ func file_proto_admin_proto_rawDescGZIP() []byte {
 	return file_proto_admin_proto_rawDescData
 }
 
-var file_proto_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_proto_admin_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_proto_admin_proto_goTypes = []any{
-	(*AddNodeRequest)(nil),     // 0: tritontube.AddNodeRequest
-	(*AddNodeResponse)(nil),    // 1: tritontube.AddNodeResponse
-	(*RemoveNodeRequest)(nil),  // 2: tritontube.RemoveNodeRequest
-	(*RemoveNodeResponse)(nil), // 3: tritontube.RemoveNodeResponse
-	(*ListNodesRequest)(nil),   // 4: tritontube.ListNodesRequest
-	(*ListNodesResponse)(nil),  // 5: tritontube.ListNodesResponse
+	(*AddNodeRequest)(nil),       // 0: tritontube.AddNodeRequest
+	(*AddNodeResponse)(nil),      // 1: tritontube.AddNodeResponse
+	(*RemoveNodeRequest)(nil),    // 2: tritontube.RemoveNodeRequest
+	(*RemoveNodeResponse)(nil),   // 3: tritontube.RemoveNodeResponse
+	(*ListNodesRequest)(nil),     // 4: tritontube.ListNodesRequest
+	(*ListNodesResponse)(nil),    // 5: tritontube.ListNodesResponse
+	(*ListAuditLogRequest)(nil),  // 6: tritontube.ListAuditLogRequest
+	(*AuditEntry)(nil),           // 7: tritontube.AuditEntry
+	(*ListAuditLogResponse)(nil), // 8: tritontube.ListAuditLogResponse
+	(*ReloadConfigRequest)(nil),  // 9: tritontube.ReloadConfigRequest
+	(*ReloadConfigResponse)(nil), // 10: tritontube.ReloadConfigResponse
 }
 var file_proto_admin_proto_depIdxs = []int32{
-	0, // 0: tritontube.VideoContentAdminService.AddNode:input_type -> tritontube.AddNodeRequest
-	2, // 1: tritontube.VideoContentAdminService.RemoveNode:input_type -> tritontube.RemoveNodeRequest
-	4, // 2: tritontube.VideoContentAdminService.ListNodes:input_type -> tritontube.ListNodesRequest
-	1, // 3: tritontube.VideoContentAdminService.AddNode:output_type -> tritontube.AddNodeResponse
-	3, // 4: tritontube.VideoContentAdminService.RemoveNode:output_type -> tritontube.RemoveNodeResponse
-	5, // 5: tritontube.VideoContentAdminService.ListNodes:output_type -> tritontube.ListNodesResponse
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	7,  // 0: tritontube.ListAuditLogResponse.entries:type_name -> tritontube.AuditEntry
+	0,  // 1: tritontube.VideoContentAdminService.AddNode:input_type -> tritontube.AddNodeRequest
+	2,  // 2: tritontube.VideoContentAdminService.RemoveNode:input_type -> tritontube.RemoveNodeRequest
+	4,  // 3: tritontube.VideoContentAdminService.ListNodes:input_type -> tritontube.ListNodesRequest
+	6,  // 4: tritontube.VideoContentAdminService.ListAuditLog:input_type -> tritontube.ListAuditLogRequest
+	9,  // 5: tritontube.VideoContentAdminService.ReloadConfig:input_type -> tritontube.ReloadConfigRequest
+	1,  // 6: tritontube.VideoContentAdminService.AddNode:output_type -> tritontube.AddNodeResponse
+	3,  // 7: tritontube.VideoContentAdminService.RemoveNode:output_type -> tritontube.RemoveNodeResponse
+	5,  // 8: tritontube.VideoContentAdminService.ListNodes:output_type -> tritontube.ListNodesResponse
+	8,  // 9: tritontube.VideoContentAdminService.ListAuditLog:output_type -> tritontube.ListAuditLogResponse
+	10, // 10: tritontube.VideoContentAdminService.ReloadConfig:output_type -> tritontube.ReloadConfigResponse
+	6,  // [6:11] is the sub-list for method output_type
+	1,  // [1:6] is the sub-list for method input_type
+	1,  // [1:1] is the sub-list for extension type_name
+	1,  // [1:1] is the sub-list for extension extendee
+	0,  // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_proto_admin_proto_init() }
@@ -346,7 +673,7 @@ func file_proto_admin_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_admin_proto_rawDesc), len(file_proto_admin_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,9 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	VideoContentAdminService_AddNode_FullMethodName    = "/tritontube.VideoContentAdminService/AddNode"
-	VideoContentAdminService_RemoveNode_FullMethodName = "/tritontube.VideoContentAdminService/RemoveNode"
-	VideoContentAdminService_ListNodes_FullMethodName  = "/tritontube.VideoContentAdminService/ListNodes"
+	VideoContentAdminService_AddNode_FullMethodName      = "/tritontube.VideoContentAdminService/AddNode"
+	VideoContentAdminService_RemoveNode_FullMethodName   = "/tritontube.VideoContentAdminService/RemoveNode"
+	VideoContentAdminService_ListNodes_FullMethodName    = "/tritontube.VideoContentAdminService/ListNodes"
+	VideoContentAdminService_ListAuditLog_FullMethodName = "/tritontube.VideoContentAdminService/ListAuditLog"
+	VideoContentAdminService_ReloadConfig_FullMethodName = "/tritontube.VideoContentAdminService/ReloadConfig"
 )
 
 // VideoContentAdminServiceClient is the client API for VideoContentAdminService service.
@@ -31,6 +33,8 @@ type VideoContentAdminServiceClient interface {
 	AddNode(ctx context.Context, in *AddNodeRequest, opts ...grpc.CallOption) (*AddNodeResponse, error)
 	RemoveNode(ctx context.Context, in *RemoveNodeRequest, opts ...grpc.CallOption) (*RemoveNodeResponse, error)
 	ListNodes(ctx context.Context, in *ListNodesRequest, opts ...grpc.CallOption) (*ListNodesResponse, error)
+	ListAuditLog(ctx context.Context, in *ListAuditLogRequest, opts ...grpc.CallOption) (*ListAuditLogResponse, error)
+	ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error)
 }
 
 type videoContentAdminServiceClient struct {
@@ -71,6 +75,26 @@ func (c *videoContentAdminServiceClient) ListNodes(ctx context.Context, in *List
 	return out, nil
 }
 
+func (c *videoContentAdminServiceClient) ListAuditLog(ctx context.Context, in *ListAuditLogRequest, opts ...grpc.CallOption) (*ListAuditLogResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListAuditLogResponse)
+	err := c.cc.Invoke(ctx, VideoContentAdminService_ListAuditLog_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoContentAdminServiceClient) ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReloadConfigResponse)
+	err := c.cc.Invoke(ctx, VideoContentAdminService_ReloadConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // VideoContentAdminServiceServer is the server API for VideoContentAdminService service.
 // All implementations must embed UnimplementedVideoContentAdminServiceServer
 // for forward compatibility.
@@ -78,6 +102,8 @@ type VideoContentAdminServiceServer interface {
 	AddNode(context.Context, *AddNodeRequest) (*AddNodeResponse, error)
 	RemoveNode(context.Context, *RemoveNodeRequest) (*RemoveNodeResponse, error)
 	ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error)
+	ListAuditLog(context.Context, *ListAuditLogRequest) (*ListAuditLogResponse, error)
+	ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error)
 	mustEmbedUnimplementedVideoContentAdminServiceServer()
 }
 
@@ -97,6 +123,12 @@ func (UnimplementedVideoContentAdminServiceServer) RemoveNode(context.Context, *
 func (UnimplementedVideoContentAdminServiceServer) ListNodes(context.Context, *ListNodesRequest) (*ListNodesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListNodes not implemented")
 }
+func (UnimplementedVideoContentAdminServiceServer) ListAuditLog(context.Context, *ListAuditLogRequest) (*ListAuditLogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAuditLog not implemented")
+}
+func (UnimplementedVideoContentAdminServiceServer) ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadConfig not implemented")
+}
 func (UnimplementedVideoContentAdminServiceServer) mustEmbedUnimplementedVideoContentAdminServiceServer() {
 }
 func (UnimplementedVideoContentAdminServiceServer) testEmbeddedByValue() {}
@@ -173,6 +205,42 @@ func _VideoContentAdminService_ListNodes_Handler(srv interface{}, ctx context.Co
 	return interceptor(ctx, in, info, handler)
 }
 
+func _VideoContentAdminService_ListAuditLog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAuditLogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentAdminServiceServer).ListAuditLog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentAdminService_ListAuditLog_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentAdminServiceServer).ListAuditLog(ctx, req.(*ListAuditLogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoContentAdminService_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentAdminServiceServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentAdminService_ReloadConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentAdminServiceServer).ReloadConfig(ctx, req.(*ReloadConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // VideoContentAdminService_ServiceDesc is the grpc.ServiceDesc for VideoContentAdminService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -192,6 +260,14 @@ var VideoContentAdminService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListNodes",
 			Handler:    _VideoContentAdminService_ListNodes_Handler,
 		},
+		{
+			MethodName: "ListAuditLog",
+			Handler:    _VideoContentAdminService_ListAuditLog_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _VideoContentAdminService_ReloadConfig_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/admin.proto",
@@ -449,6 +449,129 @@ func (x *DeleteFileResponse) GetSuccess() bool {
 	return false
 }
 
+type AppendRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	VideoId  string                 `protobuf:"bytes,1,opt,name=video_id,json=videoId,proto3" json:"video_id,omitempty"`
+	Filename string                 `protobuf:"bytes,2,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Where data goes. The file is cut there first, so offset 0 starts it
+	// over and retrying an append does no harm.
+	Offset int64  `protobuf:"varint,3,opt,name=offset,proto3" json:"offset,omitempty"`
+	Data   []byte `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	// Marks the end of the file; readers following it stop.
+	Complete      bool `protobuf:"varint,5,opt,name=complete,proto3" json:"complete,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendRequest) Reset() {
+	*x = AppendRequest{}
+	mi := &file_proto_storage_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendRequest) ProtoMessage() {}
+
+func (x *AppendRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendRequest.ProtoReflect.Descriptor instead.
+func (*AppendRequest) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *AppendRequest) GetVideoId() string {
+	if x != nil {
+		return x.VideoId
+	}
+	return ""
+}
+
+func (x *AppendRequest) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *AppendRequest) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *AppendRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *AppendRequest) GetComplete() bool {
+	if x != nil {
+		return x.Complete
+	}
+	return false
+}
+
+type AppendResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Size          int64                  `protobuf:"varint,1,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AppendResponse) Reset() {
+	*x = AppendResponse{}
+	mi := &file_proto_storage_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AppendResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AppendResponse) ProtoMessage() {}
+
+func (x *AppendResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_storage_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AppendResponse.ProtoReflect.Descriptor instead.
+func (*AppendResponse) Descriptor() ([]byte, []int) {
+	return file_proto_storage_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *AppendResponse) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
 var File_proto_storage_proto protoreflect.FileDescriptor
 
 const file_proto_storage_proto_rawDesc = "" +
@@ -476,13 +599,24 @@ const file_proto_storage_proto_rawDesc = "" +
 	"\bvideo_id\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
 	"\bfilename\x18\x02 \x01(\tR\bfilename\".\n" +
 	"\x12DeleteFileResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess2\xac\x02\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\"\x8e\x01\n" +
+	"\rAppendRequest\x12\x19\n" +
+	"\bvideo_id\x18\x01 \x01(\tR\avideoId\x12\x1a\n" +
+	"\bfilename\x18\x02 \x01(\tR\bfilename\x12\x16\n" +
+	"\x06offset\x18\x03 \x01(\x03R\x06offset\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\fR\x04data\x12\x1a\n" +
+	"\bcomplete\x18\x05 \x01(\bR\bcomplete\"$\n" +
+	"\x0eAppendResponse\x12\x12\n" +
+	"\x04size\x18\x01 \x01(\x03R\x04size2\xb0\x03\n" +
 	"\x1aVideoContentStorageService\x12<\n" +
 	"\x05Write\x12\x18.tritontube.WriteRequest\x1a\x19.tritontube.WriteResponse\x129\n" +
 	"\x04Read\x12\x17.tritontube.ReadRequest\x1a\x18.tritontube.ReadResponse\x12H\n" +
 	"\tListFiles\x12\x1c.tritontube.ListFilesRequest\x1a\x1d.tritontube.ListFilesResponse\x12K\n" +
 	"\n" +
-	"DeleteFile\x12\x1d.tritontube.DeleteFileRequest\x1a\x1e.tritontube.DeleteFileResponseB\x16Z\x14internal/proto;protob\x06proto3"
+	"DeleteFile\x12\x1d.tritontube.DeleteFileRequest\x1a\x1e.tritontube.DeleteFileResponse\x12?\n" +
+	"\x06Append\x12\x19.tritontube.AppendRequest\x1a\x1a.tritontube.AppendResponse\x12A\n" +
+	"\n" +
+	"ReadStream\x12\x17.tritontube.ReadRequest\x1a\x18.tritontube.ReadResponse0\x01B\x16Z\x14internal/proto;protob\x06proto3"
 
 var (
 	file_proto_storage_proto_rawDescOnce sync.Once
@@ -496,7 +630,7 @@ func file_proto_storage_proto_rawDescGZIP() []byte {
 	return file_proto_storage_proto_rawDescData
 }
 
-var file_proto_storage_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_proto_storage_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_proto_storage_proto_goTypes = []any{
 	(*WriteRequest)(nil),       // 0: tritontube.WriteRequest
 	(*WriteResponse)(nil),      // 1: tritontube.WriteResponse
@@ -507,22 +641,28 @@ var file_proto_storage_proto_goTypes = []any{
 	(*FileInfo)(nil),           // 6: tritontube.FileInfo
 	(*DeleteFileRequest)(nil),  // 7: tritontube.DeleteFileRequest
 	(*DeleteFileResponse)(nil), // 8: tritontube.DeleteFileResponse
+	(*AppendRequest)(nil),      // 9: tritontube.AppendRequest
+	(*AppendResponse)(nil),     // 10: tritontube.AppendResponse
 }
 var file_proto_storage_proto_depIdxs = []int32{
-	6, // 0: tritontube.ListFilesResponse.files:type_name -> tritontube.FileInfo
-	0, // 1: tritontube.VideoContentStorageService.Write:input_type -> tritontube.WriteRequest
-	2, // 2: tritontube.VideoContentStorageService.Read:input_type -> tritontube.ReadRequest
-	4, // 3: tritontube.VideoContentStorageService.ListFiles:input_type -> tritontube.ListFilesRequest
-	7, // 4: tritontube.VideoContentStorageService.DeleteFile:input_type -> tritontube.DeleteFileRequest
-	1, // 5: tritontube.VideoContentStorageService.Write:output_type -> tritontube.WriteResponse
-	3, // 6: tritontube.VideoContentStorageService.Read:output_type -> tritontube.ReadResponse
-	5, // 7: tritontube.VideoContentStorageService.ListFiles:output_type -> tritontube.ListFilesResponse
-	8, // 8: tritontube.VideoContentStorageService.DeleteFile:output_type -> tritontube.DeleteFileResponse
-	5, // [5:9] is the sub-list for method output_type
-	1, // [1:5] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	6,  // 0: tritontube.ListFilesResponse.files:type_name -> tritontube.FileInfo
+	0,  // 1: tritontube.VideoContentStorageService.Write:input_type -> tritontube.WriteRequest
+	2,  // 2: tritontube.VideoContentStorageService.Read:input_type -> tritontube.ReadRequest
+	4,  // 3: tritontube.VideoContentStorageService.ListFiles:input_type -> tritontube.ListFilesRequest
+	7,  // 4: tritontube.VideoContentStorageService.DeleteFile:input_type -> tritontube.DeleteFileRequest
+	9,  // 5: tritontube.VideoContentStorageService.Append:input_type -> tritontube.AppendRequest
+	2,  // 6: tritontube.VideoContentStorageService.ReadStream:input_type -> tritontube.ReadRequest
+	1,  // 7: tritontube.VideoContentStorageService.Write:output_type -> tritontube.WriteResponse
+	3,  // 8: tritontube.VideoContentStorageService.Read:output_type -> tritontube.ReadResponse
+	5,  // 9: tritontube.VideoContentStorageService.ListFiles:output_type -> tritontube.ListFilesResponse
+	8,  // 10: tritontube.VideoContentStorageService.DeleteFile:output_type -> tritontube.DeleteFileResponse
+	10, // 11: tritontube.VideoContentStorageService.Append:output_type -> tritontube.AppendResponse
+	3,  // 12: tritontube.VideoContentStorageService.ReadStream:output_type -> tritontube.ReadResponse
+	7,  // [7:13] is the sub-list for method output_type
+	1,  // [1:7] is the sub-list for method input_type
+	1,  // [1:1] is the sub-list for extension type_name
+	1,  // [1:1] is the sub-list for extension extendee
+	0,  // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_proto_storage_proto_init() }
@@ -536,7 +676,7 @@ func file_proto_storage_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_storage_proto_rawDesc), len(file_proto_storage_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   9,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
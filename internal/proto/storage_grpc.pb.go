@@ -23,6 +23,8 @@ const (
 	VideoContentStorageService_Read_FullMethodName       = "/tritontube.VideoContentStorageService/Read"
 	VideoContentStorageService_ListFiles_FullMethodName  = "/tritontube.VideoContentStorageService/ListFiles"
 	VideoContentStorageService_DeleteFile_FullMethodName = "/tritontube.VideoContentStorageService/DeleteFile"
+	VideoContentStorageService_Append_FullMethodName     = "/tritontube.VideoContentStorageService/Append"
+	VideoContentStorageService_ReadStream_FullMethodName = "/tritontube.VideoContentStorageService/ReadStream"
 )
 
 // VideoContentStorageServiceClient is the client API for VideoContentStorageService service.
@@ -33,6 +35,11 @@ type VideoContentStorageServiceClient interface {
 	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (*ReadResponse, error)
 	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error)
 	DeleteFile(ctx context.Context, in *DeleteFileRequest, opts ...grpc.CallOption) (*DeleteFileResponse, error)
+	// Append writes part of a file that readers may follow as it grows.
+	Append(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendResponse, error)
+	// ReadStream sends a file, then whatever is appended to it until it is
+	// complete.
+	ReadStream(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReadResponse], error)
 }
 
 type videoContentStorageServiceClient struct {
@@ -83,6 +90,35 @@ func (c *videoContentStorageServiceClient) DeleteFile(ctx context.Context, in *D
 	return out, nil
 }
 
+func (c *videoContentStorageServiceClient) Append(ctx context.Context, in *AppendRequest, opts ...grpc.CallOption) (*AppendResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AppendResponse)
+	err := c.cc.Invoke(ctx, VideoContentStorageService_Append_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *videoContentStorageServiceClient) ReadStream(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ReadResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &VideoContentStorageService_ServiceDesc.Streams[0], VideoContentStorageService_ReadStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ReadRequest, ReadResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoContentStorageService_ReadStreamClient = grpc.ServerStreamingClient[ReadResponse]
+
 // VideoContentStorageServiceServer is the server API for VideoContentStorageService service.
 // All implementations must embed UnimplementedVideoContentStorageServiceServer
 // for forward compatibility.
@@ -91,6 +127,11 @@ type VideoContentStorageServiceServer interface {
 	Read(context.Context, *ReadRequest) (*ReadResponse, error)
 	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error)
 	DeleteFile(context.Context, *DeleteFileRequest) (*DeleteFileResponse, error)
+	// Append writes part of a file that readers may follow as it grows.
+	Append(context.Context, *AppendRequest) (*AppendResponse, error)
+	// ReadStream sends a file, then whatever is appended to it until it is
+	// complete.
+	ReadStream(*ReadRequest, grpc.ServerStreamingServer[ReadResponse]) error
 	mustEmbedUnimplementedVideoContentStorageServiceServer()
 }
 
@@ -113,6 +154,12 @@ func (UnimplementedVideoContentStorageServiceServer) ListFiles(context.Context,
 func (UnimplementedVideoContentStorageServiceServer) DeleteFile(context.Context, *DeleteFileRequest) (*DeleteFileResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DeleteFile not implemented")
 }
+func (UnimplementedVideoContentStorageServiceServer) Append(context.Context, *AppendRequest) (*AppendResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Append not implemented")
+}
+func (UnimplementedVideoContentStorageServiceServer) ReadStream(*ReadRequest, grpc.ServerStreamingServer[ReadResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ReadStream not implemented")
+}
 func (UnimplementedVideoContentStorageServiceServer) mustEmbedUnimplementedVideoContentStorageServiceServer() {
 }
 func (UnimplementedVideoContentStorageServiceServer) testEmbeddedByValue() {}
@@ -207,6 +254,35 @@ func _VideoContentStorageService_DeleteFile_Handler(srv interface{}, ctx context
 	return interceptor(ctx, in, info, handler)
 }
 
+func _VideoContentStorageService_Append_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AppendRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(VideoContentStorageServiceServer).Append(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: VideoContentStorageService_Append_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(VideoContentStorageServiceServer).Append(ctx, req.(*AppendRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _VideoContentStorageService_ReadStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(VideoContentStorageServiceServer).ReadStream(m, &grpc.GenericServerStream[ReadRequest, ReadResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type VideoContentStorageService_ReadStreamServer = grpc.ServerStreamingServer[ReadResponse]
+
 // VideoContentStorageService_ServiceDesc is the grpc.ServiceDesc for VideoContentStorageService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -230,7 +306,17 @@ var VideoContentStorageService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteFile",
 			Handler:    _VideoContentStorageService_DeleteFile_Handler,
 		},
+		{
+			MethodName: "Append",
+			Handler:    _VideoContentStorageService_Append_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReadStream",
+			Handler:       _VideoContentStorageService_ReadStream_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/storage.proto",
 }
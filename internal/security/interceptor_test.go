@@ -0,0 +1,52 @@
+package security
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// peerContext returns the context of a call from a client that proved name
+// with a verified certificate, or from an anonymous client if name is empty.
+func peerContext(name string) context.Context {
+	p := &peer.Peer{}
+	if name != "" {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: name}}
+		p.AuthInfo = credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+	}
+	return peer.NewContext(context.Background(), p)
+}
+
+func TestAuthorizer(t *testing.T) {
+	const method = "/tritontube.VideoContentStorageService/Write"
+	tests := []struct {
+		name       string
+		allowed    []string
+		requireTLS bool
+		client     string
+		method     string
+		want       codes.Code
+	}{
+		{"allowed client", []string{"web"}, true, "web", method, codes.OK},
+		{"other client", []string{"web"}, true, "stranger", method, codes.PermissionDenied},
+		{"no allowed clients", nil, true, "web", method, codes.PermissionDenied},
+		{"anonymous with TLS", []string{"web"}, true, "", method, codes.Unauthenticated},
+		{"anonymous without TLS", nil, false, "", method, codes.OK},
+		{"unguarded method", nil, true, "stranger", "/grpc.health.v1.Health/Check", codes.OK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &Authorizer{Prefix: "/tritontube.VideoContentStorageService/", Allowed: test.allowed, RequireTLS: test.requireTLS}
+			if got := status.Code(a.authorize(peerContext(test.client), test.method)); got != test.want {
+				t.Errorf("code = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Role is a level of privilege; each role includes the ones below it.
+type Role int
+
+const (
+	RoleNone     Role = iota
+	RoleViewer        // read-only cluster access; manages only their own content
+	RoleOperator      // changes cluster membership and moderates content
+	RoleAdmin         // everything, including audit logs and user roles
+)
+
+var roleNames = []string{"none", "viewer", "operator", "admin"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+	return roleNames[r]
+}
+
+// ParseRole parses a role name as produced by Role.String.
+func ParseRole(name string) (Role, error) {
+	for i, roleName := range roleNames {
+		if strings.EqualFold(name, roleName) {
+			return Role(i), nil
+		}
+	}
+	return RoleNone, fmt.Errorf("unknown role %q", name)
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler using ParseRole.
+func (r *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// ParseRoleMap parses "identity=role,identity=role" into a map.
+func ParseRoleMap(list string) (map[string]Role, error) {
+	roles := make(map[string]Role)
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		identity, roleName, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid role mapping %q, want identity=role", entry)
+		}
+		role, err := ParseRole(strings.TrimSpace(roleName))
+		if err != nil {
+			return nil, err
+		}
+		roles[strings.TrimSpace(identity)] = role
+	}
+	return roles, nil
+}
+
+// AuditRecord describes one authorization decision of the RBAC interceptor.
+type AuditRecord struct {
+	Actor  string
+	Role   Role
+	Method string
+	Target string // e.g. the node address of AddNode/RemoveNode
+	Source string // network address of the caller
+	Err    error  // nil if the call was allowed and succeeded
+}
+
+// RBAC authorizes gRPC calls by the role of the caller. The caller is
+// identified by a bearer token in the "authorization" metadata if present,
+// otherwise by its verified client certificate.
+type RBAC struct {
+	// Prefix selects the full method names the interceptor guards.
+	Prefix string
+	// MethodRoles gives the role each guarded method requires. Methods not
+	// listed require RoleAdmin.
+	MethodRoles map[string]Role
+	// Identities maps certificate names to roles. Verified clients whose
+	// certificate names none of them get CertificateRole.
+	Identities      map[string]Role
+	CertificateRole Role
+	// ResolveToken maps a bearer token to an actor name and role. May be nil.
+	ResolveToken func(ctx context.Context, token string) (actor string, role Role, err error)
+	// AnonymousRole is granted to callers with neither a token nor a
+	// verified certificate (only sensible when TLS is disabled).
+	AnonymousRole Role
+	// Audit, if set, is called for every denied call and every allowed call
+	// requiring more than RoleViewer.
+	Audit func(ctx context.Context, record AuditRecord)
+}
+
+// caller identifies the actor behind ctx and their role.
+func (a *RBAC) caller(ctx context.Context) (string, Role, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token, ok := strings.CutPrefix(values[0], "Bearer ")
+			if !ok || a.ResolveToken == nil {
+				return "", RoleNone, status.Error(codes.Unauthenticated, "unsupported authorization")
+			}
+			actor, role, err := a.ResolveToken(ctx, strings.TrimSpace(token))
+			if err != nil {
+				return "", RoleNone, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+			}
+			return actor, role, nil
+		}
+	}
+
+	identities := PeerIdentities(ctx)
+	if len(identities) == 0 {
+		return "anonymous", a.AnonymousRole, nil
+	}
+	actor, best, mapped := identities[0], RoleNone, false
+	for _, identity := range identities {
+		if role, ok := a.Identities[identity]; ok && (!mapped || role > best) {
+			actor, best, mapped = identity, role, true
+		}
+	}
+	if !mapped {
+		best = a.CertificateRole
+	}
+	return actor, best, nil
+}
+
+func (a *RBAC) authorize(ctx context.Context, method string, req any) (func(error), error) {
+	if !strings.HasPrefix(method, a.Prefix) {
+		return func(error) {}, nil
+	}
+
+	required, ok := a.MethodRoles[method]
+	if !ok {
+		required = RoleAdmin
+	}
+
+	record := AuditRecord{Method: method}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		record.Source = p.Addr.String()
+	}
+	if t, ok := req.(interface{ GetNodeAddress() string }); ok {
+		record.Target = t.GetNodeAddress()
+	}
+	audit := func(err error) {
+		if a.Audit != nil && (err != nil || required > RoleViewer) {
+			record.Err = err
+			a.Audit(ctx, record)
+		}
+	}
+
+	actor, role, err := a.caller(ctx)
+	record.Actor, record.Role = actor, role
+	if err != nil {
+		audit(err)
+		return nil, err
+	}
+	if role < required {
+		err := status.Errorf(codes.PermissionDenied, "%s has role %s, %s requires %s", actor, role, method, required)
+		audit(err)
+		return nil, err
+	}
+	return audit, nil
+}
+
+// UnaryInterceptor authorizes and audits each unary call.
+func (a *RBAC) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		done, err := a.authorize(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// StreamInterceptor authorizes and audits each streaming call.
+func (a *RBAC) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		done, err := a.authorize(ss.Context(), info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		err = handler(srv, ss)
+		done(err)
+		return err
+	}
+}
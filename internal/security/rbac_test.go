@@ -0,0 +1,189 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The health service stands in for a guarded API: Check needs an operator.
+const checkMethod = "/grpc.health.v1.Health/Check"
+
+// auditLog collects the records of an RBAC.
+type auditLog struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+func (l *auditLog) add(_ context.Context, record AuditRecord) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, record)
+}
+
+func (l *auditLog) last() AuditRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.records) == 0 {
+		return AuditRecord{}
+	}
+	return l.records[len(l.records)-1]
+}
+
+// serveRBAC serves the health service guarded by rbac with creds and
+// returns its address.
+func serveRBAC(t *testing.T, rbac *RBAC, creds credentials.TransportCredentials) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(creds), grpc.UnaryInterceptor(rbac.UnaryInterceptor()))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// check calls the guarded method, with a bearer token if token is set.
+func check(t *testing.T, addr string, creds credentials.TransportCredentials, token string) error {
+	t.Helper()
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	return err
+}
+
+func newTestRBAC(audit *auditLog) *RBAC {
+	return &RBAC{
+		Prefix:      "/grpc.health.v1.Health/",
+		MethodRoles: map[string]Role{checkMethod: RoleOperator},
+		Identities:  map[string]Role{"ops": RoleOperator, "dashboard": RoleViewer},
+		ResolveToken: func(_ context.Context, token string) (string, Role, error) {
+			if token == "operator-token" {
+				return "alice", RoleOperator, nil
+			}
+			return "", RoleNone, errors.New("unknown token")
+		},
+		Audit: audit.add,
+	}
+}
+
+func TestRBACOverMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCreds, err := ServerCredentials(ca.issue(t, "web"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	audit := &auditLog{}
+	addr := serveRBAC(t, newTestRBAC(audit), serverCreds)
+
+	clientCreds := func(name string) credentials.TransportCredentials {
+		creds, err := ClientCredentials(ca.issue(t, name), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return creds
+	}
+
+	tests := []struct {
+		name   string
+		client string
+		token  string
+		want   codes.Code
+		actor  string
+	}{
+		{"mapped to the required role", "ops", "", codes.OK, "ops"},
+		{"mapped to a lower role", "dashboard", "", codes.PermissionDenied, "dashboard"},
+		{"signed by the CA but not mapped", "stranger", "", codes.PermissionDenied, "stranger"},
+		{"token of an operator", "dashboard", "operator-token", codes.OK, "alice"},
+		{"unknown token", "ops", "forged", codes.Unauthenticated, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := check(t, addr, clientCreds(test.client), test.token)
+			if got := status.Code(err); got != test.want {
+				t.Fatalf("code = %v (%v), want %v", got, err, test.want)
+			}
+			record := audit.last()
+			if record.Actor != test.actor || record.Method != checkMethod {
+				t.Errorf("audit record = %+v, want actor %q", record, test.actor)
+			}
+			if (record.Err == nil) != (test.want == codes.OK) {
+				t.Errorf("audit record error = %v, want code %v", record.Err, test.want)
+			}
+		})
+	}
+
+	t.Run("anonymous", func(t *testing.T) {
+		// Without a certificate the handshake fails before RBAC runs.
+		creds, err := ClientCredentials(TLSFiles{}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := check(t, addr, creds, ""); status.Code(err) != codes.Unavailable {
+			t.Errorf("code = %v (%v), want %v", status.Code(err), err, codes.Unavailable)
+		}
+	})
+}
+
+func TestRBACAnonymousWithoutTLS(t *testing.T) {
+	for _, test := range []struct {
+		role Role
+		want codes.Code
+	}{
+		{RoleNone, codes.PermissionDenied},
+		{RoleOperator, codes.OK},
+	} {
+		t.Run(test.role.String(), func(t *testing.T) {
+			rbac := newTestRBAC(&auditLog{})
+			rbac.AnonymousRole = test.role
+			addr := serveRBAC(t, rbac, insecure.NewCredentials())
+			if err := check(t, addr, insecure.NewCredentials(), ""); status.Code(err) != test.want {
+				t.Errorf("code = %v (%v), want %v", status.Code(err), err, test.want)
+			}
+		})
+	}
+}
+
+func TestRBACLeavesOtherServicesAlone(t *testing.T) {
+	rbac := newTestRBAC(&auditLog{})
+	rbac.Prefix = "/tritontube.VideoContentAdminService/"
+	addr := serveRBAC(t, rbac, insecure.NewCredentials())
+	if err := check(t, addr, insecure.NewCredentials(), ""); err != nil {
+		t.Errorf("unguarded method: %v", err)
+	}
+}
+
+func TestParseRoleMap(t *testing.T) {
+	roles, err := ParseRoleMap(" admin-cli = admin, dashboard=Viewer ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles["admin-cli"] != RoleAdmin || roles["dashboard"] != RoleViewer || len(roles) != 2 {
+		t.Errorf("ParseRoleMap = %v", roles)
+	}
+	for _, bad := range []string{"admin-cli", "admin-cli=root"} {
+		if _, err := ParseRoleMap(bad); err == nil {
+			t.Errorf("ParseRoleMap(%q) succeeded", bad)
+		}
+	}
+}
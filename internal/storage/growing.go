@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// GrowingIdleTimeout is how long a file may go without an append before it
+// counts as abandoned and readers following it stop.
+const GrowingIdleTimeout = 30 * time.Second
+
+// followChunkSize bounds the data sent to a follower at once.
+const followChunkSize = 256 << 10
+
+// ErrFileRestarted is returned to followers of a file that was started over
+// under them.
+var ErrFileRestarted = errors.New("file was started over")
+
+// GrowingFiles tracks files that are written by appends, so readers can
+// follow them as they grow. Its zero value is ready to use.
+type GrowingFiles struct {
+	mu    sync.Mutex
+	files map[string]*growingFile
+}
+
+type growingFile struct {
+	// changed is closed and replaced on every append.
+	changed chan struct{}
+	updated time.Time
+}
+
+// Append writes data at offset in the file at path, cutting the file there
+// first, and returns its new size. complete marks the file as done.
+func (g *GrowingFiles) Append(path string, offset int64, data []byte, complete bool) (int64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if offset < 0 || offset > info.Size() {
+		return 0, fmt.Errorf("offset %d is beyond the end of the file at %d", offset, info.Size())
+	}
+	if err := f.Truncate(offset); err != nil {
+		return 0, fmt.Errorf("failed to cut file: %w", err)
+	}
+	if _, err := f.WriteAt(data, offset); err != nil {
+		return 0, fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if g.files == nil {
+		g.files = make(map[string]*growingFile)
+	}
+	file := g.files[path]
+	if file == nil {
+		file = &growingFile{changed: make(chan struct{})}
+		g.files[path] = file
+	}
+	close(file.changed)
+	file.changed = make(chan struct{})
+	file.updated = time.Now()
+	if complete {
+		delete(g.files, path)
+	}
+	return offset + int64(len(data)), nil
+}
+
+// Complete marks the file at path as done, e.g. because it was written
+// whole or deleted.
+func (g *GrowingFiles) Complete(path string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if file := g.files[path]; file != nil {
+		close(file.changed)
+		delete(g.files, path)
+	}
+}
+
+// watch returns a channel closed on the next change to the file at path,
+// or nil if the file is not growing.
+func (g *GrowingFiles) watch(path string) <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	file := g.files[path]
+	if file == nil {
+		return nil
+	}
+	if time.Since(file.updated) > GrowingIdleTimeout {
+		close(file.changed)
+		delete(g.files, path)
+		return nil
+	}
+	return file.changed
+}
+
+// Follow passes the file at path to send in chunks, then what is appended
+// to it, until it is complete or ctx is done.
+func (g *GrowingFiles) Follow(ctx context.Context, path string, send func([]byte) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := make([]byte, followChunkSize)
+	var offset int64
+	for {
+		// Watch before reading, so an append after the read is not missed.
+		changed := g.watch(path)
+		for {
+			n, err := f.ReadAt(buf, offset)
+			if n > 0 {
+				if err := send(buf[:n]); err != nil {
+					return err
+				}
+				offset += int64(n)
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read file: %w", err)
+			}
+		}
+		if changed == nil {
+			return nil
+		}
+
+		idle := time.NewTimer(GrowingIdleTimeout)
+		select {
+		case <-changed:
+			idle.Stop()
+		case <-idle.C:
+		case <-ctx.Done():
+			idle.Stop()
+			return ctx.Err()
+		}
+		if info, err := f.Stat(); err == nil && info.Size() < offset {
+			return ErrFileRestarted
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// follow follows the file at path in the background and passes on what it
+// is sent, then the error Follow returned.
+func follow(ctx context.Context, g *GrowingFiles, path string) (<-chan string, <-chan error) {
+	chunks := make(chan string, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Follow(ctx, path, func(data []byte) error {
+			chunks <- string(data)
+			return nil
+		})
+	}()
+	return chunks, done
+}
+
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+		panic("unreachable")
+	}
+}
+
+func TestFollowGrowingFile(t *testing.T) {
+	var g GrowingFiles
+	path := filepath.Join(t.TempDir(), "video", "chunk-0-00001.m4s")
+	if size, err := g.Append(path, 0, []byte("moof"), false); err != nil || size != 4 {
+		t.Fatalf("Append = %d, %v", size, err)
+	}
+
+	chunks, done := follow(context.Background(), &g, path)
+	if got := receive(t, chunks); got != "moof" {
+		t.Errorf("first chunk = %q", got)
+	}
+	if _, err := g.Append(path, 4, []byte("mdat"), false); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, chunks); got != "mdat" {
+		t.Errorf("appended chunk = %q", got)
+	}
+	if _, err := g.Append(path, 8, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := receive(t, done); err != nil {
+		t.Errorf("Follow after completion: %v", err)
+	}
+
+	// A complete file is sent whole.
+	chunks, done = follow(context.Background(), &g, path)
+	if got := receive(t, chunks); got != "moofmdat" {
+		t.Errorf("complete file = %q", got)
+	}
+	if err := receive(t, done); err != nil {
+		t.Errorf("Follow of a complete file: %v", err)
+	}
+}
+
+func TestFollowStops(t *testing.T) {
+	var g GrowingFiles
+	dir := t.TempDir()
+
+	_, done := follow(context.Background(), &g, filepath.Join(dir, "missing.m4s"))
+	if err := receive(t, done); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Follow of a missing file: %v", err)
+	}
+
+	path := filepath.Join(dir, "chunk.m4s")
+	if _, err := g.Append(path, 0, []byte("first try"), false); err != nil {
+		t.Fatal(err)
+	}
+	chunks, done := follow(context.Background(), &g, path)
+	receive(t, chunks)
+	if _, err := g.Append(path, 0, []byte("again"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := receive(t, done); !errors.Is(err, ErrFileRestarted) {
+		t.Errorf("Follow of a restarted file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	chunks, done = follow(ctx, &g, path)
+	receive(t, chunks)
+	cancel()
+	if err := receive(t, done); !errors.Is(err, context.Canceled) {
+		t.Errorf("Follow after cancel: %v", err)
+	}
+
+	// Writing the file whole ends it as well.
+	chunks, done = follow(context.Background(), &g, path)
+	receive(t, chunks)
+	g.Complete(path)
+	if err := receive(t, done); err != nil {
+		t.Errorf("Follow after Complete: %v", err)
+	}
+}
+
+func TestAppendChecksOffset(t *testing.T) {
+	var g GrowingFiles
+	path := filepath.Join(t.TempDir(), "chunk.m4s")
+	if _, err := g.Append(path, 0, []byte("abc"), false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := g.Append(path, 4, []byte("e"), false); err == nil {
+		t.Errorf("Append past the end succeeded")
+	}
+	// A retried append overwrites what it wrote before.
+	if size, err := g.Append(path, 1, []byte("BC"), true); err != nil || size != 3 {
+		t.Fatalf("Append = %d, %v", size, err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "aBC" {
+		t.Errorf("file = %q", data)
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"tritontube/internal/security"
+)
+
+// ContentPathPrefix is where HTTPHandler serves files, as
+// ContentPathPrefix + videoId + "/" + filename.
+const ContentPathPrefix = "/content/"
+
+// ContentPath returns the escaped path HTTPHandler serves a file at, which
+// is also the path signed URLs are issued for. The handler signs the same
+// canonical form of the path whatever escaping the request used.
+func ContentPath(videoId, filename string) string {
+	return ContentPathPrefix + url.PathEscape(videoId) + "/" + url.PathEscape(filename)
+}
+
+// HTTPHandler serves the files of a storage node over plain HTTP to clients
+// holding a URL signed by the web server, so segment bytes need not pass
+// through it.
+func (s *StorageServer) HTTPHandler(signer security.URLSigner) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+ContentPathPrefix+"{videoId}/{filename}", func(w http.ResponseWriter, r *http.Request) {
+		// Players fetch segments from another origin than the page.
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		videoId, filename := r.PathValue("videoId"), r.PathValue("filename")
+		if !validName(videoId) || !validName(filename) {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		if err := signer.Verify(ContentPath(videoId, filename), r.URL.Query(), time.Now()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		f, err := os.Open(filepath.Join(s.BaseDir, videoId, filename))
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("Failed to open file", "video_id", videoId, "file", filename, "err", err)
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.Error(w, "Failed to read file", http.StatusInternalServerError)
+			return
+		}
+		// Segments do not change once written, but each player gets its own
+		// signed URL, so shared caches would gain nothing.
+		w.Header().Set("Cache-Control", "private, max-age=3600")
+		if strings.HasSuffix(filename, ".m4s") {
+			w.Header().Set("Content-Type", "video/mp4")
+		}
+		http.ServeContent(w, r, filename, info.ModTime(), f)
+	})
+	return mux
+}
+
+func validName(name string) bool {
+	return name != "" && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tritontube/internal/security"
+)
+
+func TestHTTPHandlerServesSignedURLs(t *testing.T) {
+	const videoId, filename = "my video?#%", "seg 1#?.m4s"
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, videoId), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, videoId, filename), []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	signer := security.URLSigner{Key: []byte("key")}
+	node := httptest.NewServer(NewStorageServer(dir, 0).HTTPHandler(signer))
+	defer node.Close()
+
+	path := ContentPath(videoId, filename)
+	if path != "/content/my%20video%3F%23%25/seg%201%23%3F.m4s" {
+		t.Errorf("ContentPath = %q", path)
+	}
+	get := func(url string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	query := signer.Sign(path, time.Now().Add(time.Minute))
+	if code, body := get(node.URL + path + "?" + query); code != http.StatusOK || body != "segment" {
+		t.Errorf("GET signed URL = %d, %q", code, body)
+	}
+	// Escaping characters that need none does not change the signed path.
+	if code, _ := get(node.URL + "/content/my%20vid%65o%3F%23%25/seg%201%23%3F.m4s?" + query); code != http.StatusOK {
+		t.Errorf("GET differently escaped URL = %d", code)
+	}
+	if code, _ := get(node.URL + ContentPath(videoId, "other.m4s") + "?" + query); code != http.StatusForbidden {
+		t.Errorf("GET with the signature of another file = %d", code)
+	}
+	expired := signer.Sign(path, time.Now().Add(-time.Minute))
+	if code, _ := get(node.URL + path + "?" + expired); code != http.StatusForbidden {
+		t.Errorf("GET expired URL = %d", code)
+	}
+}
@@ -4,24 +4,33 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
 	"tritontube/internal/proto"
+	"tritontube/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type StorageServer struct {
 	proto.UnimplementedVideoContentStorageServiceServer
 	BaseDir string
+
+	growing GrowingFiles
 }
 
 func NewStorageServer(baseDir string, port int) *StorageServer {
 	storageDir := filepath.Join(baseDir)
 	err := os.MkdirAll(storageDir, 0755)
 	if err != nil {
-		log.Printf("Warning: Failed to create storage directory: %v", err)
+		slog.Warn("Failed to create storage directory", "dir", storageDir, "err", err)
 	}
 	return &StorageServer{
 		BaseDir: baseDir,
@@ -37,17 +46,39 @@ func (s *StorageServer) Write(ctx context.Context, req *proto.WriteRequest) (*pr
 	}
 
 	filePath := filepath.Join(videoDir, req.Filename)
+	_, span := tracing.Start(ctx, "disk.write", trace.WithAttributes(attribute.Int("file.size", len(req.Data))))
 	err = os.WriteFile(filePath, req.Data, 0644)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write file: %w", err)
 	}
+	s.growing.Complete(filePath)
 
 	return &proto.WriteResponse{Success: true}, nil
 }
 
+// Append writes part of a file that ReadStream callers may be following.
+func (s *StorageServer) Append(ctx context.Context, req *proto.AppendRequest) (*proto.AppendResponse, error) {
+	filePath := filepath.Join(s.BaseDir, req.VideoId, req.Filename)
+	_, span := tracing.Start(ctx, "disk.append", trace.WithAttributes(
+		attribute.Int64("file.offset", req.Offset),
+		attribute.Int("file.size", len(req.Data)),
+	))
+	size, err := s.growing.Append(filePath, req.Offset, req.Data, req.Complete)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to append to file: %w", err)
+	}
+
+	return &proto.AppendResponse{Size: size}, nil
+}
+
 func (s *StorageServer) Read(ctx context.Context, req *proto.ReadRequest) (*proto.ReadResponse, error) {
 	filePath := filepath.Join(s.BaseDir, req.VideoId, req.Filename)
+	_, span := tracing.Start(ctx, "disk.read")
 	data, err := os.ReadFile(filePath)
+	span.SetAttributes(attribute.Int("file.size", len(data)))
+	tracing.End(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
@@ -55,6 +86,27 @@ func (s *StorageServer) Read(ctx context.Context, req *proto.ReadRequest) (*prot
 	return &proto.ReadResponse{Data: data}, nil
 }
 
+// ReadStream sends a file, and keeps sending what is appended to it until
+// it is complete.
+func (s *StorageServer) ReadStream(req *proto.ReadRequest, stream proto.VideoContentStorageService_ReadStreamServer) error {
+	filePath := filepath.Join(s.BaseDir, req.VideoId, req.Filename)
+	_, span := tracing.Start(stream.Context(), "disk.follow")
+	var sent int
+	err := s.growing.Follow(stream.Context(), filePath, func(data []byte) error {
+		sent += len(data)
+		return stream.Send(&proto.ReadResponse{Data: data})
+	})
+	span.SetAttributes(attribute.Int("file.size", sent))
+	tracing.End(span, err)
+	if errors.Is(err, os.ErrNotExist) {
+		return status.Errorf(codes.NotFound, "file %s/%s not found", req.VideoId, req.Filename)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stream file: %w", err)
+	}
+	return nil
+}
+
 func (s *StorageServer) ListFiles(ctx context.Context, req *proto.ListFilesRequest) (*proto.ListFilesResponse, error) {
 	var files []*proto.FileInfo
 
@@ -91,6 +143,7 @@ func (s *StorageServer) DeleteFile(ctx context.Context, req *proto.DeleteFileReq
 	if err != nil {
 		return nil, fmt.Errorf("failed to delete file: %w", err)
 	}
+	s.growing.Complete(filePath)
 
 	videoDir := filepath.Join(s.BaseDir, req.VideoId)
 	os.Remove(videoDir)
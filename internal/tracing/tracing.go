@@ -0,0 +1,98 @@
+// Package tracing sets up OpenTelemetry tracing and the instrumentation that
+// carries trace context from HTTP requests through gRPC to storage nodes.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+const instrumentationName = "tritontube"
+
+func init() {
+	// Propagate trace context even when this process does not export spans,
+	// so a traced caller's trace continues through it.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Setup exports spans of service to the OTLP/gRPC collector at endpoint
+// (host:port). With an empty endpoint tracing stays disabled. The returned
+// function flushes pending spans and must be called before exiting.
+func Setup(ctx context.Context, service, endpoint string, insecure bool) (func(context.Context) error, error) {
+	if endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	return Install(exporter, service, sdktrace.WithBatcher(exporter)), nil
+}
+
+// Install makes a tracer provider exporting to exporter the global one. It
+// is used by Setup and lets tests pass a tracetest.InMemoryExporter, with
+// sdktrace.WithSyncer so that spans are visible as soon as they end.
+func Install(exporter sdktrace.SpanExporter, service string, opts ...sdktrace.TracerProviderOption) func(context.Context) error {
+	if len(opts) == 0 {
+		opts = []sdktrace.TracerProviderOption{sdktrace.WithSyncer(exporter)}
+	}
+	opts = append(opts, sdktrace.WithResource(resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(service),
+	)))
+	provider := sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown
+}
+
+// Start starts a span named name as a child of any span in ctx.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End ends span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// HTTPMiddleware starts a span per request, continuing any trace in the
+// request headers. route names the span, as in metrics.HTTPMiddleware.
+func HTTPMiddleware(route func(*http.Request) string, next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + route(r)
+		}),
+	)
+}
+
+// ServerOption instruments a gRPC server so calls continue the caller's trace.
+func ServerOption() grpc.ServerOption {
+	return grpc.StatsHandler(otelgrpc.NewServerHandler())
+}
+
+// DialOption instruments a gRPC client so calls carry the trace in ctx.
+func DialOption() grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler())
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"tritontube/internal/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ReloadFunc re-reads the configuration, applies what a running server can
+// change and lists the keys of changed settings.
+type ReloadFunc func() (applied, restartRequired []string, err error)
+
+// AdminServer serves the admin gRPC API: cluster membership from the
+// network content service, read access to the audit log and configuration
+// reloads.
+type AdminServer struct {
+	*NetworkVideoContentService
+	audit AuditLog
+
+	// Reload serves ReloadConfig. May be nil.
+	Reload ReloadFunc
+}
+
+func NewAdminServer(service *NetworkVideoContentService, audit AuditLog) *AdminServer {
+	return &AdminServer{NetworkVideoContentService: service, audit: audit}
+}
+
+func (a *AdminServer) ListAuditLog(ctx context.Context, req *proto.ListAuditLogRequest) (*proto.ListAuditLogResponse, error) {
+	if a.audit == nil {
+		return nil, fmt.Errorf("no audit log configured")
+	}
+
+	q := AuditQuery{Actor: req.Actor, Limit: int(req.Limit)}
+	if req.SinceUnix > 0 {
+		q.Since = time.Unix(req.SinceUnix, 0)
+	}
+	entries, err := a.audit.ListAudit(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+
+	resp := &proto.ListAuditLogResponse{}
+	for _, entry := range entries {
+		resp.Entries = append(resp.Entries, &proto.AuditEntry{
+			Id:       entry.Id,
+			TimeUnix: entry.Time.Unix(),
+			Actor:    entry.Actor,
+			Role:     entry.Role,
+			Action:   entry.Action,
+			Target:   entry.Target,
+			Outcome:  entry.Outcome,
+			Source:   entry.Source,
+		})
+	}
+	return resp, nil
+}
+
+func (a *AdminServer) ReloadConfig(ctx context.Context, req *proto.ReloadConfigRequest) (*proto.ReloadConfigResponse, error) {
+	if a.Reload == nil {
+		return nil, status.Error(codes.Unimplemented, "configuration reload is not available")
+	}
+	applied, restartRequired, err := a.Reload()
+	if err != nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to reload configuration: %v", err)
+	}
+	return &proto.ReloadConfigResponse{Applied: applied, RestartRequired: restartRequired}, nil
+}
+
+var _ proto.VideoContentAdminServiceServer = (*AdminServer)(nil)
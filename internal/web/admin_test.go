@@ -0,0 +1,36 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"tritontube/internal/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReloadConfig(t *testing.T) {
+	ctx := context.Background()
+	admin := NewAdminServer(nil, nil)
+	if _, err := admin.ReloadConfig(ctx, &proto.ReloadConfigRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("ReloadConfig without Reload = %v", err)
+	}
+
+	admin.Reload = func() ([]string, []string, error) { return nil, nil, errors.New("bad config") }
+	if _, err := admin.ReloadConfig(ctx, &proto.ReloadConfigRequest{}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("ReloadConfig of an invalid configuration = %v", err)
+	}
+
+	admin.Reload = func() ([]string, []string, error) {
+		return []string{"log.level"}, []string{"http.listen"}, nil
+	}
+	resp, err := admin.ReloadConfig(ctx, &proto.ReloadConfigRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(resp.Applied, []string{"log.level"}) || !slices.Equal(resp.RestartRequired, []string{"http.listen"}) {
+		t.Errorf("ReloadConfig = %v", resp)
+	}
+}
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+	"tritontube/internal/security"
+
+	"google.golang.org/grpc/status"
+)
+
+type AuditEntryAPIResponse struct {
+	Id      int64  `json:"id"`
+	Time    string `json:"time"`
+	Actor   string `json:"actor"`
+	Role    string `json:"role"`
+	Action  string `json:"action"`
+	Target  string `json:"target,omitempty"`
+	Outcome string `json:"outcome"`
+	Source  string `json:"source,omitempty"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// writeAudit appends entry to the audit log. A failure is logged rather than
+// returned: the action it describes has already happened.
+func writeAudit(ctx context.Context, audit AuditLog, entry AuditEntry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if audit == nil {
+		slog.InfoContext(ctx, "Audit",
+			"actor", entry.Actor, "role", entry.Role, "action", entry.Action, "target", entry.Target, "outcome", entry.Outcome)
+		return
+	}
+	if err := audit.AppendAudit(&entry); err != nil {
+		slog.ErrorContext(ctx, "Error writing audit entry", "err", err)
+	}
+}
+
+// AuditGRPC adapts an AuditLog to security.RBAC.Audit.
+func AuditGRPC(audit AuditLog) func(ctx context.Context, record security.AuditRecord) {
+	return func(ctx context.Context, record security.AuditRecord) {
+		outcome := "ok"
+		if record.Err != nil {
+			outcome = status.Convert(record.Err).Message()
+		}
+		writeAudit(ctx, audit, AuditEntry{
+			Actor:   record.Actor,
+			Role:    record.Role.String(),
+			Action:  record.Method,
+			Target:  record.Target,
+			Outcome: outcome,
+			Source:  record.Source,
+		})
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// privileged guards a route that changes state: requests must come from a
+// user with at least role, and are recorded in the audit log under action
+// together with their outcome.
+func (s *server) privileged(role security.Role, action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entry := AuditEntry{
+			Actor:  "anonymous",
+			Role:   security.RoleNone.String(),
+			Action: action,
+			Target: r.Method + " " + r.URL.Path,
+			Source: r.RemoteAddr,
+		}
+		user := currentUser(r)
+		if user != nil {
+			entry.Actor, entry.Role = user.Username, user.Role.String()
+		}
+		if user == nil || user.Role < role {
+			entry.Outcome = "denied: requires " + role.String()
+			writeAudit(r.Context(), s.auditLog, entry)
+			requireRole(w, r, role)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		entry.Outcome = "ok"
+		if rec.status >= 400 {
+			entry.Outcome = fmt.Sprintf("failed: %d %s", rec.status, http.StatusText(rec.status))
+		}
+		writeAudit(r.Context(), s.auditLog, entry)
+	}
+}
+
+// API endpoint: GET /api/v1/admin/audit?actor=&since=&limit= - List audit entries, newest first (admin)
+func (s *server) handleListAudit(w http.ResponseWriter, r *http.Request) {
+	if requireRole(w, r, security.RoleAdmin) == nil {
+		return
+	}
+	if s.auditLog == nil {
+		sendErrorResponse(w, http.StatusNotImplemented, "No audit log configured")
+		return
+	}
+
+	params := r.URL.Query()
+	q := AuditQuery{Actor: params.Get("actor")}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			sendErrorResponse(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		q.Limit = limit
+	}
+	if v := params.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			sendErrorResponse(w, http.StatusBadRequest, "since must be an RFC 3339 time")
+			return
+		}
+		q.Since = since
+	}
+
+	entries, err := s.auditLog.ListAudit(q)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching audit log")
+		slog.ErrorContext(r.Context(), "Error listing audit log", "err", err)
+		return
+	}
+
+	entryResponses := []AuditEntryAPIResponse{}
+	for _, entry := range entries {
+		entryResponses = append(entryResponses, AuditEntryAPIResponse{
+			Id:      entry.Id,
+			Time:    entry.Time.Format(time.RFC3339),
+			Actor:   entry.Actor,
+			Role:    entry.Role,
+			Action:  entry.Action,
+			Target:  entry.Target,
+			Outcome: entry.Outcome,
+			Source:  entry.Source,
+		})
+	}
+	sendJSONResponse(w, http.StatusOK, APIResponse{Success: true, Data: entryResponses})
+}
+
+// API endpoint: PUT /api/v1/admin/users/{username}/role - Change a user's role (admin)
+func (s *server) handleSetRole(w http.ResponseWriter, r *http.Request) {
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	role, err := security.ParseRole(req.Role)
+	if err != nil || role == security.RoleNone {
+		sendErrorResponse(w, http.StatusBadRequest, "role must be viewer, operator or admin")
+		return
+	}
+
+	user, err := s.userService.ReadUserByName(r.PathValue("username"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching user")
+		slog.ErrorContext(r.Context(), "Error reading user", "err", err)
+		return
+	}
+	if user == nil {
+		sendErrorResponse(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	err = s.userService.SetUserRole(user.Id, role)
+	if errors.Is(err, ErrLastAdmin) {
+		sendErrorResponse(w, http.StatusConflict, "At least one admin must remain")
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error updating user")
+		slog.ErrorContext(r.Context(), "Error setting user role", "err", err)
+		return
+	}
+	user.Role = role
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{Success: true, Data: newUserAPIResponse(user)})
+}
@@ -0,0 +1,452 @@
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"tritontube/internal/security"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookieName = "session"
+	sessionLifetime   = 30 * 24 * time.Hour
+	minPasswordLength = 8
+	maxPasswordLength = 72 // bcrypt ignores anything longer
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{3,32}$`)
+
+// dummyPasswordHash is compared against when a login names an unknown user,
+// so that both failure modes take as long as a real password check.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	tokenContextKey
+)
+
+type UserAPIResponse struct {
+	Id        string `json:"id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	Admin     bool   `json:"admin"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func newUserAPIResponse(user *User) UserAPIResponse {
+	return UserAPIResponse{
+		Id:        user.Id,
+		Username:  user.Username,
+		Role:      user.Role.String(),
+		Admin:     user.Role == security.RoleAdmin,
+		CreatedAt: user.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+type TokenAPIResponse struct {
+	Id        string `json:"id"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name,omitempty"`
+	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	// Token is the secret itself, only returned when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+func newTokenAPIResponse(token *AuthToken, secret string) TokenAPIResponse {
+	resp := TokenAPIResponse{
+		Id:        token.Id,
+		Kind:      string(token.Kind),
+		Name:      token.Name,
+		CreatedAt: token.CreatedAt.Format("2006-01-02 15:04:05"),
+		Token:     secret,
+	}
+	if !token.ExpiresAt.IsZero() {
+		resp.ExpiresAt = token.ExpiresAt.Format("2006-01-02 15:04:05")
+	}
+	return resp
+}
+
+type CredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type TokenRequest struct {
+	Name string `json:"name"`
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueToken creates a credential for user and returns its secret.
+func (s *server) issueToken(user *User, kind AuthTokenKind, name string, lifetime time.Duration) (string, *AuthToken, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+
+	token := &AuthToken{
+		Id:        newRandomID(),
+		Hash:      hashTokenSecret(secret),
+		UserId:    user.Id,
+		Kind:      kind,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+	if lifetime > 0 {
+		token.ExpiresAt = token.CreatedAt.Add(lifetime)
+	}
+	if err := s.userService.CreateToken(token); err != nil {
+		return "", nil, err
+	}
+	return secret, token, nil
+}
+
+// resolveToken returns the user a secret of the given kind belongs to, or
+// nil if the secret is unknown, expired or of another kind. Session cookies
+// only work as cookies and API tokens only as bearer tokens.
+func (s *server) resolveToken(secret string, kind AuthTokenKind) (*User, *AuthToken, error) {
+	return lookupToken(s.userService, secret, kind)
+}
+
+func lookupToken(users UserService, secret string, kind AuthTokenKind) (*User, *AuthToken, error) {
+	token, err := users.ReadTokenByHash(hashTokenSecret(secret))
+	if err != nil || token == nil || token.Kind != kind {
+		return nil, nil, err
+	}
+	if !token.ExpiresAt.IsZero() && time.Now().After(token.ExpiresAt) {
+		return nil, nil, nil
+	}
+	user, err := users.ReadUser(token.UserId)
+	if err != nil || user == nil {
+		return nil, nil, err
+	}
+	return user, token, nil
+}
+
+// TokenRoleResolver lets the admin gRPC server accept the same API tokens
+// as the HTTP API; the caller gets the role of the token's user.
+func TokenRoleResolver(users UserService) func(ctx context.Context, secret string) (string, security.Role, error) {
+	return func(ctx context.Context, secret string) (string, security.Role, error) {
+		user, _, err := lookupToken(users, secret, APIToken)
+		if err != nil {
+			return "", security.RoleNone, err
+		}
+		if user == nil {
+			return "", security.RoleNone, errors.New("unknown or expired token")
+		}
+		return user.Username, user.Role, nil
+	}
+}
+
+// authenticate resolves the caller from a bearer token or session cookie and
+// stores the user in the request context. A bearer token that does not
+// resolve is rejected; a stale session cookie is treated as anonymous.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var user *User
+		var token *AuthToken
+
+		if header := r.Header.Get("Authorization"); header != "" {
+			secret, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				sendErrorResponse(w, http.StatusUnauthorized, "Unsupported authorization scheme")
+				return
+			}
+			resolved, resolvedToken, err := s.resolveToken(strings.TrimSpace(secret), APIToken)
+			if err != nil {
+				sendErrorResponse(w, http.StatusInternalServerError, "Error checking credentials")
+				slog.ErrorContext(r.Context(), "Error resolving bearer token", "err", err)
+				return
+			}
+			if resolved == nil {
+				sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired token")
+				return
+			}
+			user, token = resolved, resolvedToken
+		} else if cookie, err := r.Cookie(sessionCookieName); err == nil {
+			resolved, _, err := s.resolveToken(cookie.Value, SessionToken)
+			if err != nil {
+				sendErrorResponse(w, http.StatusInternalServerError, "Error checking credentials")
+				slog.ErrorContext(r.Context(), "Error resolving session", "err", err)
+				return
+			}
+			user = resolved
+		}
+
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+		}
+		if token != nil {
+			r = r.WithContext(context.WithValue(r.Context(), tokenContextKey, token))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// currentUser returns the authenticated caller, or nil for anonymous requests.
+func currentUser(r *http.Request) *User {
+	user, _ := r.Context().Value(userContextKey).(*User)
+	return user
+}
+
+// currentToken returns the API token the caller authenticated with, or nil
+// for session and anonymous requests.
+func currentToken(r *http.Request) *AuthToken {
+	token, _ := r.Context().Value(tokenContextKey).(*AuthToken)
+	return token
+}
+
+// requireUser returns the authenticated caller, replying 401 if there is none.
+func requireUser(w http.ResponseWriter, r *http.Request) *User {
+	user := currentUser(r)
+	if user == nil {
+		sendErrorResponse(w, http.StatusUnauthorized, "Authentication required")
+	}
+	return user
+}
+
+// requireRole returns the authenticated caller, replying 401 if there is
+// none and 403 if their role is below role.
+func requireRole(w http.ResponseWriter, r *http.Request, role security.Role) *User {
+	user := requireUser(w, r)
+	if user != nil && user.Role < role {
+		sendErrorResponse(w, http.StatusForbidden, "Requires the "+role.String()+" role")
+		return nil
+	}
+	return user
+}
+
+// canModify reports whether user may change or delete something owned by
+// ownerId. Operators and admins may change anything; things without an
+// owner can only be changed by them.
+func canModify(user *User, ownerId string) bool {
+	return user != nil && (user.Role >= security.RoleOperator || (ownerId != "" && ownerId == user.Id))
+}
+
+func setSessionCookie(w http.ResponseWriter, r *http.Request, secret string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    secret,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// API endpoint: POST /api/v1/auth/register - Create an account (the first account of a new deployment is an admin, later ones viewers)
+func (s *server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	var req CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !usernamePattern.MatchString(req.Username) {
+		sendErrorResponse(w, http.StatusBadRequest, "Username must be 3-32 letters, digits, '.', '_' or '-'")
+		return
+	}
+	if len(req.Password) < minPasswordLength || len(req.Password) > maxPasswordLength {
+		sendErrorResponse(w, http.StatusBadRequest, "Password must be between 8 and 72 characters")
+		return
+	}
+
+	existing, err := s.userService.ReadUserByName(req.Username)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error checking for existing user")
+		slog.ErrorContext(r.Context(), "Error checking for existing user", "err", err)
+		return
+	}
+	if existing != nil {
+		sendErrorResponse(w, http.StatusConflict, "Username already taken")
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error creating user")
+		slog.ErrorContext(r.Context(), "Error hashing password", "err", err)
+		return
+	}
+
+	user := &User{
+		Id:           newRandomID(),
+		Username:     req.Username,
+		PasswordHash: hash,
+		Role:         security.RoleViewer,
+		CreatedAt:    time.Now(),
+	}
+	if err := s.userService.RegisterUser(user); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error creating user")
+		slog.ErrorContext(r.Context(), "Error creating user", "err", err)
+		return
+	}
+
+	sendJSONResponse(w, http.StatusCreated, APIResponse{Success: true, Data: newUserAPIResponse(user)})
+}
+
+// API endpoint: POST /api/v1/auth/login - Start a session
+func (s *server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req CredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	user, err := s.userService.ReadUserByName(req.Username)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error checking credentials")
+		slog.ErrorContext(r.Context(), "Error reading user", "err", err)
+		return
+	}
+	hash := dummyPasswordHash
+	if user != nil {
+		hash = user.PasswordHash
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(req.Password)); err != nil || user == nil {
+		sendErrorResponse(w, http.StatusUnauthorized, "Invalid username or password")
+		return
+	}
+
+	secret, token, err := s.issueToken(user, SessionToken, r.UserAgent(), sessionLifetime)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error creating session")
+		slog.ErrorContext(r.Context(), "Error creating session", "err", err)
+		return
+	}
+	setSessionCookie(w, r, secret, token.ExpiresAt)
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{Success: true, Data: newUserAPIResponse(user)})
+}
+
+// API endpoint: POST /api/v1/auth/logout - End the current session
+func (s *server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		_, token, err := s.resolveToken(cookie.Value, SessionToken)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error resolving session", "err", err)
+		} else if token != nil {
+			if err := s.userService.DeleteToken(token.Id); err != nil {
+				slog.ErrorContext(r.Context(), "Error deleting session", "err", err)
+			}
+		}
+	}
+	setSessionCookie(w, r, "", time.Unix(0, 0))
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    map[string]string{"message": "Logged out"},
+	})
+}
+
+// API endpoint: GET /api/v1/auth/me - Get the signed-in user
+func (s *server) handleMe(w http.ResponseWriter, r *http.Request) {
+	if user := requireUser(w, r); user != nil {
+		sendJSONResponse(w, http.StatusOK, APIResponse{Success: true, Data: newUserAPIResponse(user)})
+	}
+}
+
+// API endpoint: GET /api/v1/auth/tokens - List the caller's tokens and sessions
+func (s *server) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	user := requireUser(w, r)
+	if user == nil {
+		return
+	}
+
+	tokens, err := s.userService.ListTokens(user.Id)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching tokens")
+		slog.ErrorContext(r.Context(), "Error listing tokens", "err", err)
+		return
+	}
+
+	tokenResponses := []TokenAPIResponse{}
+	for i := range tokens {
+		tokenResponses = append(tokenResponses, newTokenAPIResponse(&tokens[i], ""))
+	}
+	sendJSONResponse(w, http.StatusOK, APIResponse{Success: true, Data: tokenResponses})
+}
+
+// API endpoint: POST /api/v1/auth/tokens - Create an API token
+func (s *server) handleCreateToken(w http.ResponseWriter, r *http.Request) {
+	user := requireUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Token name is required")
+		return
+	}
+
+	secret, token, err := s.issueToken(user, APIToken, req.Name, 0)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error creating token")
+		slog.ErrorContext(r.Context(), "Error creating token", "err", err)
+		return
+	}
+
+	sendJSONResponse(w, http.StatusCreated, APIResponse{Success: true, Data: newTokenAPIResponse(token, secret)})
+}
+
+// API endpoint: DELETE /api/v1/auth/tokens/{tokenId} - Revoke a token or session
+func (s *server) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	user := requireUser(w, r)
+	if user == nil {
+		return
+	}
+	tokenId := r.PathValue("tokenId")
+
+	tokens, err := s.userService.ListTokens(user.Id)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching tokens")
+		slog.ErrorContext(r.Context(), "Error listing tokens", "err", err)
+		return
+	}
+	found := false
+	for _, token := range tokens {
+		if token.Id == tokenId {
+			found = true
+			break
+		}
+	}
+	if !found {
+		sendErrorResponse(w, http.StatusNotFound, "Token not found")
+		return
+	}
+
+	if err := s.userService.DeleteToken(tokenId); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error deleting token")
+		slog.ErrorContext(r.Context(), "Error deleting token", "err", err)
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    map[string]string{"message": "Token revoked"},
+	})
+}
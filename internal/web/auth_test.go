@@ -0,0 +1,170 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"tritontube/internal/security"
+)
+
+func register(t *testing.T, handler http.Handler, username string) (int, UserAPIResponse) {
+	t.Helper()
+	var user UserAPIResponse
+	w := doJSON(t, handler, "POST", "/api/v1/auth/register", "",
+		map[string]string{"username": username, "password": "correct horse"}, &user)
+	return w.Code, user
+}
+
+func TestConcurrentFirstRegistrationsMakeOneAdmin(t *testing.T) {
+	_, handler := newSQLiteServer(t)
+
+	const n = 8
+	var wg sync.WaitGroup
+	roles := make([]string, n)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, user := register(t, handler, fmt.Sprintf("user%d", i))
+			if code != http.StatusCreated {
+				t.Errorf("register status = %d", code)
+			}
+			roles[i] = user.Role
+		}()
+	}
+	wg.Wait()
+
+	admins := 0
+	for _, role := range roles {
+		if role == security.RoleAdmin.String() {
+			admins++
+		}
+	}
+	if admins != 1 {
+		t.Errorf("roles = %v, want exactly one admin", roles)
+	}
+}
+
+func TestFirstRegistrationWithVideosIsNotAdmin(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	createVideo(t, s.metadataService, "existing")
+
+	code, user := register(t, handler, "visitor")
+	if code != http.StatusCreated {
+		t.Fatalf("register status = %d", code)
+	}
+	if user.Role != security.RoleViewer.String() {
+		t.Errorf("role = %q, want %q", user.Role, security.RoleViewer)
+	}
+}
+
+func TestLoginAndLogout(t *testing.T) {
+	_, handler := newSQLiteServer(t)
+	register(t, handler, "alice")
+
+	credentials := map[string]string{"username": "alice", "password": "wrong password"}
+	if w := doJSON(t, handler, "POST", "/api/v1/auth/login", "", credentials, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("login with a wrong password: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	credentials["password"] = "correct horse"
+	w := doJSON(t, handler, "POST", "/api/v1/auth/login", "", credentials, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	withSession := func(method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := withSession("GET", "/api/v1/auth/me"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"username":"alice"`) {
+		t.Fatalf("me = %d %s", w.Code, w.Body)
+	}
+	if w := withSession("POST", "/api/v1/auth/logout"); w.Code >= 300 {
+		t.Fatalf("logout status = %d", w.Code)
+	}
+	if w := withSession("GET", "/api/v1/auth/me"); w.Code != http.StatusUnauthorized {
+		t.Errorf("me after logout: status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestTokenKindsStayInTheirPlace(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	apiToken := signIn(t, s, "alice", security.RoleAdmin)
+	session, _, err := s.issueToken(userOf(t, s, apiToken), SessionToken, "browser", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	me := func(r *http.Request) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	withCookie := func(secret string) *http.Request {
+		r := httptest.NewRequest("GET", "/api/v1/auth/me", nil)
+		r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: secret})
+		return r
+	}
+
+	if code := doJSON(t, handler, "GET", "/api/v1/auth/me", apiToken, nil, nil).Code; code != http.StatusOK {
+		t.Errorf("API token as bearer: %d", code)
+	}
+	if code := doJSON(t, handler, "GET", "/api/v1/auth/me", session, nil, nil).Code; code != http.StatusUnauthorized {
+		t.Errorf("session as bearer: %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := me(withCookie(session)); code != http.StatusOK {
+		t.Errorf("session as cookie: %d", code)
+	}
+	if code := me(withCookie(apiToken)); code != http.StatusUnauthorized {
+		t.Errorf("API token as cookie: %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	resolve := TokenRoleResolver(s.userService)
+	if name, role, err := resolve(context.Background(), apiToken); err != nil || name != "alice" || role != security.RoleAdmin {
+		t.Errorf("gRPC with the API token = %q, %v, %v", name, role, err)
+	}
+	if _, role, err := resolve(context.Background(), session); err == nil || role != security.RoleNone {
+		t.Errorf("gRPC with the session = %v, %v", role, err)
+	}
+}
+
+func TestLastAdminCannotBeDemoted(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	alice := signIn(t, s, "alice", security.RoleAdmin)
+	signIn(t, s, "bob", security.RoleViewer)
+	setRole := func(username, role string) int {
+		t.Helper()
+		return doJSON(t, handler, "PUT", "/api/v1/admin/users/"+username+"/role", alice, map[string]string{"role": role}, nil).Code
+	}
+
+	if code := setRole("alice", "operator"); code != http.StatusConflict {
+		t.Errorf("self-demotion of the last admin: status = %d, want %d", code, http.StatusConflict)
+	}
+	if code := setRole("alice", "admin"); code != http.StatusOK {
+		t.Errorf("last admin keeping the role: status = %d", code)
+	}
+	if code := setRole("bob", "admin"); code != http.StatusOK {
+		t.Fatalf("promotion: status = %d", code)
+	}
+	if code := setRole("alice", "viewer"); code != http.StatusOK {
+		t.Errorf("demotion with another admin left: status = %d", code)
+	}
+	if user := userOf(t, s, alice); user.Role != security.RoleViewer {
+		t.Errorf("role after demotion = %v", user.Role)
+	}
+	if err := s.userService.SetUserRole("nobody", security.RoleViewer); err == nil || errors.Is(err, ErrLastAdmin) {
+		t.Errorf("SetUserRole of a missing user = %v", err)
+	}
+}
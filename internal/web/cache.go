@@ -0,0 +1,622 @@
+package web
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tritontube/internal/manifest"
+	"tritontube/internal/metrics"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ContentCacheConfig sizes the tiers of a CachedContentService.
+type ContentCacheConfig struct {
+	// MemoryBytes bounds the in-process tier.
+	MemoryBytes int64
+	// DiskDir, if set, holds a second tier of files evicted from memory,
+	// bounded by DiskBytes. Its contents are discarded on start.
+	DiskDir   string
+	DiskBytes int64
+	// PrefetchSegments is how many segments after a requested one are read
+	// into the cache ahead of the player asking. 0 turns prefetching off.
+	PrefetchSegments int
+	// PrefetchPerVideo and PrefetchTotal bound the prefetches running at
+	// once for a video and in total. Segment reads past them do not start
+	// one.
+	PrefetchPerVideo int
+	PrefetchTotal    int
+}
+
+// CachedContentService serves reads of another content service from an LRU
+// cache, so that hot segments do not cost a storage node round trip each.
+// Concurrent misses for the same file share a single read. Files are
+// dropped from the cache when they are deleted or written, and when a ring
+// change moves them (see Invalidate).
+//
+// Cached data is shared between callers and must not be modified.
+type CachedContentService struct {
+	VideoContentService
+
+	// mu guards the state below, not the files of the disk tier: they are
+	// read and written without it, under names never reused.
+	mu     sync.Mutex
+	memory *lru
+	disk   *lru // nil without a disk tier
+	dir    string
+	// diskFiles numbers the files of the disk tier.
+	diskFiles uint64
+	// reads holds the files being read into the cache, by key. A read
+	// must not fill the cache if its file was invalidated meanwhile, as it
+	// may have returned the old file.
+	reads  map[string]*cacheRead
+	flight singleflight.Group
+
+	prefetchSegments int
+	prefetchPerVideo int
+	prefetchTotal    int
+	prefetching      map[string]int // running prefetches by video ID
+	// templates holds the segment naming of each video's manifest, nil for
+	// manifests without numbered segments. templateOrder bounds it to the
+	// maxTemplates videos prefetched from most recently.
+	templates     map[string][]manifest.SegmentTemplate
+	templateOrder *lru
+}
+
+// manifestFile is the manifest prefetching learns segment names from.
+const manifestFile = "manifest.mpd"
+
+// maxTemplates is how many videos' segment naming is kept for prefetching.
+// Naming that is dropped is parsed again from the manifest.
+const maxTemplates = 1000
+
+// NewCachedContentService wraps content with a cache configured by config.
+func NewCachedContentService(content VideoContentService, config ContentCacheConfig) (*CachedContentService, error) {
+	c := &CachedContentService{
+		VideoContentService: content,
+		memory:              newLRU(config.MemoryBytes),
+		prefetchSegments:    config.PrefetchSegments,
+		prefetchPerVideo:    config.PrefetchPerVideo,
+		prefetchTotal:       config.PrefetchTotal,
+		reads:               make(map[string]*cacheRead),
+		prefetching:         make(map[string]int),
+		templates:           make(map[string][]manifest.SegmentTemplate),
+		templateOrder:       newLRU(maxTemplates),
+	}
+	if config.DiskDir != "" {
+		if err := os.RemoveAll(config.DiskDir); err != nil {
+			return nil, fmt.Errorf("failed to clear cache directory: %w", err)
+		}
+		if err := os.MkdirAll(config.DiskDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		c.disk = newLRU(config.DiskBytes)
+		c.dir = config.DiskDir
+	}
+	return c, nil
+}
+
+func cacheKey(videoId, filename string) string {
+	return videoId + "/" + filename
+}
+
+// cacheRead counts the invalidations of a file while reads of it into the
+// cache are in progress.
+type cacheRead struct {
+	generation uint64
+	readers    int
+}
+
+// beginRead registers a read of the file at key into the cache and returns
+// the file's generation, to be passed to endRead. c.mu must be held.
+func (c *CachedContentService) beginRead(key string) uint64 {
+	r := c.reads[key]
+	if r == nil {
+		r = &cacheRead{}
+		c.reads[key] = r
+	}
+	r.readers++
+	return r.generation
+}
+
+// endRead ends a read started by beginRead and reports whether the file is
+// unchanged since. c.mu must be held.
+func (c *CachedContentService) endRead(key string, generation uint64) bool {
+	r := c.reads[key]
+	if r.readers--; r.readers == 0 {
+		delete(c.reads, key)
+	}
+	return r.generation == generation
+}
+
+// Read implements VideoContentService. Reading a segment prefetches the
+// ones after it.
+func (c *CachedContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
+	key := cacheKey(videoId, filename)
+	data, tier := c.lookup(key)
+	if data != nil {
+		metrics.ContentCacheRequests.WithLabelValues(tier).Inc()
+	} else {
+		metrics.ContentCacheRequests.WithLabelValues("miss").Inc()
+		var err error
+		if data, err = c.fetch(ctx, videoId, filename, false); err != nil {
+			return nil, err
+		}
+	}
+	c.prefetch(videoId, filename)
+	return data, nil
+}
+
+// fetch reads a file from the content service into the cache. Concurrent
+// fetches of the same file share one read.
+func (c *CachedContentService) fetch(ctx context.Context, videoId, filename string, prefetch bool) ([]byte, error) {
+	key := cacheKey(videoId, filename)
+	v, err, _ := c.flight.Do(key, func() (any, error) {
+		c.mu.Lock()
+		generation := c.beginRead(key)
+		c.mu.Unlock()
+
+		// The read is shared, so one caller going away must not fail it
+		// for the others.
+		data, err := c.VideoContentService.Read(context.WithoutCancel(ctx), videoId, filename)
+		if err != nil {
+			c.mu.Lock()
+			c.endRead(key, generation)
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.store(key, data, generation, prefetch)
+		return data, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// lookup returns the cached file at key and the tier it was found in, or
+// nil. Files found on disk move back to memory.
+func (c *CachedContentService) lookup(key string) ([]byte, string) {
+	c.mu.Lock()
+	if e := c.memory.get(key); e != nil {
+		if e.prefetched {
+			e.prefetched = false
+			metrics.ContentPrefetchHits.Inc()
+		}
+		c.mu.Unlock()
+		return e.data, "memory"
+	}
+	var e *lruEntry
+	if c.disk != nil {
+		e = c.disk.get(key)
+	}
+	if e == nil || e.writing {
+		c.mu.Unlock()
+		return nil, ""
+	}
+	generation := c.beginRead(key)
+	c.mu.Unlock()
+
+	data, err := os.ReadFile(e.file)
+
+	c.mu.Lock()
+	unchanged := c.endRead(key, generation)
+	var changes diskChanges
+	// The file may have moved to memory or been dropped meanwhile, in
+	// which case it is gone or going.
+	stillOnDisk := c.disk.items[key] != nil && c.disk.items[key].Value.(*lruEntry) == e
+	if stillOnDisk {
+		c.disk.remove(key)
+		changes.removals = append(changes.removals, e.file)
+	}
+	if err == nil && unchanged {
+		changes.add(c.addToMemory(key, data))
+	}
+	c.updateSizeMetrics()
+	c.mu.Unlock()
+	c.applyDiskChanges(changes)
+
+	if err != nil {
+		if stillOnDisk {
+			slog.Warn("Failed to read cached file", "file", key, "err", err)
+		}
+		return nil, ""
+	}
+	return data, "disk"
+}
+
+// store caches data read at key unless the file was invalidated since the
+// read began at generation.
+func (c *CachedContentService) store(key string, data []byte, generation uint64, prefetched bool) {
+	c.mu.Lock()
+	if !c.endRead(key, generation) {
+		c.mu.Unlock()
+		return
+	}
+	changes := c.addToMemory(key, data)
+	if e := c.memory.items[key]; e != nil {
+		e.Value.(*lruEntry).prefetched = prefetched
+	}
+	c.mu.Unlock()
+	c.applyDiskChanges(changes)
+}
+
+// cached reports whether key is in either tier, without marking it used.
+func (c *CachedContentService) cached(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.memory.items[key]; ok {
+		return true
+	}
+	if c.disk != nil {
+		_, ok := c.disk.items[key]
+		return ok
+	}
+	return false
+}
+
+// addToMemory caches data and moves what it evicts to the disk tier. The
+// files of the disk tier change once the caller releases c.mu and passes
+// the result to applyDiskChanges. c.mu must be held.
+func (c *CachedContentService) addToMemory(key string, data []byte) diskChanges {
+	var changes diskChanges
+	for _, e := range c.memory.add(key, int64(len(data)), data) {
+		if c.disk == nil || e.size > c.disk.maxBytes {
+			continue
+		}
+		if old := c.disk.remove(e.key); old != nil {
+			changes.removals = append(changes.removals, old.file)
+		}
+		for _, old := range c.disk.add(e.key, e.size, nil) {
+			changes.removals = append(changes.removals, old.file)
+		}
+		entry := c.disk.items[e.key].Value.(*lruEntry)
+		c.diskFiles++
+		entry.file = c.diskPath(e.key, c.diskFiles)
+		entry.writing = true
+		changes.writes = append(changes.writes, diskWrite{entry, e.data})
+	}
+	c.updateSizeMetrics()
+	return changes
+}
+
+// diskChanges are the file operations that bring the disk tier in line
+// with its index.
+type diskChanges struct {
+	writes   []diskWrite
+	removals []string
+}
+
+type diskWrite struct {
+	entry *lruEntry
+	data  []byte
+}
+
+func (d *diskChanges) add(other diskChanges) {
+	d.writes = append(d.writes, other.writes...)
+	d.removals = append(d.removals, other.removals...)
+}
+
+// applyDiskChanges writes and removes the files of the disk tier. Entries
+// are readable once written; files of entries dropped while being written
+// are removed. c.mu must not be held.
+func (c *CachedContentService) applyDiskChanges(changes diskChanges) {
+	for _, file := range changes.removals {
+		os.Remove(file)
+	}
+	for _, w := range changes.writes {
+		err := os.WriteFile(w.entry.file, w.data, 0o644)
+		if err != nil {
+			slog.Warn("Failed to write cached file", "file", w.entry.key, "err", err)
+		}
+
+		c.mu.Lock()
+		current := c.disk.items[w.entry.key]
+		kept := current != nil && current.Value.(*lruEntry) == w.entry
+		if kept && err == nil {
+			w.entry.writing = false
+		} else if kept {
+			c.disk.remove(w.entry.key)
+			c.updateSizeMetrics()
+		}
+		c.mu.Unlock()
+		if !kept || err != nil {
+			os.Remove(w.entry.file)
+		}
+	}
+}
+
+// diskPath names the nth file of the disk tier, which holds key.
+func (c *CachedContentService) diskPath(key string, n uint64) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%d", hex.EncodeToString(sum[:8]), n))
+}
+
+func (c *CachedContentService) updateSizeMetrics() {
+	metrics.ContentCacheBytes.WithLabelValues("memory").Set(float64(c.memory.size))
+	if c.disk != nil {
+		metrics.ContentCacheBytes.WithLabelValues("disk").Set(float64(c.disk.size))
+	}
+}
+
+// Invalidate drops a file from the cache. An empty filename drops every
+// file of the video.
+func (c *CachedContentService) Invalidate(videoId, filename string) {
+	c.mu.Lock()
+	if filename == "" || filename == manifestFile {
+		delete(c.templates, videoId)
+		c.templateOrder.remove(videoId)
+	}
+
+	keys := []string{cacheKey(videoId, filename)}
+	if filename == "" {
+		prefix := videoId + "/"
+		keys = append(c.memory.keysWithPrefix(prefix), c.disk.keysWithPrefix(prefix)...)
+		for key := range c.reads {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	var changes diskChanges
+	for _, key := range keys {
+		if r := c.reads[key]; r != nil {
+			r.generation++
+		}
+		// Later reads must not join one that may return the old file.
+		c.flight.Forget(key)
+		c.memory.remove(key)
+		if c.disk != nil {
+			if e := c.disk.remove(key); e != nil {
+				changes.removals = append(changes.removals, e.file)
+			}
+		}
+	}
+	c.updateSizeMetrics()
+	c.mu.Unlock()
+	c.applyDiskChanges(changes)
+}
+
+// Write implements VideoContentService. A new video may reuse the ID of a
+// deleted one, so nothing cached for the ID survives.
+func (c *CachedContentService) Write(ctx context.Context, videoId string, filename string, data []byte) ([]VideoFile, error) {
+	c.Invalidate(videoId, "")
+	files, err := c.VideoContentService.Write(ctx, videoId, filename, data)
+	c.Invalidate(videoId, "")
+	return files, err
+}
+
+// WriteFile implements FileWriter for content services that do.
+func (c *CachedContentService) WriteFile(ctx context.Context, videoId string, filename string, data []byte) error {
+	writer, ok := c.VideoContentService.(FileWriter)
+	if !ok {
+		return fmt.Errorf("content service cannot store files without transcoding")
+	}
+	err := writer.WriteFile(ctx, videoId, filename, data)
+	c.Invalidate(videoId, filename)
+	return err
+}
+
+// AppendFile implements FileAppender. Cached copies of the file are
+// dropped on every append.
+func (c *CachedContentService) AppendFile(ctx context.Context, videoId string, filename string, offset int64, data []byte, complete bool) error {
+	appender, ok := c.VideoContentService.(FileAppender)
+	if !ok {
+		return fmt.Errorf("content service cannot append to files")
+	}
+	err := appender.AppendFile(ctx, videoId, filename, offset, data, complete)
+	c.Invalidate(videoId, filename)
+	return err
+}
+
+// ReadStream implements StreamReader. Streams bypass the cache, as the
+// file may still be growing.
+func (c *CachedContentService) ReadStream(ctx context.Context, videoId string, filename string) (io.ReadCloser, error) {
+	reader, ok := c.VideoContentService.(StreamReader)
+	if !ok {
+		return nil, fmt.Errorf("content service cannot stream files")
+	}
+	return reader.ReadStream(ctx, videoId, filename)
+}
+
+// Delete implements VideoContentService.
+func (c *CachedContentService) Delete(ctx context.Context, videoId string, filename string) error {
+	err := c.VideoContentService.Delete(ctx, videoId, filename)
+	c.Invalidate(videoId, filename)
+	return err
+}
+
+// CheckHealth implements HealthChecker for content services that do.
+func (c *CachedContentService) CheckHealth(ctx context.Context) error {
+	if checker, ok := c.VideoContentService.(HealthChecker); ok {
+		return checker.CheckHealth(ctx)
+	}
+	return nil
+}
+
+// prefetch reads the segments after filename into the cache in the
+// background, if filename is a numbered segment of the video's manifest
+// and the prefetch bounds allow.
+func (c *CachedContentService) prefetch(videoId, filename string) {
+	if c.prefetchSegments <= 0 || manifest.IsManifest(filename) {
+		return
+	}
+	c.mu.Lock()
+	total := 0
+	for _, n := range c.prefetching {
+		total += n
+	}
+	if c.prefetching[videoId] >= c.prefetchPerVideo || total >= c.prefetchTotal {
+		c.mu.Unlock()
+		metrics.ContentPrefetches.WithLabelValues("skipped").Inc()
+		return
+	}
+	c.prefetching[videoId]++
+	c.mu.Unlock()
+
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			if c.prefetching[videoId]--; c.prefetching[videoId] == 0 {
+				delete(c.prefetching, videoId)
+			}
+			c.mu.Unlock()
+		}()
+
+		ctx := context.Background()
+		for _, name := range c.nextSegments(ctx, videoId, filename) {
+			if c.cached(cacheKey(videoId, name)) {
+				metrics.ContentPrefetches.WithLabelValues("cached").Inc()
+				continue
+			}
+			if _, err := c.fetch(ctx, videoId, name, true); err != nil {
+				metrics.ContentPrefetches.WithLabelValues("failed").Inc()
+				slog.Debug("Failed to prefetch segment", "video_id", videoId, "file", name, "err", err)
+				return
+			}
+			metrics.ContentPrefetches.WithLabelValues("fetched").Inc()
+		}
+	}()
+}
+
+// nextSegments returns the names of up to prefetchSegments segments after
+// filename in the video's manifest.
+func (c *CachedContentService) nextSegments(ctx context.Context, videoId, filename string) []string {
+	key := cacheKey(videoId, manifestFile)
+	c.mu.Lock()
+	templates, ok := c.templates[videoId]
+	var generation uint64
+	if ok {
+		c.templateOrder.get(videoId)
+	} else {
+		generation = c.beginRead(key)
+	}
+	c.mu.Unlock()
+	if !ok {
+		data, _ := c.lookup(key)
+		var err error
+		if data == nil {
+			data, err = c.fetch(ctx, videoId, manifestFile, false)
+		}
+		if err == nil {
+			templates, _ = manifest.SegmentTemplates(data)
+		}
+		c.mu.Lock()
+		if c.endRead(key, generation) && err == nil {
+			c.templates[videoId] = templates
+			for _, e := range c.templateOrder.add(videoId, 1, nil) {
+				delete(c.templates, e.key)
+			}
+		}
+		c.mu.Unlock()
+		if err != nil {
+			return nil
+		}
+	}
+
+	for _, t := range templates {
+		n, ok := t.Number(filename)
+		if !ok {
+			continue
+		}
+		var names []string
+		for next := n + 1; next <= n+c.prefetchSegments; next++ {
+			if t.EndNumber > 0 && next > t.EndNumber {
+				break
+			}
+			names = append(names, t.Name(next))
+		}
+		return names
+	}
+	return nil
+}
+
+// lru is a set of entries bounded by their total size that evicts the least
+// recently used first. It is not safe for concurrent use.
+type lru struct {
+	maxBytes int64
+	size     int64
+	order    *list.List // of *lruEntry, most recently used first
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key  string
+	size int64
+	data []byte
+	// prefetched is set until a prefetched file is first read.
+	prefetched bool
+	// file holds the data of disk tier entries, which cannot be read
+	// while writing is set.
+	file    string
+	writing bool
+}
+
+func newLRU(maxBytes int64) *lru {
+	return &lru{maxBytes: maxBytes, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// get returns the entry at key, marking it as recently used, or nil.
+func (l *lru) get(key string) *lruEntry {
+	elem, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	l.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry)
+}
+
+// add stores an entry of size bytes at key and returns the entries evicted
+// to make room. data may be nil for entries kept elsewhere. Entries larger
+// than the whole cache are not stored.
+func (l *lru) add(key string, size int64, data []byte) []*lruEntry {
+	l.remove(key)
+	if size > l.maxBytes {
+		return nil
+	}
+	l.items[key] = l.order.PushFront(&lruEntry{key: key, size: size, data: data})
+	l.size += size
+	return l.evict()
+}
+
+func (l *lru) evict() []*lruEntry {
+	var evicted []*lruEntry
+	for l.size > l.maxBytes {
+		e := l.remove(l.order.Back().Value.(*lruEntry).key)
+		evicted = append(evicted, e)
+	}
+	return evicted
+}
+
+func (l *lru) remove(key string) *lruEntry {
+	elem, ok := l.items[key]
+	if !ok {
+		return nil
+	}
+	l.order.Remove(elem)
+	delete(l.items, key)
+	e := elem.Value.(*lruEntry)
+	l.size -= e.size
+	return e
+}
+
+func (l *lru) keysWithPrefix(prefix string) []string {
+	if l == nil {
+		return nil
+	}
+	var keys []string
+	for key := range l.items {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
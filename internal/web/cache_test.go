@@ -0,0 +1,364 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryContent keeps files in memory and counts reads. Reads of files in
+// blocked wait until the channel is closed.
+type memoryContent struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	reads   map[string]int
+	blocked map[string]chan struct{}
+}
+
+func newMemoryContent() *memoryContent {
+	return &memoryContent{files: make(map[string][]byte), reads: make(map[string]int), blocked: make(map[string]chan struct{})}
+}
+
+func (m *memoryContent) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
+	key := cacheKey(videoId, filename)
+	m.mu.Lock()
+	m.reads[key]++
+	data, ok := m.files[key]
+	gate := m.blocked[key]
+	m.mu.Unlock()
+	if gate != nil {
+		<-gate
+	}
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return data, nil
+}
+
+func (m *memoryContent) Write(ctx context.Context, videoId string, filename string, data []byte) ([]VideoFile, error) {
+	return nil, m.WriteFile(ctx, videoId, filename, data)
+}
+
+func (m *memoryContent) WriteFile(ctx context.Context, videoId string, filename string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[cacheKey(videoId, filename)] = data
+	return nil
+}
+
+func (m *memoryContent) Delete(ctx context.Context, videoId string, filename string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, cacheKey(videoId, filename))
+	return nil
+}
+
+func (m *memoryContent) ListFiles(ctx context.Context, videoId string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *memoryContent) readCount(videoId, filename string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reads[cacheKey(videoId, filename)]
+}
+
+// block makes reads of a file wait until the returned function is called.
+func (m *memoryContent) block(videoId, filename string) func() {
+	gate := make(chan struct{})
+	m.mu.Lock()
+	m.blocked[cacheKey(videoId, filename)] = gate
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		delete(m.blocked, cacheKey(videoId, filename))
+		m.mu.Unlock()
+		close(gate)
+	}
+}
+
+// waitForReads waits until n reads of a file reached the content service.
+func (m *memoryContent) waitForReads(t *testing.T, videoId, filename string, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); m.readCount(videoId, filename) < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d reads of %s/%s, want %d", m.readCount(videoId, filename), videoId, filename, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newTestCache(t *testing.T, content VideoContentService, memory, disk int64) *CachedContentService {
+	t.Helper()
+	config := ContentCacheConfig{MemoryBytes: memory}
+	if disk > 0 {
+		config.DiskDir, config.DiskBytes = t.TempDir(), disk
+	}
+	cache, err := NewCachedContentService(content, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+func mustRead(t *testing.T, c *CachedContentService, videoId, filename string, want []byte) {
+	t.Helper()
+	data, err := c.Read(context.Background(), videoId, filename)
+	if err != nil || !bytes.Equal(data, want) {
+		t.Fatalf("Read(%s, %s) = %q, %v, want %q", videoId, filename, data, err, want)
+	}
+}
+
+func TestCacheTiers(t *testing.T) {
+	content := newMemoryContent()
+	ctx := context.Background()
+	a, b := bytes.Repeat([]byte("a"), 8), bytes.Repeat([]byte("b"), 8)
+	content.WriteFile(ctx, "v", "a.m4s", a)
+	content.WriteFile(ctx, "v", "b.m4s", b)
+	cache := newTestCache(t, content, 10, 100)
+
+	mustRead(t, cache, "v", "a.m4s", a)
+	mustRead(t, cache, "v", "a.m4s", a)
+	if _, tier := cache.lookup(cacheKey("v", "a.m4s")); tier != "memory" {
+		t.Errorf("a is in %q, want memory", tier)
+	}
+
+	// b pushes a out of memory onto disk, and reading a brings it back.
+	mustRead(t, cache, "v", "b.m4s", b)
+	files, _ := os.ReadDir(cache.dir)
+	if len(files) != 1 {
+		t.Errorf("%d files on disk, want 1", len(files))
+	}
+	if data, tier := cache.lookup(cacheKey("v", "a.m4s")); tier != "disk" || !bytes.Equal(data, a) {
+		t.Errorf("lookup of a = %q from %q, want it from disk", data, tier)
+	}
+	mustRead(t, cache, "v", "b.m4s", b)
+	if content.readCount("v", "a.m4s") != 1 || content.readCount("v", "b.m4s") != 1 {
+		t.Errorf("content service read a %d and b %d times, want once each",
+			content.readCount("v", "a.m4s"), content.readCount("v", "b.m4s"))
+	}
+
+	cache.Invalidate("v", "")
+	if files, _ := os.ReadDir(cache.dir); len(files) != 0 || cache.cached(cacheKey("v", "a.m4s")) || cache.cached(cacheKey("v", "b.m4s")) {
+		t.Errorf("after invalidating the video: %d files on disk", len(files))
+	}
+}
+
+func TestCacheInvalidationDuringRead(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name       string
+		invalidate func(c *CachedContentService)
+		cached     bool
+	}{
+		{"same file", func(c *CachedContentService) { c.Invalidate("v", "a.m4s") }, false},
+		{"whole video", func(c *CachedContentService) { c.Invalidate("v", "") }, false},
+		{"other file", func(c *CachedContentService) { c.Invalidate("v", "b.m4s") }, true},
+		{"other video", func(c *CachedContentService) { c.Invalidate("w", "") }, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			content := newMemoryContent()
+			content.WriteFile(ctx, "v", "a.m4s", []byte("old"))
+			cache := newTestCache(t, content, 100, 0)
+
+			release := content.block("v", "a.m4s")
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				mustRead(t, cache, "v", "a.m4s", []byte("old"))
+			}()
+			content.waitForReads(t, "v", "a.m4s", 1)
+			test.invalidate(cache)
+			release()
+			<-done
+
+			if cache.cached(cacheKey("v", "a.m4s")) != test.cached {
+				t.Errorf("cached = %v, want %v", !test.cached, test.cached)
+			}
+		})
+	}
+}
+
+func TestCacheReadAfterInvalidationDoesNotJoinOldRead(t *testing.T) {
+	ctx := context.Background()
+	content := newMemoryContent()
+	content.WriteFile(ctx, "v", "a.m4s", []byte("old"))
+	cache := newTestCache(t, content, 100, 0)
+
+	release := content.block("v", "a.m4s")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.Read(ctx, "v", "a.m4s")
+	}()
+	content.waitForReads(t, "v", "a.m4s", 1)
+	if err := cache.WriteFile(ctx, "v", "a.m4s", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	mustRead(t, cache, "v", "a.m4s", []byte("new"))
+	<-done
+	mustRead(t, cache, "v", "a.m4s", []byte("new"))
+}
+
+func TestCacheConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	content := newMemoryContent()
+	for i := range 20 {
+		content.WriteFile(ctx, "v", fmt.Sprintf("%d.m4s", i), bytes.Repeat([]byte{byte(i)}, 10))
+	}
+	cache := newTestCache(t, content, 50, 100)
+
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 200 {
+				n := (g*7 + i) % 20
+				if i%25 == 0 {
+					cache.Invalidate("v", fmt.Sprintf("%d.m4s", n))
+					continue
+				}
+				mustRead(t, cache, "v", fmt.Sprintf("%d.m4s", n), bytes.Repeat([]byte{byte(n)}, 10))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every file on disk belongs to an entry of the disk tier.
+	files, _ := os.ReadDir(cache.dir)
+	if len(files) != len(cache.disk.items) {
+		t.Errorf("%d files on disk for %d entries", len(files), len(cache.disk.items))
+	}
+	if cache.memory.size > 50 || cache.disk.size > 100 {
+		t.Errorf("tiers hold %d and %d bytes", cache.memory.size, cache.disk.size)
+	}
+	if len(cache.reads) != 0 {
+		t.Errorf("%d reads left registered", len(cache.reads))
+	}
+}
+
+func TestCachePrefetchesNextSegments(t *testing.T) {
+	ctx := context.Background()
+	content := newMemoryContent()
+	content.WriteFile(ctx, "v", "manifest.mpd", []byte(testMPD))
+	// testMPD lasts 2 seconds without a segment duration, so segments are
+	// prefetched until one is missing.
+	for i := 1; i <= 4; i++ {
+		content.WriteFile(ctx, "v", fmt.Sprintf("chunk-0-%05d.m4s", i), []byte{byte(i)})
+	}
+	cache, err := NewCachedContentService(content, ContentCacheConfig{
+		MemoryBytes:      1 << 20,
+		PrefetchSegments: 2,
+		PrefetchPerVideo: 1,
+		PrefetchTotal:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mustRead(t, cache, "v", "chunk-0-00001.m4s", []byte{1})
+	content.waitForReads(t, "v", "chunk-0-00003.m4s", 1)
+	for cache.prefetchRunning() {
+		time.Sleep(time.Millisecond)
+	}
+	mustRead(t, cache, "v", "chunk-0-00002.m4s", []byte{2})
+	if n := content.readCount("v", "chunk-0-00002.m4s"); n != 1 {
+		t.Errorf("prefetched segment read %d times from the content service", n)
+	}
+	content.waitForReads(t, "v", "chunk-0-00004.m4s", 1)
+
+	// Manifests and files outside the template start no prefetch.
+	cache.Invalidate("v", "")
+	mustRead(t, cache, "v", "manifest.mpd", []byte(testMPD))
+	if cache.prefetchRunning() || content.readCount("v", "chunk-0-00001.m4s") != 1 {
+		t.Error("reading the manifest prefetched segments")
+	}
+}
+
+func TestCachePrefetchBounds(t *testing.T) {
+	ctx := context.Background()
+	content := newMemoryContent()
+	content.WriteFile(ctx, "v", "manifest.mpd", []byte(testMPD))
+	content.WriteFile(ctx, "v", "chunk-0-00001.m4s", []byte{1})
+	content.WriteFile(ctx, "v", "chunk-0-00002.m4s", []byte{2})
+	cache, err := NewCachedContentService(content, ContentCacheConfig{
+		MemoryBytes:      1 << 20,
+		PrefetchSegments: 1,
+		PrefetchPerVideo: 1,
+		PrefetchTotal:    1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first prefetch is stuck on the manifest, so the second read of
+	// the video starts none.
+	release := content.block("v", "manifest.mpd")
+	mustRead(t, cache, "v", "chunk-0-00001.m4s", []byte{1})
+	content.waitForReads(t, "v", "manifest.mpd", 1)
+	cache.Invalidate("v", "chunk-0-00001.m4s")
+	mustRead(t, cache, "v", "chunk-0-00001.m4s", []byte{1})
+	release()
+	content.waitForReads(t, "v", "chunk-0-00002.m4s", 1)
+	for cache.prefetchRunning() {
+		time.Sleep(time.Millisecond)
+	}
+	if n := content.readCount("v", "manifest.mpd"); n != 1 {
+		t.Errorf("manifest read %d times, want once by the one prefetch", n)
+	}
+}
+
+func TestCacheBoundsSegmentTemplates(t *testing.T) {
+	ctx := context.Background()
+	content := newMemoryContent()
+	cache, err := NewCachedContentService(content, ContentCacheConfig{MemoryBytes: 1 << 20, PrefetchSegments: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func(videoId string) {
+		t.Helper()
+		if names := cache.nextSegments(ctx, videoId, "chunk-0-00001.m4s"); len(names) != 1 || names[0] != "chunk-0-00002.m4s" {
+			t.Fatalf("next segments of %s = %q", videoId, names)
+		}
+	}
+	for i := range maxTemplates + 1 {
+		videoId := fmt.Sprintf("v%d", i)
+		content.WriteFile(ctx, videoId, "manifest.mpd", []byte(testMPD))
+		next(videoId)
+		if i == 1 {
+			// Used again, the first video outlives the second.
+			next("v0")
+		}
+	}
+
+	if len(cache.templates) != maxTemplates || cache.templateOrder.order.Len() != maxTemplates {
+		t.Errorf("naming of %d videos kept, %d ordered, want %d", len(cache.templates), cache.templateOrder.order.Len(), maxTemplates)
+	}
+	if _, ok := cache.templates["v1"]; ok {
+		t.Error("naming of the least recently used video kept")
+	}
+	if _, ok := cache.templates["v0"]; !ok {
+		t.Error("naming of a recently used video dropped")
+	}
+
+	cache.Invalidate("v0", "manifest.mpd")
+	if _, ok := cache.templateOrder.items["v0"]; ok {
+		t.Error("invalidated naming still ordered")
+	}
+	// Dropped naming is parsed again from the manifest.
+	next("v1")
+}
+
+// prefetchRunning reports whether any prefetch is running.
+func (c *CachedContentService) prefetchRunning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.prefetching) > 0
+}
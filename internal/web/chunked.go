@@ -0,0 +1,245 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"tritontube/internal/manifest"
+)
+
+const (
+	defaultLiveChunkDuration = 500 * time.Millisecond
+	defaultLiveTargetLatency = 3 * time.Second
+	// liveChunkSyncInterval is how often low-latency streams copy new
+	// chunks to the content service.
+	liveChunkSyncInterval = 100 * time.Millisecond
+	// tmpSuffix marks files ffmpeg is still writing.
+	tmpSuffix = ".tmp"
+)
+
+// liveSegmentName matches the segment names of liveCommand.
+var liveSegmentName = regexp.MustCompile(`^(?:init-(.+)|chunk-(.+)-(\d+))\.m4s$`)
+
+// liveSegment is a segment file in the work directory of a stream.
+type liveSegment struct {
+	name    string // without tmpSuffix
+	writing bool   // still under its temporary name
+	rep     string
+	number  int // -1 for initialization segments
+}
+
+// appendLiveChunks copies what ffmpeg wrote to the segments of st since the
+// last call to the content service. Segments are complete once ffmpeg has
+// given them their final name and started the next one, or once it has
+// exited. Failures are retried on the next call.
+func (s *server) appendLiveChunks(ctx context.Context, st *liveStream, exited bool) {
+	entries, err := os.ReadDir(st.dir)
+	if err != nil {
+		slog.Warn("Failed to list live segments", "video", st.videoId, "err", err)
+		return
+	}
+
+	var segments []liveSegment
+	seen := make(map[string]bool)
+	latest := make(map[string]int)
+	for _, entry := range entries {
+		name, writing := strings.CutSuffix(entry.Name(), tmpSuffix)
+		m := liveSegmentName.FindStringSubmatch(name)
+		if m == nil || seen[name] {
+			// Both names are listed if ffmpeg renamed the file meanwhile.
+			continue
+		}
+		seen[name] = true
+		seg := liveSegment{name: name, writing: writing, rep: m[1], number: -1}
+		if m[1] == "" {
+			seg.rep = m[2]
+			seg.number, _ = strconv.Atoi(m[3])
+			latest[seg.rep] = max(latest[seg.rep], seg.number)
+		}
+		segments = append(segments, seg)
+	}
+	// Initialization segments first, then media segments in order.
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].number != segments[j].number {
+			return segments[i].number < segments[j].number
+		}
+		return segments[i].name < segments[j].name
+	})
+
+	appender := s.contentService.(FileAppender)
+	for _, seg := range segments {
+		if _, done := st.uploaded[seg.name]; done {
+			continue
+		}
+		complete := exited
+		if !seg.writing && len(latest) > 0 {
+			complete = complete || seg.number < latest[seg.rep]
+		}
+
+		path := filepath.Join(st.dir, seg.name)
+		if seg.writing {
+			path += tmpSuffix
+		}
+		offset := s.live.sent(st, seg.name)
+		data, err := readFrom(path, offset)
+		if errors.Is(err, os.ErrNotExist) {
+			// Renamed since the listing; picked up next time.
+			continue
+		}
+		if err != nil {
+			slog.Warn("Failed to read live segment", "video", st.videoId, "file", seg.name, "err", err)
+			return
+		}
+		if len(data) == 0 && !complete {
+			continue
+		}
+		if err := appender.AppendFile(ctx, st.videoId, seg.name, offset, data, complete); err != nil {
+			slog.Warn("Failed to store live chunk", "video", st.videoId, "file", seg.name, "err", err)
+			return
+		}
+		s.live.setSent(st, seg.name, offset+int64(len(data)))
+		if offset == 0 {
+			st.unrecorded = true
+		}
+		if complete {
+			file, err := statVideoFile(path)
+			if err != nil {
+				file = VideoFile{Size: offset + int64(len(data))}
+			}
+			file.Filename = seg.name
+			st.uploaded[seg.name] = file
+			st.unrecorded = true
+		}
+	}
+}
+
+// readFrom reads the file at path from offset to its end.
+func readFrom(path string, offset int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek: %w", err)
+	}
+	return io.ReadAll(f)
+}
+
+// sent returns how much of a segment of st has been stored.
+func (l *liveStreams) sent(st *liveStream, name string) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return st.sent[name]
+}
+
+func (l *liveStreams) setSent(st *liveStream, name string, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := st.sent[name]; !ok {
+		close(st.segmentAdded)
+		st.segmentAdded = make(chan struct{})
+	}
+	st.sent[name] = size
+}
+
+// waitSegment waits until storing the segment name of st has begun, for at
+// most timeout, and reports whether it has.
+func (l *liveStreams) waitSegment(ctx context.Context, st *liveStream, name string, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		l.mu.Lock()
+		_, ok := st.sent[name]
+		added := st.segmentAdded
+		l.mu.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-added:
+		case <-st.done:
+			return false
+		case <-deadline.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// streamLiveSegment answers a request for a segment of a low-latency live
+// stream, sending it with chunked transfer encoding as it is stored. Players
+// ask for a segment before it is complete, and even slightly before it is
+// begun. It returns false if the request is not for such a segment.
+func (s *server) streamLiveSegment(w http.ResponseWriter, r *http.Request, videoId, filename string) bool {
+	if s.live == nil || !s.live.config.LowLatency || manifest.IsManifest(filename) || !liveSegmentName.MatchString(filename) {
+		return false
+	}
+	st, state := s.live.get(videoId)
+	if st == nil || state == liveProcessing {
+		return false
+	}
+	reader, ok := s.contentService.(StreamReader)
+	if !ok {
+		return false
+	}
+
+	wait := 2 * time.Duration(contentEncoding(s.contentService).SegmentDuration) * time.Second
+	if !s.live.waitSegment(r.Context(), st, filename, wait) {
+		sendErrorResponse(w, http.StatusNotFound, "Segment not available")
+		return true
+	}
+	body, err := reader.ReadStream(r.Context(), videoId, filename)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error reading video content")
+		slog.ErrorContext(r.Context(), "Content service stream error", "err", err)
+		return true
+	}
+	defer body.Close()
+
+	// The status is only known once the first chunk arrives.
+	buf := make([]byte, 64<<10)
+	n, err := body.Read(buf)
+	if err != nil && !errors.Is(err, io.EOF) {
+		if errors.Is(err, os.ErrNotExist) {
+			sendErrorResponse(w, http.StatusNotFound, "Segment not available")
+		} else {
+			sendErrorResponse(w, http.StatusInternalServerError, "Error reading video content")
+			slog.ErrorContext(r.Context(), "Content service stream error", "err", err)
+		}
+		return true
+	}
+
+	w.Header().Set("Content-Type", "video/mp4")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	for n > 0 {
+		if _, err := w.Write(buf[:n]); err != nil {
+			return true
+		}
+		_ = rc.Flush()
+		if err != nil {
+			break
+		}
+		n, err = body.Read(buf)
+		if err != nil && !errors.Is(err, io.EOF) {
+			// Too late for an error status; cut the response short so
+			// the player retries.
+			slog.WarnContext(r.Context(), "Live segment stream failed", "video", videoId, "file", filename, "err", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+	return true
+}
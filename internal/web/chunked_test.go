@@ -0,0 +1,206 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLiveSegmentName(t *testing.T) {
+	for name, want := range map[string]bool{
+		"init-0.m4s":            true,
+		"chunk-0-00001.m4s":     true,
+		"chunk-1-12345.m4s":     true,
+		"chunk-0-00001.m4s.tmp": false,
+		"chunk-0.m4s":           false,
+		"manifest.mpd":          false,
+		"thumbnail.jpg":         false,
+	} {
+		if got := liveSegmentName.MatchString(name); got != want {
+			t.Errorf("liveSegmentName matches %q: %v, want %v", name, got, want)
+		}
+	}
+}
+
+func lowLatencyConfig() LiveConfig {
+	config := testLiveConfig()
+	config.LowLatency = true
+	return config
+}
+
+func TestAppendLiveChunks(t *testing.T) {
+	s, st := newLiveStream(t, lowLatencyConfig())
+	ctx := context.Background()
+	stored := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(s.contentService.(*FSVideoContentService).BaseDir, st.videoId, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	writeLive(t, st, map[string]string{"init-0.m4s": "init", "chunk-0-00001.m4s.tmp": "moof1"})
+	s.appendLiveChunks(ctx, st, false)
+	if got := stored("chunk-0-00001.m4s"); got != "moof1" {
+		t.Errorf("first chunk stored as %q", got)
+	}
+	if _, ok := st.uploaded["chunk-0-00001.m4s"]; ok {
+		t.Errorf("segment still being written counted as complete")
+	}
+	// The initialization segment is final once named so, but is only
+	// complete once a media segment follows it.
+	if got := stored("init-0.m4s"); got != "init" {
+		t.Errorf("initialization segment stored as %q", got)
+	}
+
+	// Only what was added since is sent.
+	writeLive(t, st, map[string]string{"chunk-0-00001.m4s.tmp": "moof1mdat1moof2"})
+	s.appendLiveChunks(ctx, st, false)
+	if got := stored("chunk-0-00001.m4s"); got != "moof1mdat1moof2" {
+		t.Errorf("segment stored as %q", got)
+	}
+	if sent := s.live.sent(st, "chunk-0-00001.m4s"); sent != 15 {
+		t.Errorf("sent = %d", sent)
+	}
+
+	// Renamed and followed by the next segment, it is complete.
+	os.Remove(filepath.Join(st.dir, "chunk-0-00001.m4s.tmp"))
+	writeLive(t, st, map[string]string{"chunk-0-00001.m4s": "moof1mdat1moof2mdat2", "chunk-0-00002.m4s.tmp": ""})
+	s.appendLiveChunks(ctx, st, false)
+	if want := newVideoFile("chunk-0-00001.m4s", []byte("moof1mdat1moof2mdat2")); st.uploaded["chunk-0-00001.m4s"] != want {
+		t.Errorf("complete segment = %+v, want %+v", st.uploaded["chunk-0-00001.m4s"], want)
+	}
+	if _, ok := s.live.streams[st.videoId].sent["chunk-0-00002.m4s"]; ok {
+		t.Errorf("empty segment begun")
+	}
+
+	// Once ffmpeg exits everything left is complete.
+	writeLive(t, st, map[string]string{"chunk-0-00002.m4s.tmp": "last"})
+	s.appendLiveChunks(ctx, st, true)
+	for _, name := range []string{"init-0.m4s", "chunk-0-00002.m4s"} {
+		if _, ok := st.uploaded[name]; !ok {
+			t.Errorf("%s not complete after ffmpeg exited", name)
+		}
+	}
+}
+
+func TestWaitSegment(t *testing.T) {
+	l := newLiveStreams(lowLatencyConfig())
+	st, err := l.reserve("live-1", "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if l.waitSegment(ctx, st, "chunk-0-00001.m4s", 10*time.Millisecond) {
+		t.Errorf("segment nobody began reported begun")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		l.setSent(st, "init-0.m4s", 4)
+		l.setSent(st, "chunk-0-00001.m4s", 0)
+	}()
+	if !l.waitSegment(ctx, st, "chunk-0-00001.m4s", 5*time.Second) {
+		t.Errorf("begun segment not reported")
+	}
+
+	close(st.done)
+	start := time.Now()
+	if l.waitSegment(ctx, st, "chunk-0-00002.m4s", 5*time.Second) || time.Since(start) > time.Second {
+		t.Errorf("waited for a segment of an ended stream")
+	}
+}
+
+func TestStreamLiveSegment(t *testing.T) {
+	s, st := newLiveStream(t, lowLatencyConfig())
+	s.live.setState(st, liveStreaming)
+	srv := httptest.NewServer(newTestServer(t, s))
+	defer srv.Close()
+	ctx := context.Background()
+
+	// The player asks for the segment before ffmpeg begins it.
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/api/v1/content/live-1/chunk-0-00001.m4s")
+		if err != nil {
+			t.Error(err)
+			close(responses)
+			return
+		}
+		responses <- resp
+	}()
+	time.Sleep(50 * time.Millisecond)
+	writeLive(t, st, map[string]string{"init-0.m4s": "init", "chunk-0-00001.m4s.tmp": "moof1"})
+	s.appendLiveChunks(ctx, st, false)
+
+	var resp *http.Response
+	select {
+	case resp = <-responses:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response to a begun segment")
+	}
+	if resp == nil {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("status %d, transfer encoding %q", resp.StatusCode, resp.TransferEncoding)
+	}
+	if got := resp.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+	first := make([]byte, 5)
+	if _, err := io.ReadFull(resp.Body, first); err != nil || string(first) != "moof1" {
+		t.Fatalf("first chunk = %q, %v", first, err)
+	}
+
+	writeLive(t, st, map[string]string{"chunk-0-00001.m4s.tmp": "moof1mdat1"})
+	s.appendLiveChunks(ctx, st, true)
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil || string(rest) != "mdat1" {
+		t.Errorf("rest of the segment = %q, %v", rest, err)
+	}
+}
+
+func TestStreamLiveSegmentFallsBack(t *testing.T) {
+	s, st := newLiveStream(t, lowLatencyConfig())
+	handler := newTestServer(t, s)
+	content := s.contentService.(FileWriter)
+	for _, name := range []string{manifestFile, "chunk-0-00001.m4s"} {
+		if err := content.WriteFile(context.Background(), st.videoId, name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	get := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/content/live-1/"+name, nil))
+		return w
+	}
+
+	// Manifests change as a whole and are served as usual.
+	if w := get(manifestFile); w.Code != http.StatusOK || w.Header().Get("Cache-Control") == "no-cache" {
+		t.Errorf("manifest: %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+	// Once the stream is being converted its files are complete.
+	s.live.setState(st, liveProcessing)
+	if w := get("chunk-0-00001.m4s"); w.Code != http.StatusOK || w.Body.String() != "chunk-0-00001.m4s" {
+		t.Errorf("segment after the stream ended: %d %q", w.Code, w.Body)
+	}
+	// As is everything once the stream is gone.
+	s.live.setState(st, liveStreaming)
+	s.live.release(st.videoId)
+	if w := get("chunk-0-00001.m4s"); w.Code != http.StatusOK {
+		t.Errorf("segment of a finished stream: %d", w.Code)
+	}
+
+	s.live.config.LowLatency = false
+	if s.streamLiveSegment(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), st.videoId, "chunk-0-00001.m4s") {
+		t.Errorf("segment streamed without low latency")
+	}
+}
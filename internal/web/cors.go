@@ -0,0 +1,75 @@
+package web
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"tritontube/internal/logging"
+)
+
+// CORSPolicy says which other origins may call the API from a browser.
+type CORSPolicy struct {
+	// AllowedOrigins are origins such as "https://app.example.com", or
+	// "*" for any origin.
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies, which requires
+	// explicit origins.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response.
+	MaxAge time.Duration
+}
+
+// DefaultCORSPolicy lets any origin call the API without cookies, as the
+// API always allowed.
+var DefaultCORSPolicy = CORSPolicy{
+	AllowedOrigins: []string{"*"},
+	AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete},
+	AllowedHeaders: []string{"Content-Type", "Authorization"},
+	MaxAge:         10 * time.Minute,
+}
+
+func (p *CORSPolicy) allowsOrigin(origin string) bool {
+	return slices.Contains(p.AllowedOrigins, "*") || slices.Contains(p.AllowedOrigins, origin)
+}
+
+// cors applies the server's CORS policy to every response and answers
+// preflight requests itself.
+func (s *server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := s.corsPolicy.Load()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		header := w.Header()
+		header.Add("Vary", "Origin")
+		allowed := origin != "" && policy.allowsOrigin(origin)
+		if allowed {
+			if slices.Contains(policy.AllowedOrigins, "*") && !policy.AllowCredentials {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if policy.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+			header.Set("Access-Control-Expose-Headers", logging.RequestIDHeader)
+		}
+
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if allowed {
+			header.Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+			header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			if policy.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,78 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// corsRequest sends a request from origin, a preflight if preflight is set.
+func corsRequest(handler http.Handler, origin string, preflight bool) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/videos", nil)
+	if preflight {
+		r = httptest.NewRequest(http.MethodOptions, "/api/v1/videos", nil)
+		r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	if origin != "" {
+		r.Header.Set("Origin", origin)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCORSDefaultPolicyAllowsAnyOrigin(t *testing.T) {
+	_, handler := newSQLiteServer(t)
+	w := corsRequest(handler, "https://elsewhere.example", false)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("GET: %d, Access-Control-Allow-Origin %q", w.Code, w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("default policy allows credentials")
+	}
+}
+
+func TestCORSExplicitOrigins(t *testing.T) {
+	s, handler := newSQLiteServer(t, WithCORSPolicy(CORSPolicy{
+		AllowedOrigins:   []string{"https://app.example.com"},
+		AllowedMethods:   []string{http.MethodGet, http.MethodPost},
+		AllowedHeaders:   []string{"Content-Type"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}))
+
+	w := corsRequest(handler, "https://app.example.com", true)
+	header := w.Header()
+	if w.Code != http.StatusNoContent {
+		t.Errorf("preflight status = %d", w.Code)
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Allow-Methods":     "GET, POST",
+		"Access-Control-Allow-Headers":     "Content-Type",
+		"Access-Control-Max-Age":           "3600",
+		"Vary":                             "Origin",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	w = corsRequest(handler, "https://evil.example", true)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "" || w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("preflight from another origin: %d, %v", w.Code, w.Header())
+	}
+
+	// Same-origin requests carry no Origin and get no CORS headers.
+	if w := corsRequest(handler, "", false); w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("same-origin GET: %d, %v", w.Code, w.Header())
+	}
+
+	// A reload changes the policy of the running server.
+	s.SetCORSPolicy(DefaultCORSPolicy)
+	if w := corsRequest(handler, "https://evil.example", false); w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("after SetCORSPolicy: %v", w.Header())
+	}
+}
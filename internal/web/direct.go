@@ -0,0 +1,78 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"tritontube/internal/manifest"
+	"tritontube/internal/security"
+	"tritontube/internal/storage"
+)
+
+const defaultDirectURLTTL = 5 * time.Minute
+
+// DirectContent lets clients fetch segments from the storage node holding
+// them instead of through the web server, which then only serves manifests
+// and checks access.
+type DirectContent struct {
+	// Locate returns the address of the storage node holding a file.
+	Locate func(videoId, filename string) string
+	// URLs maps storage node addresses to the base URL of their HTTP
+	// endpoint. Files on nodes without one are served by the web server.
+	URLs map[string]string
+	// Key signs the URLs and must match the nodes' key.
+	Key []byte
+	// TTL is how long a signed URL stays valid.
+	TTL time.Duration
+}
+
+// Validate reports a missing key or a malformed URL.
+func (d DirectContent) Validate() error {
+	if len(d.URLs) > 0 && len(d.Key) == 0 {
+		return fmt.Errorf("direct serving needs a URL signing key")
+	}
+	for node, base := range d.URLs {
+		u, err := url.Parse(base)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid URL %q for node %s", base, node)
+		}
+	}
+	return nil
+}
+
+// directURL returns a signed URL on the storage node holding a file, or ""
+// if the file must be served by the web server. Manifests always are, as
+// they may be rewritten per request.
+func (s *server) directURL(videoId, filename string, now time.Time) string {
+	d := s.direct
+	if d == nil || d.Locate == nil || manifest.IsManifest(filename) {
+		return ""
+	}
+	base, ok := d.URLs[d.Locate(videoId, filename)]
+	if !ok {
+		return ""
+	}
+	ttl := d.TTL
+	if ttl <= 0 {
+		ttl = defaultDirectURLTTL
+	}
+	path := storage.ContentPath(videoId, filename)
+	signer := security.URLSigner{Key: d.Key}
+	return strings.TrimRight(base, "/") + path + "?" + signer.Sign(path, now.Add(ttl))
+}
+
+// redirectToNode answers with a redirect to the storage node serving the
+// file if there is one.
+func (s *server) redirectToNode(w http.ResponseWriter, r *http.Request, videoId, filename string) bool {
+	target := s.directURL(videoId, filename, time.Now())
+	if target == "" {
+		return false
+	}
+	// The signature expires, so the redirect must not be reused.
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+	return true
+}
@@ -0,0 +1,52 @@
+package web
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tritontube/internal/security"
+	"tritontube/internal/storage"
+)
+
+func TestDirectURLsOfAwkwardNames(t *testing.T) {
+	const videoId, filename = "my video?#%", "seg 1#?.m4s"
+	key := []byte("url key")
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, videoId), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, videoId, filename), []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	node := httptest.NewServer(storage.NewStorageServer(dir, 0).HTTPHandler(security.URLSigner{Key: key}))
+	defer node.Close()
+
+	s, handler := newSQLiteServer(t, WithDirectContent(DirectContent{
+		Locate: func(string, string) string { return "node:8090" },
+		URLs:   map[string]string{"node:8090": node.URL + "/"},
+		Key:    key,
+	}))
+	storeVideo(t, s, videoId, "", VisibilityPublic)
+
+	w := httptest.NewRecorder()
+	path := "/api/v1/content/" + url.PathEscape(videoId) + "/" + url.PathEscape(filename)
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("GET %s = %d %s", path, w.Code, w.Body)
+	}
+
+	resp, err := http.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "segment" {
+		t.Errorf("GET %s = %d, %q", w.Header().Get("Location"), resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,260 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync/atomic"
+)
+
+// Rendition is one video quality of the DASH output.
+type Rendition struct {
+	// Height scales the video to this many lines, keeping the aspect
+	// ratio. Zero keeps the source resolution.
+	Height  int
+	Bitrate string
+}
+
+// Encoding describes how uploads are transcoded to DASH.
+type Encoding struct {
+	Renditions   []Rendition
+	AudioBitrate string
+	// Preset is the x264 speed/quality preset, e.g. "veryfast". Empty
+	// leaves ffmpeg's default.
+	Preset           string
+	SegmentDuration  int // seconds
+	KeyframeInterval int // frames
+	// PosterPosition is where the poster frame is taken, in percent of
+	// the duration.
+	PosterPosition int
+	Thumbnails     Thumbnails
+}
+
+// Thumbnails describes the scrub preview images made from each video:
+// sprite sheets of Columns×Columns thumbnails and a WebVTT track mapping
+// time ranges to them.
+type Thumbnails struct {
+	// Interval is the seconds between thumbnails. Zero makes none.
+	Interval      int
+	Width, Height int // pixels
+	Columns       int
+}
+
+// DefaultEncoding is the single-quality encoding used unless configured
+// otherwise.
+var DefaultEncoding = Encoding{
+	Renditions:       []Rendition{{Bitrate: "3000k"}},
+	AudioBitrate:     "128k",
+	SegmentDuration:  4,
+	KeyframeInterval: 120,
+	PosterPosition:   10,
+	Thumbnails:       Thumbnails{Interval: 10, Width: 160, Height: 90, Columns: 10},
+}
+
+var (
+	bitratePattern = regexp.MustCompile(`^[0-9]+[kKM]?$`)
+	presets        = map[string]bool{
+		"ultrafast": true, "superfast": true, "veryfast": true, "faster": true, "fast": true,
+		"medium": true, "slow": true, "slower": true, "veryslow": true, "placebo": true,
+	}
+)
+
+// Validate reports the first setting ffmpeg would reject.
+func (e Encoding) Validate() error {
+	if len(e.Renditions) == 0 {
+		return errors.New("at least one rendition is required")
+	}
+	for i, r := range e.Renditions {
+		if r.Height < 0 || r.Height%2 != 0 {
+			return fmt.Errorf("rendition %d: height must be a positive even number or 0, got %d", i, r.Height)
+		}
+		if !bitratePattern.MatchString(r.Bitrate) {
+			return fmt.Errorf("rendition %d: invalid bitrate %q, want e.g. 3000k", i, r.Bitrate)
+		}
+	}
+	if !bitratePattern.MatchString(e.AudioBitrate) {
+		return fmt.Errorf("invalid audio bitrate %q, want e.g. 128k", e.AudioBitrate)
+	}
+	if e.Preset != "" && !presets[e.Preset] {
+		return fmt.Errorf("unknown x264 preset %q", e.Preset)
+	}
+	if e.SegmentDuration <= 0 {
+		return fmt.Errorf("segment duration must be positive, got %d", e.SegmentDuration)
+	}
+	if e.KeyframeInterval <= 0 {
+		return fmt.Errorf("keyframe interval must be positive, got %d", e.KeyframeInterval)
+	}
+	if e.PosterPosition < 0 || e.PosterPosition >= 100 {
+		return fmt.Errorf("poster position must be a percentage from 0 to 99, got %d", e.PosterPosition)
+	}
+	if t := e.Thumbnails; t.Interval < 0 {
+		return fmt.Errorf("thumbnail interval must not be negative, got %d", t.Interval)
+	} else if t.Interval > 0 {
+		if t.Width <= 0 || t.Width%2 != 0 || t.Height <= 0 || t.Height%2 != 0 {
+			return fmt.Errorf("thumbnail size must be positive even numbers, got %dx%d", t.Width, t.Height)
+		}
+		if t.Columns <= 0 {
+			return fmt.Errorf("thumbnail columns must be positive, got %d", t.Columns)
+		}
+	}
+	return nil
+}
+
+// dashCommand builds the ffmpeg command transcoding input into a DASH
+// manifest and its segments. Several renditions share one video adaptation
+// set so players can switch between them. The same segments are listed in
+// HLS playlists too, master.m3u8 and a media playlist per stream, for
+// players without DASH support such as Safari.
+func (e Encoding) dashCommand(input, manifest string) *exec.Cmd {
+	args := []string{"-i", input}
+	multi := len(e.Renditions) > 1
+	if multi {
+		for range e.Renditions {
+			args = append(args, "-map", "0:v:0")
+		}
+		args = append(args, "-map", "0:a:0?")
+	}
+	args = append(args,
+		"-c:v", "libx264",
+		"-c:a", "aac",
+		"-bf", "1",
+		"-keyint_min", strconv.Itoa(e.KeyframeInterval),
+		"-g", strconv.Itoa(e.KeyframeInterval),
+		"-sc_threshold", "0",
+	)
+	if e.Preset != "" {
+		args = append(args, "-preset", e.Preset)
+	}
+	if multi {
+		for i, r := range e.Renditions {
+			args = append(args, fmt.Sprintf("-b:v:%d", i), r.Bitrate)
+			if r.Height > 0 {
+				args = append(args, fmt.Sprintf("-filter:v:%d", i), fmt.Sprintf("scale=-2:%d", r.Height))
+			}
+		}
+		sets := "id=0,streams=v"
+		if hasAudio(input) {
+			sets += " id=1,streams=a"
+		}
+		args = append(args, "-adaptation_sets", sets)
+	} else {
+		r := e.Renditions[0]
+		args = append(args, "-b:v", r.Bitrate)
+		if r.Height > 0 {
+			args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", r.Height))
+		}
+	}
+	args = append(args,
+		"-b:a", e.AudioBitrate,
+		"-f", "dash",
+		"-use_timeline", "1",
+		"-use_template", "1",
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+		"-seg_duration", strconv.Itoa(e.SegmentDuration),
+		"-hls_playlist", "1",
+		manifest,
+	)
+	return exec.Command("ffmpeg", args...)
+}
+
+// liveCommand builds the ffmpeg command that reads a live stream from input,
+// ffmpeg input options that wait for an encoder to publish, and packages it
+// as live DASH: a dynamic manifest listing the last config.Window segments.
+// In low-latency mode segments are written in CMAF chunks as they are
+// encoded, under a temporary name until they are complete. The stream is
+// also recorded unchanged to recording, from which the on-demand video is
+// made once it ends. Live streams get the first rendition only.
+func (e Encoding) liveCommand(input []string, config LiveConfig, manifest, recording string) *exec.Cmd {
+	r := e.Renditions[0]
+	args := slices.Concat(input, []string{
+		"-map", "0:v:0",
+		"-map", "0:a:0?",
+		"-c:v", "libx264",
+		"-c:a", "aac",
+		"-bf", "1",
+		"-keyint_min", strconv.Itoa(e.KeyframeInterval),
+		"-g", strconv.Itoa(e.KeyframeInterval),
+		"-sc_threshold", "0",
+		"-b:v", r.Bitrate,
+		"-b:a", e.AudioBitrate,
+	})
+	if e.Preset != "" {
+		args = append(args, "-preset", e.Preset)
+	}
+	if r.Height > 0 {
+		args = append(args, "-vf", fmt.Sprintf("scale=-2:%d", r.Height))
+	}
+	args = append(args,
+		"-f", "dash",
+		"-window_size", strconv.Itoa(config.Window),
+		"-extra_window_size", strconv.Itoa(config.Window),
+		"-use_template", "1",
+		"-init_seg_name", "init-$RepresentationID$.m4s",
+		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
+		"-seg_duration", strconv.Itoa(e.SegmentDuration),
+	)
+	if config.LowLatency {
+		// Low-latency DASH players locate segments by number, not timeline.
+		args = append(args,
+			"-use_timeline", "0",
+			"-streaming", "1",
+			"-ldash", "1",
+			"-frag_type", "duration",
+			"-frag_duration", strconv.FormatFloat(config.ChunkDuration.Seconds(), 'f', -1, 64),
+			"-target_latency", strconv.FormatFloat(config.TargetLatency.Seconds(), 'f', -1, 64),
+		)
+	} else {
+		args = append(args, "-use_timeline", "1")
+	}
+	args = append(args,
+		manifest,
+		"-map", "0",
+		"-c", "copy",
+		"-f", "matroska",
+		recording,
+	)
+	return exec.Command("ffmpeg", args...)
+}
+
+// hasAudio reports whether input has an audio stream. An empty adaptation
+// set would make an invalid manifest.
+func hasAudio(input string) bool {
+	out, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "a",
+		"-show_entries", "stream=index", "-of", "csv=p=0", input).Output()
+	return err == nil && len(bytes.TrimSpace(out)) > 0
+}
+
+// encodingSetting holds the Encoding of a content service. Its zero value
+// uses DefaultEncoding.
+type encodingSetting struct {
+	p atomic.Pointer[Encoding]
+}
+
+// SetEncoding changes how later uploads are transcoded.
+func (s *encodingSetting) SetEncoding(e Encoding) {
+	s.p.Store(&e)
+}
+
+func (s *encodingSetting) encoding() Encoding {
+	if e := s.p.Load(); e != nil {
+		return *e
+	}
+	return DefaultEncoding
+}
+
+// contentEncoding returns the Encoding of a content service, looking
+// through a cache in front of it.
+func contentEncoding(c VideoContentService) Encoding {
+	switch c := c.(type) {
+	case interface{ encoding() Encoding }:
+		return c.encoding()
+	case *CachedContentService:
+		return contentEncoding(c.VideoContentService)
+	}
+	return DefaultEncoding
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"tritontube/internal/manifest"
+)
+
+func TestDashCommandWritesHLSPlaylists(t *testing.T) {
+	e := DefaultEncoding
+	e.Renditions = []Rendition{{Height: 720, Bitrate: "3000k"}, {Height: 360, Bitrate: "800k"}}
+	args := e.dashCommand("input.mp4", "out/manifest.mpd").Args
+	if args[len(args)-1] != "out/manifest.mpd" {
+		t.Errorf("output = %q", args[len(args)-1])
+	}
+	i := slices.Index(args, "-hls_playlist")
+	if i < 0 || args[i+1] != "1" {
+		t.Errorf("no HLS playlists in %q", args)
+	}
+}
+
+func TestEncodingValidate(t *testing.T) {
+	if err := DefaultEncoding.Validate(); err != nil {
+		t.Errorf("DefaultEncoding: %v", err)
+	}
+	for name, change := range map[string]func(e *Encoding){
+		"no renditions":   func(e *Encoding) { e.Renditions = nil },
+		"odd height":      func(e *Encoding) { e.Renditions = []Rendition{{Height: 721, Bitrate: "1M"}} },
+		"bad bitrate":     func(e *Encoding) { e.AudioBitrate = "loud" },
+		"unknown preset":  func(e *Encoding) { e.Preset = "instant" },
+		"poster past end": func(e *Encoding) { e.PosterPosition = 100 },
+	} {
+		e := DefaultEncoding
+		change(&e)
+		if err := e.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+// TestTranscodeWithFFmpeg transcodes a generated clip with the local ffmpeg.
+func TestTranscodeWithFFmpeg(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mp4")
+	generate := exec.Command("ffmpeg", "-f", "lavfi", "-i", "testsrc=duration=3:size=320x240:rate=30",
+		"-f", "lavfi", "-i", "sine=duration=3", "-shortest", "-y", input)
+	if out, err := generate.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate input: %v\n%s", err, out)
+	}
+
+	e := DefaultEncoding
+	e.Renditions = []Rendition{{Height: 240, Bitrate: "500k"}, {Height: 120, Bitrate: "200k"}}
+	e.SegmentDuration, e.KeyframeInterval = 1, 30
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := runFFmpeg(context.Background(), "transcode", e.dashCommand(input, filepath.Join(out, "manifest.mpd"))); err != nil {
+		t.Fatal(err)
+	}
+
+	master, err := os.ReadFile(filepath.Join(out, "master.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewritten, err := manifest.RewriteHLS(master, manifest.Options{BaseURLs: []string{"https://cdn.example.com/v/"}})
+	if err != nil {
+		t.Fatalf("rewriting ffmpeg's master playlist: %v\n%s", err, master)
+	}
+	t.Logf("%s", rewritten)
+	for _, name := range []string{"media_0.m3u8", "media_1.m3u8"} {
+		if _, err := os.Stat(filepath.Join(out, name)); err != nil {
+			t.Errorf("media playlist: %v", err)
+		}
+	}
+}
+
+func TestLiveCommandLeavesInputAlone(t *testing.T) {
+	// Spare capacity would let appending overwrite the caller's array.
+	input := make([]string, 2, 64)
+	copy(input, []string{"-i", "srt://127.0.0.1:1935?mode=listener&passphrase=key"})
+	args := DefaultEncoding.liveCommand(input, LiveConfig{Window: 5}, "manifest.mpd", "recording.mkv").Args
+	if spare := input[:cap(input)][2:]; slices.ContainsFunc(spare, func(arg string) bool { return arg != "" }) {
+		t.Errorf("liveCommand wrote into the input array: %q", spare)
+	}
+	if !slices.Equal(args[1:3], input) || args[len(args)-1] != "recording.mkv" {
+		t.Errorf("args = %q", args)
+	}
+}
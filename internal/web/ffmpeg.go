@@ -0,0 +1,60 @@
+package web
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+	"tritontube/internal/metrics"
+	"tritontube/internal/tracing"
+)
+
+// ffmpegJobs counts running ffmpeg processes so shutdown can wait for them.
+var ffmpegJobs sync.WaitGroup
+
+// waitFFmpeg waits until no ffmpeg job is running or ctx is done.
+func waitFFmpeg(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		ffmpegJobs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runFFmpeg runs an ffmpeg command and records its duration and outcome
+// under stage (e.g. "dash" or "thumbnail") as metrics and a trace span.
+func runFFmpeg(ctx context.Context, stage string, cmd *exec.Cmd) error {
+	wait, err := startFFmpeg(ctx, stage, cmd)
+	if err != nil {
+		return err
+	}
+	return wait()
+}
+
+// startFFmpeg starts an ffmpeg command and returns a function that waits
+// for it to exit, recording it as runFFmpeg does.
+func startFFmpeg(ctx context.Context, stage string, cmd *exec.Cmd) (wait func() error, err error) {
+	ffmpegJobs.Add(1)
+	_, span := tracing.Start(ctx, "ffmpeg "+stage)
+	start := time.Now()
+	finish := func(err error) error {
+		tracing.End(span, err)
+		metrics.FFmpegDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+		if err != nil {
+			metrics.FFmpegFailures.WithLabelValues(stage).Inc()
+		}
+		ffmpegJobs.Done()
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, finish(err)
+	}
+	return func() error { return finish(cmd.Wait()) }, nil
+}
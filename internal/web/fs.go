@@ -3,19 +3,24 @@
 package web
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"tritontube/internal/storage"
 )
 
 // FSVideoContentService implements VideoContentService using the local filesystem.
 type FSVideoContentService struct {
 	BaseDir string
+	encodingSetting
+
+	growing storage.GrowingFiles
 }
 
 // Read implements VideoContentService.
-func (f *FSVideoContentService) Read(videoId string, filename string) ([]byte, error) {
+func (f *FSVideoContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
 	filePath := filepath.Join(f.BaseDir, videoId, filename)
 	data, err := os.ReadFile(filePath)
 	if err != nil {
@@ -25,100 +30,127 @@ func (f *FSVideoContentService) Read(videoId string, filename string) ([]byte, e
 }
 
 // Write implements VideoContentService.
-func (f *FSVideoContentService) Write(videoId string, filename string, data []byte) error {
+func (f *FSVideoContentService) Write(ctx context.Context, videoId string, filename string, data []byte) ([]VideoFile, error) {
 
 	videoDir := filepath.Join(f.BaseDir, videoId)
 	err := os.MkdirAll(videoDir, 0755)
 	if err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	projectRoot, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("failed to get working directory: %w", err)
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
 	}
 	tempDir := filepath.Join(projectRoot, "video-upload-"+videoId)
 	err = os.Mkdir(tempDir, 0755)
 	if err != nil && !os.IsExist(err) {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer os.RemoveAll(tempDir)
 
 	tempInputFile := filepath.Join(tempDir, filename)
 	err = os.WriteFile(tempInputFile, data, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to write input file: %w", err)
-	}
-
-	tempThumbnailPath := filepath.Join(tempDir, "thumbnail.jpg")
-	thumbnailCmd := exec.Command(
-		"ffmpeg",
-		"-i", tempInputFile,
-		"-ss", "00:00:01", // Take frame at 1 second
-		"-vframes", "1", // Take only one frame
-		"-q:v", "2", // High quality
-		"-y", // Overwrite output file if it exists
-		tempThumbnailPath,
-	)
-	if err := thumbnailCmd.Run(); err != nil {
-		return fmt.Errorf("failed to generate thumbnail: %w", err)
+		return nil, fmt.Errorf("failed to write input file: %w", err)
 	}
 
 	tempManifestPath := filepath.Join(tempDir, "manifest.mpd")
 
-	cmd := exec.Command(
-		"ffmpeg",
-		"-i", tempInputFile,
-		"-c:v", "libx264",
-		"-c:a", "aac",
-		"-bf", "1",
-		"-keyint_min", "120",
-		"-g", "120",
-		"-sc_threshold", "0",
-		"-b:v", "3000k",
-		"-b:a", "128k",
-		"-f", "dash",
-		"-use_timeline", "1",
-		"-use_template", "1",
-		"-init_seg_name", "init-$RepresentationID$.m4s",
-		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
-		"-seg_duration", "4",
-		tempManifestPath,
-	)
+	encoding := f.encoding()
+	cmd := encoding.dashCommand(tempInputFile, tempManifestPath)
 	cmd.Dir = tempDir
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to execute ffmpeg command: %w", err)
+	if err := runFFmpeg(ctx, "dash", cmd); err != nil {
+		return nil, fmt.Errorf("failed to execute ffmpeg command: %w", err)
+	}
+
+	if err := encoding.writeImages(ctx, tempInputFile, tempDir); err != nil {
+		return nil, fmt.Errorf("failed to generate thumbnails: %w", err)
 	}
 
 	err = os.Remove(tempInputFile)
 	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete temp input file: %w", err)
+		return nil, fmt.Errorf("failed to delete temp input file: %w", err)
 	}
 
 	files, err := os.ReadDir(tempDir)
 	if err != nil {
-		return fmt.Errorf("failed to read temp directory: %w", err)
+		return nil, fmt.Errorf("failed to read temp directory: %w", err)
 	}
+	var written []VideoFile
 	for _, file := range files {
 		src := filepath.Join(tempDir, file.Name())
 		dst := filepath.Join(videoDir, file.Name())
 		err := os.Rename(src, dst)
 		if err != nil {
-			return fmt.Errorf("failed to move file %s: %w", file.Name(), err)
+			return written, fmt.Errorf("failed to move file %s: %w", file.Name(), err)
 		}
+
+		videoFile, err := statVideoFile(dst)
+		if err != nil {
+			return append(written, VideoFile{Filename: file.Name()}), err
+		}
+		written = append(written, videoFile)
 	}
 
+	return written, nil
+}
+
+// WriteFile implements FileWriter. The file is replaced in one step, so
+// readers never see it half written.
+func (f *FSVideoContentService) WriteFile(ctx context.Context, videoId string, filename string, data []byte) error {
+	videoDir := filepath.Join(f.BaseDir, videoId)
+	if err := os.MkdirAll(videoDir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(videoDir, "."+filename+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(videoDir, filename)); err != nil {
+		return fmt.Errorf("failed to move file %s: %w", filename, err)
+	}
+	f.growing.Complete(filepath.Join(videoDir, filename))
 	return nil
 }
 
+// AppendFile implements FileAppender.
+func (f *FSVideoContentService) AppendFile(ctx context.Context, videoId string, filename string, offset int64, data []byte, complete bool) error {
+	_, err := f.growing.Append(filepath.Join(f.BaseDir, videoId, filename), offset, data, complete)
+	return err
+}
+
+// ReadStream implements StreamReader.
+func (f *FSVideoContentService) ReadStream(ctx context.Context, videoId string, filename string) (io.ReadCloser, error) {
+	filePath := filepath.Join(f.BaseDir, videoId, filename)
+	return pipeStream(ctx, func(ctx context.Context, w io.Writer) error {
+		return f.growing.Follow(ctx, filePath, func(data []byte) error {
+			_, err := w.Write(data)
+			return err
+		})
+	}), nil
+}
+
 // Delete implements VideoContentService.
-func (f *FSVideoContentService) Delete(videoId string, filename string) error {
+func (f *FSVideoContentService) Delete(ctx context.Context, videoId string, filename string) error {
 	filePath := filepath.Join(f.BaseDir, videoId, filename)
 	err := os.Remove(filePath)
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
+	f.growing.Complete(filePath)
 
 	videoDir := filepath.Join(f.BaseDir, videoId)
 	files, err := os.ReadDir(videoDir)
@@ -136,7 +168,7 @@ func (f *FSVideoContentService) Delete(videoId string, filename string) error {
 }
 
 // ListFiles implements VideoContentService.
-func (f *FSVideoContentService) ListFiles(videoId string) ([]string, error) {
+func (f *FSVideoContentService) ListFiles(ctx context.Context, videoId string) ([]string, error) {
 	videoDir := filepath.Join(f.BaseDir, videoId)
 	entries, err := os.ReadDir(videoDir)
 	if err != nil {
@@ -0,0 +1,66 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const readinessTimeout = 5 * time.Second
+
+type ReadinessAPIResponse struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// API endpoint: GET /healthz - The process is up and serving HTTP
+func (s *server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	sendJSONResponse(w, http.StatusOK, APIResponse{Success: true, Data: map[string]string{"status": "ok"}})
+}
+
+// API endpoint: GET /readyz - The metadata store and every storage node are
+// reachable and the server is not shutting down
+func (s *server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := ReadinessAPIResponse{Ready: true, Checks: map[string]string{}}
+	check := func(name string, err error) {
+		resp.Checks[name] = "ok"
+		if err != nil {
+			resp.Ready = false
+			resp.Checks[name] = err.Error()
+		}
+	}
+
+	if s.draining.Load() {
+		check("server", errors.New("shutting down"))
+	}
+	if checker, ok := s.metadataService.(HealthChecker); ok {
+		check("metadata", checker.CheckHealth(ctx))
+	}
+	if checker, ok := s.contentService.(HealthChecker); ok {
+		check("storage", checker.CheckHealth(ctx))
+	}
+
+	if !resp.Ready {
+		sendJSONResponse(w, http.StatusServiceUnavailable, APIResponse{Success: false, Data: resp, Error: "Not ready"})
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, APIResponse{Success: true, Data: resp})
+}
+
+// Shutdown stops accepting connections, reports not ready, and waits until
+// in-flight requests, live streams and ffmpeg jobs finish or ctx is done.
+func (s *server) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+	err := s.httpServer.Shutdown(ctx)
+	if liveErr := s.live.shutdown(ctx); err == nil {
+		err = liveErr
+	}
+	if waitErr := waitFFmpeg(ctx); err == nil {
+		err = waitErr
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+	"tritontube/internal/proto"
+	"tritontube/internal/security"
+	"tritontube/internal/storage"
+
+	"google.golang.org/grpc"
+)
+
+func TestReadyzChecksStorageNodes(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := grpc.NewServer()
+	proto.RegisterVideoContentStorageServiceServer(node, storage.NewStorageServer(t.TempDir(), 0))
+	go node.Serve(lis)
+	defer node.Stop()
+
+	metadata := newTestMetadata(t)
+	content := NewNetworkVideoContentService([]string{lis.Addr().String()}, metadata, nil)
+	handler := newTestServer(t, NewServer(metadata, content, metadata, metadata))
+
+	var readiness ReadinessAPIResponse
+	if w := doJSON(t, handler, "GET", "/readyz", "", nil, &readiness); w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if readiness.Checks["storage"] != "ok" || readiness.Checks["metadata"] != "ok" {
+		t.Errorf("checks = %v", readiness.Checks)
+	}
+
+	node.Stop()
+	if w := doJSON(t, handler, "GET", "/readyz", "", nil, nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("with the node down: status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w := doJSON(t, handler, "GET", "/healthz", "", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("healthz with the node down: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+// blockingContentService holds uploads until release is closed.
+type blockingContentService struct {
+	*stubContentService
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingContentService) Write(ctx context.Context, videoId string, filename string, data []byte) ([]VideoFile, error) {
+	close(c.started)
+	<-c.release
+	return c.stubContentService.Write(ctx, videoId, filename, data)
+}
+
+func TestShutdownWaitsForUploads(t *testing.T) {
+	metadata := newTestMetadata(t)
+	content := &blockingContentService{
+		stubContentService: &stubContentService{
+			FSVideoContentService: &FSVideoContentService{BaseDir: t.TempDir()},
+			files:                 map[string][]byte{"manifest.mpd": []byte(testMPD)},
+		},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	s := NewServer(metadata, content, metadata, metadata)
+	token := signIn(t, s, "uploader", security.RoleViewer)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start(lis)
+	base := "http://" + lis.Addr().String()
+
+	uploaded := make(chan int, 1)
+	go func() {
+		r := uploadRequest(t, token, "clip.mp4", []byte("video"))
+		req, _ := http.NewRequest(r.Method, base+r.URL.Path, r.Body)
+		req.Header = r.Header
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			uploaded <- 0
+			return
+		}
+		resp.Body.Close()
+		uploaded <- resp.StatusCode
+	}()
+	<-content.started
+
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- s.Shutdown(context.Background()) }()
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned during an upload: %v", err)
+	default:
+	}
+	if !s.draining.Load() {
+		t.Errorf("not reporting unready while shutting down")
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Errorf("new connections still accepted while shutting down")
+	}
+
+	close(content.release)
+	if code := <-uploaded; code != http.StatusCreated {
+		t.Errorf("upload status = %d, want %d", code, http.StatusCreated)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown = %v", err)
+	}
+}
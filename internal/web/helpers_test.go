@@ -0,0 +1,165 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+	"tritontube/internal/proto"
+	"tritontube/internal/security"
+	"tritontube/internal/storage"
+	"tritontube/internal/tracing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"google.golang.org/grpc"
+)
+
+// newTestMetadata returns a metadata service backed by a fresh SQLite database.
+func newTestMetadata(t *testing.T) *SQLiteVideoMetadataService {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &SQLiteVideoMetadataService{Instance: db}
+}
+
+// startStorageNode serves a storage node over gRPC on a local port and
+// returns its address and base directory.
+func startStorageNode(t *testing.T) (string, string) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	grpcServer := grpc.NewServer(tracing.ServerOption())
+	proto.RegisterVideoContentStorageServiceServer(grpcServer, storage.NewStorageServer(dir, 0))
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+	return lis.Addr().String(), dir
+}
+
+// createVideo records a public video with the given id.
+func createVideo(t *testing.T, metadata VideoMetadataService, id string) {
+	t.Helper()
+	err := metadata.Create(&VideoMetadata{Id: id, UploadedAt: time.Now(), Visibility: VisibilityPublic})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestServer returns s with its routes set up and the handler serving them.
+func newTestServer(t *testing.T, s *server) http.Handler {
+	t.Helper()
+	s.mux = http.NewServeMux()
+	s.routes()
+	return s.handler()
+}
+
+// signIn creates a user with role and returns a bearer token for them.
+func signIn(t *testing.T, s *server, username string, role security.Role) string {
+	t.Helper()
+	user := &User{Id: newRandomID(), Username: username, PasswordHash: []byte("-"), Role: role, CreatedAt: time.Now()}
+	if err := s.userService.CreateUser(user); err != nil {
+		t.Fatal(err)
+	}
+	secret, _, err := s.issueToken(user, APIToken, "test", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// uploadRequest returns a multipart upload of a video file.
+func uploadRequest(t *testing.T, token, filename string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/videos", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// stubContentService stores a fixed set of files for every upload instead
+// of transcoding it, then fails with err if set.
+type stubContentService struct {
+	*FSVideoContentService
+	files map[string][]byte
+	err   error
+}
+
+func (c *stubContentService) Write(ctx context.Context, videoId string, filename string, data []byte) ([]VideoFile, error) {
+	var written []VideoFile
+	for name, data := range c.files {
+		if err := c.WriteFile(ctx, videoId, name, data); err != nil {
+			return nil, err
+		}
+		written = append(written, newVideoFile(name, data))
+	}
+	return written, c.err
+}
+
+// newSQLiteServer returns a server keeping everything in one SQLite
+// database and files under a temporary directory, and its handler.
+func newSQLiteServer(t *testing.T, opts ...ServerOption) (*server, http.Handler) {
+	t.Helper()
+	metadata := newTestMetadata(t)
+	content := &FSVideoContentService{BaseDir: t.TempDir()}
+	s := NewServer(metadata, content, metadata, metadata, opts...)
+	return s, newTestServer(t, s)
+}
+
+// doJSON sends body, if any, as JSON with the bearer token, if any, and
+// decodes the data of the response envelope into data, if given.
+func doJSON(t *testing.T, handler http.Handler, method, path, token string, body, data any) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	r := httptest.NewRequest(method, path, reader)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if data != nil && w.Code < 300 {
+		envelope := struct{ Data any }{Data: data}
+		if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return w
+}
+
+// userOf returns the user a bearer token belongs to.
+func userOf(t *testing.T, s *server, token string) *User {
+	t.Helper()
+	user, _, err := s.resolveToken(token, APIToken)
+	if err != nil || user == nil {
+		t.Fatalf("resolving token: %v, %v", user, err)
+	}
+	return user
+}
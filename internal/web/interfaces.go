@@ -1,22 +1,241 @@
 package web
 
-import "time"
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+	"tritontube/internal/security"
+)
+
+// Visibility controls who can find and play a video.
+type Visibility string
+
+const (
+	VisibilityPublic   Visibility = "public"   // listed and playable by anyone
+	VisibilityUnlisted Visibility = "unlisted" // playable by anyone with the link
+	VisibilityPrivate  Visibility = "private"  // playable by the owner and admins
+)
 
 type VideoMetadata struct {
-	Id         string
-	UploadedAt time.Time
+	Id          string
+	UploadedAt  time.Time
+	Title       string
+	Description string
+	Duration    time.Duration
+	Views       int64
+	Category    string
+	Tags        []string
+	OwnerId     string // empty for videos uploaded before accounts existed
+	Visibility  Visibility
+}
+
+// VideoSort names a field that video listings can be ordered by.
+type VideoSort string
+
+const (
+	SortByUploadedAt VideoSort = "uploadedAt"
+	SortByTitle      VideoSort = "title"
+	SortByDuration   VideoSort = "duration"
+	SortByViews      VideoSort = "views"
+)
+
+// VideoQuery selects one page of videos. Cursor is the NextCursor of the
+// previous page and must be used with the same filters, Sort and Descending.
+type VideoQuery struct {
+	Search   string
+	Tag      string
+	Category string
+	// Only public videos are returned, plus every video owned by ViewerId,
+	// unless IncludeHidden is set.
+	ViewerId      string
+	IncludeHidden bool
+	Sort          VideoSort
+	Descending    bool
+	Limit         int
+	Cursor        string
+}
+
+// VideoPage is one page of a VideoQuery. NextCursor is empty on the last page.
+type VideoPage struct {
+	Videos     []VideoMetadata
+	NextCursor string
+}
+
+// LabelCount is a tag or category together with the number of videos carrying it.
+type LabelCount struct {
+	Name  string
+	Count int
+}
+
+// Playlist is a named, ordered list of videos.
+type Playlist struct {
+	Id          string
+	OwnerId     string
+	Name        string
+	Description string
+	VideoIds    []string
+	CreatedAt   time.Time
+}
+
+// VideoFile describes one file stored for a video, as recorded at ingest.
+type VideoFile struct {
+	Filename string
+	Size     int64
+	Digest   string // hex-encoded SHA-256 of the file contents
 }
 
 type VideoMetadataService interface {
 	Read(id string) (*VideoMetadata, error)
 	List() ([]VideoMetadata, error)
-	Create(videoId string, uploadedAt time.Time) error
+	// Create stores a new video; fields other than Id, UploadedAt, OwnerId
+	// and Visibility are set later with Update.
+	Create(video *VideoMetadata) error
 	Delete(id string) error
+	// Update stores the descriptive fields (title, description, duration,
+	// category, tags and visibility) of an existing video.
+	Update(video *VideoMetadata) error
+	// AddView increments the view count of a video.
+	AddView(id string) error
+	// Query returns one page of videos matching q.
+	Query(q VideoQuery) (*VideoPage, error)
+	// Tags and Categories list the labels in use on public videos, most used first.
+	Tags() ([]LabelCount, error)
+	Categories() ([]LabelCount, error)
+
+	// SetFiles replaces the recorded file manifest of a video.
+	SetFiles(videoId string, files []VideoFile) error
+	// Files returns the recorded file manifest of a video, or nil if none was recorded.
+	Files(videoId string) ([]VideoFile, error)
+	// StorageUsed returns the total size of the recorded files of the
+	// videos owned by ownerId.
+	StorageUsed(ownerId string) (int64, error)
+}
+
+type PlaylistService interface {
+	CreatePlaylist(playlist *Playlist) error
+	// ReadPlaylist returns nil if the playlist does not exist.
+	ReadPlaylist(id string) (*Playlist, error)
+	ListPlaylists() ([]Playlist, error)
+	// UpdatePlaylist replaces the name, description and videos of a playlist.
+	UpdatePlaylist(playlist *Playlist) error
+	DeletePlaylist(id string) error
+}
+
+// User is an account that can sign in to the HTTP API.
+type User struct {
+	Id           string
+	Username     string
+	PasswordHash []byte
+	Role         security.Role
+	CreatedAt    time.Time
 }
 
+// AuthTokenKind distinguishes browser sessions from API tokens.
+type AuthTokenKind string
+
+const (
+	SessionToken AuthTokenKind = "session"
+	APIToken     AuthTokenKind = "api"
+)
+
+// AuthToken is a credential issued to a user. Only the SHA-256 of the
+// secret is stored; the secret itself is shown to the user once.
+type AuthToken struct {
+	Id        string
+	Hash      string
+	UserId    string
+	Kind      AuthTokenKind
+	Name      string
+	CreatedAt time.Time
+	ExpiresAt time.Time // zero for tokens that do not expire
+}
+
+// ErrLastAdmin is returned by SetUserRole for a change that would leave no admin.
+var ErrLastAdmin = errors.New("no admin would remain")
+
+type UserService interface {
+	CreateUser(user *User) error
+	// ReadUser and ReadUserByName return nil if the user does not exist.
+	ReadUser(id string) (*User, error)
+	ReadUserByName(username string) (*User, error)
+	// RegisterUser creates user, but as an admin instead of user.Role if
+	// the deployment is new: it holds no users and no videos. The check and
+	// the insert are atomic, and user.Role is set to the role created.
+	RegisterUser(user *User) error
+	// SetUserRole changes the role of an existing user. Demoting the last
+	// admin fails with ErrLastAdmin; the check and the update are atomic.
+	SetUserRole(id string, role security.Role) error
+
+	CreateToken(token *AuthToken) error
+	// ReadTokenByHash returns nil if no token has the given hash.
+	ReadTokenByHash(hash string) (*AuthToken, error)
+	ListTokens(userId string) ([]AuthToken, error)
+	DeleteToken(id string) error
+}
+
+// AuditEntry records one privileged action, whether it succeeded or not.
+type AuditEntry struct {
+	Id      int64
+	Time    time.Time
+	Actor   string // username or certificate name
+	Role    string
+	Action  string // e.g. "video.delete" or the full gRPC method name
+	Target  string
+	Outcome string // "ok", or why the action failed or was denied
+	Source  string // network address of the caller
+}
+
+// AuditQuery selects audit entries, newest first.
+type AuditQuery struct {
+	Actor string
+	Since time.Time
+	Limit int
+}
+
+// AuditLog is an append-only record of privileged actions.
+type AuditLog interface {
+	AppendAudit(entry *AuditEntry) error
+	ListAudit(q AuditQuery) ([]AuditEntry, error)
+}
+
+// HealthChecker is implemented by services that can tell whether their
+// backing store is reachable. The web server is only ready while every
+// service implementing it reports nil.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
+// VideoContentService stores the files of videos. The context carries the
+// caller's deadline and trace through to storage nodes.
 type VideoContentService interface {
-	Read(videoId string, filename string) ([]byte, error)
-	Write(videoId string, filename string, data []byte) error
-	Delete(videoId string, filename string) error
-	ListFiles(videoId string) ([]string, error)
+	Read(ctx context.Context, videoId string, filename string) ([]byte, error)
+	// Write ingests an uploaded video and returns the files that were stored for it.
+	// On failure it returns the files stored so far, for the caller to delete.
+	Write(ctx context.Context, videoId string, filename string, data []byte) ([]VideoFile, error)
+	Delete(ctx context.Context, videoId string, filename string) error
+	ListFiles(ctx context.Context, videoId string) ([]string, error)
+}
+
+// FileWriter is implemented by content services that can store a file as
+// it is, without transcoding. Live streams store their segments with it.
+type FileWriter interface {
+	WriteFile(ctx context.Context, videoId string, filename string, data []byte) error
+}
+
+// FileAppender is implemented by content services that can store a file
+// in parts while readers follow it. Low-latency live streams store their
+// segments with it chunk by chunk.
+type FileAppender interface {
+	// AppendFile writes data at offset, cutting the file there first.
+	// complete marks the end of the file.
+	AppendFile(ctx context.Context, videoId string, filename string, offset int64, data []byte, complete bool) error
+}
+
+// StreamReader is implemented by content services that can read a file
+// while it is being appended to. The stream ends once the file is complete;
+// a missing file fails the first read with an error wrapping
+// os.ErrNotExist.
+type StreamReader interface {
+	ReadStream(ctx context.Context, videoId string, filename string) (io.ReadCloser, error)
 }
@@ -0,0 +1,715 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"tritontube/internal/manifest"
+)
+
+const (
+	defaultLiveWindow         = 5
+	defaultLiveConnectTimeout = 2 * time.Minute
+	// liveRecording is the copy of a live stream the on-demand video is
+	// made from.
+	liveRecording = "recording.mkv"
+	// liveSyncInterval is how often new segments are copied to the content
+	// service. It should be well below the segment duration.
+	liveSyncInterval = time.Second
+	// liveStopTimeout bounds how long deleting a video waits for its live
+	// stream to wind down.
+	liveStopTimeout = 30 * time.Second
+)
+
+// LiveConfig enables live streaming: each stream gets a port of its own on
+// which ffmpeg waits for an encoder such as OBS to publish.
+type LiveConfig struct {
+	// Protocol is "srt". The stream key is the SRT passphrase, so only
+	// encoders that know it can publish. RTMP is not supported: ffmpeg's
+	// RTMP listener accepts any stream name.
+	Protocol string
+	// ListenHost is the address ffmpeg listens on, e.g. "0.0.0.0".
+	ListenHost string
+	// PublicHost is the host encoders connect to, as given in ingest URLs.
+	PublicHost string
+	// FirstPort and LastPort bound the ingest ports, one per stream.
+	FirstPort, LastPort int
+	// ConnectTimeout is how long a stream waits for its encoder before it
+	// is dropped.
+	ConnectTimeout time.Duration
+	// Window is how many segments the live manifest lists.
+	Window int
+	// WorkDir holds the files of running streams. Empty means the system
+	// temporary directory.
+	WorkDir string
+	// LowLatency streams segments to players in chunks of ChunkDuration
+	// while they are encoded, instead of once they are complete. Players
+	// aim to stay TargetLatency behind the encoder. The content service
+	// must implement FileAppender and StreamReader.
+	LowLatency    bool
+	ChunkDuration time.Duration
+	TargetLatency time.Duration
+}
+
+// Validate reports the first invalid setting.
+func (c LiveConfig) Validate() error {
+	switch c.Protocol {
+	case "srt":
+	case "rtmp":
+		return fmt.Errorf("live protocol rtmp cannot check stream keys, use srt")
+	default:
+		return fmt.Errorf("unknown live protocol %q", c.Protocol)
+	}
+	if c.FirstPort <= 0 || c.LastPort < c.FirstPort || c.LastPort > 65535 {
+		return fmt.Errorf("invalid live port range %d-%d", c.FirstPort, c.LastPort)
+	}
+	if c.PublicHost == "" {
+		return fmt.Errorf("live streaming needs a public host")
+	}
+	if c.Window < 1 {
+		return fmt.Errorf("live window must be at least one segment")
+	}
+	if c.ConnectTimeout <= 0 {
+		return fmt.Errorf("live connect timeout must be positive")
+	}
+	if c.LowLatency {
+		if c.ChunkDuration <= 0 {
+			return fmt.Errorf("live chunk duration must be positive")
+		}
+		if c.TargetLatency < c.ChunkDuration {
+			return fmt.Errorf("live target latency must be at least one chunk")
+		}
+	}
+	return nil
+}
+
+type liveState string
+
+const (
+	liveWaiting    liveState = "waiting" // for the encoder to publish
+	liveStreaming  liveState = "live"
+	liveProcessing liveState = "processing" // being made an on-demand video
+)
+
+var errNoLivePort = errors.New("no free ingest port")
+
+type liveStream struct {
+	videoId   string
+	ownerId   string
+	port      int
+	key       string
+	startedAt time.Time
+	dir       string
+	cmd       *exec.Cmd
+	stdin     io.WriteCloser
+	done      chan struct{}
+
+	// Guarded by liveStreams.mu.
+	state   liveState
+	started bool // whether cmd is running
+	discard bool // delete the stream instead of keeping it
+	// sent is how much of each segment a low-latency stream has stored.
+	// segmentAdded is closed and replaced when a segment is begun.
+	sent         map[string]int64
+	segmentAdded chan struct{}
+
+	// Used only by runLive.
+	uploaded map[string]VideoFile
+	manifest []byte
+	// unrecorded is set while the files stored differ from the file
+	// manifest of the video.
+	unrecorded bool
+}
+
+// liveStreams tracks the running live streams by video ID.
+type liveStreams struct {
+	config  LiveConfig
+	mu      sync.Mutex
+	streams map[string]*liveStream
+	running sync.WaitGroup
+}
+
+func newLiveStreams(config LiveConfig) *liveStreams {
+	if config.Window <= 0 {
+		config.Window = defaultLiveWindow
+	}
+	if config.ConnectTimeout <= 0 {
+		config.ConnectTimeout = defaultLiveConnectTimeout
+	}
+	if config.ChunkDuration <= 0 {
+		config.ChunkDuration = defaultLiveChunkDuration
+	}
+	if config.TargetLatency <= 0 {
+		config.TargetLatency = defaultLiveTargetLatency
+	}
+	return &liveStreams{config: config, streams: make(map[string]*liveStream)}
+}
+
+// reserve registers a stream for videoId on a free port.
+func (l *liveStreams) reserve(videoId, ownerId string) (*liveStream, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	used := make(map[int]bool)
+	for _, st := range l.streams {
+		used[st.port] = true
+	}
+	for port := l.config.FirstPort; port <= l.config.LastPort; port++ {
+		if used[port] {
+			continue
+		}
+		st := &liveStream{
+			videoId:   videoId,
+			ownerId:   ownerId,
+			port:      port,
+			key:       newRandomID(),
+			startedAt: time.Now(),
+			done:      make(chan struct{}),
+			state:     liveWaiting,
+			uploaded:  make(map[string]VideoFile),
+
+			sent:         make(map[string]int64),
+			segmentAdded: make(chan struct{}),
+		}
+		l.streams[videoId] = st
+		return st, nil
+	}
+	return nil, errNoLivePort
+}
+
+func (l *liveStreams) release(videoId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.streams, videoId)
+}
+
+// get returns the stream of videoId and its state, or nil.
+func (l *liveStreams) get(videoId string) (*liveStream, liveState) {
+	if l == nil {
+		return nil, ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.streams[videoId]
+	if st == nil {
+		return nil, ""
+	}
+	return st, st.state
+}
+
+// active reports whether videoId is a live stream that has not ended yet.
+func (l *liveStreams) active(videoId string) bool {
+	st, state := l.get(videoId)
+	return st != nil && state != liveProcessing
+}
+
+func (l *liveStreams) setState(st *liveStream, state liveState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st.state = state
+}
+
+func (l *liveStreams) discarded(st *liveStream) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return st.discard
+}
+
+// stop ends the stream of videoId, dropping what it recorded if discard is
+// set. It returns a channel closed once the stream is wound down, or nil if
+// there is no such stream.
+func (l *liveStreams) stop(videoId string, discard bool) <-chan struct{} {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st := l.streams[videoId]
+	if st == nil {
+		return nil
+	}
+	if discard {
+		st.discard = true
+	}
+	switch {
+	case !st.started:
+		// markStarted stops it.
+		st.discard = true
+	case st.state == liveStreaming && !discard:
+		// "q" makes ffmpeg finish its outputs, so the recording is complete.
+		_, _ = io.WriteString(st.stdin, "q")
+	case st.state != liveProcessing:
+		_ = st.cmd.Process.Signal(os.Interrupt)
+	}
+	return st.done
+}
+
+// markStarted records that the ffmpeg of st is running, and stops it if
+// the stream was stopped before.
+func (l *liveStreams) markStarted(st *liveStream) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st.started = true
+	if st.discard {
+		_ = st.cmd.Process.Signal(os.Interrupt)
+	}
+}
+
+// shutdown stops every stream, keeping their recordings, and waits until
+// they are wound down or ctx is done.
+func (l *liveStreams) shutdown(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	var ids []string
+	for id := range l.streams {
+		ids = append(ids, id)
+	}
+	l.mu.Unlock()
+	for _, id := range ids {
+		l.stop(id, false)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		l.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// supported reports whether content can store the files of live streams.
+func (l *liveStreams) supported(content VideoContentService) bool {
+	if _, ok := content.(FileWriter); !ok {
+		return false
+	}
+	if l.config.LowLatency {
+		_, appends := content.(FileAppender)
+		_, streams := content.(StreamReader)
+		return appends && streams
+	}
+	return true
+}
+
+// input returns the ffmpeg options that make it wait for the encoder of st.
+// Encoders without the passphrase fail the SRT handshake.
+func (l *liveStreams) input(st *liveStream) []string {
+	addr := net.JoinHostPort(l.config.ListenHost, strconv.Itoa(st.port))
+	return []string{"-i", "srt://" + addr + "?mode=listener&passphrase=" + st.key}
+}
+
+// ingestURL is where the encoder of st publishes to.
+func (l *liveStreams) ingestURL(st *liveStream) string {
+	addr := net.JoinHostPort(l.config.PublicHost, strconv.Itoa(st.port))
+	return "srt://" + addr + "?passphrase=" + st.key
+}
+
+// LiveStreamAPIResponse describes a live stream. IngestURL, which carries
+// the stream key, is only shown to the owner while waiting or live.
+type LiveStreamAPIResponse struct {
+	VideoId   string `json:"videoId"`
+	State     string `json:"state"`
+	IngestURL string `json:"ingestUrl,omitempty"`
+	StartedAt string `json:"startedAt"`
+}
+
+func (s *server) newLiveStreamAPIResponse(st *liveStream, state liveState) LiveStreamAPIResponse {
+	resp := LiveStreamAPIResponse{
+		VideoId:   st.videoId,
+		State:     string(state),
+		StartedAt: st.startedAt.Format("2006-01-02 15:04:05"),
+	}
+	if state != liveProcessing {
+		resp.IngestURL = s.live.ingestURL(st)
+	}
+	return resp
+}
+
+// API endpoint: POST /api/v1/live - Start a live stream
+// The body sets the video's title, description, category, tags and
+// visibility as in PATCH /api/v1/videos/{videoId}.
+func (s *server) handleStartLive(w http.ResponseWriter, r *http.Request) {
+	if s.live == nil {
+		sendErrorResponse(w, http.StatusNotImplemented, "Live streaming is not enabled")
+		return
+	}
+	if !s.live.supported(s.contentService) {
+		sendErrorResponse(w, http.StatusNotImplemented, "Live streaming is not supported by this content service")
+		return
+	}
+	user := requireUser(w, r)
+	if user == nil {
+		return
+	}
+	if !s.checkQuota(w, r, user, 0) {
+		return
+	}
+
+	var req VideoUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	video := &VideoMetadata{
+		Id:         "live-" + newRandomID(),
+		UploadedAt: time.Now(),
+		OwnerId:    user.Id,
+		Visibility: VisibilityPublic,
+	}
+	if err := req.apply(video); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if video.Title == "" {
+		video.Title = video.Id
+	}
+
+	st, err := s.live.reserve(video.Id, user.Id)
+	if err != nil {
+		sendErrorResponse(w, http.StatusServiceUnavailable, "No ingest port is free, try again later")
+		return
+	}
+	if err := s.startLive(r.Context(), st, video); err != nil {
+		s.live.release(video.Id)
+		sendErrorResponse(w, http.StatusInternalServerError, "Error starting live stream")
+		slog.ErrorContext(r.Context(), "Error starting live stream", "video", video.Id, "err", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Live stream waiting for encoder", "video", video.Id, "port", st.port)
+
+	sendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Data:    s.newLiveStreamAPIResponse(st, liveWaiting),
+	})
+}
+
+// startLive records the video of st and starts its ffmpeg.
+func (s *server) startLive(ctx context.Context, st *liveStream, video *VideoMetadata) error {
+	if err := s.metadataService.Create(video); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	// Create leaves out the descriptive fields.
+	if err := s.metadataService.Update(video); err != nil {
+		s.metadataService.Delete(video.Id)
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+
+	var err error
+	defer func() {
+		if err != nil {
+			s.metadataService.Delete(video.Id)
+			if st.dir != "" {
+				os.RemoveAll(st.dir)
+			}
+		}
+	}()
+	st.dir, err = os.MkdirTemp(s.live.config.WorkDir, "live-"+video.Id+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+
+	st.cmd = contentEncoding(s.contentService).liveCommand(s.live.input(st), s.live.config, manifestFile, liveRecording)
+	st.cmd.Dir = st.dir
+	st.stdin, err = st.cmd.StdinPipe()
+	if err != nil {
+		return fmt.Errorf("failed to connect to ffmpeg: %w", err)
+	}
+	wait, err := startFFmpeg(context.WithoutCancel(ctx), "live", st.cmd)
+	if err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	s.live.markStarted(st)
+	s.live.running.Add(1)
+	go s.runLive(st, wait)
+	return nil
+}
+
+// runLive copies the segments of st to the content service as ffmpeg
+// writes them, and once the stream ends turns it into an on-demand video.
+func (s *server) runLive(st *liveStream, wait func() error) {
+	defer s.live.running.Done()
+	defer close(st.done)
+	defer s.live.release(st.videoId)
+	defer os.RemoveAll(st.dir)
+
+	ctx := context.Background()
+	exited := make(chan error, 1)
+	go func() { exited <- wait() }()
+
+	interval := liveSyncInterval
+	if s.live.config.LowLatency {
+		interval = liveChunkSyncInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	connect := time.NewTimer(s.live.config.ConnectTimeout)
+	defer connect.Stop()
+
+	var exitErr error
+loop:
+	for {
+		select {
+		case exitErr = <-exited:
+			break loop
+		case <-ticker.C:
+			s.syncLive(ctx, st, false)
+		case <-connect.C:
+			if _, state := s.live.get(st.videoId); state == liveWaiting {
+				slog.Warn("No encoder published to live stream in time", "video", st.videoId)
+				s.live.stop(st.videoId, true)
+			}
+		}
+	}
+
+	if s.live.discarded(st) {
+		s.discardLive(ctx, st)
+		return
+	}
+	s.syncLive(ctx, st, true)
+	if len(st.uploaded) == 0 {
+		slog.Warn("Live stream ended without any segments", "video", st.videoId, "err", exitErr)
+		s.discardLive(ctx, st)
+		return
+	}
+	if exitErr != nil {
+		slog.Warn("Live ffmpeg exited with an error", "video", st.videoId, "err", exitErr)
+	}
+
+	s.live.setState(st, liveProcessing)
+	slog.Info("Live stream ended, converting to on-demand video", "video", st.videoId)
+	if err := s.convertLive(ctx, st); err != nil {
+		slog.Error("Failed to convert live stream, keeping its live segments", "video", st.videoId, "err", err)
+		if err := s.metadataService.SetFiles(st.videoId, liveFiles(st)); err != nil {
+			slog.Error("Failed to save file manifest", "video", st.videoId, "err", err)
+		}
+	}
+}
+
+// syncLive copies segments of st that are new since the last call, then
+// the manifest listing them, to the content service, and records them in
+// the file manifest of the video. Failures are retried on the next call.
+// exited says ffmpeg is done writing.
+func (s *server) syncLive(ctx context.Context, st *liveStream, exited bool) {
+	if s.live.config.LowLatency {
+		s.appendLiveChunks(ctx, st, exited)
+	}
+	s.uploadLiveManifest(ctx, st)
+	if !st.unrecorded {
+		return
+	}
+	if err := s.metadataService.SetFiles(st.videoId, liveFiles(st)); err != nil {
+		slog.Warn("Failed to save file manifest", "video", st.videoId, "err", err)
+		return
+	}
+	st.unrecorded = false
+}
+
+// uploadLiveManifest copies the manifest of st and the complete segments
+// it lists to the content service if it changed.
+func (s *server) uploadLiveManifest(ctx context.Context, st *liveStream) {
+	data, err := os.ReadFile(filepath.Join(st.dir, manifestFile))
+	if err != nil || bytes.Equal(data, st.manifest) {
+		return
+	}
+	templates, err := manifest.SegmentTemplates(data)
+	if err != nil {
+		// Most likely caught while ffmpeg rewrites it.
+		return
+	}
+
+	writer := s.contentService.(FileWriter)
+	if s.live.config.LowLatency {
+		// The segments are appended as they grow.
+		templates = nil
+	}
+	upload := func(name string) error {
+		if name == "" {
+			return nil
+		}
+		if _, ok := st.uploaded[name]; ok {
+			return nil
+		}
+		segment, err := os.ReadFile(filepath.Join(st.dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			// Already out of the window.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := writer.WriteFile(ctx, st.videoId, name, segment); err != nil {
+			return err
+		}
+		st.uploaded[name] = newVideoFile(name, segment)
+		st.unrecorded = true
+		return nil
+	}
+	for _, t := range templates {
+		if err := upload(t.InitializationName()); err != nil {
+			slog.Warn("Failed to store live segment", "video", st.videoId, "err", err)
+			return
+		}
+		for n := t.StartNumber; n <= t.EndNumber; n++ {
+			if err := upload(t.Name(n)); err != nil {
+				slog.Warn("Failed to store live segment", "video", st.videoId, "err", err)
+				return
+			}
+		}
+	}
+	if err := writer.WriteFile(ctx, st.videoId, manifestFile, data); err != nil {
+		slog.Warn("Failed to store live manifest", "video", st.videoId, "err", err)
+		return
+	}
+
+	if st.manifest == nil {
+		s.live.setState(st, liveStreaming)
+		slog.Info("Live stream started", "video", st.videoId)
+	}
+	st.manifest = data
+	// The manifest is rewritten on every segment, so it has no digest.
+	st.uploaded[manifestFile] = VideoFile{Filename: manifestFile, Size: int64(len(data))}
+	st.unrecorded = true
+}
+
+// convertLive transcodes the recording of st into the files of an
+// on-demand video, which replace the live ones.
+func (s *server) convertLive(ctx context.Context, st *liveStream) error {
+	recording, err := os.ReadFile(filepath.Join(st.dir, liveRecording))
+	if err != nil {
+		return fmt.Errorf("failed to read recording: %w", err)
+	}
+	// Only the transcoded files the live ones do not share a name with
+	// can go; the rest are overwritten live files and stay recorded.
+	deleteUnrecorded := func(files []VideoFile) {
+		var unrecorded []VideoFile
+		for _, f := range files {
+			if _, ok := st.uploaded[f.Filename]; !ok {
+				unrecorded = append(unrecorded, f)
+			}
+		}
+		s.deleteFiles(ctx, st.videoId, unrecorded)
+	}
+	files, err := s.contentService.Write(ctx, st.videoId, liveRecording, recording)
+	if err != nil {
+		deleteUnrecorded(files)
+		return fmt.Errorf("failed to transcode recording: %w", err)
+	}
+	if err := s.metadataService.SetFiles(st.videoId, files); err != nil {
+		deleteUnrecorded(files)
+		return fmt.Errorf("failed to save file manifest: %w", err)
+	}
+
+	kept := make(map[string]bool)
+	for _, f := range files {
+		kept[f.Filename] = true
+	}
+	for name := range st.uploaded {
+		if kept[name] {
+			continue
+		}
+		if err := s.contentService.Delete(ctx, st.videoId, name); err != nil {
+			slog.Warn("Failed to delete live segment", "video", st.videoId, "file", name, "err", err)
+		}
+	}
+
+	video, err := s.metadataService.Read(st.videoId)
+	if err != nil || video == nil {
+		return fmt.Errorf("failed to read metadata: %w", err)
+	}
+	if data, err := s.contentService.Read(ctx, st.videoId, manifestFile); err != nil {
+		slog.Warn("Could not read manifest", "video", st.videoId, "err", err)
+	} else if video.Duration, err = mpdDuration(data); err != nil {
+		slog.Warn("Could not determine duration", "video", st.videoId, "err", err)
+	}
+	if err := s.metadataService.Update(video); err != nil {
+		return fmt.Errorf("failed to save metadata: %w", err)
+	}
+	slog.Info("Live stream converted to on-demand video", "video", st.videoId, "files", len(files))
+	return nil
+}
+
+// discardLive deletes the video of st and every file it stored.
+func (s *server) discardLive(ctx context.Context, st *liveStream) {
+	if err := s.metadataService.Delete(st.videoId); err != nil {
+		slog.Error("Failed to delete live stream metadata", "video", st.videoId, "err", err)
+	}
+	// Segments a low-latency stream was still appending to are not
+	// recorded as uploaded yet.
+	for name := range st.sent {
+		if _, ok := st.uploaded[name]; !ok {
+			st.uploaded[name] = VideoFile{Filename: name}
+		}
+	}
+	for name := range st.uploaded {
+		if err := s.contentService.Delete(ctx, st.videoId, name); err != nil {
+			slog.Warn("Failed to delete live segment", "video", st.videoId, "file", name, "err", err)
+		}
+	}
+}
+
+// liveFiles returns the manifest entries of what st stored. Segments a
+// low-latency stream is still appending to have no digest yet.
+func liveFiles(st *liveStream) []VideoFile {
+	files := make([]VideoFile, 0, len(st.uploaded))
+	for _, f := range st.uploaded {
+		files = append(files, f)
+	}
+	for name, size := range st.sent {
+		if _, ok := st.uploaded[name]; !ok {
+			files = append(files, VideoFile{Filename: name, Size: size})
+		}
+	}
+	return files
+}
+
+// API endpoint: GET /api/v1/live/{videoId} - Get the state of a live stream
+func (s *server) handleGetLive(w http.ResponseWriter, r *http.Request) {
+	st, state := s.live.get(r.PathValue("videoId"))
+	if st == nil || !canModify(currentUser(r), st.ownerId) {
+		sendErrorResponse(w, http.StatusNotFound, "Live stream not found")
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    s.newLiveStreamAPIResponse(st, state),
+	})
+}
+
+// API endpoint: DELETE /api/v1/live/{videoId} - End a live stream
+// The stream becomes an on-demand video in the background.
+func (s *server) handleStopLive(w http.ResponseWriter, r *http.Request) {
+	videoId := r.PathValue("videoId")
+	st, _ := s.live.get(videoId)
+	if st == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Live stream not found")
+		return
+	}
+	if !canModify(currentUser(r), st.ownerId) {
+		sendErrorResponse(w, http.StatusForbidden, "Only the owner or an admin can end this live stream")
+		return
+	}
+	s.live.stop(videoId, false)
+	sendJSONResponse(w, http.StatusAccepted, APIResponse{
+		Success: true,
+		Data:    map[string]string{"message": "Live stream is ending"},
+	})
+}
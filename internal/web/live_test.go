@@ -0,0 +1,311 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tritontube/internal/security"
+)
+
+// testLiveMPD is a dynamic manifest listing segments first to last.
+const testLiveMPD = `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="dynamic" availabilityStartTime="2026-01-01T00:00:00Z">
+  <Period start="PT0.0S">
+    <AdaptationSet id="0">
+      <Representation id="0" bandwidth="1000">
+        <SegmentTemplate timescale="1000" initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%%05d$.m4s" startNumber="%d">
+          <SegmentTimeline>
+            <S t="0" d="4000" r="%d"/>
+          </SegmentTimeline>
+        </SegmentTemplate>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+func testLiveConfig() LiveConfig {
+	return LiveConfig{
+		Protocol:       "srt",
+		ListenHost:     "127.0.0.1",
+		PublicHost:     "live.example.com",
+		FirstPort:      1935,
+		LastPort:       1936,
+		Window:         5,
+		ConnectTimeout: time.Minute,
+	}
+}
+
+func TestLiveConfigValidate(t *testing.T) {
+	if err := testLiveConfig().Validate(); err != nil {
+		t.Errorf("srt: %v", err)
+	}
+	for _, protocol := range []string{"rtmp", "udp", ""} {
+		config := testLiveConfig()
+		config.Protocol = protocol
+		if err := config.Validate(); err == nil {
+			t.Errorf("protocol %q accepted", protocol)
+		}
+	}
+}
+
+func TestLiveIngestNeedsStreamKey(t *testing.T) {
+	l := newLiveStreams(testLiveConfig())
+	st, err := l.reserve("live-1", "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st.key) < 10 || len(st.key) > 79 {
+		t.Errorf("key %q is not a valid SRT passphrase", st.key)
+	}
+	if got, want := l.ingestURL(st), "srt://live.example.com:1935?passphrase="+st.key; got != want {
+		t.Errorf("ingestURL = %q, want %q", got, want)
+	}
+	input := strings.Join(l.input(st), " ")
+	if want := "-i srt://127.0.0.1:1935?mode=listener&passphrase=" + st.key; input != want {
+		t.Errorf("input = %q, want %q", input, want)
+	}
+
+	other, err := l.reserve("live-2", "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.port == st.port || other.key == st.key {
+		t.Errorf("streams share port %d or key %q", other.port, other.key)
+	}
+	if _, err := l.reserve("live-3", "owner"); err != errNoLivePort {
+		t.Errorf("reserve past the port range: %v", err)
+	}
+}
+
+// newLiveStream returns a server with live streaming enabled and a stream
+// of a new video whose work directory the test writes ffmpeg's output to.
+func newLiveStream(t *testing.T, config LiveConfig) (*server, *liveStream) {
+	t.Helper()
+	s, _ := newSQLiteServer(t, WithLive(config))
+	createVideo(t, s.metadataService, "live-1")
+	st, err := s.live.reserve("live-1", "owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.dir = t.TempDir()
+	return s, st
+}
+
+// writeLive writes files to the work directory of st.
+func writeLive(t *testing.T, st *liveStream, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(st.dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// recordedFiles returns the file manifest of the video of st by name.
+func recordedFiles(t *testing.T, s *server, st *liveStream) map[string]VideoFile {
+	t.Helper()
+	files, err := s.metadataService.Files(st.videoId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]VideoFile)
+	for _, f := range files {
+		byName[f.Filename] = f
+	}
+	return byName
+}
+
+func TestSyncLiveRecordsFiles(t *testing.T) {
+	s, st := newLiveStream(t, testLiveConfig())
+	ctx := context.Background()
+
+	s.syncLive(ctx, st, false)
+	if files := recordedFiles(t, s, st); len(files) != 0 {
+		t.Errorf("files recorded before ffmpeg wrote any: %v", files)
+	}
+
+	firstMPD := fmt.Sprintf(testLiveMPD, 1, 1)
+	writeLive(t, st, map[string]string{
+		"init-0.m4s":        "init",
+		"chunk-0-00001.m4s": "first",
+		"chunk-0-00002.m4s": "second",
+		manifestFile:        firstMPD,
+	})
+	s.syncLive(ctx, st, false)
+	files := recordedFiles(t, s, st)
+	for name, data := range map[string]string{"init-0.m4s": "init", "chunk-0-00001.m4s": "first", "chunk-0-00002.m4s": "second"} {
+		if want := newVideoFile(name, []byte(data)); files[name] != want {
+			t.Errorf("%s recorded as %+v, want %+v", name, files[name], want)
+		}
+	}
+	// The manifest changes with every segment, so it is never verified.
+	if want := (VideoFile{Filename: manifestFile, Size: int64(len(firstMPD))}); files[manifestFile] != want {
+		t.Errorf("manifest recorded as %+v, want %+v", files[manifestFile], want)
+	}
+	if _, state := s.live.get(st.videoId); state != liveStreaming {
+		t.Errorf("state = %q after the first manifest", state)
+	}
+
+	// ffmpeg drops segments out of the window; they stay recorded.
+	os.Remove(filepath.Join(st.dir, "chunk-0-00001.m4s"))
+	secondMPD := fmt.Sprintf(testLiveMPD, 2, 1)
+	writeLive(t, st, map[string]string{"chunk-0-00003.m4s": "third", manifestFile: secondMPD})
+	s.syncLive(ctx, st, false)
+	files = recordedFiles(t, s, st)
+	if len(files) != 5 || files["chunk-0-00001.m4s"].Digest == "" || files["chunk-0-00003.m4s"].Digest == "" {
+		t.Errorf("files after the window moved: %v", files)
+	}
+	if files[manifestFile].Size != int64(len(secondMPD)) || files[manifestFile].Digest != "" {
+		t.Errorf("manifest recorded as %+v", files[manifestFile])
+	}
+	data, err := s.contentService.Read(ctx, st.videoId, "chunk-0-00003.m4s")
+	if err != nil || string(data) != "third" {
+		t.Errorf("stored segment = %q, %v", data, err)
+	}
+}
+
+func TestSyncLiveRetriesRecording(t *testing.T) {
+	s, st := newLiveStream(t, testLiveConfig())
+	ctx := context.Background()
+	writeLive(t, st, map[string]string{
+		"init-0.m4s":        "init",
+		"chunk-0-00001.m4s": "first",
+		manifestFile:        fmt.Sprintf(testLiveMPD, 1, 0),
+	})
+
+	real := s.metadataService
+	s.metadataService = failingFiles{real.(*SQLiteVideoMetadataService)}
+	s.syncLive(ctx, st, false)
+	if !st.unrecorded {
+		t.Fatalf("failed recording not retried")
+	}
+	s.metadataService = real
+	s.syncLive(ctx, st, false)
+	if st.unrecorded {
+		t.Errorf("still unrecorded after a successful retry")
+	}
+	if files := recordedFiles(t, s, st); len(files) != 3 {
+		t.Errorf("files = %v", files)
+	}
+}
+
+func TestSyncLiveRecordsGrowingSegments(t *testing.T) {
+	config := testLiveConfig()
+	config.LowLatency = true
+	s, st := newLiveStream(t, config)
+	ctx := context.Background()
+
+	writeLive(t, st, map[string]string{
+		"init-0.m4s":            "init",
+		"chunk-0-00001.m4s.tmp": "chunk",
+	})
+	s.syncLive(ctx, st, false)
+	files := recordedFiles(t, s, st)
+	if want := (VideoFile{Filename: "chunk-0-00001.m4s", Size: 5}); files["chunk-0-00001.m4s"] != want {
+		t.Errorf("growing segment recorded as %+v, want %+v", files["chunk-0-00001.m4s"], want)
+	}
+
+	// ffmpeg gives the segment its final name once it starts the next.
+	os.Remove(filepath.Join(st.dir, "chunk-0-00001.m4s.tmp"))
+	writeLive(t, st, map[string]string{
+		"chunk-0-00001.m4s":     "chunk-complete",
+		"chunk-0-00002.m4s.tmp": "next",
+	})
+	s.syncLive(ctx, st, false)
+	files = recordedFiles(t, s, st)
+	if want := newVideoFile("chunk-0-00001.m4s", []byte("chunk-complete")); files["chunk-0-00001.m4s"] != want {
+		t.Errorf("complete segment recorded as %+v, want %+v", files["chunk-0-00001.m4s"], want)
+	}
+	if files["chunk-0-00002.m4s"].Digest != "" || files["chunk-0-00002.m4s"].Size != 4 {
+		t.Errorf("next segment recorded as %+v", files["chunk-0-00002.m4s"])
+	}
+}
+
+// TestLiveStreamWithFFmpeg publishes a generated clip to a live stream with
+// the local ffmpeg, first without the stream key.
+func TestLiveStreamWithFFmpeg(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	if out, _ := exec.Command("ffmpeg", "-hide_banner", "-protocols").Output(); !bytes.Contains(out, []byte("srt")) {
+		t.Skip("ffmpeg built without SRT")
+	}
+	// SRT runs over UDP.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	config := testLiveConfig()
+	config.PublicHost = "127.0.0.1"
+	config.FirstPort, config.LastPort = port, port
+	config.WorkDir = t.TempDir()
+	s, handler := newSQLiteServer(t, WithLive(config))
+	enc := DefaultEncoding
+	enc.Renditions = []Rendition{{Height: 240, Bitrate: "500k"}}
+	enc.SegmentDuration, enc.KeyframeInterval = 1, 30
+	s.contentService.(*FSVideoContentService).SetEncoding(enc)
+	token := signIn(t, s, "streamer", security.RoleViewer)
+
+	var stream LiveStreamAPIResponse
+	if w := doJSON(t, handler, "POST", "/api/v1/live", token, map[string]any{}, &stream); w.Code != http.StatusCreated {
+		t.Fatalf("POST /api/v1/live = %d: %s", w.Code, w.Body)
+	}
+	t.Cleanup(func() {
+		s.live.stop(stream.VideoId, true)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s.live.shutdown(ctx)
+	})
+
+	publish := func(url string, seconds int) *exec.Cmd {
+		return exec.Command("ffmpeg", "-hide_banner", "-loglevel", "error", "-re",
+			"-f", "lavfi", "-i", fmt.Sprintf("testsrc2=size=320x240:rate=30:duration=%d", seconds),
+			"-f", "lavfi", "-i", fmt.Sprintf("sine=duration=%d", seconds),
+			"-c:v", "libx264", "-g", "30", "-c:a", "aac", "-f", "mpegts", url)
+	}
+	forged := strings.Replace(stream.IngestURL, "passphrase=", "passphrase=not-", 1)
+	if out, err := publish(forged, 1).CombinedOutput(); err == nil {
+		t.Fatalf("published without the stream key:\n%s", out)
+	}
+	if _, state := s.live.get(stream.VideoId); state != liveWaiting {
+		t.Fatalf("state = %q after a publish without the stream key", state)
+	}
+
+	publisher := publish(stream.IngestURL, 6)
+	if err := publisher.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer publisher.Wait()
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		files, err := s.metadataService.Files(stream.VideoId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		segments := 0
+		for _, f := range files {
+			if strings.HasPrefix(f.Filename, "chunk-") && f.Digest != "" {
+				segments++
+			}
+		}
+		if segments > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no segments recorded while live: %v", files)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
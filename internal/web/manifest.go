@@ -0,0 +1,67 @@
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// newVideoFile builds the manifest entry for a file whose contents are in memory.
+func newVideoFile(filename string, data []byte) VideoFile {
+	sum := sha256.Sum256(data)
+	return VideoFile{
+		Filename: filename,
+		Size:     int64(len(data)),
+		Digest:   hex.EncodeToString(sum[:]),
+	}
+}
+
+// statVideoFile builds the manifest entry for a file on disk without loading it whole.
+func statVideoFile(path string) (VideoFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return VideoFile{}, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return VideoFile{}, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+
+	return VideoFile{
+		Filename: filepath.Base(path),
+		Size:     size,
+		Digest:   hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// errDigestMismatch reports a file whose contents differ from its manifest entry.
+var errDigestMismatch = errors.New("digest mismatch")
+
+// verifyDigest checks data against the recorded digest of a file. Files still
+// being written are recorded without one, which always passes.
+func verifyDigest(filename, digest string, data []byte) error {
+	if digest == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != digest {
+		return fmt.Errorf("failed to verify %s: %w", filename, errDigestMismatch)
+	}
+	return nil
+}
+
+// videoFileNames returns the filenames of a manifest in order.
+func videoFileNames(files []VideoFile) []string {
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Filename)
+	}
+	return names
+}
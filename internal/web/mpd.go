@@ -0,0 +1,26 @@
+package web
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+	"tritontube/internal/manifest"
+)
+
+// mpdRoot holds the attributes of a DASH manifest's root element that the web tier reads.
+type mpdRoot struct {
+	XMLName                   xml.Name `xml:"MPD"`
+	MediaPresentationDuration string   `xml:"mediaPresentationDuration,attr"`
+}
+
+// mpdDuration returns the presentation duration declared by a DASH manifest.
+func mpdDuration(data []byte) (time.Duration, error) {
+	var root mpdRoot
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return 0, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if root.MediaPresentationDuration == "" {
+		return 0, nil
+	}
+	return manifest.ParseDuration(root.MediaPresentationDuration)
+}
@@ -6,20 +6,31 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 
+	"tritontube/internal/logging"
+	"tritontube/internal/metrics"
 	"tritontube/internal/proto"
+	"tritontube/internal/tracing"
 )
 
 type NetworkVideoContentService struct {
@@ -28,12 +39,32 @@ type NetworkVideoContentService struct {
 	hashRing       []uint64
 	serverMap      map[uint64]string
 	mu             sync.RWMutex // Protects StorageServers, hashRing, and serverMap
+
+	// metadata holds the per-video file manifests used to locate files
+	// without scanning every storage node. May be nil.
+	metadata VideoMetadataService
+
+	// creds secure connections to storage nodes.
+	creds credentials.TransportCredentials
+
+	// OnFileMoved, if set, is called for every file a ring change moves to
+	// another node, e.g. to drop it from a cache.
+	OnFileMoved func(videoId, filename string)
+
+	encodingSetting
 }
 
-func NewNetworkVideoContentService(servers []string) *NetworkVideoContentService {
+// NewNetworkVideoContentService returns a content service spreading files
+// over servers. A nil creds dials storage nodes without TLS.
+func NewNetworkVideoContentService(servers []string, metadata VideoMetadataService, creds credentials.TransportCredentials) *NetworkVideoContentService {
+	if creds == nil {
+		creds = insecure.NewCredentials()
+	}
 	service := &NetworkVideoContentService{
 		StorageServers: servers,
 		serverMap:      make(map[uint64]string),
+		metadata:       metadata,
+		creds:          creds,
 	}
 	service.initHashRing()
 
@@ -52,6 +83,19 @@ func (n *NetworkVideoContentService) initHashRing() {
 	sort.Slice(n.hashRing, func(i, j int) bool {
 		return n.hashRing[i] < n.hashRing[j]
 	})
+	metrics.RingNodes.Set(float64(len(n.hashRing)))
+}
+
+func (n *NetworkVideoContentService) dial(server string) (*grpc.ClientConn, error) {
+	return grpc.NewClient(server,
+		grpc.WithTransportCredentials(n.creds),
+		grpc.WithChainUnaryInterceptor(logging.UnaryClientInterceptor(), metrics.UnaryClientInterceptor()),
+		tracing.DialOption(),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(math.MaxInt32),
+			grpc.MaxCallSendMsgSize(math.MaxInt32),
+		),
+	)
 }
 
 func hashStringToUint64(s string) uint64 {
@@ -76,6 +120,11 @@ func (n *NetworkVideoContentService) getServerForKey(videoId string, filename st
 	return n.serverMap[n.hashRing[idx]]
 }
 
+// NodeFor returns the address of the storage node that holds a file.
+func (n *NetworkVideoContentService) NodeFor(videoId, filename string) string {
+	return n.getServerForKey(videoId, filename)
+}
+
 // Admin Service Implementation
 // I have implemented the three methods that were expected:
 // ListNodes, AddNode, RemoveNode
@@ -93,7 +142,7 @@ func (n *NetworkVideoContentService) ListNodes(ctx context.Context, req *proto.L
 
 func (n *NetworkVideoContentService) AddNode(ctx context.Context, req *proto.AddNodeRequest) (*proto.AddNodeResponse, error) {
 	nodeAddr := req.NodeAddress
-	log.Printf("Adding node: %s", nodeAddr)
+	slog.InfoContext(ctx, "Adding node", "node", nodeAddr)
 
 	n.mu.Lock()
 	defer n.mu.Unlock()
@@ -104,7 +153,7 @@ func (n *NetworkVideoContentService) AddNode(ctx context.Context, req *proto.Add
 		}
 	}
 
-	allFiles, err := n.getAllFiles()
+	allFiles, digests, err := n.clusterFiles(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all files: %w", err)
 	}
@@ -119,18 +168,21 @@ func (n *NetworkVideoContentService) AddNode(ctx context.Context, req *proto.Add
 
 	n.StorageServers = append(n.StorageServers, nodeAddr)
 	n.initHashRing()
-	migratedCount, err := n.migrateFiles(allFiles, oldMapping)
+	// Finish the migration even if the admin client goes away.
+	migratedCount, err := n.migrateFiles(context.WithoutCancel(ctx), allFiles, oldMapping, digests)
 	if err != nil {
+		metrics.Migrations.WithLabelValues("add", "failed").Inc()
 		return nil, fmt.Errorf("failed to migrate files: %w", err)
 	}
+	metrics.Migrations.WithLabelValues("add", "ok").Inc()
 
-	log.Printf("Successfully added node %s, migrated %d files", nodeAddr, migratedCount)
+	slog.InfoContext(ctx, "Added node", "node", nodeAddr, "migrated", migratedCount)
 	return &proto.AddNodeResponse{MigratedFileCount: int32(migratedCount)}, nil
 }
 
 func (n *NetworkVideoContentService) RemoveNode(ctx context.Context, req *proto.RemoveNodeRequest) (*proto.RemoveNodeResponse, error) {
 	nodeAddr := req.NodeAddress
-	fmt.Printf("Removing node: %s", nodeAddr)
+	slog.InfoContext(ctx, "Removing node", "node", nodeAddr)
 
 	n.mu.Lock()
 	defer n.mu.Unlock()
@@ -146,7 +198,7 @@ func (n *NetworkVideoContentService) RemoveNode(ctx context.Context, req *proto.
 		return nil, fmt.Errorf("Node %s not found", nodeAddr)
 	}
 
-	allFiles, err := n.getAllFiles()
+	allFiles, digests, err := n.clusterFiles(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get all files: %w", err)
 	}
@@ -160,20 +212,120 @@ func (n *NetworkVideoContentService) RemoveNode(ctx context.Context, req *proto.
 	n.StorageServers = append(n.StorageServers[:nodeIndex], n.StorageServers[nodeIndex+1:]...)
 	n.initHashRing()
 
-	migratedCount, err := n.migrateFiles(allFiles, oldMapping)
+	migratedCount, err := n.migrateFiles(context.WithoutCancel(ctx), allFiles, oldMapping, digests)
 	if err != nil {
+		metrics.Migrations.WithLabelValues("remove", "failed").Inc()
 		return nil, fmt.Errorf("failed to migrate files: %w", err)
 	}
+	metrics.Migrations.WithLabelValues("remove", "ok").Inc()
 
-	log.Printf("Successfully removed node %s, migrated %d files", nodeAddr, migratedCount)
+	slog.InfoContext(ctx, "Removed node", "node", nodeAddr, "migrated", migratedCount)
 	return &proto.RemoveNodeResponse{MigratedFileCount: int32(migratedCount)}, nil
 }
 
-func (n *NetworkVideoContentService) getAllFiles() (map[string][]*proto.FileInfo, error) {
+// CheckHealth implements HealthChecker by asking every node in the ring for
+// its gRPC health. Nodes without the health service count as reachable.
+func (n *NetworkVideoContentService) CheckHealth(ctx context.Context) error {
+	n.mu.RLock()
+	servers := append([]string(nil), n.StorageServers...)
+	n.mu.RUnlock()
+
+	var unreachable []string
+	for _, server := range servers {
+		if err := n.checkNode(ctx, server); err != nil {
+			slog.WarnContext(ctx, "Storage node not healthy", "node", server, "err", err)
+			unreachable = append(unreachable, server)
+		}
+	}
+	if len(unreachable) > 0 {
+		return fmt.Errorf("storage nodes not serving: %s", strings.Join(unreachable, ", "))
+	}
+	return nil
+}
+
+func (n *NetworkVideoContentService) checkNode(ctx context.Context, server string) error {
+	conn, err := n.dial(server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+// clusterFiles returns the files held by each storage server, along with the
+// recorded digests of those files keyed by "videoId/filename". Videos with a
+// recorded manifest are placed from the current ring; the files of the rest
+// are found by scanning every node. Callers must hold n.mu.
+func (n *NetworkVideoContentService) clusterFiles(ctx context.Context) (map[string][]*proto.FileInfo, map[string]string, error) {
+	if n.metadata == nil {
+		allFiles, err := n.getAllFiles(ctx)
+		return allFiles, nil, err
+	}
+
+	videos, err := n.metadata.List()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+
+	allFiles := make(map[string][]*proto.FileInfo)
+	digests := make(map[string]string)
+	unrecorded := make(map[string]bool)
+	for _, video := range videos {
+		files, err := n.metadata.Files(video.Id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read manifest for video %s: %w", video.Id, err)
+		}
+		if len(files) == 0 {
+			unrecorded[video.Id] = true
+			continue
+		}
+		for _, file := range files {
+			server := n.identifyServerForGivenKey(video.Id, file.Filename)
+			allFiles[server] = append(allFiles[server], &proto.FileInfo{
+				VideoId:  video.Id,
+				Filename: file.Filename,
+			})
+			digests[video.Id+"/"+file.Filename] = file.Digest
+		}
+	}
+	if len(unrecorded) == 0 {
+		return allFiles, digests, nil
+	}
+
+	slog.InfoContext(ctx, "No manifest recorded for some videos, scanning storage nodes", "videos", len(unrecorded))
+	scanned, err := n.getAllFiles(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for server, files := range scanned {
+		for _, file := range files {
+			if unrecorded[file.VideoId] {
+				allFiles[server] = append(allFiles[server], file)
+			}
+		}
+	}
+
+	return allFiles, digests, nil
+}
+
+func (n *NetworkVideoContentService) getAllFiles(ctx context.Context) (map[string][]*proto.FileInfo, error) {
 	allFiles := make(map[string][]*proto.FileInfo)
 
 	for _, server := range n.StorageServers {
-		files, err := n.listFilesOnServer(server)
+		files, err := n.listFilesOnServer(ctx, server)
 		if err != nil {
 			return nil, fmt.Errorf("failed to list files on server %s: %w", server, err)
 		}
@@ -183,23 +335,15 @@ func (n *NetworkVideoContentService) getAllFiles() (map[string][]*proto.FileInfo
 	return allFiles, nil
 }
 
-func (n *NetworkVideoContentService) listFilesOnServer(server string) ([]*proto.FileInfo, error) {
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(math.MaxInt32),
-			grpc.MaxCallSendMsgSize(math.MaxInt32),
-		),
-	}
-
-	conn, err := grpc.NewClient(server, opts...)
+func (n *NetworkVideoContentService) listFilesOnServer(ctx context.Context, server string) ([]*proto.FileInfo, error) {
+	conn, err := n.dial(server)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to storage server %s: %w", server, err)
 	}
 	defer conn.Close()
 
 	client := proto.NewVideoContentStorageServiceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 	response, err := client.ListFiles(ctx, &proto.ListFilesRequest{})
 	if err != nil {
@@ -209,9 +353,20 @@ func (n *NetworkVideoContentService) listFilesOnServer(server string) ([]*proto.
 	return response.Files, nil
 }
 
-func (n *NetworkVideoContentService) migrateFiles(allFiles map[string][]*proto.FileInfo, oldMapping map[string]string) (int, error) {
+func (n *NetworkVideoContentService) migrateFiles(ctx context.Context, allFiles map[string][]*proto.FileInfo, oldMapping map[string]string, digests map[string]string) (int, error) {
 	migratedCount := 0
 
+	pending := 0
+	for _, files := range allFiles {
+		for _, file := range files {
+			if oldMapping[fmt.Sprintf("%s/%s", file.VideoId, file.Filename)] != n.identifyServerForGivenKey(file.VideoId, file.Filename) {
+				pending++
+			}
+		}
+	}
+	metrics.MigrationPending.Set(float64(pending))
+	defer metrics.MigrationPending.Set(0)
+
 	// TODO: iterate through all the files and for every file check current server and the new server and move the file
 	for _, files := range allFiles {
 		for _, file := range files {
@@ -222,12 +377,18 @@ func (n *NetworkVideoContentService) migrateFiles(allFiles map[string][]*proto.F
 
 			if oldServer != newServer {
 
-				log.Printf("Migrating file %s from %s to %s", key, oldServer, newServer)
-				if err := n.moveFile(file, oldServer, newServer); err != nil {
+				slog.DebugContext(ctx, "Migrating file", "file", key, "from", oldServer, "to", newServer)
+				if err := n.moveFile(ctx, file, digests[key], oldServer, newServer); err != nil {
+					metrics.MigrationFiles.WithLabelValues("failed").Inc()
 					return migratedCount, fmt.Errorf("Error: Failed to move file %s from %s to %s: %w",
 						key, oldServer, newServer, err)
 				}
 				migratedCount++
+				metrics.MigrationFiles.WithLabelValues("moved").Inc()
+				if n.OnFileMoved != nil {
+					n.OnFileMoved(file.VideoId, file.Filename)
+				}
+				metrics.MigrationPending.Dec()
 			}
 		}
 	}
@@ -253,42 +414,40 @@ func (n *NetworkVideoContentService) identifyServerForGivenKey(videoId string, f
 	return n.serverMap[n.hashRing[idx]]
 }
 
-func (n *NetworkVideoContentService) moveFile(file *proto.FileInfo, fromServer, toServer string) error {
+// moveFile copies a file to its new server and deletes it from the old one.
+// A file whose contents no longer match its recorded digest is left where it
+// is; an empty digest is not checked.
+func (n *NetworkVideoContentService) moveFile(ctx context.Context, file *proto.FileInfo, digest, fromServer, toServer string) error {
 
 	// TODO: read, write and then delete
-	data, err := n.readFileFromServer(file.VideoId, file.Filename, fromServer)
+	data, err := n.readFileFromServer(ctx, file.VideoId, file.Filename, fromServer)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
+	if err := verifyDigest(file.Filename, digest, data); err != nil {
+		return err
+	}
 
-	if err := n.writeFileToServer(file.VideoId, file.Filename, data, toServer); err != nil {
+	if err := n.writeFileToServer(ctx, file.VideoId, file.Filename, data, toServer); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
-	if err := n.deleteFileFromServer(file.VideoId, file.Filename, fromServer); err != nil {
+	if err := n.deleteFileFromServer(ctx, file.VideoId, file.Filename, fromServer); err != nil {
 		return fmt.Errorf("failed to delete file from source: %w", err)
 	}
 
 	return nil
 }
 
-func (n *NetworkVideoContentService) readFileFromServer(videoId, filename, server string) ([]byte, error) {
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(math.MaxInt32),
-			grpc.MaxCallSendMsgSize(math.MaxInt32),
-		),
-	}
-
-	conn, err := grpc.NewClient(server, opts...)
+func (n *NetworkVideoContentService) readFileFromServer(ctx context.Context, videoId, filename, server string) ([]byte, error) {
+	conn, err := n.dial(server)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to storage server %s: %w", server, err)
 	}
 	defer conn.Close()
 
 	client := proto.NewVideoContentStorageServiceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	response, err := client.Read(ctx, &proto.ReadRequest{
@@ -302,23 +461,15 @@ func (n *NetworkVideoContentService) readFileFromServer(videoId, filename, serve
 	return response.Data, nil
 }
 
-func (n *NetworkVideoContentService) writeFileToServer(videoId, filename string, data []byte, server string) error {
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(math.MaxInt32),
-			grpc.MaxCallSendMsgSize(math.MaxInt32),
-		),
-	}
-
-	conn, err := grpc.NewClient(server, opts...)
+func (n *NetworkVideoContentService) writeFileToServer(ctx context.Context, videoId, filename string, data []byte, server string) error {
+	conn, err := n.dial(server)
 	if err != nil {
 		return fmt.Errorf("failed to connect to storage server %s: %w", server, err)
 	}
 	defer conn.Close()
 
 	client := proto.NewVideoContentStorageServiceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	_, err = client.Write(ctx, &proto.WriteRequest{
@@ -333,23 +484,15 @@ func (n *NetworkVideoContentService) writeFileToServer(videoId, filename string,
 	return nil
 }
 
-func (n *NetworkVideoContentService) deleteFileFromServer(videoId, filename, server string) error {
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(math.MaxInt32),
-			grpc.MaxCallSendMsgSize(math.MaxInt32),
-		),
-	}
-
-	conn, err := grpc.NewClient(server, opts...)
+func (n *NetworkVideoContentService) deleteFileFromServer(ctx context.Context, videoId, filename, server string) error {
+	conn, err := n.dial(server)
 	if err != nil {
 		return fmt.Errorf("failed to connect to storage server %s: %w", server, err)
 	}
 	defer conn.Close()
 
 	client := proto.NewVideoContentStorageServiceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
 	_, err = client.DeleteFile(ctx, &proto.DeleteFileRequest{
@@ -367,18 +510,12 @@ func (n *NetworkVideoContentService) deleteFileFromServer(videoId, filename, ser
 // Read and Write methods
 // writeToStorageServer is a helper func which I have used in Write method
 // to write to the storage server consistent hash
-func (n *NetworkVideoContentService) Read(videoId string, filename string) ([]byte, error) {
+func (n *NetworkVideoContentService) Read(ctx context.Context, videoId string, filename string) ([]byte, error) {
 	server := n.getServerForKey(videoId, filename)
 
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(math.MaxInt32),
-			grpc.MaxCallSendMsgSize(math.MaxInt32),
-		),
-	}
-
-	conn, err := grpc.NewClient(server, opts...)
+	_, span := tracing.Start(ctx, "storage.dial", trace.WithAttributes(attribute.String("storage.node", server)))
+	conn, err := n.dial(server)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to storage server %s: %w", server, err)
 	}
@@ -386,7 +523,7 @@ func (n *NetworkVideoContentService) Read(videoId string, filename string) ([]by
 
 	client := proto.NewVideoContentStorageServiceClient(conn)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
 	response, err := client.Read(ctx, &proto.ReadRequest{
@@ -396,79 +533,52 @@ func (n *NetworkVideoContentService) Read(videoId string, filename string) ([]by
 	if err != nil {
 		return nil, fmt.Errorf("storage server read failed for %s: %w", filename, err)
 	}
-
 	return response.Data, nil
 }
 
-func (n *NetworkVideoContentService) Write(videoId string, filename string, data []byte) error {
+func (n *NetworkVideoContentService) Write(ctx context.Context, videoId string, filename string, data []byte) ([]VideoFile, error) {
 	projectRoot, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("failed to get working directory: %w", err)
+		return nil, fmt.Errorf("failed to get working directory: %w", err)
 	}
 	tempDir := filepath.Join(projectRoot, "video-upload-"+videoId)
 	err = os.Mkdir(tempDir, 0755)
 	if err != nil && !os.IsExist(err) {
-		return fmt.Errorf("failed to create temp directory: %w", err)
+		return nil, fmt.Errorf("failed to create temp directory: %w", err)
 	}
 	defer os.RemoveAll(tempDir)
 
 	tempInputFile := filepath.Join(tempDir, filename)
 	err = os.WriteFile(tempInputFile, data, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to write input file: %w", err)
+		return nil, fmt.Errorf("failed to write input file: %w", err)
 	}
 
 	tempManifestPath := filepath.Join(tempDir, "manifest.mpd")
-	cmd := exec.Command(
-		"ffmpeg",
-		"-i", tempInputFile,
-		"-c:v", "libx264",
-		"-c:a", "aac",
-		"-bf", "1",
-		"-keyint_min", "120",
-		"-g", "120",
-		"-sc_threshold", "0",
-		"-b:v", "3000k",
-		"-b:a", "128k",
-		"-f", "dash",
-		"-use_timeline", "1",
-		"-use_template", "1",
-		"-init_seg_name", "init-$RepresentationID$.m4s",
-		"-media_seg_name", "chunk-$RepresentationID$-$Number%05d$.m4s",
-		"-seg_duration", "4",
-		tempManifestPath,
-	)
+	encoding := n.encoding()
+	cmd := encoding.dashCommand(tempInputFile, tempManifestPath)
 	cmd.Dir = tempDir
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to execute ffmpeg command: %w", err)
+	if err := runFFmpeg(ctx, "dash", cmd); err != nil {
+		return nil, fmt.Errorf("failed to execute ffmpeg command: %w", err)
 	}
 
-	// Generate thumbnail
-	tempThumbnailPath := filepath.Join(tempDir, "thumbnail.jpg")
-	thumbnailCmd := exec.Command(
-		"ffmpeg",
-		"-i", tempInputFile,
-		"-ss", "00:00:01", // Take frame at 1 second
-		"-vframes", "1", // Take only one frame
-		"-q:v", "2", // High quality
-		"-y", // Overwrite output file if it exists
-		tempThumbnailPath,
-	)
-	if err := thumbnailCmd.Run(); err != nil {
-		return fmt.Errorf("failed to generate thumbnail: %w", err)
+	// Generate poster and scrub preview thumbnails
+	if err := encoding.writeImages(ctx, tempInputFile, tempDir); err != nil {
+		return nil, fmt.Errorf("failed to generate thumbnails: %w", err)
 	}
 
 	err = os.Remove(tempInputFile)
 	if err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("failed to delete temp input file: %w", err)
+		return nil, fmt.Errorf("failed to delete temp input file: %w", err)
 	}
 
 	files, err := os.ReadDir(tempDir)
 	if err != nil {
-		return fmt.Errorf("failed to read temp directory: %w", err)
+		return nil, fmt.Errorf("failed to read temp directory: %w", err)
 	}
 
+	var written []VideoFile
 	for _, file := range files {
 		if file.IsDir() {
 			continue
@@ -477,30 +587,110 @@ func (n *NetworkVideoContentService) Write(videoId string, filename string, data
 		filePath := filepath.Join(tempDir, file.Name())
 		fileData, err := os.ReadFile(filePath)
 		if err != nil {
-			return fmt.Errorf("failed to read generated file %s: %w", file.Name(), err)
+			return written, fmt.Errorf("failed to read generated file %s: %w", file.Name(), err)
 		}
 
-		err = n.writeToStorageServer(videoId, file.Name(), fileData)
+		err = n.writeToStorageServer(ctx, videoId, file.Name(), fileData)
 		if err != nil {
-			return fmt.Errorf("failed to write file %s to storage: %w", file.Name(), err)
+			// The node may have stored part of it.
+			written = append(written, VideoFile{Filename: file.Name()})
+			return written, fmt.Errorf("failed to write file %s to storage: %w", file.Name(), err)
 		}
+		written = append(written, newVideoFile(file.Name(), fileData))
+	}
+
+	return written, nil
+}
+
+// WriteFile implements FileWriter.
+func (n *NetworkVideoContentService) WriteFile(ctx context.Context, videoId string, filename string, data []byte) error {
+	return n.writeToStorageServer(ctx, videoId, filename, data)
+}
+
+// AppendFile implements FileAppender.
+func (n *NetworkVideoContentService) AppendFile(ctx context.Context, videoId string, filename string, offset int64, data []byte, complete bool) (err error) {
+	server := n.getServerForKey(videoId, filename)
+
+	ctx, span := tracing.Start(ctx, "storage.append", trace.WithAttributes(
+		attribute.String("storage.node", server),
+		attribute.String("video.file", filename),
+		attribute.Int("video.file_size", len(data)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	conn, err := n.dial(server)
+	if err != nil {
+		return fmt.Errorf("failed to connect to storage server %s: %w", server, err)
+	}
+	defer conn.Close()
+
+	client := proto.NewVideoContentStorageServiceClient(conn)
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	_, err = client.Append(ctx, &proto.AppendRequest{
+		VideoId:  videoId,
+		Filename: filename,
+		Offset:   offset,
+		Data:     data,
+		Complete: complete,
+	})
+	if err != nil {
+		return fmt.Errorf("storage server append failed for %s: %w", filename, err)
 	}
 
 	return nil
 }
 
-func (n *NetworkVideoContentService) writeToStorageServer(videoId string, filename string, data []byte) error {
+// ReadStream implements StreamReader.
+func (n *NetworkVideoContentService) ReadStream(ctx context.Context, videoId string, filename string) (io.ReadCloser, error) {
 	server := n.getServerForKey(videoId, filename)
 
-	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(math.MaxInt32),
-			grpc.MaxCallSendMsgSize(math.MaxInt32),
-		),
+	conn, err := n.dial(server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to storage server %s: %w", server, err)
 	}
 
-	conn, err := grpc.NewClient(server, opts...)
+	return pipeStream(ctx, func(ctx context.Context, w io.Writer) error {
+		defer conn.Close()
+		client := proto.NewVideoContentStorageServiceClient(conn)
+		stream, err := client.ReadStream(ctx, &proto.ReadRequest{
+			VideoId:  videoId,
+			Filename: filename,
+		})
+		if err != nil {
+			return fmt.Errorf("storage server read failed for %s: %w", filename, err)
+		}
+		for {
+			resp, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if status.Code(err) == codes.NotFound {
+				return fmt.Errorf("storage server read failed for %s: %w", filename, os.ErrNotExist)
+			}
+			if err != nil {
+				return fmt.Errorf("storage server read failed for %s: %w", filename, err)
+			}
+			if _, err := w.Write(resp.Data); err != nil {
+				return err
+			}
+		}
+	}), nil
+}
+
+func (n *NetworkVideoContentService) writeToStorageServer(ctx context.Context, videoId string, filename string, data []byte) (err error) {
+	server := n.getServerForKey(videoId, filename)
+
+	ctx, span := tracing.Start(ctx, "storage.write", trace.WithAttributes(
+		attribute.String("storage.node", server),
+		attribute.String("video.file", filename),
+		attribute.Int("video.file_size", len(data)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	conn, err := n.dial(server)
 	if err != nil {
 		return fmt.Errorf("failed to connect to storage server %s: %w", server, err)
 	}
@@ -508,7 +698,7 @@ func (n *NetworkVideoContentService) writeToStorageServer(videoId string, filena
 
 	client := proto.NewVideoContentStorageServiceClient(conn)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
 	_, err = client.Write(ctx, &proto.WriteRequest{
@@ -524,14 +714,27 @@ func (n *NetworkVideoContentService) writeToStorageServer(videoId string, filena
 }
 
 // Delete implements VideoContentService.
-func (n *NetworkVideoContentService) Delete(videoId string, filename string) error {
+func (n *NetworkVideoContentService) Delete(ctx context.Context, videoId string, filename string) error {
 	server := n.getServerForKey(videoId, filename)
-	return n.deleteFileFromServer(videoId, filename, server)
+	return n.deleteFileFromServer(ctx, videoId, filename, server)
 }
 
 // ListFiles implements VideoContentService.
-func (n *NetworkVideoContentService) ListFiles(videoId string) ([]string, error) {
-	allFiles, err := n.getAllFiles()
+func (n *NetworkVideoContentService) ListFiles(ctx context.Context, videoId string) ([]string, error) {
+	if n.metadata != nil {
+		files, err := n.metadata.Files(videoId)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest: %w", err)
+		}
+		if len(files) > 0 {
+			return videoFileNames(files), nil
+		}
+	}
+
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	allFiles, err := n.getAllFiles(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get all files: %w", err)
 	}
@@ -0,0 +1,217 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"tritontube/internal/proto"
+	"tritontube/internal/security"
+)
+
+func TestClusterFilesScansOnlyUnrecordedVideos(t *testing.T) {
+	ctx := context.Background()
+	addr, dir := startStorageNode(t)
+	metadata := newTestMetadata(t)
+	n := NewNetworkVideoContentService([]string{addr}, metadata, nil)
+
+	// "recorded" has a manifest that lists one of its two stored files.
+	createVideo(t, metadata, "recorded")
+	for _, name := range []string{"manifest.mpd", "stray.m4s"} {
+		if err := n.WriteFile(ctx, "recorded", name, []byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := metadata.SetFiles("recorded", []VideoFile{newVideoFile("manifest.mpd", []byte("manifest.mpd"))}); err != nil {
+		t.Fatal(err)
+	}
+	// "legacy" was uploaded before manifests were recorded.
+	createVideo(t, metadata, "legacy")
+	if err := n.WriteFile(ctx, "legacy", "manifest.mpd", []byte("legacy")); err != nil {
+		t.Fatal(err)
+	}
+	// "orphan" has no metadata at all.
+	if err := os.MkdirAll(filepath.Join(dir, "orphan"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "orphan", "manifest.mpd"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	allFiles, digests, err := n.clusterFiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, files := range allFiles {
+		for _, file := range files {
+			got[file.VideoId+"/"+file.Filename] = true
+		}
+	}
+	want := map[string]bool{"recorded/manifest.mpd": true, "legacy/manifest.mpd": true}
+	if len(got) != len(want) {
+		t.Fatalf("clusterFiles = %v, want %v", got, want)
+	}
+	for key := range want {
+		if !got[key] {
+			t.Errorf("clusterFiles is missing %s, got %v", key, got)
+		}
+	}
+	if digests["recorded/manifest.mpd"] == "" {
+		t.Errorf("no digest returned for a recorded file")
+	}
+}
+
+// Digests are checked when files move between nodes, not on the content
+// path, so playback does not depend on the metadata database.
+func TestReadDoesNotNeedMetadata(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startStorageNode(t)
+	metadata := newTestMetadata(t)
+	n := NewNetworkVideoContentService([]string{addr}, metadata, nil)
+
+	createVideo(t, metadata, "video")
+	if err := n.WriteFile(ctx, "video", "manifest.mpd", []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+	if err := metadata.SetFiles("video", []VideoFile{newVideoFile("manifest.mpd", []byte("original"))}); err != nil {
+		t.Fatal(err)
+	}
+	metadata.Instance.Close()
+	data, err := n.Read(ctx, "video", "manifest.mpd")
+	if err != nil || string(data) != "original" {
+		t.Fatalf("Read = %q, %v, want %q", data, err, "original")
+	}
+}
+
+func TestMoveFileKeepsCorruptedFile(t *testing.T) {
+	ctx := context.Background()
+	from, fromDir := startStorageNode(t)
+	to, toDir := startStorageNode(t)
+	n := NewNetworkVideoContentService([]string{from, to}, nil, nil)
+
+	if err := n.writeFileToServer(ctx, "video", "segment.m4s", []byte("corrupted"), from); err != nil {
+		t.Fatal(err)
+	}
+	file := &proto.FileInfo{VideoId: "video", Filename: "segment.m4s"}
+	digest := newVideoFile("segment.m4s", []byte("original")).Digest
+	if err := n.moveFile(ctx, file, digest, from, to); !errors.Is(err, errDigestMismatch) {
+		t.Fatalf("moveFile: err = %v, want %v", err, errDigestMismatch)
+	}
+	if _, err := os.Stat(filepath.Join(fromDir, "video", "segment.m4s")); err != nil {
+		t.Errorf("source file: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(toDir, "video", "segment.m4s")); !os.IsNotExist(err) {
+		t.Errorf("corrupted file was copied to the new node")
+	}
+}
+
+// failingFiles fails to record file manifests.
+type failingFiles struct {
+	*SQLiteVideoMetadataService
+}
+
+func (failingFiles) SetFiles(string, []VideoFile) error {
+	return errors.New("database is locked")
+}
+
+func TestUploadDeletesFilesWhenManifestFails(t *testing.T) {
+	metadata := newTestMetadata(t)
+	dir := t.TempDir()
+	content := &stubContentService{
+		FSVideoContentService: &FSVideoContentService{BaseDir: dir},
+		files:                 map[string][]byte{"manifest.mpd": []byte("<MPD/>"), "init-stream0.m4s": []byte("init")},
+	}
+	s := NewServer(failingFiles{metadata}, content, metadata, metadata)
+	handler := newTestServer(t, s)
+	token := signIn(t, s, "uploader", security.RoleViewer)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, uploadRequest(t, token, "clip.mp4", []byte("video")))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("upload status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "clip"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d unrecorded files left behind", len(entries))
+	}
+	if video, err := metadata.Read("clip"); err != nil || video != nil {
+		t.Errorf("metadata left behind: %v, %v", video, err)
+	}
+}
+
+func TestUploadDeletesFilesWhenWriteFails(t *testing.T) {
+	metadata := newTestMetadata(t)
+	dir := t.TempDir()
+	content := &stubContentService{
+		FSVideoContentService: &FSVideoContentService{BaseDir: dir},
+		files:                 map[string][]byte{"manifest.mpd": []byte("<MPD/>"), "init-stream0.m4s": []byte("init")},
+		err:                   errors.New("storage node unavailable"),
+	}
+	s := NewServer(metadata, content, metadata, metadata)
+	handler := newTestServer(t, s)
+	token := signIn(t, s, "uploader", security.RoleViewer)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, uploadRequest(t, token, "clip.mp4", []byte("video")))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("upload status = %d, want %d: %s", w.Code, http.StatusInternalServerError, w.Body)
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "clip"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%d files of the failed upload left behind", len(entries))
+	}
+	// Left behind, the video would count as unrecorded on every node change.
+	if videos, err := metadata.List(); err != nil || len(videos) != 0 {
+		t.Errorf("videos after the failed upload = %v, %v", videos, err)
+	}
+}
+
+func TestNetworkStreamsGrowingFiles(t *testing.T) {
+	ctx := context.Background()
+	addr, _ := startStorageNode(t)
+	n := NewNetworkVideoContentService([]string{addr}, nil, nil)
+
+	missing, err := n.ReadStream(ctx, "live-1", "chunk-0-00009.m4s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stream of a missing file: %v", err)
+	}
+	missing.Close()
+
+	if err := n.AppendFile(ctx, "live-1", "chunk-0-00001.m4s", 0, []byte("moof1"), false); err != nil {
+		t.Fatal(err)
+	}
+	stream, err := n.ReadStream(ctx, "live-1", "chunk-0-00001.m4s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	first := make([]byte, 5)
+	if _, err := io.ReadFull(stream, first); err != nil || string(first) != "moof1" {
+		t.Fatalf("first chunk = %q, %v", first, err)
+	}
+	if err := n.AppendFile(ctx, "live-1", "chunk-0-00001.m4s", 5, []byte("mdat1"), true); err != nil {
+		t.Fatal(err)
+	}
+	if rest, err := io.ReadAll(stream); err != nil || string(rest) != "mdat1" {
+		t.Errorf("rest of the file = %q, %v", rest, err)
+	}
+	if data, err := n.Read(ctx, "live-1", "chunk-0-00001.m4s"); err != nil || string(data) != "moof1mdat1" {
+		t.Errorf("Read = %q, %v", data, err)
+	}
+}
@@ -0,0 +1,141 @@
+package web
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// openAPISpec describes every API endpoint. The tests compare it with the
+// registered routes, so the document cannot fall behind.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+const openAPIPath = "/api/openapi.json"
+
+// API endpoint: GET /api/openapi.json - The OpenAPI 3 document of the API
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// openAPISchemas maps schemas in the document to the types handlers encode
+// or decode for them. Responses must mark exactly their fields without
+// omitempty as required.
+var openAPISchemas = map[string]struct {
+	value    any
+	response bool
+}{
+	"Video":           {VideoAPIResponse{}, true},
+	"VideoUpdate":     {VideoUpdateRequest{}, false},
+	"LiveStream":      {LiveStreamAPIResponse{}, true},
+	"Subtitle":        {SubtitleAPIResponse{}, true},
+	"Label":           {LabelAPIResponse{}, true},
+	"Playlist":        {PlaylistAPIResponse{}, true},
+	"PlaylistRequest": {PlaylistRequest{}, false},
+	"Credentials":     {CredentialsRequest{}, false},
+	"User":            {UserAPIResponse{}, true},
+	"Token":           {TokenAPIResponse{}, true},
+	"AuditEntry":      {AuditEntryAPIResponse{}, true},
+}
+
+type openAPIDocument struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+// checkOpenAPI compares the document with the API routes registered on the
+// mux, given as "METHOD /path" patterns, and with the request and response
+// types of the handlers. It reports every mismatch.
+func checkOpenAPI(spec []byte, patterns []string) error {
+	var doc openAPIDocument
+	if err := json.Unmarshal(spec, &doc); err != nil {
+		return fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	var errs []error
+
+	documented := make(map[string]bool)
+	for path, item := range doc.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options":
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+	registered := make(map[string]bool)
+	for _, pattern := range patterns {
+		registered[pattern] = true
+		if !documented[pattern] {
+			errs = append(errs, fmt.Errorf("route %s is not documented", pattern))
+		}
+	}
+	for _, op := range slices.Sorted(maps.Keys(documented)) {
+		if !registered[op] {
+			errs = append(errs, fmt.Errorf("documented operation %s has no route", op))
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(openAPISchemas)) {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("schema %s is missing", name))
+			continue
+		}
+		typ := openAPISchemas[name]
+		fields, omitted := jsonFields(reflect.TypeOf(typ.value))
+		for _, field := range fields {
+			if _, ok := schema.Properties[field]; !ok {
+				errs = append(errs, fmt.Errorf("schema %s lacks property %s", name, field))
+			}
+		}
+		for property := range schema.Properties {
+			if !slices.Contains(fields, property) {
+				errs = append(errs, fmt.Errorf("schema %s has property %s, which %T does not", name, property, typ.value))
+			}
+		}
+		if !typ.response {
+			continue
+		}
+		for _, field := range fields {
+			required := slices.Contains(schema.Required, field)
+			if required && omitted[field] {
+				errs = append(errs, fmt.Errorf("schema %s marks %s required, but it is omitted when empty", name, field))
+			} else if !required && !omitted[field] {
+				errs = append(errs, fmt.Errorf("schema %s does not mark %s required, but it is always present", name, field))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// jsonFields lists the JSON names of the fields of struct type t and which
+// of them are omitted when empty.
+func jsonFields(t reflect.Type) ([]string, map[string]bool) {
+	var names []string
+	omitted := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "-" || !t.Field(i).IsExported() {
+			continue
+		}
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		names = append(names, name)
+		omitted[name] = strings.Contains(opts, "omitempty")
+	}
+	return names, omitted
+}
@@ -0,0 +1,34 @@
+package web
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	s, _ := newSQLiteServer(t)
+	if err := checkOpenAPI(openAPISpec, s.apiRoutes); err != nil {
+		t.Errorf("API does not match openapi.json:\n%v", err)
+	}
+}
+
+func TestCheckOpenAPIReportsMismatches(t *testing.T) {
+	spec := `{"paths": {"/api/v1/videos": {"get": {}, "parameters": []}, "/api/v1/gone": {"post": {}}},
+		"components": {"schemas": {"Label": {"properties": {"name": {}, "extra": {}}, "required": ["name"]}}}}`
+	err := checkOpenAPI([]byte(spec), []string{"GET /api/v1/videos", "GET /api/v1/tags"})
+	if err == nil {
+		t.Fatal("mismatching document accepted")
+	}
+	for _, want := range []string{
+		"route GET /api/v1/tags is not documented",
+		"documented operation POST /api/v1/gone has no route",
+		"schema Label lacks property count",
+		"schema Label has property extra",
+		"schema Label does not mark count required",
+		"schema Video is missing",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not report %q:\n%v", want, err)
+		}
+	}
+}
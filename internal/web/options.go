@@ -0,0 +1,121 @@
+package web
+
+import "time"
+
+// defaultContentLogSample keeps segment fetches, the bulk of all requests,
+// from drowning out everything else in the access log.
+const defaultContentLogSample = 100
+
+// ServerOption configures optional behaviour of the web server.
+type ServerOption func(*server)
+
+// WithPlaybackKey sets the HMAC key for playback tokens. Servers sharing a
+// metadata store should share the key so tokens work on any of them.
+func WithPlaybackKey(key []byte) ServerOption {
+	return func(s *server) {
+		s.playback = newPlaybackSigner(key, s.playback.ttl)
+	}
+}
+
+// WithPlaybackTokenTTL sets how long playback tokens stay valid.
+func WithPlaybackTokenTTL(ttl time.Duration) ServerOption {
+	return func(s *server) {
+		s.playback = newPlaybackSigner(s.playback.key, ttl)
+	}
+}
+
+// WithAuditLog records privileged HTTP actions in audit. Without it they
+// are only written to the process log.
+func WithAuditLog(audit AuditLog) ServerOption {
+	return func(s *server) {
+		s.auditLog = audit
+	}
+}
+
+// WithContentLogSample logs only one in every n successful content
+// requests; n <= 1 logs all of them. Failed requests are always logged.
+func WithContentLogSample(n uint64) ServerOption {
+	return func(s *server) {
+		s.contentLogSample = n
+	}
+}
+
+// WithMaxUploadSize rejects uploads larger than n bytes with 413. n <= 0
+// allows any size.
+func WithMaxUploadSize(n int64) ServerOption {
+	return func(s *server) {
+		s.SetMaxUploadSize(n)
+	}
+}
+
+// SetMaxUploadSize changes the upload limit of a running server, see
+// WithMaxUploadSize.
+func (s *server) SetMaxUploadSize(n int64) {
+	s.maxUploadSize.Store(n)
+}
+
+// WithCORSPolicy sets which browser origins may call the API. Without it
+// DefaultCORSPolicy applies.
+func WithCORSPolicy(policy CORSPolicy) ServerOption {
+	return func(s *server) {
+		s.SetCORSPolicy(policy)
+	}
+}
+
+// SetCORSPolicy changes the CORS policy of a running server.
+func (s *server) SetCORSPolicy(policy CORSPolicy) {
+	s.corsPolicy.Store(&policy)
+}
+
+// WithRateLimits sets the request budgets of each client. Without it
+// DefaultRateLimits apply.
+func WithRateLimits(limits RateLimits) ServerOption {
+	return func(s *server) {
+		s.SetRateLimits(limits)
+	}
+}
+
+// SetRateLimits changes the request budgets of a running server. Clients
+// keep their current buckets, capped at the new bursts.
+func (s *server) SetRateLimits(limits RateLimits) {
+	s.rateLimits.Store(&limits)
+}
+
+// WithUserQuota rejects uploads that would take the files stored for a
+// user's videos past n bytes. n <= 0 allows any amount.
+func WithUserQuota(n int64) ServerOption {
+	return func(s *server) {
+		s.SetUserQuota(n)
+	}
+}
+
+// SetUserQuota changes the per-user storage quota of a running server.
+func (s *server) SetUserQuota(n int64) {
+	s.userQuota.Store(n)
+}
+
+// WithDirectContent redirects requests for segments and thumbnails to the
+// storage nodes holding them, see DirectContent.
+func WithDirectContent(direct DirectContent) ServerOption {
+	return func(s *server) {
+		s.direct = &direct
+	}
+}
+
+// WithManifestBaseURLs makes manifests send players to the given origins
+// for segments, e.g. CDN hosts, in order of preference. Each is the prefix
+// that content URLs continue with "<videoId>/<filename>" on, such as
+// "https://cdn.example.com/api/v1/content".
+func WithManifestBaseURLs(urls []string) ServerOption {
+	return func(s *server) {
+		s.manifestBaseURLs = urls
+	}
+}
+
+// WithLive enables live streaming. Streams store their segments as files,
+// so the content service must implement FileWriter.
+func WithLive(config LiveConfig) ServerOption {
+	return func(s *server) {
+		s.live = newLiveStreams(config)
+	}
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"tritontube/internal/manifest"
+)
+
+const defaultPlaybackTokenTTL = 6 * time.Hour
+
+// playbackSigner issues and checks the expiring tokens that grant access to
+// the content of unlisted and private videos. A token is
+// "<unix expiry>.<base64url HMAC-SHA256(videoId|expiry)>".
+type playbackSigner struct {
+	key []byte
+	ttl time.Duration
+}
+
+// newPlaybackSigner returns a signer using key, or a random key if key is
+// empty (tokens then stop working when the process restarts).
+func newPlaybackSigner(key []byte, ttl time.Duration) *playbackSigner {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(err)
+		}
+	}
+	if ttl <= 0 {
+		ttl = defaultPlaybackTokenTTL
+	}
+	return &playbackSigner{key: key, ttl: ttl}
+}
+
+func (p *playbackSigner) mac(videoId string, expiry int64) []byte {
+	h := hmac.New(sha256.New, p.key)
+	h.Write([]byte(videoId))
+	h.Write([]byte{'|'})
+	h.Write([]byte(strconv.FormatInt(expiry, 10)))
+	return h.Sum(nil)
+}
+
+// Sign returns a token for videoId valid for the signer's TTL from now.
+func (p *playbackSigner) Sign(videoId string, now time.Time) string {
+	expiry := now.Add(p.ttl).Unix()
+	return strconv.FormatInt(expiry, 10) + "." + base64.RawURLEncoding.EncodeToString(p.mac(videoId, expiry))
+}
+
+// Verify reports whether token was issued for videoId and has not expired.
+func (p *playbackSigner) Verify(videoId, token string, now time.Time) bool {
+	expiryPart, macPart, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(expiryPart, 10, 64)
+	if err != nil || now.Unix() > expiry {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(macPart)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, p.mac(videoId, expiry))
+}
+
+// rewriteManifest points the segment URLs of a manifest at the configured
+// origins and, for videos that are not public, adds the playback token to
+// them. DASH manifests and HLS master playlists also list the video's
+// subtitles.
+func (s *server) rewriteManifest(video *VideoMetadata, filename string, data []byte, token string) ([]byte, error) {
+	var opts manifest.Options
+	for _, base := range s.manifestBaseURLs {
+		opts.BaseURLs = append(opts.BaseURLs, strings.TrimRight(base, "/")+"/"+url.PathEscape(video.Id)+"/")
+	}
+	if video.Visibility != VisibilityPublic {
+		opts.Query = url.Values{"token": {token}}
+	}
+	if ext := path.Ext(filename); ext == ".mpd" || ext == ".m3u8" {
+		files, err := s.metadataService.Files(video.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file manifest: %w", err)
+		}
+		for _, language := range subtitleLanguages(files) {
+			opts.Subtitles = append(opts.Subtitles, manifest.Subtitle{
+				Language:    language,
+				URI:         subtitleFile(language),
+				PlaylistURI: subtitlePlaylist(language),
+			})
+		}
+	}
+	return manifest.Rewrite(filename, data, opts)
+}
+
+// canView reports whether user may play video.
+func canView(user *User, video *VideoMetadata) bool {
+	return video.Visibility != VisibilityPrivate || canModify(user, video.OwnerId)
+}
+
+func (v Visibility) valid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityUnlisted, VisibilityPrivate:
+		return true
+	}
+	return false
+}
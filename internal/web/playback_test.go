@@ -0,0 +1,174 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"tritontube/internal/security"
+)
+
+const testMPD = `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" mediaPresentationDuration="PT2.0S" type="static">
+  <Period>
+    <AdaptationSet id="0">
+      <Representation id="0" bandwidth="1000">
+        <SegmentTemplate initialization="init-$RepresentationID$.m4s" media="chunk-$RepresentationID$-$Number%05d$.m4s" startNumber="1"/>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`
+
+func TestPlaybackSigner(t *testing.T) {
+	now := time.Now()
+	signer := newPlaybackSigner([]byte("key"), time.Minute)
+	token := signer.Sign("video", now)
+
+	if !signer.Verify("video", token, now) {
+		t.Errorf("fresh token rejected")
+	}
+	if signer.Verify("other", token, now) {
+		t.Errorf("token accepted for another video")
+	}
+	if signer.Verify("video", token, now.Add(2*time.Minute)) {
+		t.Errorf("expired token accepted")
+	}
+	if newPlaybackSigner([]byte("other key"), time.Minute).Verify("video", token, now) {
+		t.Errorf("token accepted under another key")
+	}
+	expiry, mac, _ := strings.Cut(token, ".")
+	if signer.Verify("video", expiry+"0."+mac, now) {
+		t.Errorf("token with an extended expiry accepted")
+	}
+}
+
+// storeVideo records a video owned by ownerId and stores its manifest.
+func storeVideo(t *testing.T, s *server, id, ownerId string, visibility Visibility) {
+	t.Helper()
+	video := &VideoMetadata{Id: id, UploadedAt: time.Now(), OwnerId: ownerId, Visibility: visibility}
+	if err := s.metadataService.Create(video); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.contentService.(FileWriter).WriteFile(context.Background(), id, "manifest.mpd", []byte(testMPD)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContentOfPrivateVideosNeedsToken(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	owner := signIn(t, s, "owner", security.RoleViewer)
+	stranger := signIn(t, s, "stranger", security.RoleViewer)
+	storeVideo(t, s, "secret", userOf(t, s, owner).Id, VisibilityPrivate)
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		return doJSON(t, handler, "GET", path, token, nil, nil)
+	}
+	if w := get("/api/v1/content/secret/manifest.mpd", ""); w.Code != http.StatusForbidden {
+		t.Errorf("anonymous: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := get("/api/v1/content/secret/manifest.mpd?token=1.AAAA", stranger); w.Code != http.StatusForbidden {
+		t.Errorf("forged token: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := get("/api/v1/videos/secret", stranger); w.Code != http.StatusNotFound {
+		t.Errorf("stranger reading metadata: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	var video VideoAPIResponse
+	doJSON(t, handler, "GET", "/api/v1/videos/secret", owner, nil, &video)
+	if video.PlaybackToken == "" {
+		t.Fatalf("owner got no playback token")
+	}
+	w := get("/api/v1/content/secret/manifest.mpd?token="+video.PlaybackToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("with token: status = %d, want %d", w.Code, http.StatusOK)
+	}
+	// Players fetch segments relative to the manifest, so they must carry
+	// the token too.
+	if !strings.Contains(w.Body.String(), "token="+video.PlaybackToken) {
+		t.Errorf("segment URLs do not carry the token:\n%s", w.Body)
+	}
+}
+
+func TestUnlistedVideosAreHiddenFromListings(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	storeVideo(t, s, "listed", "", VisibilityPublic)
+	storeVideo(t, s, "unlisted", "", VisibilityUnlisted)
+
+	var page []VideoAPIResponse
+	doJSON(t, handler, "GET", "/api/v1/videos", "", nil, &page)
+	if len(page) != 1 || page[0].Id != "listed" {
+		t.Errorf("listing = %+v, want only the public video", page)
+	}
+
+	var video VideoAPIResponse
+	if w := doJSON(t, handler, "GET", "/api/v1/videos/unlisted", "", nil, &video); w.Code != http.StatusOK {
+		t.Fatalf("unlisted video by link: status = %d", w.Code)
+	}
+	if w := doJSON(t, handler, "GET", "/api/v1/content/unlisted/manifest.mpd?token="+video.PlaybackToken, "", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("unlisted content with token: status = %d", w.Code)
+	}
+}
+
+// The HLS playlists ffmpeg writes next to testMPD.
+const (
+	testHLSMaster = `#EXTM3U
+#EXT-X-VERSION:7
+
+#EXT-X-STREAM-INF:BANDWIDTH=1000,RESOLUTION=1280x720,CODECS="avc1.64001f"
+media_0.m3u8
+
+`
+	testHLSMedia = `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:1
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-MAP:URI="init-0.m4s"
+#EXTINF:2.000000,
+chunk-0-00001.m4s
+#EXT-X-ENDLIST
+`
+)
+
+// storeHLS stores the HLS playlists of a video stored by storeVideo.
+func storeHLS(t *testing.T, s *server, id string) {
+	t.Helper()
+	writer := s.contentService.(FileWriter)
+	for name, data := range map[string]string{"master.m3u8": testHLSMaster, "media_0.m3u8": testHLSMedia} {
+		if err := writer.WriteFile(context.Background(), id, name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHLSPlaylistsOfPrivateVideos(t *testing.T) {
+	s, handler := newSQLiteServer(t, WithManifestBaseURLs([]string{"https://cdn.example.com/api/v1/content"}))
+	owner := signIn(t, s, "owner", security.RoleViewer)
+	storeVideo(t, s, "secret", userOf(t, s, owner).Id, VisibilityPrivate)
+	storeHLS(t, s, "secret")
+
+	var video VideoAPIResponse
+	doJSON(t, handler, "GET", "/api/v1/videos/secret", owner, nil, &video)
+	query := "?token=" + video.PlaybackToken
+
+	w := doJSON(t, handler, "GET", "/api/v1/content/secret/master.m3u8"+query, "", nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/vnd.apple.mpegurl" {
+		t.Fatalf("master playlist: %d, %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if want := "\nhttps://cdn.example.com/api/v1/content/secret/media_0.m3u8" + query + "\n"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("master playlist does not point at the media playlist on the CDN:\n%s", w.Body)
+	}
+
+	w = doJSON(t, handler, "GET", "/api/v1/content/secret/media_0.m3u8"+query, "", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("media playlist: %d", w.Code)
+	}
+	for _, want := range []string{`#EXT-X-MAP:URI="init-0.m4s` + query + `"`, "\nchunk-0-00001.m4s" + query + "\n"} {
+		if !strings.Contains(w.Body.String(), want) {
+			t.Errorf("media playlist lacks %q:\n%s", want, w.Body)
+		}
+	}
+}
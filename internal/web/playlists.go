@@ -0,0 +1,308 @@
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type PlaylistAPIResponse struct {
+	Id          string   `json:"id"`
+	OwnerId     string   `json:"ownerId,omitempty"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	VideoIds    []string `json:"videoIds"`
+	CreatedAt   string   `json:"createdAt"`
+}
+
+func newPlaylistAPIResponse(playlist Playlist) PlaylistAPIResponse {
+	videoIds := playlist.VideoIds
+	if videoIds == nil {
+		videoIds = []string{}
+	}
+	return PlaylistAPIResponse{
+		Id:          playlist.Id,
+		OwnerId:     playlist.OwnerId,
+		Name:        playlist.Name,
+		Description: playlist.Description,
+		VideoIds:    videoIds,
+		CreatedAt:   playlist.CreatedAt.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// PlaylistRequest is the body of playlist create and update requests. On
+// update, omitted fields are left unchanged and videoIds replaces the order.
+type PlaylistRequest struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	VideoIds    []string `json:"videoIds"`
+}
+
+// PlaylistVideoRequest is the body of POST /api/v1/playlists/{playlistId}/videos.
+type PlaylistVideoRequest struct {
+	VideoId string `json:"videoId"`
+}
+
+func newRandomID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// applyPlaylistRequest copies req onto playlist after checking every video exists.
+func (s *server) applyPlaylistRequest(req *PlaylistRequest, playlist *Playlist) error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return errors.New("name must not be empty")
+		}
+		playlist.Name = name
+	}
+	if req.Description != nil {
+		playlist.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.VideoIds != nil {
+		if err := s.checkVideosExist(req.VideoIds); err != nil {
+			return err
+		}
+		playlist.VideoIds = req.VideoIds
+	}
+	return nil
+}
+
+func (s *server) checkVideosExist(videoIds []string) error {
+	for _, videoId := range videoIds {
+		video, err := s.metadataService.Read(videoId)
+		if err != nil {
+			return fmt.Errorf("error checking video %s: %w", videoId, err)
+		}
+		if video == nil {
+			return fmt.Errorf("video %s not found", videoId)
+		}
+	}
+	return nil
+}
+
+// API endpoint: GET /api/v1/tags - List tags with video counts
+func (s *server) handleListTags(w http.ResponseWriter, r *http.Request) {
+	s.handleLabels(w, r, s.metadataService.Tags)
+}
+
+// API endpoint: GET /api/v1/categories - List categories with video counts
+func (s *server) handleListCategories(w http.ResponseWriter, r *http.Request) {
+	s.handleLabels(w, r, s.metadataService.Categories)
+}
+
+func (s *server) handleLabels(w http.ResponseWriter, r *http.Request, list func() ([]LabelCount, error)) {
+	labels, err := list()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching labels")
+		slog.ErrorContext(r.Context(), "Metadata service error", "err", err)
+		return
+	}
+
+	labelResponses := []LabelAPIResponse{}
+	for _, label := range labels {
+		labelResponses = append(labelResponses, LabelAPIResponse{Name: label.Name, Count: label.Count})
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    labelResponses,
+	})
+}
+
+// API endpoint: GET /api/v1/playlists - List playlists
+func (s *server) handleListPlaylists(w http.ResponseWriter, r *http.Request) {
+	playlists, err := s.playlistService.ListPlaylists()
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching playlists")
+		slog.ErrorContext(r.Context(), "Playlist service error", "err", err)
+		return
+	}
+
+	playlistResponses := []PlaylistAPIResponse{}
+	for _, playlist := range playlists {
+		playlistResponses = append(playlistResponses, newPlaylistAPIResponse(playlist))
+	}
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    playlistResponses,
+	})
+}
+
+// API endpoint: POST /api/v1/playlists - Create a playlist
+func (s *server) handleCreatePlaylist(w http.ResponseWriter, r *http.Request) {
+	user := requireUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req PlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Name == nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Playlist name is required")
+		return
+	}
+
+	playlist := &Playlist{
+		Id:        newRandomID(),
+		OwnerId:   user.Id,
+		CreatedAt: time.Now(),
+	}
+	if err := s.applyPlaylistRequest(&req, playlist); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.playlistService.CreatePlaylist(playlist); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error creating playlist")
+		slog.ErrorContext(r.Context(), "Error creating playlist", "err", err)
+		return
+	}
+	sendJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Data:    newPlaylistAPIResponse(*playlist),
+	})
+}
+
+// readPlaylist loads the playlist named in the path, replying 404 if there
+// is none. With modify set, the caller must also be allowed to change it.
+func (s *server) readPlaylist(w http.ResponseWriter, r *http.Request, modify bool) *Playlist {
+	playlist, err := s.playlistService.ReadPlaylist(r.PathValue("playlistId"))
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching playlist")
+		slog.ErrorContext(r.Context(), "Playlist service error", "err", err)
+		return nil
+	}
+	if playlist == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Playlist not found")
+		return nil
+	}
+
+	if modify {
+		user := requireUser(w, r)
+		if user == nil {
+			return nil
+		}
+		if !canModify(user, playlist.OwnerId) {
+			sendErrorResponse(w, http.StatusForbidden, "Only the owner or an admin can change this playlist")
+			return nil
+		}
+	}
+	return playlist
+}
+
+// updatePlaylist stores playlist and replies with it.
+func (s *server) updatePlaylist(w http.ResponseWriter, r *http.Request, playlist *Playlist) {
+	if err := s.playlistService.UpdatePlaylist(playlist); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error updating playlist")
+		slog.ErrorContext(r.Context(), "Error updating playlist", "err", err)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    newPlaylistAPIResponse(*playlist),
+	})
+}
+
+// API endpoint: GET /api/v1/playlists/{playlistId} - Get a playlist
+func (s *server) handleGetPlaylist(w http.ResponseWriter, r *http.Request) {
+	playlist := s.readPlaylist(w, r, false)
+	if playlist == nil {
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    newPlaylistAPIResponse(*playlist),
+	})
+}
+
+// API endpoint: PUT /api/v1/playlists/{playlistId} - Update a playlist
+func (s *server) handleUpdatePlaylist(w http.ResponseWriter, r *http.Request) {
+	playlist := s.readPlaylist(w, r, true)
+	if playlist == nil {
+		return
+	}
+
+	var req PlaylistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if err := s.applyPlaylistRequest(&req, playlist); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.updatePlaylist(w, r, playlist)
+}
+
+// API endpoint: DELETE /api/v1/playlists/{playlistId} - Delete a playlist
+func (s *server) handleDeletePlaylist(w http.ResponseWriter, r *http.Request) {
+	playlist := s.readPlaylist(w, r, true)
+	if playlist == nil {
+		return
+	}
+
+	if err := s.playlistService.DeletePlaylist(playlist.Id); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error deleting playlist")
+		slog.ErrorContext(r.Context(), "Error deleting playlist", "err", err)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    map[string]string{"message": "Playlist deleted successfully"},
+	})
+}
+
+// API endpoint: POST /api/v1/playlists/{playlistId}/videos - Append a video
+func (s *server) handleAddPlaylistVideo(w http.ResponseWriter, r *http.Request) {
+	playlist := s.readPlaylist(w, r, true)
+	if playlist == nil {
+		return
+	}
+
+	var req PlaylistVideoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.VideoId == "" {
+		sendErrorResponse(w, http.StatusBadRequest, "Video ID is required")
+		return
+	}
+	if err := s.checkVideosExist([]string{req.VideoId}); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	playlist.VideoIds = append(playlist.VideoIds, req.VideoId)
+	s.updatePlaylist(w, r, playlist)
+}
+
+// API endpoint: DELETE /api/v1/playlists/{playlistId}/videos/{videoId} - Remove a video
+func (s *server) handleRemovePlaylistVideo(w http.ResponseWriter, r *http.Request) {
+	playlist := s.readPlaylist(w, r, true)
+	if playlist == nil {
+		return
+	}
+
+	videoId := r.PathValue("videoId")
+	var kept []string
+	for _, id := range playlist.VideoIds {
+		if id != videoId {
+			kept = append(kept, id)
+		}
+	}
+	if len(kept) == len(playlist.VideoIds) {
+		sendErrorResponse(w, http.StatusNotFound, "Video not in playlist")
+		return
+	}
+	playlist.VideoIds = kept
+	s.updatePlaylist(w, r, playlist)
+}
@@ -0,0 +1,100 @@
+package web
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+	"tritontube/internal/security"
+)
+
+func TestPlaylists(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	owner := signIn(t, s, "owner", security.RoleViewer)
+	other := signIn(t, s, "other", security.RoleViewer)
+	for _, id := range []string{"intro", "outro"} {
+		createVideo(t, s.metadataService, id)
+	}
+
+	var created PlaylistAPIResponse
+	w := doJSON(t, handler, "POST", "/api/v1/playlists", owner,
+		map[string]any{"name": " Course ", "videoIds": []string{"outro"}}, &created)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d: %s", w.Code, w.Body)
+	}
+	if created.Name != "Course" {
+		t.Errorf("name = %q, want it trimmed", created.Name)
+	}
+	path := "/api/v1/playlists/" + created.Id
+
+	if w := doJSON(t, handler, "POST", path+"/videos", owner, map[string]string{"videoId": "missing"}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("adding a missing video: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if w := doJSON(t, handler, "POST", path+"/videos", other, map[string]string{"videoId": "intro"}, nil); w.Code != http.StatusForbidden {
+		t.Errorf("adding to someone else's playlist: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := doJSON(t, handler, "POST", path+"/videos", owner, map[string]string{"videoId": "intro"}, nil); w.Code != http.StatusOK {
+		t.Fatalf("add status = %d: %s", w.Code, w.Body)
+	}
+
+	var got PlaylistAPIResponse
+	doJSON(t, handler, "GET", path, "", nil, &got)
+	if want := []string{"outro", "intro"}; !slices.Equal(got.VideoIds, want) {
+		t.Errorf("videoIds = %v, want %v", got.VideoIds, want)
+	}
+
+	if w := doJSON(t, handler, "DELETE", path+"/videos/outro", owner, nil, &got); w.Code != http.StatusOK {
+		t.Fatalf("remove status = %d: %s", w.Code, w.Body)
+	}
+	if want := []string{"intro"}; !slices.Equal(got.VideoIds, want) {
+		t.Errorf("videoIds after removal = %v, want %v", got.VideoIds, want)
+	}
+
+	if w := doJSON(t, handler, "DELETE", path, owner, nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("delete status = %d: %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, handler, "GET", path, "", nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("deleted playlist: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTagsAndCategories(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	owner := signIn(t, s, "owner", security.RoleViewer)
+	ownerId := userOf(t, s, owner).Id
+	for _, id := range []string{"a", "b"} {
+		if err := s.metadataService.Create(&VideoMetadata{Id: id, UploadedAt: time.Now(), OwnerId: ownerId}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	edits := map[string]map[string]any{
+		"a": {"tags": []string{"Go", " go ", "talks"}, "category": "education"},
+		"b": {"tags": []string{"go"}, "category": "education"},
+	}
+	for id, edit := range edits {
+		if w := doJSON(t, handler, "PATCH", "/api/v1/videos/"+id, owner, edit, nil); w.Code != http.StatusOK {
+			t.Fatalf("PATCH %s status = %d: %s", id, w.Code, w.Body)
+		}
+	}
+
+	var tags []LabelAPIResponse
+	doJSON(t, handler, "GET", "/api/v1/tags", "", nil, &tags)
+	counts := make(map[string]int)
+	for _, tag := range tags {
+		counts[tag.Name] = tag.Count
+	}
+	if counts["go"] != 2 || counts["talks"] != 1 || len(counts) != 2 {
+		t.Errorf("tags = %v, want go:2 talks:1", counts)
+	}
+
+	var page []VideoAPIResponse
+	doJSON(t, handler, "GET", "/api/v1/videos?tag=talks", "", nil, &page)
+	if len(page) != 1 || page[0].Id != "a" {
+		t.Errorf("videos tagged talks = %v, want [a]", page)
+	}
+	doJSON(t, handler, "GET", "/api/v1/videos?category=education", "", nil, &page)
+	if len(page) != 2 {
+		t.Errorf("videos in education = %d, want 2", len(page))
+	}
+}
@@ -0,0 +1,103 @@
+package web
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultQueryLimit = 20
+	maxQueryLimit     = 100
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort field")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// videoCursor is the opaque position after the last video of a page: the
+// value of the sort field and the ID, which breaks ties.
+type videoCursor struct {
+	Value string `json:"v"`
+	Id    string `json:"id"`
+}
+
+// normalized validates q and fills in defaults.
+func (q VideoQuery) normalized() (VideoQuery, error) {
+	switch q.Sort {
+	case "":
+		q.Sort = SortByUploadedAt
+	case SortByUploadedAt, SortByTitle, SortByDuration, SortByViews:
+	default:
+		return q, fmt.Errorf("%w: %q", ErrInvalidSort, q.Sort)
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultQueryLimit
+	}
+	if q.Limit > maxQueryLimit {
+		q.Limit = maxQueryLimit
+	}
+	q.Search = strings.TrimSpace(q.Search)
+	return q, nil
+}
+
+// sortValue renders the sort field of a video for use in a cursor.
+func sortValue(sort VideoSort, video VideoMetadata) string {
+	switch sort {
+	case SortByTitle:
+		return video.Title
+	case SortByDuration:
+		return strconv.FormatInt(video.Duration.Milliseconds(), 10)
+	case SortByViews:
+		return strconv.FormatInt(video.Views, 10)
+	default:
+		return video.UploadedAt.Format(time.RFC3339Nano)
+	}
+}
+
+func encodeVideoCursor(sort VideoSort, video VideoMetadata) string {
+	data, _ := json.Marshal(videoCursor{Value: sortValue(sort, video), Id: video.Id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeVideoCursor(cursor string) (*videoCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c videoCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Id == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// searchTerms splits a free-text search into the words to match.
+func searchTerms(search string) []string {
+	return strings.Fields(search)
+}
+
+const maxTagLength = 64
+
+// normalizeLabels lowercases, trims and de-duplicates tags, dropping empty ones.
+func normalizeLabels(labels []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label == "" || seen[label] {
+			continue
+		}
+		if len(label) > maxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", label, maxTagLength)
+		}
+		seen[label] = true
+		normalized = append(normalized, label)
+	}
+	return normalized, nil
+}
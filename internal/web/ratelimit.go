@@ -0,0 +1,225 @@
+package web
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tritontube/internal/metrics"
+)
+
+// RateLimit is a token bucket: a client may make Burst requests at once
+// and PerMinute requests a minute after that. PerMinute 0 means no limit.
+type RateLimit struct {
+	PerMinute float64
+	Burst     int
+}
+
+// RateLimits holds a budget for each class of endpoint. Every client, a
+// signed-in user or else an IP address, has its own bucket in each class.
+type RateLimits struct {
+	// Upload covers video uploads, each of which starts ffmpeg jobs.
+	Upload RateLimit
+	// Metadata covers every other API endpoint except content.
+	Metadata RateLimit
+	// Content covers manifests, segments and thumbnails. A player fetches
+	// a segment every few seconds per rendition.
+	Content RateLimit
+}
+
+var DefaultRateLimits = RateLimits{
+	Upload:   RateLimit{PerMinute: 10, Burst: 3},
+	Metadata: RateLimit{PerMinute: 600, Burst: 60},
+	Content:  RateLimit{PerMinute: 6000, Burst: 300},
+}
+
+// Validate reports the first invalid budget.
+func (l RateLimits) Validate() error {
+	for _, c := range []struct {
+		name  string
+		limit RateLimit
+	}{{"upload", l.Upload}, {"metadata", l.Metadata}, {"content", l.Content}} {
+		if c.limit.PerMinute < 0 {
+			return fmt.Errorf("%s: rate must not be negative", c.name)
+		}
+		if c.limit.PerMinute > 0 && c.limit.Burst < 1 {
+			return fmt.Errorf("%s: burst must be at least 1", c.name)
+		}
+	}
+	return nil
+}
+
+// rateClass returns the budget r is charged to and its name, or ok false
+// for requests outside the API such as health checks and metrics.
+func (s *server) rateClass(r *http.Request, limits *RateLimits) (limit RateLimit, class string, ok bool) {
+	route := s.route(r)
+	switch {
+	case r.Method == http.MethodPost && (route == apiPrefix+"/videos" || route == "/api/upload" || route == apiPrefix+"/live"):
+		return limits.Upload, "upload", true
+	case strings.HasPrefix(route, apiPrefix+"/content/") || strings.HasPrefix(route, "/api/content/"):
+		return limits.Content, "content", true
+	case strings.HasPrefix(r.URL.Path, "/api/"):
+		return limits.Metadata, "metadata", true
+	}
+	return RateLimit{}, "", false
+}
+
+// rateLimit answers 429 with Retry-After to clients that exceed the budget
+// of the endpoint they call. It runs after authenticate so that signed-in
+// requests are counted against their user rather than their IP.
+func (s *server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, class, ok := s.limitedClass(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if wait := s.limiter.take(class+" "+rateClient(r), limit, time.Now()); wait > 0 {
+			rateLimited(w, class, wait)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// limitRejected runs before authenticate and keeps a bucket per IP address
+// for requests answered 401: invalid tokens and wrong passwords. Once it is
+// empty, requests from the address are refused before their credentials
+// are checked.
+func (s *server) limitRejected(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, class, ok := s.limitedClass(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := class + " rejected " + clientIP(r)
+		if wait := s.limiter.wait(key, limit, time.Now()); wait > 0 {
+			rateLimited(w, class, wait)
+			return
+		}
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status == http.StatusUnauthorized {
+			s.limiter.take(key, limit, time.Now())
+		}
+	})
+}
+
+// limitedClass returns the budget r is charged to and its name, or ok
+// false for requests that are not limited.
+func (s *server) limitedClass(r *http.Request) (limit RateLimit, class string, ok bool) {
+	if r.Method == http.MethodOptions {
+		return RateLimit{}, "", false
+	}
+	limit, class, ok = s.rateClass(r, s.rateLimits.Load())
+	return limit, class, ok && limit.PerMinute > 0
+}
+
+func rateLimited(w http.ResponseWriter, class string, wait time.Duration) {
+	metrics.RateLimited.WithLabelValues(class).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	sendErrorResponse(w, http.StatusTooManyRequests, "Rate limit exceeded")
+}
+
+// rateClient names the client a request is counted against. Users share
+// a bucket across their sessions and API tokens.
+func rateClient(r *http.Request) string {
+	if user := currentUser(r); user != nil {
+		return "user:" + user.Id
+	}
+	return clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// full is when the bucket will have refilled to its burst.
+	full time.Time
+}
+
+// rateLimiter keeps a token bucket per key. Buckets that have refilled
+// completely are dropped, as a new bucket starts full anyway.
+type rateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// take spends a token from the bucket of key and returns 0, or returns how
+// long it is until the bucket holds a token again.
+func (l *rateLimiter) take(key string, limit RateLimit, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.refill(key, limit, now)
+	var wait time.Duration
+	if b.tokens >= 1 {
+		b.tokens--
+	} else {
+		wait = b.wait(limit)
+	}
+	b.full = now.Add(time.Duration((float64(limit.Burst) - b.tokens) / (limit.PerMinute / 60) * float64(time.Second)))
+	return wait
+}
+
+// wait returns how long it is until the bucket of key holds a token,
+// without spending one.
+func (l *rateLimiter) wait(key string, limit RateLimit, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.buckets[key]; !ok {
+		return 0
+	}
+	b := l.refill(key, limit, now)
+	if b.tokens >= 1 {
+		return 0
+	}
+	return b.wait(limit)
+}
+
+// refill returns the bucket of key, created full or topped up for the time
+// since it was last used. l.mu must be held.
+func (l *rateLimiter) refill(key string, limit RateLimit, now time.Time) *tokenBucket {
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	if now.Sub(l.lastSweep) > time.Minute {
+		for k, b := range l.buckets {
+			if now.After(b.full) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	burst := float64(limit.Burst)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.PerMinute/60)
+	b.last = now
+	return b
+}
+
+// wait returns how long it is until b holds a token.
+func (b *tokenBucket) wait(limit RateLimit) time.Duration {
+	return time.Duration((1 - b.tokens) / (limit.PerMinute / 60) * float64(time.Second))
+}
@@ -0,0 +1,142 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"tritontube/internal/security"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	var l rateLimiter
+	limit := RateLimit{PerMinute: 60, Burst: 2}
+	now := time.Now()
+	for i := range 2 {
+		if wait := l.take("a", limit, now); wait != 0 {
+			t.Fatalf("request %d of the burst waits %v", i+1, wait)
+		}
+	}
+	if wait := l.take("a", limit, now); wait != time.Second {
+		t.Errorf("request past the burst waits %v, want 1s", wait)
+	}
+	if wait := l.take("b", limit, now); wait != 0 {
+		t.Errorf("another key waits %v", wait)
+	}
+	if wait := l.take("a", limit, now.Add(time.Second)); wait != 0 {
+		t.Errorf("request after refilling waits %v", wait)
+	}
+}
+
+func TestRateLimitPerClientAndClass(t *testing.T) {
+	s, handler := newSQLiteServer(t, WithRateLimits(RateLimits{
+		Metadata: RateLimit{PerMinute: 1, Burst: 1},
+	}))
+	token := signIn(t, s, "alice", security.RoleViewer)
+
+	if w := doJSON(t, handler, http.MethodGet, "/api/v1/tags", "", nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("first request = %d", w.Code)
+	}
+	w := doJSON(t, handler, http.MethodGet, "/api/v1/categories", "", nil, nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("second request = %d, Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// A user has their own bucket, and content and health checks are
+	// outside the metadata budget.
+	if w := doJSON(t, handler, http.MethodGet, "/api/v1/tags", token, nil, nil); w.Code != http.StatusOK {
+		t.Errorf("request with a token = %d", w.Code)
+	}
+	if w := doJSON(t, handler, http.MethodGet, "/api/v1/content/v1/manifest.mpd", "", nil, nil); w.Code == http.StatusTooManyRequests {
+		t.Error("content request charged to the metadata budget")
+	}
+	if w := doJSON(t, handler, http.MethodGet, "/healthz", "", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("health check = %d", w.Code)
+	}
+
+	s.SetRateLimits(RateLimits{})
+	if w := doJSON(t, handler, http.MethodGet, "/api/v1/tags", "", nil, nil); w.Code != http.StatusOK {
+		t.Errorf("request after lifting the limit = %d", w.Code)
+	}
+}
+
+func TestRateLimitPerUser(t *testing.T) {
+	s, handler := newSQLiteServer(t, WithRateLimits(RateLimits{
+		Metadata: RateLimit{PerMinute: 1, Burst: 1},
+	}))
+	first := signIn(t, s, "alice", security.RoleViewer)
+	second, _, err := s.issueToken(userOf(t, s, first), APIToken, "second", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := doJSON(t, handler, http.MethodGet, "/api/v1/tags", first, nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("first request = %d", w.Code)
+	}
+	if w := doJSON(t, handler, http.MethodGet, "/api/v1/tags", second, nil, nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request with another token of the user = %d", w.Code)
+	}
+	if w := doJSON(t, handler, http.MethodGet, "/api/v1/tags", signIn(t, s, "bob", security.RoleViewer), nil, nil); w.Code != http.StatusOK {
+		t.Errorf("request of another user = %d", w.Code)
+	}
+}
+
+func TestRateLimitRejectedCredentials(t *testing.T) {
+	s, handler := newSQLiteServer(t, WithRateLimits(RateLimits{
+		Metadata: RateLimit{PerMinute: 1, Burst: 2},
+	}))
+	token := signIn(t, s, "alice", security.RoleViewer)
+	get := func(token, remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/tags", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := range 2 {
+		if code := get("forged", "192.0.2.1:1234"); code != http.StatusUnauthorized {
+			t.Fatalf("invalid token %d = %d", i+1, code)
+		}
+	}
+	if code := get("forged", "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("invalid token past the budget = %d", code)
+	}
+	if code := get(token, "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("valid token from the refused address = %d", code)
+	}
+	if code := get(token, "198.51.100.1:1234"); code != http.StatusOK {
+		t.Errorf("valid token from another address = %d", code)
+	}
+}
+
+func TestUserQuota(t *testing.T) {
+	s, handler := newSQLiteServer(t, WithUserQuota(100))
+	token := signIn(t, s, "alice", security.RoleViewer)
+	owner := userOf(t, s, token).Id
+
+	upload := func(size int) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, uploadRequest(t, token, "video.mp4", bytes.Repeat([]byte{0}, size)))
+		return w.Code
+	}
+	if code := upload(101); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload past the quota = %d", code)
+	}
+
+	storeVideo(t, s, "v1", owner, VisibilityPublic)
+	if err := s.metadataService.SetFiles("v1", []VideoFile{{Filename: "manifest.mpd", Size: 100}}); err != nil {
+		t.Fatal(err)
+	}
+	if code := upload(1); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload at the quota = %d", code)
+	}
+
+	// Other users have their own quota.
+	used, err := s.metadataService.StorageUsed("someone else")
+	if err != nil || used != 0 {
+		t.Errorf("StorageUsed of another user = %d, %v", used, err)
+	}
+}
@@ -0,0 +1,163 @@
+package web
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"tritontube/internal/logging"
+	"tritontube/internal/metrics"
+	"tritontube/internal/security"
+	"tritontube/internal/tracing"
+)
+
+// apiPrefix is the root of the current API version.
+const apiPrefix = "/api/v1"
+
+// routes registers every endpoint. API endpoints live under apiPrefix; the
+// paths they had before the API was versioned stay as aliases.
+func (s *server) routes() {
+	s.handle("GET /videos", s.handleListVideos, "/api/videos")
+	s.handle("POST /videos", s.handleUploadVideo, "/api/upload")
+	s.handle("GET /videos/{videoId}", s.handleGetVideo, "/api/videos/{videoId}")
+	s.handle("PATCH /videos/{videoId}", s.privileged(security.RoleViewer, "video.update", s.handleUpdateVideo), "/api/videos/{videoId}")
+	s.handle("DELETE /videos/{videoId}", s.privileged(security.RoleViewer, "video.delete", s.handleDeleteVideo), "/api/delete/{videoId}")
+	s.handle("GET /content/{videoId}/{filename}", s.handleVideoContent, "/api/content/{videoId}/{filename}")
+	s.handle("GET /videos/{videoId}/subtitles", s.handleListSubtitles)
+	s.handle("PUT /videos/{videoId}/subtitles/{language}", s.privileged(security.RoleViewer, "subtitles.update", s.handlePutSubtitles))
+	s.handle("DELETE /videos/{videoId}/subtitles/{language}", s.privileged(security.RoleViewer, "subtitles.delete", s.handleDeleteSubtitles))
+
+	s.handle("POST /live", s.handleStartLive)
+	s.handle("GET /live/{videoId}", s.handleGetLive)
+	s.handle("DELETE /live/{videoId}", s.privileged(security.RoleViewer, "live.stop", s.handleStopLive))
+
+	s.handle("GET /tags", s.handleListTags, "/api/tags")
+	s.handle("GET /categories", s.handleListCategories, "/api/categories")
+
+	s.handle("GET /playlists", s.handleListPlaylists, "/api/playlists")
+	s.handle("POST /playlists", s.handleCreatePlaylist, "/api/playlists")
+	s.handle("GET /playlists/{playlistId}", s.handleGetPlaylist, "/api/playlists/{playlistId}")
+	s.handle("PUT /playlists/{playlistId}", s.privileged(security.RoleViewer, "playlist.modify", s.handleUpdatePlaylist), "/api/playlists/{playlistId}")
+	s.handle("DELETE /playlists/{playlistId}", s.privileged(security.RoleViewer, "playlist.modify", s.handleDeletePlaylist), "/api/playlists/{playlistId}")
+	s.handle("POST /playlists/{playlistId}/videos", s.privileged(security.RoleViewer, "playlist.modify", s.handleAddPlaylistVideo), "/api/playlists/{playlistId}/videos")
+	s.handle("DELETE /playlists/{playlistId}/videos/{videoId}", s.privileged(security.RoleViewer, "playlist.modify", s.handleRemovePlaylistVideo), "/api/playlists/{playlistId}/videos/{videoId}")
+
+	s.handle("POST /auth/register", s.handleRegister, "/api/auth/register")
+	s.handle("POST /auth/login", s.handleLogin, "/api/auth/login")
+	s.handle("POST /auth/logout", s.handleLogout, "/api/auth/logout")
+	s.handle("GET /auth/me", s.handleMe, "/api/auth/me")
+	s.handle("GET /auth/tokens", s.handleListTokens, "/api/auth/tokens")
+	s.handle("POST /auth/tokens", s.handleCreateToken, "/api/auth/tokens")
+	s.handle("DELETE /auth/tokens/{tokenId}", s.handleDeleteToken, "/api/auth/tokens/{tokenId}")
+
+	s.handle("GET /admin/audit", s.handleListAudit, "/api/admin/audit")
+	s.handle("PUT /admin/users/{username}/role", s.privileged(security.RoleAdmin, "user.role", s.handleSetRole), "/api/admin/users/{username}/role")
+
+	s.mux.HandleFunc("GET "+openAPIPath, handleOpenAPI)
+	s.apiRoutes = append(s.apiRoutes, "GET "+openAPIPath)
+
+	s.mux.Handle("GET /metrics", metrics.Handler())
+	s.mux.HandleFunc("GET /healthz", s.handleHealthz)
+	s.mux.HandleFunc("GET /readyz", s.handleReadyz)
+}
+
+// handle registers handler for pattern, a method and a path relative to
+// apiPrefix, and for the same method at each legacy path.
+func (s *server) handle(pattern string, handler http.HandlerFunc, legacy ...string) {
+	method, path, _ := strings.Cut(pattern, " ")
+	s.mux.HandleFunc(method+" "+apiPrefix+path, handler)
+	s.apiRoutes = append(s.apiRoutes, method+" "+apiPrefix+path)
+	for _, alias := range legacy {
+		s.mux.HandleFunc(method+" "+alias, handler)
+	}
+}
+
+// handler returns the full middleware chain in front of the mux.
+func (s *server) handler() http.Handler {
+	sampler := &logging.Sampler{Prefixes: []string{apiPrefix + "/content/", "/api/content/"}, Every: s.contentLogSample}
+	return chain(http.HandlerFunc(s.serveMux),
+		func(next http.Handler) http.Handler { return logging.HTTPMiddleware(sampler, next) },
+		func(next http.Handler) http.Handler { return tracing.HTTPMiddleware(s.route, next) },
+		func(next http.Handler) http.Handler { return metrics.HTTPMiddleware(s.route, next) },
+		s.cors,
+		recoverPanics,
+		s.limitRejected,
+		s.authenticate,
+		s.rateLimit,
+	)
+}
+
+type middleware func(http.Handler) http.Handler
+
+// chain wraps h in middlewares, the first one outermost.
+func chain(h http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+// serveMux serves r from the mux. Requests that match no route get the
+// same JSON error envelope as every handler failure, rather than the mux's
+// plain text.
+func (s *server) serveMux(w http.ResponseWriter, r *http.Request) {
+	h, pattern := s.mux.Handler(r)
+	if pattern != "" {
+		s.mux.ServeHTTP(w, r)
+		return
+	}
+
+	// The mux answers 405 with an Allow header when the path matches a
+	// route of another method, and 404 otherwise.
+	probe := &headerRecorder{header: http.Header{}}
+	h.ServeHTTP(probe, r)
+	if probe.status == http.StatusMethodNotAllowed {
+		w.Header().Set("Allow", probe.header.Get("Allow"))
+		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	sendErrorResponse(w, http.StatusNotFound, "Endpoint not found")
+}
+
+// headerRecorder keeps the headers and status of a response and discards
+// its body.
+type headerRecorder struct {
+	header http.Header
+	status int
+}
+
+func (r *headerRecorder) Header() http.Header         { return r.header }
+func (r *headerRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (r *headerRecorder) WriteHeader(status int)      { r.status = status }
+
+// route names requests by the path of the mux pattern that serves them,
+// for metrics and span names.
+func (s *server) route(r *http.Request) string {
+	_, pattern := s.mux.Handler(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
+
+// recoverPanics turns a panicking handler into a 500 response instead of
+// a dropped connection.
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			slog.ErrorContext(r.Context(), "Handler panicked", "panic", v, "stack", string(debug.Stack()))
+			sendErrorResponse(w, http.StatusInternalServerError, "Internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUnmatchedRequestsGetErrorEnvelope(t *testing.T) {
+	_, handler := newSQLiteServer(t)
+	tests := []struct {
+		method, path string
+		code         int
+		allow        string
+	}{
+		{http.MethodGet, "/api/v1/nothing", http.StatusNotFound, ""},
+		{http.MethodPut, "/api/v1/tags", http.StatusMethodNotAllowed, "GET, HEAD"},
+		{http.MethodPost, "/api/v1/videos/abc", http.StatusMethodNotAllowed, "DELETE, GET, HEAD, PATCH"},
+	}
+	for _, test := range tests {
+		w := doJSON(t, handler, test.method, test.path, "", nil, nil)
+		if w.Code != test.code || w.Header().Get("Allow") != test.allow {
+			t.Errorf("%s %s = %d, Allow %q, want %d, %q", test.method, test.path, w.Code, w.Header().Get("Allow"), test.code, test.allow)
+		}
+		var resp APIResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Success || resp.Error == "" {
+			t.Errorf("%s %s body = %q", test.method, test.path, w.Body)
+		}
+	}
+}
+
+func TestLegacyPathsServeTheSameHandlers(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	storeVideo(t, s, "v1", "", VisibilityPublic)
+	for _, path := range []string{"/api/v1/videos/v1", "/api/videos/v1"} {
+		var video VideoAPIResponse
+		if w := doJSON(t, handler, http.MethodGet, path, "", nil, &video); w.Code != http.StatusOK || video.Id != "v1" {
+			t.Errorf("GET %s = %d, %+v", path, w.Code, video)
+		}
+	}
+	if w := doJSON(t, handler, http.MethodGet, "/api/delete/v1", "", nil, nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET of a legacy DELETE path = %d", w.Code)
+	}
+}
+
+func TestRouteNamesRequestsByPattern(t *testing.T) {
+	s, _ := newSQLiteServer(t)
+	for path, want := range map[string]string{
+		"/api/v1/content/v1/manifest.mpd": "/api/v1/content/{videoId}/{filename}",
+		"/api/content/v1/manifest.mpd":    "/api/content/{videoId}/{filename}",
+		"/api/v1/nothing":                 "unmatched",
+	} {
+		if got := s.route(httptest.NewRequest(http.MethodGet, path, nil)); got != want {
+			t.Errorf("route(%s) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	handler := recoverPanics(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("boom") }))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d", w.Code)
+	}
+}
@@ -3,15 +3,23 @@
 package web
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
+	"tritontube/internal/manifest"
+	"tritontube/internal/metrics"
+	"tritontube/internal/security"
 )
 
 type server struct {
@@ -20,52 +28,179 @@ type server struct {
 
 	metadataService VideoMetadataService
 	contentService  VideoContentService
-
-	mux *http.ServeMux
+	playlistService PlaylistService
+	userService     UserService
+
+	playback *playbackSigner
+	auditLog AuditLog
+
+	// contentLogSample is N in "log one in N successful content requests".
+	contentLogSample uint64
+	maxUploadSize    atomic.Int64
+	corsPolicy       atomic.Pointer[CORSPolicy]
+	rateLimits       atomic.Pointer[RateLimits]
+	limiter          rateLimiter
+	userQuota        atomic.Int64
+	direct           *DirectContent
+	manifestBaseURLs []string
+	live             *liveStreams // nil unless live streaming is enabled
+
+	mux        *http.ServeMux
+	apiRoutes  []string // patterns of documented routes, checked by the tests
+	httpServer *http.Server
+	draining   atomic.Bool
 }
 
 func NewServer(
 	metadataService VideoMetadataService,
 	contentService VideoContentService,
+	playlistService PlaylistService,
+	userService UserService,
+	opts ...ServerOption,
 ) *server {
-	return &server{
-		metadataService: metadataService,
-		contentService:  contentService,
-	}
+	s := &server{
+		metadataService:  metadataService,
+		contentService:   contentService,
+		playlistService:  playlistService,
+		userService:      userService,
+		playback:         newPlaybackSigner(nil, defaultPlaybackTokenTTL),
+		contentLogSample: defaultContentLogSample,
+		httpServer:       &http.Server{},
+	}
+	s.SetCORSPolicy(DefaultCORSPolicy)
+	s.SetRateLimits(DefaultRateLimits)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 func (s *server) Start(lis net.Listener) error {
 	s.mux = http.NewServeMux()
-
-	// API endpoints for Next.js
-	s.mux.HandleFunc("/api/videos", s.handleAPIVideos)
-	s.mux.HandleFunc("/api/videos/", s.handleAPIVideo)
-	s.mux.HandleFunc("/api/upload", s.handleAPIUpload)
-	s.mux.HandleFunc("/api/delete/", s.handleAPIDelete)
-	s.mux.HandleFunc("/api/content/", s.handleAPIVideoContent)
-
-	// CORS middleware for all API routes
-	s.mux.HandleFunc("/", s.handleCORS)
-
-	return http.Serve(lis, s.mux)
+	s.routes()
+	s.httpServer.Handler = s.handler()
+	return s.httpServer.Serve(lis)
 }
 
 // API Response structures
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success    bool        `json:"success"`
+	Data       interface{} `json:"data,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	NextCursor string      `json:"nextCursor,omitempty"`
 }
 
 type VideoAPIResponse struct {
-	Id         string `json:"id"`
-	UploadedAt string `json:"uploadedAt"`
+	Id          string   `json:"id"`
+	UploadedAt  string   `json:"uploadedAt"`
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	Duration    float64  `json:"duration"` // seconds
+	Views       int64    `json:"views"`
+	Category    string   `json:"category,omitempty"`
+	Tags        []string `json:"tags"`
+	OwnerId     string   `json:"ownerId,omitempty"`
+	Visibility  string   `json:"visibility"`
+	// PlaybackToken must be passed as ?token= on content requests for
+	// videos that are not public.
+	PlaybackToken string `json:"playbackToken,omitempty"`
+	// Live is set while the video is a live stream.
+	Live bool `json:"live,omitempty"`
+	// Poster is the URL of the poster frame. Thumbnails is the URL of the
+	// WebVTT track of scrub preview thumbnails; only the single video
+	// endpoint sets it, for videos that have one.
+	Poster     string `json:"poster"`
+	Thumbnails string `json:"thumbnails,omitempty"`
+	// Subtitles are only set by the single video endpoint.
+	Subtitles []SubtitleAPIResponse `json:"subtitles,omitempty"`
+}
+
+func (s *server) newVideoAPIResponse(video VideoMetadata) VideoAPIResponse {
+	tags := video.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	resp := VideoAPIResponse{
+		Id:          video.Id,
+		UploadedAt:  video.UploadedAt.Format("2006-01-02 15:04:05"),
+		Title:       video.Title,
+		Description: video.Description,
+		Duration:    video.Duration.Seconds(),
+		Views:       video.Views,
+		Category:    video.Category,
+		Tags:        tags,
+		OwnerId:     video.OwnerId,
+		Visibility:  string(video.Visibility),
+		Live:        s.live.active(video.Id),
+	}
+	// Callers only see videos they can view, so they may play them too.
+	if video.Visibility != VisibilityPublic {
+		resp.PlaybackToken = s.playback.Sign(video.Id, time.Now())
+	}
+	resp.Poster = resp.contentURL(posterFile)
+	return resp
+}
+
+// contentURL returns the URL of a file of the video, with its playback
+// token.
+func (v VideoAPIResponse) contentURL(filename string) string {
+	u := apiPrefix + "/content/" + url.PathEscape(v.Id) + "/" + url.PathEscape(filename)
+	if v.PlaybackToken != "" {
+		u += "?" + url.Values{"token": {v.PlaybackToken}}.Encode()
+	}
+	return u
 }
 
 type UploadAPIResponse struct {
 	VideoId string `json:"videoId"`
 }
 
+// VideoUpdateRequest is the body of PATCH /api/v1/videos/{videoId}. Omitted
+// fields are left unchanged; an empty tags list clears the tags.
+type VideoUpdateRequest struct {
+	Title       *string  `json:"title"`
+	Description *string  `json:"description"`
+	Category    *string  `json:"category"`
+	Tags        []string `json:"tags"`
+	Visibility  *string  `json:"visibility"`
+}
+
+func (req *VideoUpdateRequest) apply(video *VideoMetadata) error {
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			return errors.New("title must not be empty")
+		}
+		video.Title = title
+	}
+	if req.Description != nil {
+		video.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Category != nil {
+		video.Category = strings.TrimSpace(*req.Category)
+	}
+	if req.Tags != nil {
+		tags, err := normalizeLabels(req.Tags)
+		if err != nil {
+			return err
+		}
+		video.Tags = tags
+	}
+	if req.Visibility != nil {
+		visibility := Visibility(*req.Visibility)
+		if !visibility.valid() {
+			return fmt.Errorf("invalid visibility %q", *req.Visibility)
+		}
+		video.Visibility = visibility
+	}
+	return nil
+}
+
+type LabelAPIResponse struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
 // Helper function to send JSON responses
 func sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -81,137 +216,203 @@ func sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
 	})
 }
 
-// CORS handler for all routes
-func (s *server) handleCORS(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// API endpoint: GET /api/v1/videos - List videos
+// Query parameters: q (search), tag, category, sort (uploadedAt, title,
+// duration, views), order (asc, desc), limit, cursor (nextCursor of the previous page),
+// all=true (admins only: include other users' unlisted and private videos).
+func (s *server) handleListVideos(w http.ResponseWriter, r *http.Request) {
+	query, err := parseVideoQuery(r)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if user := currentUser(r); user != nil {
+		query.ViewerId = user.Id
+		query.IncludeHidden = user.Role >= security.RoleOperator && r.URL.Query().Get("all") == "true"
+	}
 
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+	page, err := s.metadataService.Query(query)
+	if errors.Is(err, ErrInvalidCursor) || errors.Is(err, ErrInvalidSort) {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching video metadata")
+		slog.ErrorContext(r.Context(), "Metadata service error", "err", err)
 		return
 	}
 
-	// If not OPTIONS, return 404 for unknown routes
-	sendErrorResponse(w, http.StatusNotFound, "Endpoint not found")
-}
+	videoResponses := []VideoAPIResponse{}
+	for _, video := range page.Videos {
+		videoResponses = append(videoResponses, s.newVideoAPIResponse(video))
+	}
 
-// API endpoint: GET /api/videos - List all videos
-func (s *server) handleAPIVideos(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success:    true,
+		Data:       videoResponses,
+		NextCursor: page.NextCursor,
+	})
+}
 
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
+// parseVideoQuery reads listing parameters from the query string. Orderings
+// default to newest, longest and most viewed first, and to A-Z for titles.
+func parseVideoQuery(r *http.Request) (VideoQuery, error) {
+	params := r.URL.Query()
+	query := VideoQuery{
+		Search:   params.Get("q"),
+		Tag:      strings.ToLower(strings.TrimSpace(params.Get("tag"))),
+		Category: strings.TrimSpace(params.Get("category")),
+		Sort:     VideoSort(params.Get("sort")),
+		Cursor:   params.Get("cursor"),
+	}
+	if query.Sort == "" {
+		query.Sort = SortByUploadedAt
+	}
+
+	switch params.Get("order") {
+	case "":
+		query.Descending = query.Sort != SortByTitle
+	case "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		return query, fmt.Errorf("invalid order %q", params.Get("order"))
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			return query, fmt.Errorf("invalid limit %q", limit)
+		}
+		query.Limit = n
 	}
 
-	if r.Method != http.MethodGet {
-		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	return query, nil
+}
+
+// API endpoint: GET /api/v1/videos/{videoId} - Get specific video
+func (s *server) handleGetVideo(w http.ResponseWriter, r *http.Request) {
+	video, err := s.metadataService.Read(r.PathValue("videoId"))
+	if err != nil || video == nil || !canView(currentUser(r), video) {
+		sendErrorResponse(w, http.StatusNotFound, "Video not found")
 		return
 	}
 
-	videos, err := s.metadataService.List()
+	resp := s.newVideoAPIResponse(*video)
+	files, err := s.metadataService.Files(video.Id)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, "Error fetching video metadata")
-		log.Println("Metadata service error:", err)
-		return
+		slog.ErrorContext(r.Context(), "Error reading video files", "video", video.Id, "err", err)
 	}
-
-	var videoResponses []VideoAPIResponse
-	for _, video := range videos {
-		videoResponses = append(videoResponses, VideoAPIResponse{
-			Id:         video.Id,
-			UploadedAt: video.UploadedAt.Format("2006-01-02 15:04:05"),
-		})
+	for _, file := range files {
+		if file.Filename == thumbnailsTrack {
+			resp.Thumbnails = resp.contentURL(thumbnailsTrack)
+		}
+	}
+	if languages := subtitleLanguages(files); len(languages) > 0 {
+		resp.Subtitles = resp.subtitles(languages)
 	}
 
 	sendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
-		Data:    videoResponses,
+		Data:    resp,
 	})
 }
 
-// API endpoint: GET /api/videos/{videoId} - Get specific video
-func (s *server) handleAPIVideo(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+// API endpoint: PATCH /api/v1/videos/{videoId} - Update title, description, category, tags or visibility
+func (s *server) handleUpdateVideo(w http.ResponseWriter, r *http.Request) {
+	video, err := s.metadataService.Read(r.PathValue("videoId"))
+	if err != nil || video == nil || !canView(currentUser(r), video) {
+		sendErrorResponse(w, http.StatusNotFound, "Video not found")
 		return
 	}
 
-	if r.Method != http.MethodGet {
-		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	user := requireUser(w, r)
+	if user == nil {
 		return
 	}
-
-	videoId := r.URL.Path[len("/api/videos/"):]
-	if videoId == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "Video ID is required")
+	if !canModify(user, video.OwnerId) {
+		sendErrorResponse(w, http.StatusForbidden, "Only the owner or an admin can edit this video")
 		return
 	}
 
-	video, err := s.metadataService.Read(videoId)
-	if err != nil || video == nil {
-		sendErrorResponse(w, http.StatusNotFound, "Video not found")
+	var req VideoUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-
-	videoResponse := VideoAPIResponse{
-		Id:         video.Id,
-		UploadedAt: video.UploadedAt.Format("2006-01-02 15:04:05"),
+	if err := req.apply(video); err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.metadataService.Update(video); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error updating video metadata")
+		slog.ErrorContext(r.Context(), "Error updating metadata", "err", err)
+		return
 	}
 
 	sendJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
-		Data:    videoResponse,
+		Data:    s.newVideoAPIResponse(*video),
 	})
 }
 
-// API endpoint: POST /api/upload - Upload video
-func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+// API endpoint: POST /api/v1/videos - Upload video
+func (s *server) handleUploadVideo(w http.ResponseWriter, r *http.Request) {
+	user := requireUser(w, r)
+	if user == nil {
 		return
 	}
-
-	if r.Method != http.MethodPost {
-		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if !s.checkQuota(w, r, user, 0) {
 		return
 	}
 
+	if limit := s.maxUploadSize.Load(); limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
 	err := r.ParseMultipartForm(0)
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds the limit of %d bytes", tooLarge.Limit))
+			return
+		}
 		sendErrorResponse(w, http.StatusBadRequest, "Error parsing form data")
-		log.Println("Error parsing form data", err)
+		slog.ErrorContext(r.Context(), "Error parsing form data", "err", err)
 		return
 	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
 		sendErrorResponse(w, http.StatusBadRequest, "Error retrieving file")
-		log.Println("Error retrieving file", err)
+		slog.ErrorContext(r.Context(), "Error retrieving file", "err", err)
 		return
 	}
 	defer file.Close()
+	if !s.checkQuota(w, r, user, header.Size) {
+		return
+	}
+
+	tags, err := normalizeLabels(strings.Split(r.FormValue("tags"), ","))
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	visibility := VisibilityPublic
+	if v := r.FormValue("visibility"); v != "" {
+		visibility = Visibility(v)
+		if !visibility.valid() {
+			sendErrorResponse(w, http.StatusBadRequest, "Invalid visibility")
+			return
+		}
+	}
 
 	videoID := generateVideoID(header.Filename)
 
 	existing, err := s.metadataService.Read(videoID)
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, "Error checking for existing video")
-		log.Println("Error checking for existing video:", err)
+		slog.ErrorContext(r.Context(), "Error checking for existing video", "err", err)
 		return
 	}
 	if existing != nil {
@@ -222,21 +423,68 @@ func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 	filedata, err := io.ReadAll(file)
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, "Error reading file content")
-		log.Println("Error reading file content: ", err)
+		slog.ErrorContext(r.Context(), "Error reading file content", "err", err)
 		return
 	}
 
-	err = s.metadataService.Create(videoID, time.Now())
+	err = s.metadataService.Create(&VideoMetadata{
+		Id:         videoID,
+		UploadedAt: time.Now(),
+		OwnerId:    user.Id,
+		Visibility: visibility,
+	})
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, "Error in saving metadata")
-		log.Println("Error in saving metadata:", err)
+		slog.ErrorContext(r.Context(), "Error in saving metadata", "err", err)
 		return
 	}
 
-	err = s.contentService.Write(videoID, header.Filename, filedata)
+	files, err := s.contentService.Write(r.Context(), videoID, header.Filename, filedata)
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, "Error saving file to content service")
-		log.Println("Content service write error:", err)
+		slog.ErrorContext(r.Context(), "Content service write error", "err", err)
+		// A video without a file manifest would make node changes scan
+		// every node for its files.
+		s.deleteFiles(r.Context(), videoID, files)
+		if err := s.metadataService.Delete(videoID); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting metadata", "video", videoID, "err", err)
+		}
+		return
+	}
+
+	err = s.metadataService.SetFiles(videoID, files)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error in saving file manifest")
+		slog.ErrorContext(r.Context(), "Error in saving file manifest", "err", err)
+		// Nothing would know about the files otherwise.
+		s.deleteFiles(r.Context(), videoID, files)
+		if err := s.metadataService.Delete(videoID); err != nil {
+			slog.ErrorContext(r.Context(), "Error deleting metadata", "video", videoID, "err", err)
+		}
+		return
+	}
+
+	video := &VideoMetadata{
+		Id:          videoID,
+		Title:       strings.TrimSpace(r.FormValue("title")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+		Category:    strings.TrimSpace(r.FormValue("category")),
+		Tags:        tags,
+		Visibility:  visibility,
+	}
+	if video.Title == "" {
+		video.Title = videoID
+	}
+	if manifest, err := s.contentService.Read(r.Context(), videoID, "manifest.mpd"); err != nil {
+		slog.WarnContext(r.Context(), "Could not read manifest", "video", videoID, "err", err)
+	} else if video.Duration, err = mpdDuration(manifest); err != nil {
+		slog.WarnContext(r.Context(), "Could not determine duration", "video", videoID, "err", err)
+	}
+
+	err = s.metadataService.Update(video)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error in saving metadata")
+		slog.ErrorContext(r.Context(), "Error in saving metadata", "err", err)
 		return
 	}
 
@@ -248,67 +496,95 @@ func (s *server) handleAPIUpload(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// API endpoint: DELETE /api/delete/{videoId} - Delete video
-func (s *server) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
-		return
+// checkQuota replies 413 and returns false if the user is at their storage
+// quota or an upload of size bytes would take them past it. Stored videos
+// count with the size of their transcoded files, new uploads with the size
+// of the source.
+func (s *server) checkQuota(w http.ResponseWriter, r *http.Request, user *User, size int64) bool {
+	quota := s.userQuota.Load()
+	if quota <= 0 {
+		return true
 	}
-
-	if r.Method != http.MethodDelete {
-		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
-		return
+	used, err := s.metadataService.StorageUsed(user.Id)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error checking storage quota")
+		slog.ErrorContext(r.Context(), "Error checking storage quota", "user", user.Username, "err", err)
+		return false
 	}
-
-	videoId := r.URL.Path[len("/api/delete/"):]
-	if videoId == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "Video ID is required")
-		return
+	if used >= quota || used+size > quota {
+		metrics.QuotaRejections.Inc()
+		sendErrorResponse(w, http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Upload would exceed your storage quota (%d of %d bytes used)", used, quota))
+		return false
 	}
+	return true
+}
+
+// API endpoint: DELETE /api/v1/videos/{videoId} - Delete video
+func (s *server) handleDeleteVideo(w http.ResponseWriter, r *http.Request) {
+	videoId := r.PathValue("videoId")
 
 	// First check if video exists
 	video, err := s.metadataService.Read(videoId)
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, "Error checking video existence")
-		log.Println("Error checking video:", err)
+		slog.ErrorContext(r.Context(), "Error checking video", "err", err)
 		return
 	}
 	if video == nil {
 		sendErrorResponse(w, http.StatusNotFound, "Video not found")
 		return
 	}
+	if !canModify(currentUser(r), video.OwnerId) {
+		if currentUser(r) == nil {
+			sendErrorResponse(w, http.StatusUnauthorized, "Authentication required")
+		} else {
+			sendErrorResponse(w, http.StatusForbidden, "Only the owner or an admin can delete this video")
+		}
+		return
+	}
 
-	err = s.metadataService.Delete(videoId)
+	// A live stream deletes what it stored itself once it is wound down.
+	if done := s.live.stop(videoId, true); done != nil {
+		select {
+		case <-done:
+		case <-time.After(liveStopTimeout):
+			slog.WarnContext(r.Context(), "Live stream did not stop in time", "video", videoId)
+		}
+	}
+
+	// Resolve the files to delete before the manifest goes away with the metadata.
+	// Videos ingested before manifests were recorded fall back to a listing.
+	manifest, err := s.metadataService.Files(videoId)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, "Error deleting video metadata")
-		log.Println("Error deleting metadata:", err)
+		sendErrorResponse(w, http.StatusInternalServerError, "Error reading video file manifest")
+		slog.ErrorContext(r.Context(), "Error reading file manifest", "err", err)
 		return
 	}
+	files := videoFileNames(manifest)
+	if len(files) == 0 {
+		files, err = s.contentService.ListFiles(r.Context(), videoId)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Error listing video files")
+			slog.WarnContext(r.Context(), "Could not list files", "video", videoId, "err", err)
+			return
+		}
+	}
 
-	files, err := s.contentService.ListFiles(videoId)
+	err = s.metadataService.Delete(videoId)
 	if err != nil {
-		log.Printf("Warning: Could not list files for video %s: %v", videoId, err)
-		files = []string{"manifest.mpd", "thumbnail.jpg"}
-		files = append(files, "init-0.m4s", "init-1.m4s")
-		for stream := 0; stream <= 1; stream++ {
-			for i := 1; i <= 100; i++ {
-				files = append(files, fmt.Sprintf("chunk-%d-%05d.m4s", stream, i))
-			}
-		}
+		sendErrorResponse(w, http.StatusInternalServerError, "Error deleting video metadata")
+		slog.ErrorContext(r.Context(), "Error deleting metadata", "err", err)
+		return
 	}
 
 	// Delete each file
 	var deleteErrors []error
 	for _, filename := range files {
-		err := s.contentService.Delete(videoId, filename)
+		err := s.contentService.Delete(r.Context(), videoId, filename)
 		if err != nil {
 			if !strings.Contains(err.Error(), "no such file") {
-				log.Printf("Error deleting file %s: %v", filename, err)
+				slog.ErrorContext(r.Context(), "Error deleting file", "video", videoId, "file", filename, "err", err)
 				deleteErrors = append(deleteErrors, err)
 			}
 		}
@@ -316,7 +592,7 @@ func (s *server) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
 
 	if len(deleteErrors) > 0 {
 		sendErrorResponse(w, http.StatusInternalServerError, "Error deleting some video files")
-		log.Printf("Errors deleting files for video %s: %v", videoId, deleteErrors)
+		slog.ErrorContext(r.Context(), "Errors deleting files", "video", videoId, "errs", deleteErrors)
 		return
 	}
 
@@ -326,50 +602,89 @@ func (s *server) handleAPIDelete(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// API endpoint: GET /api/content/{videoId}/{filename} - Serve video content
-func (s *server) handleAPIVideoContent(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+// deleteFiles deletes written files that could not be recorded, logging
+// failures.
+func (s *server) deleteFiles(ctx context.Context, videoId string, files []VideoFile) {
+	for _, file := range files {
+		if err := s.contentService.Delete(ctx, videoId, file.Filename); err != nil {
+			slog.WarnContext(ctx, "Error deleting unrecorded file", "video", videoId, "file", file.Filename, "err", err)
+		}
+	}
+}
+
+// API endpoint: GET /api/v1/content/{videoId}/{filename} - Serve video content
+func (s *server) handleVideoContent(w http.ResponseWriter, r *http.Request) {
+	videoId := r.PathValue("videoId")
+	filename := r.PathValue("filename")
 
-	if r.Method == http.MethodOptions {
-		w.WriteHeader(http.StatusOK)
+	video, err := s.metadataService.Read(videoId)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error reading video metadata")
+		slog.ErrorContext(r.Context(), "Metadata service error", "err", err)
 		return
 	}
-
-	if r.Method != http.MethodGet {
-		sendErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	if video == nil {
+		sendErrorResponse(w, http.StatusNotFound, "Video not found")
 		return
 	}
 
-	// parse /api/content/<videoId>/<filename>
-	contentPath := r.URL.Path[len("/api/content/"):]
-	parts := strings.Split(contentPath, "/")
-	if len(parts) != 2 {
-		sendErrorResponse(w, http.StatusBadRequest, "Invalid content path")
+	// Content of non-public videos needs a playback token, except for callers
+	// who could obtain one anyway.
+	token := r.URL.Query().Get("token")
+	if video.Visibility != VisibilityPublic {
+		if token == "" || !s.playback.Verify(videoId, token, time.Now()) {
+			if !canModify(currentUser(r), video.OwnerId) {
+				sendErrorResponse(w, http.StatusForbidden, "Valid playback token required")
+				return
+			}
+			token = s.playback.Sign(videoId, time.Now())
+		}
+	}
+
+	if s.streamLiveSegment(w, r, videoId, filename) {
+		return
+	}
+	if s.redirectToNode(w, r, videoId, filename) {
 		return
 	}
-	videoId := parts[0]
-	filename := parts[1]
-	log.Println("Video ID:", videoId, "Filename:", filename)
 
-	content, err := s.contentService.Read(videoId, filename)
+	content, err := s.contentService.Read(r.Context(), videoId, filename)
 	if err != nil {
 		sendErrorResponse(w, http.StatusInternalServerError, "Error reading video content")
-		log.Println("Content service read error:", err)
+		slog.ErrorContext(r.Context(), "Content service read error", "err", err)
 		return
 	}
 
+	if manifest.IsManifest(filename) {
+		content, err = s.rewriteManifest(video, filename, content, token)
+		if err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Error reading video content")
+			slog.ErrorContext(r.Context(), "Failed to rewrite manifest", "file", filename, "err", err)
+			return
+		}
+	}
+
 	// Set appropriate Content-Type based on filename
 	if strings.HasSuffix(filename, ".mpd") {
 		w.Header().Set("Content-Type", "application/dash+xml")
+	} else if strings.HasSuffix(filename, ".m3u8") {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
 	} else if strings.HasSuffix(filename, ".mp4") {
 		w.Header().Set("Content-Type", "video/mp4")
 	} else if strings.HasSuffix(filename, ".jpg") {
 		w.Header().Set("Content-Type", "image/jpeg")
 	} else if strings.HasSuffix(filename, ".m4s") {
 		w.Header().Set("Content-Type", "video/mp4")
+	} else if strings.HasSuffix(filename, ".vtt") {
+		w.Header().Set("Content-Type", "text/vtt")
+	}
+
+	// Players fetch the manifest once per playback, so it doubles as the view counter.
+	// Live manifests are refetched throughout playback instead.
+	if filename == "manifest.mpd" && !s.live.active(videoId) {
+		if err := s.metadataService.AddView(videoId); err != nil {
+			slog.ErrorContext(r.Context(), "Error counting view", "err", err)
+		}
 	}
 
 	w.WriteHeader(http.StatusOK)
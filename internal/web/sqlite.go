@@ -3,8 +3,13 @@
 package web
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -12,29 +17,208 @@ import (
 
 type SQLiteVideoMetadataService struct {
 	Instance *sql.DB
+
+	schemaOnce sync.Once
+	schemaErr  error
+	fts        bool // whether the videos_fts full-text index is available
+}
+
+// addedColumns are added to tables created before they existed.
+var addedColumns = []struct{ table, name, definition string }{
+	{"videos", "title", "TEXT NOT NULL DEFAULT ''"},
+	{"videos", "description", "TEXT NOT NULL DEFAULT ''"},
+	{"videos", "duration_ms", "INTEGER NOT NULL DEFAULT 0"},
+	{"videos", "views", "INTEGER NOT NULL DEFAULT 0"},
+	{"videos", "category", "TEXT NOT NULL DEFAULT ''"},
+	{"videos", "owner_id", "TEXT NOT NULL DEFAULT ''"},
+	{"videos", "visibility", "TEXT NOT NULL DEFAULT 'public'"},
+	{"playlists", "owner_id", "TEXT NOT NULL DEFAULT ''"},
 }
 
+const videoSelect = "SELECT id, uploaded_at, title, description, duration_ms, views, category, owner_id, visibility FROM videos"
+
 func (s *SQLiteVideoMetadataService) ensureTable() error {
+	s.schemaOnce.Do(func() {
+		s.schemaErr = s.migrate()
+	})
+	return s.schemaErr
+}
+
+func (s *SQLiteVideoMetadataService) migrate() error {
 	_, err := s.Instance.Exec(`
         CREATE TABLE IF NOT EXISTS videos (
             id TEXT PRIMARY KEY,
             uploaded_at DATETIME
-        )
+        );
+        CREATE TABLE IF NOT EXISTS video_files (
+            video_id TEXT NOT NULL,
+            filename TEXT NOT NULL,
+            size INTEGER NOT NULL,
+            digest TEXT NOT NULL,
+            PRIMARY KEY (video_id, filename)
+        );
+        CREATE TABLE IF NOT EXISTS video_tags (
+            video_id TEXT NOT NULL,
+            tag TEXT NOT NULL,
+            PRIMARY KEY (video_id, tag)
+        );
+        CREATE INDEX IF NOT EXISTS video_tags_tag ON video_tags (tag);
+        CREATE TABLE IF NOT EXISTS playlists (
+            id TEXT PRIMARY KEY,
+            name TEXT NOT NULL,
+            description TEXT NOT NULL DEFAULT '',
+            created_at DATETIME,
+            owner_id TEXT NOT NULL DEFAULT ''
+        );
+        CREATE TABLE IF NOT EXISTS playlist_videos (
+            playlist_id TEXT NOT NULL,
+            position INTEGER NOT NULL,
+            video_id TEXT NOT NULL,
+            PRIMARY KEY (playlist_id, position)
+        );
+        CREATE TABLE IF NOT EXISTS users (
+            id TEXT PRIMARY KEY,
+            username TEXT NOT NULL UNIQUE COLLATE NOCASE,
+            password_hash BLOB NOT NULL,
+            role TEXT NOT NULL DEFAULT 'viewer',
+            created_at DATETIME
+        );
+        CREATE TABLE IF NOT EXISTS auth_tokens (
+            id TEXT PRIMARY KEY,
+            hash TEXT NOT NULL UNIQUE,
+            user_id TEXT NOT NULL,
+            kind TEXT NOT NULL,
+            name TEXT NOT NULL DEFAULT '',
+            created_at DATETIME,
+            expires_at DATETIME
+        );
+        CREATE TABLE IF NOT EXISTS audit_log (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            at DATETIME NOT NULL,
+            actor TEXT NOT NULL,
+            role TEXT NOT NULL,
+            action TEXT NOT NULL,
+            target TEXT NOT NULL DEFAULT '',
+            outcome TEXT NOT NULL,
+            source TEXT NOT NULL DEFAULT ''
+        );
+        CREATE INDEX IF NOT EXISTS audit_log_actor ON audit_log (actor, id);
+        CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+        BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+        CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+        BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END
     `)
-	return err
+	if err != nil {
+		return err
+	}
+
+	for _, column := range addedColumns {
+		existing, err := s.columns(column.table)
+		if err != nil {
+			return err
+		}
+		if existing[column.name] {
+			continue
+		}
+		_, err = s.Instance.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", column.table, column.name, column.definition))
+		if err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", column.table, column.name, err)
+		}
+	}
+	if _, err := s.Instance.Exec("UPDATE videos SET title = id WHERE title = ''"); err != nil {
+		return fmt.Errorf("failed to backfill titles: %w", err)
+	}
+
+	// FTS5 is only compiled in with the sqlite_fts5 build tag; without it
+	// search falls back to LIKE matching.
+	_, err = s.Instance.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(id UNINDEXED, title, description)`)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no such module") {
+			return fmt.Errorf("failed to create search index: %w", err)
+		}
+		slog.Warn("SQLite built without FTS5, video search will use LIKE matching")
+		return nil
+	}
+	s.fts = true
+
+	_, err = s.Instance.Exec(`
+        INSERT INTO videos_fts (id, title, description)
+        SELECT id, title, description FROM videos WHERE id NOT IN (SELECT id FROM videos_fts)
+    `)
+	if err != nil {
+		return fmt.Errorf("failed to backfill search index: %w", err)
+	}
+
+	return nil
+}
+
+// CheckHealth implements HealthChecker.
+func (s *SQLiteVideoMetadataService) CheckHealth(ctx context.Context) error {
+	if err := s.Instance.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to reach database: %w", err)
+	}
+	return s.ensureTable()
+}
+
+func (s *SQLiteVideoMetadataService) columns(table string) (map[string]bool, error) {
+	rows, err := s.Instance.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid        int
+			name, typ  string
+			notNull    bool
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &defaultVal, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanVideo(row rowScanner) (VideoMetadata, error) {
+	var video VideoMetadata
+	var durationMs int64
+	err := row.Scan(&video.Id, &video.UploadedAt, &video.Title, &video.Description, &durationMs, &video.Views, &video.Category, &video.OwnerId, &video.Visibility)
+	video.Duration = time.Duration(durationMs) * time.Millisecond
+	return video, err
 }
 
 // Create implements VideoMetadataService.
-func (s *SQLiteVideoMetadataService) Create(videoId string, uploadedAt time.Time) error {
+func (s *SQLiteVideoMetadataService) Create(video *VideoMetadata) error {
 	if err := s.ensureTable(); err != nil {
 		return err
 	}
 
-	_, err := s.Instance.Exec(`INSERT INTO videos (id, uploaded_at) VALUES (?, ?)`, videoId, uploadedAt)
+	visibility := video.Visibility
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
+	_, err := s.Instance.Exec(`INSERT INTO videos (id, uploaded_at, title, owner_id, visibility) VALUES (?, ?, ?, ?, ?)`,
+		video.Id, video.UploadedAt, video.Id, video.OwnerId, visibility)
 	if err != nil {
 		return err
 	}
 
+	if s.fts {
+		_, err = s.Instance.Exec(`INSERT INTO videos_fts (id, title, description) VALUES (?, ?, '')`, video.Id, video.Id)
+		if err != nil {
+			return fmt.Errorf("failed to index video: %w", err)
+		}
+	}
+
 	return nil
 }
 
@@ -44,7 +228,7 @@ func (s *SQLiteVideoMetadataService) List() ([]VideoMetadata, error) {
 		return nil, err
 	}
 
-	rows, err := s.Instance.Query("SELECT id, uploaded_at FROM videos")
+	rows, err := s.Instance.Query(videoSelect)
 	if err != nil {
 		return nil, err
 	}
@@ -52,16 +236,56 @@ func (s *SQLiteVideoMetadataService) List() ([]VideoMetadata, error) {
 
 	var videos []VideoMetadata
 	for rows.Next() {
-		var video VideoMetadata
-		if err := rows.Scan(&video.Id, &video.UploadedAt); err != nil {
+		video, err := scanVideo(rows)
+		if err != nil {
 			return nil, err
 		}
 		videos = append(videos, video)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTags(videos); err != nil {
+		return nil, err
+	}
 
 	return videos, nil
 }
 
+// loadTags fills in the tags of each video.
+func (s *SQLiteVideoMetadataService) loadTags(videos []VideoMetadata) error {
+	if len(videos) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(videos))
+	placeholders := make([]string, len(videos))
+	args := make([]any, len(videos))
+	for i, video := range videos {
+		index[video.Id] = i
+		placeholders[i] = "?"
+		args[i] = video.Id
+	}
+
+	rows, err := s.Instance.Query("SELECT video_id, tag FROM video_tags WHERE video_id IN ("+
+		strings.Join(placeholders, ", ")+") ORDER BY tag", args...)
+	if err != nil {
+		return fmt.Errorf("failed to load tags: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var videoId, tag string
+		if err := rows.Scan(&videoId, &tag); err != nil {
+			return err
+		}
+		i := index[videoId]
+		videos[i].Tags = append(videos[i].Tags, tag)
+	}
+	return rows.Err()
+}
+
 // Read implements VideoMetadataService.
 func (s *SQLiteVideoMetadataService) Read(id string) (*VideoMetadata, error) {
 
@@ -69,8 +293,7 @@ func (s *SQLiteVideoMetadataService) Read(id string) (*VideoMetadata, error) {
 		return nil, err
 	}
 
-	var video VideoMetadata
-	err := s.Instance.QueryRow("SELECT id, uploaded_at FROM videos WHERE id = ?", id).Scan(&video.Id, &video.UploadedAt)
+	video, err := scanVideo(s.Instance.QueryRow(videoSelect+" WHERE id = ?", id))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -78,7 +301,244 @@ func (s *SQLiteVideoMetadataService) Read(id string) (*VideoMetadata, error) {
 		return nil, err
 	}
 
-	return &video, nil
+	videos := []VideoMetadata{video}
+	if err := s.loadTags(videos); err != nil {
+		return nil, err
+	}
+
+	return &videos[0], nil
+}
+
+// Update implements VideoMetadataService.
+func (s *SQLiteVideoMetadataService) Update(video *VideoMetadata) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	tx, err := s.Instance.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	visibility := video.Visibility
+	if visibility == "" {
+		visibility = VisibilityPublic
+	}
+	_, err = tx.Exec(`UPDATE videos SET title = ?, description = ?, duration_ms = ?, category = ?, visibility = ? WHERE id = ?`,
+		video.Title, video.Description, video.Duration.Milliseconds(), video.Category, visibility, video.Id)
+	if err != nil {
+		return fmt.Errorf("failed to update video metadata: %w", err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM video_tags WHERE video_id = ?", video.Id); err != nil {
+		return fmt.Errorf("failed to clear tags: %w", err)
+	}
+	for _, tag := range video.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO video_tags (video_id, tag) VALUES (?, ?)", video.Id, tag); err != nil {
+			return fmt.Errorf("failed to tag video: %w", err)
+		}
+	}
+
+	if s.fts {
+		_, err = tx.Exec(`UPDATE videos_fts SET title = ?, description = ? WHERE id = ?`,
+			video.Title, video.Description, video.Id)
+		if err != nil {
+			return fmt.Errorf("failed to reindex video: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AddView implements VideoMetadataService.
+func (s *SQLiteVideoMetadataService) AddView(id string) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	_, err := s.Instance.Exec("UPDATE videos SET views = views + 1 WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to count view: %w", err)
+	}
+
+	return nil
+}
+
+// sqliteSortColumns maps sort fields to columns.
+var sqliteSortColumns = map[VideoSort]string{
+	SortByUploadedAt: "uploaded_at",
+	SortByTitle:      "title COLLATE NOCASE",
+	SortByDuration:   "duration_ms",
+	SortByViews:      "views",
+}
+
+// Query implements VideoMetadataService.
+func (s *SQLiteVideoMetadataService) Query(q VideoQuery) (*VideoPage, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	q, err := q.normalized()
+	if err != nil {
+		return nil, err
+	}
+
+	var where []string
+	var args []any
+
+	if terms := searchTerms(q.Search); len(terms) > 0 {
+		if s.fts {
+			where = append(where, "id IN (SELECT id FROM videos_fts WHERE videos_fts MATCH ?)")
+			args = append(args, ftsQuery(terms))
+		} else {
+			for _, term := range terms {
+				pattern := "%" + escapeLike(term) + "%"
+				where = append(where, `(title LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\')`)
+				args = append(args, pattern, pattern)
+			}
+		}
+	}
+
+	if !q.IncludeHidden {
+		where = append(where, "(visibility = 'public' OR (owner_id != '' AND owner_id = ?))")
+		args = append(args, q.ViewerId)
+	}
+	if q.Tag != "" {
+		where = append(where, "id IN (SELECT video_id FROM video_tags WHERE tag = ?)")
+		args = append(args, q.Tag)
+	}
+	if q.Category != "" {
+		where = append(where, "category = ?")
+		args = append(args, q.Category)
+	}
+
+	column := sqliteSortColumns[q.Sort]
+	cmp, dir := ">", "ASC"
+	if q.Descending {
+		cmp, dir = "<", "DESC"
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodeVideoCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		value, err := sqliteCursorValue(q.Sort, cursor.Value)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, cmp))
+		args = append(args, value, value, cursor.Id)
+	}
+
+	query := videoSelect
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	// Fetch one extra row to learn whether another page follows.
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", column, dir, dir)
+	args = append(args, q.Limit+1)
+
+	rows, err := s.Instance.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query videos: %w", err)
+	}
+	defer rows.Close()
+
+	page := &VideoPage{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		page.Videos = append(page.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(page.Videos) > q.Limit {
+		page.Videos = page.Videos[:q.Limit]
+		page.NextCursor = encodeVideoCursor(q.Sort, page.Videos[q.Limit-1])
+	}
+
+	if err := s.loadTags(page.Videos); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// Tags implements VideoMetadataService.
+func (s *SQLiteVideoMetadataService) Tags() ([]LabelCount, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+	return s.labelCounts(`SELECT tag, COUNT(*) AS n FROM video_tags
+        WHERE video_id IN (SELECT id FROM videos WHERE visibility = 'public')
+        GROUP BY tag ORDER BY n DESC, tag`)
+}
+
+// Categories implements VideoMetadataService.
+func (s *SQLiteVideoMetadataService) Categories() ([]LabelCount, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+	return s.labelCounts(`SELECT category, COUNT(*) AS n FROM videos
+        WHERE category != '' AND visibility = 'public'
+        GROUP BY category ORDER BY n DESC, category`)
+}
+
+func (s *SQLiteVideoMetadataService) labelCounts(query string) ([]LabelCount, error) {
+	rows, err := s.Instance.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	labels := []LabelCount{}
+	for rows.Next() {
+		var label LabelCount
+		if err := rows.Scan(&label.Name, &label.Count); err != nil {
+			return nil, err
+		}
+		labels = append(labels, label)
+	}
+	return labels, rows.Err()
+}
+
+// sqliteCursorValue converts a cursor's sort value back to the column's type.
+func sqliteCursorValue(sort VideoSort, value string) (any, error) {
+	switch sort {
+	case SortByTitle:
+		return value, nil
+	case SortByDuration, SortByViews:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return n, nil
+	default:
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	}
+}
+
+// ftsQuery turns search words into an FTS5 query matching all of them as prefixes.
+func ftsQuery(terms []string) string {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(quoted, " ")
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
 
 // Delete implements VideoMetadataService.
@@ -92,8 +552,94 @@ func (s *SQLiteVideoMetadataService) Delete(id string) error {
 		return fmt.Errorf("failed to delete video metadata: %w", err)
 	}
 
+	_, err = s.Instance.Exec("DELETE FROM video_files WHERE video_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete video file manifest: %w", err)
+	}
+
+	_, err = s.Instance.Exec("DELETE FROM video_tags WHERE video_id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete video tags: %w", err)
+	}
+
+	if err := s.removeFromPlaylists(id); err != nil {
+		return err
+	}
+
+	if s.fts {
+		_, err = s.Instance.Exec("DELETE FROM videos_fts WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete video from search index: %w", err)
+		}
+	}
+
 	return nil
 }
 
+// SetFiles implements VideoMetadataService.
+func (s *SQLiteVideoMetadataService) SetFiles(videoId string, files []VideoFile) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	tx, err := s.Instance.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM video_files WHERE video_id = ?", videoId); err != nil {
+		return fmt.Errorf("failed to clear video file manifest: %w", err)
+	}
+	for _, file := range files {
+		_, err := tx.Exec(`INSERT INTO video_files (video_id, filename, size, digest) VALUES (?, ?, ?, ?)`,
+			videoId, file.Filename, file.Size, file.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to record file %s: %w", file.Filename, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Files implements VideoMetadataService.
+func (s *SQLiteVideoMetadataService) Files(videoId string) ([]VideoFile, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.Instance.Query("SELECT filename, size, digest FROM video_files WHERE video_id = ? ORDER BY filename", videoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []VideoFile
+	for rows.Next() {
+		var file VideoFile
+		if err := rows.Scan(&file.Filename, &file.Size, &file.Digest); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+// StorageUsed implements VideoMetadataService.
+func (s *SQLiteVideoMetadataService) StorageUsed(ownerId string) (int64, error) {
+	if err := s.ensureTable(); err != nil {
+		return 0, err
+	}
+
+	var used int64
+	err := s.Instance.QueryRow(`SELECT COALESCE(SUM(f.size), 0) FROM video_files f
+        JOIN videos v ON v.id = f.video_id WHERE v.owner_id = ?`, ownerId).Scan(&used)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum stored file sizes: %w", err)
+	}
+	return used, nil
+}
+
 // Uncomment the following line to ensure SQLiteVideoMetadataService implements VideoMetadataService
 var _ VideoMetadataService = (*SQLiteVideoMetadataService)(nil)
@@ -0,0 +1,76 @@
+package web
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AppendAudit implements AuditLog.
+func (s *SQLiteVideoMetadataService) AppendAudit(entry *AuditEntry) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	result, err := s.Instance.Exec(`INSERT INTO audit_log (at, actor, role, action, target, outcome, source) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.Time, entry.Actor, entry.Role, entry.Action, entry.Target, entry.Outcome, entry.Source)
+	if err != nil {
+		return fmt.Errorf("failed to append audit entry: %w", err)
+	}
+	entry.Id, _ = result.LastInsertId()
+
+	return nil
+}
+
+// ListAudit implements AuditLog.
+func (s *SQLiteVideoMetadataService) ListAudit(q AuditQuery) ([]AuditEntry, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var where []string
+	var args []any
+	if q.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, q.Actor)
+	}
+	if !q.Since.IsZero() {
+		where = append(where, "at >= ?")
+		args = append(args, q.Since)
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+	limit = min(limit, maxAuditLimit)
+
+	query := "SELECT id, at, actor, role, action, target, outcome, source FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.Instance.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		err := rows.Scan(&entry.Id, &entry.Time, &entry.Actor, &entry.Role, &entry.Action, &entry.Target, &entry.Outcome, &entry.Source)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+var _ AuditLog = (*SQLiteVideoMetadataService)(nil)
@@ -0,0 +1,211 @@
+package web
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// CreatePlaylist implements PlaylistService.
+func (s *SQLiteVideoMetadataService) CreatePlaylist(playlist *Playlist) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	tx, err := s.Instance.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO playlists (id, name, description, created_at, owner_id) VALUES (?, ?, ?, ?, ?)`,
+		playlist.Id, playlist.Name, playlist.Description, playlist.CreatedAt, playlist.OwnerId)
+	if err != nil {
+		return fmt.Errorf("failed to create playlist: %w", err)
+	}
+	if err := setPlaylistVideos(tx, playlist.Id, playlist.VideoIds); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ReadPlaylist implements PlaylistService.
+func (s *SQLiteVideoMetadataService) ReadPlaylist(id string) (*Playlist, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var playlist Playlist
+	err := s.Instance.QueryRow("SELECT id, name, description, created_at, owner_id FROM playlists WHERE id = ?", id).
+		Scan(&playlist.Id, &playlist.Name, &playlist.Description, &playlist.CreatedAt, &playlist.OwnerId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	playlist.VideoIds, err = s.playlistVideos(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &playlist, nil
+}
+
+// ListPlaylists implements PlaylistService.
+func (s *SQLiteVideoMetadataService) ListPlaylists() ([]Playlist, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.Instance.Query("SELECT id, name, description, created_at, owner_id FROM playlists ORDER BY created_at DESC, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var playlists []Playlist
+	for rows.Next() {
+		var playlist Playlist
+		if err := rows.Scan(&playlist.Id, &playlist.Name, &playlist.Description, &playlist.CreatedAt, &playlist.OwnerId); err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range playlists {
+		playlists[i].VideoIds, err = s.playlistVideos(playlists[i].Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return playlists, nil
+}
+
+// UpdatePlaylist implements PlaylistService.
+func (s *SQLiteVideoMetadataService) UpdatePlaylist(playlist *Playlist) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	tx, err := s.Instance.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE playlists SET name = ?, description = ? WHERE id = ?",
+		playlist.Name, playlist.Description, playlist.Id)
+	if err != nil {
+		return fmt.Errorf("failed to update playlist: %w", err)
+	}
+	if err := setPlaylistVideos(tx, playlist.Id, playlist.VideoIds); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeletePlaylist implements PlaylistService.
+func (s *SQLiteVideoMetadataService) DeletePlaylist(id string) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	if _, err := s.Instance.Exec("DELETE FROM playlist_videos WHERE playlist_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete playlist videos: %w", err)
+	}
+	if _, err := s.Instance.Exec("DELETE FROM playlists WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete playlist: %w", err)
+	}
+
+	return nil
+}
+
+func (s *SQLiteVideoMetadataService) playlistVideos(playlistId string) ([]string, error) {
+	rows, err := s.Instance.Query("SELECT video_id FROM playlist_videos WHERE playlist_id = ? ORDER BY position", playlistId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist videos: %w", err)
+	}
+	defer rows.Close()
+
+	videoIds := []string{}
+	for rows.Next() {
+		var videoId string
+		if err := rows.Scan(&videoId); err != nil {
+			return nil, err
+		}
+		videoIds = append(videoIds, videoId)
+	}
+	return videoIds, rows.Err()
+}
+
+func setPlaylistVideos(tx *sql.Tx, playlistId string, videoIds []string) error {
+	if _, err := tx.Exec("DELETE FROM playlist_videos WHERE playlist_id = ?", playlistId); err != nil {
+		return fmt.Errorf("failed to clear playlist videos: %w", err)
+	}
+	for position, videoId := range videoIds {
+		_, err := tx.Exec("INSERT INTO playlist_videos (playlist_id, position, video_id) VALUES (?, ?, ?)",
+			playlistId, position, videoId)
+		if err != nil {
+			return fmt.Errorf("failed to add video %s to playlist: %w", videoId, err)
+		}
+	}
+	return nil
+}
+
+// removeFromPlaylists drops a deleted video from every playlist, keeping the
+// remaining entries contiguous.
+func (s *SQLiteVideoMetadataService) removeFromPlaylists(videoId string) error {
+	rows, err := s.Instance.Query("SELECT DISTINCT playlist_id FROM playlist_videos WHERE video_id = ?", videoId)
+	if err != nil {
+		return fmt.Errorf("failed to find playlists of video: %w", err)
+	}
+	var playlistIds []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		playlistIds = append(playlistIds, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, playlistId := range playlistIds {
+		videoIds, err := s.playlistVideos(playlistId)
+		if err != nil {
+			return err
+		}
+		var kept []string
+		for _, id := range videoIds {
+			if id != videoId {
+				kept = append(kept, id)
+			}
+		}
+
+		tx, err := s.Instance.Begin()
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		if err := setPlaylistVideos(tx, playlistId, kept); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var _ PlaylistService = (*SQLiteVideoMetadataService)(nil)
@@ -0,0 +1,87 @@
+package web
+
+import (
+	"testing"
+	"time"
+)
+
+// addVideos records videos with the given titles, one second apart.
+func addVideos(t *testing.T, metadata *SQLiteVideoMetadataService, titles ...string) {
+	t.Helper()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, title := range titles {
+		video := &VideoMetadata{Id: title, UploadedAt: start.Add(time.Duration(i) * time.Second)}
+		if err := metadata.Create(video); err != nil {
+			t.Fatal(err)
+		}
+		video.Title = title
+		video.Description = "about " + title
+		video.Visibility = VisibilityPublic
+		if err := metadata.Update(video); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func videoIds(page *VideoPage) []string {
+	ids := make([]string, 0, len(page.Videos))
+	for _, video := range page.Videos {
+		ids = append(ids, video.Id)
+	}
+	return ids
+}
+
+// TestQuerySearch runs with and without the sqlite_fts5 tag; both must
+// match word prefixes in titles and descriptions.
+func TestQuerySearch(t *testing.T) {
+	metadata := newTestMetadata(t)
+	addVideos(t, metadata, "lecture-one", "lecture-two", "holiday")
+
+	tests := []struct {
+		search string
+		want   int
+	}{
+		{"lecture", 2},
+		{"lect", 2},
+		{"about holiday", 1},
+		{"lecture holiday", 0},
+		{"", 3},
+	}
+	for _, test := range tests {
+		page, err := metadata.Query(VideoQuery{Search: test.search})
+		if err != nil {
+			t.Fatalf("Query(%q): %v", test.search, err)
+		}
+		if len(page.Videos) != test.want {
+			t.Errorf("Query(%q) = %v, want %d videos", test.search, videoIds(page), test.want)
+		}
+	}
+}
+
+func TestQueryPages(t *testing.T) {
+	metadata := newTestMetadata(t)
+	addVideos(t, metadata, "a", "b", "c", "d", "e")
+
+	var got []string
+	q := VideoQuery{Limit: 2, Descending: true}
+	for {
+		page, err := metadata.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, videoIds(page)...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	want := []string{"e", "d", "c", "b", "a"}
+	if len(got) != len(want) {
+		t.Fatalf("pages = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("pages = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package web
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+	"tritontube/internal/security"
+)
+
+// CreateUser implements UserService.
+func (s *SQLiteVideoMetadataService) CreateUser(user *User) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	_, err := s.Instance.Exec(`INSERT INTO users (id, username, password_hash, role, created_at) VALUES (?, ?, ?, ?, ?)`,
+		user.Id, user.Username, user.PasswordHash, user.Role.String(), user.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+const userSelect = "SELECT id, username, password_hash, role, created_at FROM users"
+
+func (s *SQLiteVideoMetadataService) readUser(where string, arg string) (*User, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	var user User
+	var role string
+	err := s.Instance.QueryRow(userSelect+" WHERE "+where, arg).
+		Scan(&user.Id, &user.Username, &user.PasswordHash, &role, &user.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// An unknown role grants nothing rather than failing every request of the user.
+	user.Role, _ = security.ParseRole(role)
+
+	return &user, nil
+}
+
+// ReadUser implements UserService.
+func (s *SQLiteVideoMetadataService) ReadUser(id string) (*User, error) {
+	return s.readUser("id = ?", id)
+}
+
+// ReadUserByName implements UserService.
+func (s *SQLiteVideoMetadataService) ReadUserByName(username string) (*User, error) {
+	return s.readUser("username = ?", username)
+}
+
+// RegisterUser implements UserService. SQLite runs the single statement
+// under its write lock, so concurrent first registrations cannot both see
+// an empty table.
+func (s *SQLiteVideoMetadataService) RegisterUser(user *User) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	var role string
+	err := s.Instance.QueryRow(`
+        INSERT INTO users (id, username, password_hash, role, created_at)
+        SELECT ?, ?, ?, CASE WHEN EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM videos) THEN ? ELSE ? END, ?
+        RETURNING role
+    `, user.Id, user.Username, user.PasswordHash, user.Role.String(), security.RoleAdmin.String(), user.CreatedAt).Scan(&role)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	user.Role, err = security.ParseRole(role)
+	return err
+}
+
+// SetUserRole implements UserService.
+func (s *SQLiteVideoMetadataService) SetUserRole(id string, role security.Role) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	admin := security.RoleAdmin.String()
+	result, err := s.Instance.Exec(`
+        UPDATE users SET role = ?
+        WHERE id = ? AND (? = ? OR role != ? OR EXISTS (SELECT 1 FROM users WHERE role = ? AND id != ?))
+    `, role.String(), id, role.String(), admin, admin, admin, id)
+	if err != nil {
+		return fmt.Errorf("failed to set user role: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		user, err := s.ReadUser(id)
+		if err != nil {
+			return fmt.Errorf("failed to set user role: %w", err)
+		}
+		if user != nil {
+			return ErrLastAdmin
+		}
+		return fmt.Errorf("user %s not found", id)
+	}
+
+	return nil
+}
+
+// CreateToken implements UserService.
+func (s *SQLiteVideoMetadataService) CreateToken(token *AuthToken) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	var expiresAt any
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = token.ExpiresAt
+	}
+	_, err := s.Instance.Exec(`INSERT INTO auth_tokens (id, hash, user_id, kind, name, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		token.Id, token.Hash, token.UserId, string(token.Kind), token.Name, token.CreatedAt, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+
+	return nil
+}
+
+const tokenSelect = "SELECT id, hash, user_id, kind, name, created_at, expires_at FROM auth_tokens"
+
+func scanToken(row rowScanner) (AuthToken, error) {
+	var token AuthToken
+	var kind string
+	var expiresAt sql.NullTime
+	err := row.Scan(&token.Id, &token.Hash, &token.UserId, &kind, &token.Name, &token.CreatedAt, &expiresAt)
+	token.Kind = AuthTokenKind(kind)
+	if expiresAt.Valid {
+		token.ExpiresAt = expiresAt.Time
+	}
+	return token, err
+}
+
+// ReadTokenByHash implements UserService.
+func (s *SQLiteVideoMetadataService) ReadTokenByHash(hash string) (*AuthToken, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	token, err := scanToken(s.Instance.QueryRow(tokenSelect+" WHERE hash = ?", hash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// ListTokens implements UserService.
+func (s *SQLiteVideoMetadataService) ListTokens(userId string) ([]AuthToken, error) {
+	if err := s.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	// Expired sessions are never shown again, so this is a convenient place to drop them.
+	if _, err := s.Instance.Exec("DELETE FROM auth_tokens WHERE expires_at IS NOT NULL AND expires_at < ?", time.Now()); err != nil {
+		return nil, fmt.Errorf("failed to expire tokens: %w", err)
+	}
+
+	rows, err := s.Instance.Query(tokenSelect+" WHERE user_id = ? ORDER BY created_at", userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []AuthToken
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteToken implements UserService.
+func (s *SQLiteVideoMetadataService) DeleteToken(id string) error {
+	if err := s.ensureTable(); err != nil {
+		return err
+	}
+
+	if _, err := s.Instance.Exec("DELETE FROM auth_tokens WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+
+	return nil
+}
+
+var _ UserService = (*SQLiteVideoMetadataService)(nil)
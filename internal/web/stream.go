@@ -0,0 +1,27 @@
+package web
+
+import (
+	"context"
+	"io"
+)
+
+// pipeStream returns a reader of what produce writes, running produce in
+// the background. Closing the reader cancels the context produce gets.
+func pipeStream(ctx context.Context, produce func(ctx context.Context, w io.Writer) error) io.ReadCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(produce(ctx, pw))
+	}()
+	return &pipeStreamReader{PipeReader: pr, cancel: cancel}
+}
+
+type pipeStreamReader struct {
+	*io.PipeReader
+	cancel context.CancelFunc
+}
+
+func (r *pipeStreamReader) Close() error {
+	r.cancel()
+	return r.PipeReader.Close()
+}
@@ -0,0 +1,326 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxSubtitleSize bounds uploaded subtitle files.
+const maxSubtitleSize = 2 << 20
+
+var (
+	// languageTag loosely matches a BCP 47 language tag, e.g. en or pt-br.
+	languageTag      = regexp.MustCompile(`^[a-z]{2,3}(?:-[a-z0-9]{2,8})*$`)
+	subtitleFileName = regexp.MustCompile(`^subtitles-(.+)\.vtt$`)
+	srtTiming        = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})[,.](\d{3})\s*-->\s*(\d+):(\d{2}):(\d{2})[,.](\d{3})`)
+	srtBlankLines    = regexp.MustCompile(`\n[ \t]*\n`)
+	srtFontTag       = regexp.MustCompile(`(?i)</?font[^>]*>`)
+)
+
+// SubtitleAPIResponse describes a subtitle track of a video.
+type SubtitleAPIResponse struct {
+	Language string `json:"language"`
+	URL      string `json:"url"`
+}
+
+// subtitleFile names the WebVTT file of the subtitles in language, and
+// subtitlePlaylist the HLS media playlist of it.
+func subtitleFile(language string) string     { return "subtitles-" + language + ".vtt" }
+func subtitlePlaylist(language string) string { return "subtitles-" + language + ".m3u8" }
+
+// subtitleLanguages returns the languages a video has subtitles in, in
+// order.
+func subtitleLanguages(files []VideoFile) []string {
+	var languages []string
+	for _, file := range files {
+		if m := subtitleFileName.FindStringSubmatch(file.Filename); m != nil {
+			languages = append(languages, m[1])
+		}
+	}
+	slices.Sort(languages)
+	return languages
+}
+
+func (v VideoAPIResponse) subtitles(languages []string) []SubtitleAPIResponse {
+	subtitles := make([]SubtitleAPIResponse, 0, len(languages))
+	for _, language := range languages {
+		subtitles = append(subtitles, SubtitleAPIResponse{Language: language, URL: v.contentURL(subtitleFile(language))})
+	}
+	return subtitles
+}
+
+// toWebVTT returns data, SRT or WebVTT subtitles, as WebVTT.
+func toWebVTT(data []byte) ([]byte, error) {
+	if !utf8.Valid(data) {
+		return nil, errors.New("subtitles must be UTF-8 text")
+	}
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	if header, _, _ := strings.Cut(text, "\n"); strings.HasPrefix(header, "WEBVTT") {
+		if rest := header[len("WEBVTT"):]; rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			return nil, errors.New("invalid WebVTT header")
+		}
+		return []byte(text), nil
+	}
+
+	var out strings.Builder
+	out.WriteString("WEBVTT\n")
+	cues := 0
+	for _, block := range srtBlankLines.Split(strings.TrimSpace(text), -1) {
+		lines := strings.Split(strings.TrimSpace(block), "\n")
+		// The cue number is optional in practice.
+		if _, err := strconv.Atoi(strings.TrimSpace(lines[0])); err == nil && len(lines) > 1 {
+			lines = lines[1:]
+		}
+		m := srtTiming.FindStringSubmatch(strings.TrimSpace(lines[0]))
+		if m == nil {
+			return nil, fmt.Errorf("subtitles are neither WebVTT nor SRT: cue %d has no valid timing line", cues+1)
+		}
+		start, end := srtTimestamp(m[1:5]), srtTimestamp(m[5:9])
+		if end < start {
+			return nil, fmt.Errorf("invalid SRT: cue %d ends before it starts", cues+1)
+		}
+		payload := srtFontTag.ReplaceAllString(strings.Join(lines[1:], "\n"), "")
+		// "-->" would end a WebVTT cue payload.
+		payload = strings.ReplaceAll(payload, "-->", "--&gt;")
+		fmt.Fprintf(&out, "\n%s --> %s\n%s\n", vttTimestamp(start), vttTimestamp(end), strings.TrimSpace(payload))
+		cues++
+	}
+	if cues == 0 {
+		return nil, errors.New("subtitles contain no cues")
+	}
+	return []byte(out.String()), nil
+}
+
+// srtTimestamp converts the hours, minutes, seconds and milliseconds of an
+// SRT timestamp.
+func srtTimestamp(parts []string) time.Duration {
+	var n [4]int
+	for i, part := range parts {
+		n[i], _ = strconv.Atoi(part)
+	}
+	return time.Duration(n[0])*time.Hour + time.Duration(n[1])*time.Minute +
+		time.Duration(n[2])*time.Second + time.Duration(n[3])*time.Millisecond
+}
+
+// subtitleMediaPlaylist returns an HLS media playlist with the WebVTT file of
+// language as its only segment.
+func subtitleMediaPlaylist(language string, duration time.Duration) []byte {
+	target := max(1, int(math.Ceil(duration.Seconds())))
+	return fmt.Appendf(nil, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:%d\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:%.3f,\n%s\n#EXT-X-ENDLIST\n",
+		target, duration.Seconds(), subtitleFile(language))
+}
+
+// videoFiles returns the file manifest of a video. Videos ingested before
+// manifests were recorded fall back to a listing without sizes.
+func (s *server) videoFiles(r *http.Request, videoId string) ([]VideoFile, error) {
+	files, err := s.metadataService.Files(videoId)
+	if err != nil || len(files) > 0 {
+		return files, err
+	}
+	names, err := s.contentService.ListFiles(r.Context(), videoId)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		files = append(files, VideoFile{Filename: name})
+	}
+	return files, nil
+}
+
+// API endpoint: GET /api/v1/videos/{videoId}/subtitles - List the subtitle tracks of a video
+func (s *server) handleListSubtitles(w http.ResponseWriter, r *http.Request) {
+	video, err := s.metadataService.Read(r.PathValue("videoId"))
+	if err != nil || video == nil || !canView(currentUser(r), video) {
+		sendErrorResponse(w, http.StatusNotFound, "Video not found")
+		return
+	}
+	files, err := s.metadataService.Files(video.Id)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error reading video file manifest")
+		slog.ErrorContext(r.Context(), "Error reading file manifest", "err", err)
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    s.newVideoAPIResponse(*video).subtitles(subtitleLanguages(files)),
+	})
+}
+
+// API endpoint: PUT /api/v1/videos/{videoId}/subtitles/{language} - Upload SRT or WebVTT subtitles
+func (s *server) handlePutSubtitles(w http.ResponseWriter, r *http.Request) {
+	video, err := s.metadataService.Read(r.PathValue("videoId"))
+	if err != nil || video == nil || !canView(currentUser(r), video) {
+		sendErrorResponse(w, http.StatusNotFound, "Video not found")
+		return
+	}
+	user := requireUser(w, r)
+	if user == nil {
+		return
+	}
+	if !canModify(user, video.OwnerId) {
+		sendErrorResponse(w, http.StatusForbidden, "Only the owner or an admin can edit this video")
+		return
+	}
+	writer, ok := s.contentService.(FileWriter)
+	if !ok {
+		sendErrorResponse(w, http.StatusNotImplemented, "Subtitles are not supported by this content service")
+		return
+	}
+	if s.live.active(video.Id) {
+		sendErrorResponse(w, http.StatusConflict, "Subtitles can be added once the live stream has ended")
+		return
+	}
+	language := strings.ToLower(r.PathValue("language"))
+	if !languageTag.MatchString(language) {
+		sendErrorResponse(w, http.StatusBadRequest, "Invalid language tag, want e.g. en or pt-br")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSubtitleSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			sendErrorResponse(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Subtitles exceed the maximum size of %d bytes", maxSubtitleSize))
+			return
+		}
+		sendErrorResponse(w, http.StatusBadRequest, "Error reading request body")
+		return
+	}
+	vtt, err := toWebVTT(data)
+	if err != nil {
+		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	playlist := subtitleMediaPlaylist(language, video.Duration)
+	if !s.checkQuota(w, r, user, int64(len(vtt)+len(playlist))) {
+		return
+	}
+
+	files, err := s.videoFiles(r, video.Id)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error reading video file manifest")
+		slog.ErrorContext(r.Context(), "Error reading file manifest", "video", video.Id, "err", err)
+		return
+	}
+	created := !slices.Contains(subtitleLanguages(files), language)
+	type upload struct {
+		name     string
+		data     []byte
+		previous []byte // nil for files that did not exist
+	}
+	uploads := []upload{{name: subtitleFile(language), data: vtt}, {name: subtitlePlaylist(language), data: playlist}}
+	for i, u := range uploads {
+		if !slices.ContainsFunc(files, func(f VideoFile) bool { return f.Filename == u.name }) {
+			continue
+		}
+		if uploads[i].previous, err = s.contentService.Read(r.Context(), video.Id, u.name); err != nil {
+			sendErrorResponse(w, http.StatusInternalServerError, "Error reading subtitles from content service")
+			slog.ErrorContext(r.Context(), "Content service read error", "video", video.Id, "file", u.name, "err", err)
+			return
+		}
+	}
+
+	// If the upload fails part way, replaced files are put back and new
+	// ones deleted, so that stored files keep matching the file manifest.
+	var written []upload
+	undo := func() {
+		for _, u := range written {
+			var err error
+			if u.previous != nil {
+				err = writer.WriteFile(r.Context(), video.Id, u.name, u.previous)
+			} else {
+				err = s.contentService.Delete(r.Context(), video.Id, u.name)
+			}
+			if err != nil {
+				slog.WarnContext(r.Context(), "Error undoing subtitle upload", "video", video.Id, "file", u.name, "err", err)
+			}
+		}
+	}
+	for _, u := range uploads {
+		if err := writer.WriteFile(r.Context(), video.Id, u.name, u.data); err != nil {
+			undo()
+			sendErrorResponse(w, http.StatusInternalServerError, "Error saving subtitles to content service")
+			slog.ErrorContext(r.Context(), "Content service write error", "video", video.Id, "file", u.name, "err", err)
+			return
+		}
+		written = append(written, u)
+		files = slices.DeleteFunc(files, func(f VideoFile) bool { return f.Filename == u.name })
+		files = append(files, newVideoFile(u.name, u.data))
+	}
+	if err := s.metadataService.SetFiles(video.Id, files); err != nil {
+		undo()
+		sendErrorResponse(w, http.StatusInternalServerError, "Error in saving file manifest")
+		slog.ErrorContext(r.Context(), "Error in saving file manifest", "video", video.Id, "err", err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	sendJSONResponse(w, status, APIResponse{
+		Success: true,
+		Data:    s.newVideoAPIResponse(*video).subtitles([]string{language})[0],
+	})
+}
+
+// API endpoint: DELETE /api/v1/videos/{videoId}/subtitles/{language} - Remove subtitles
+func (s *server) handleDeleteSubtitles(w http.ResponseWriter, r *http.Request) {
+	video, err := s.metadataService.Read(r.PathValue("videoId"))
+	if err != nil || video == nil || !canView(currentUser(r), video) {
+		sendErrorResponse(w, http.StatusNotFound, "Video not found")
+		return
+	}
+	user := requireUser(w, r)
+	if user == nil {
+		return
+	}
+	if !canModify(user, video.OwnerId) {
+		sendErrorResponse(w, http.StatusForbidden, "Only the owner or an admin can edit this video")
+		return
+	}
+	language := strings.ToLower(r.PathValue("language"))
+
+	files, err := s.metadataService.Files(video.Id)
+	if err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error reading video file manifest")
+		slog.ErrorContext(r.Context(), "Error reading file manifest", "video", video.Id, "err", err)
+		return
+	}
+	if !slices.Contains(subtitleLanguages(files), language) {
+		sendErrorResponse(w, http.StatusNotFound, "Subtitles not found")
+		return
+	}
+	// Drop them from the manifest first, so players stop being offered them.
+	names := []string{subtitleFile(language), subtitlePlaylist(language)}
+	files = slices.DeleteFunc(files, func(f VideoFile) bool { return slices.Contains(names, f.Filename) })
+	if err := s.metadataService.SetFiles(video.Id, files); err != nil {
+		sendErrorResponse(w, http.StatusInternalServerError, "Error in saving file manifest")
+		slog.ErrorContext(r.Context(), "Error in saving file manifest", "video", video.Id, "err", err)
+		return
+	}
+	for _, name := range names {
+		if err := s.contentService.Delete(r.Context(), video.Id, name); err != nil && !strings.Contains(err.Error(), "no such file") {
+			slog.WarnContext(r.Context(), "Error deleting subtitle file", "video", video.Id, "file", name, "err", err)
+		}
+	}
+
+	sendJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    map[string]string{"message": "Subtitles deleted successfully"},
+	})
+}
@@ -0,0 +1,224 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"tritontube/internal/security"
+)
+
+func TestToWebVTT(t *testing.T) {
+	srt := "\ufeff1\r\n00:00:01,000 --> 00:00:02,500\r\n<font color=\"red\">Hello</font>\r\n\r\n" +
+		"00:01:00,000 --> 00:01:02,000\r\nno number --> here\r\nsecond line\r\n\r\n\r\n"
+	got, err := toWebVTT([]byte(srt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `WEBVTT
+
+00:00:01.000 --> 00:00:02.500
+Hello
+
+00:01:00.000 --> 00:01:02.000
+no number --&gt; here
+second line
+`
+	if string(got) != want {
+		t.Errorf("toWebVTT =\n%s\nwant\n%s", got, want)
+	}
+
+	vtt := "WEBVTT - captions\r\n\r\n00:01.000 --> 00:02.000\r\n<v Ann>Hi\r\n"
+	if got, err := toWebVTT([]byte(vtt)); err != nil || string(got) != strings.ReplaceAll(vtt, "\r\n", "\n") {
+		t.Errorf("toWebVTT of WebVTT = %q, %v", got, err)
+	}
+
+	for name, bad := range map[string]string{
+		"not UTF-8":       "1\n00:00:01,000 --> 00:00:02,000\n\xff\xfe\n",
+		"bad header":      "WEBVTTX\n\n00:01.000 --> 00:02.000\nHi\n",
+		"no timing":       "1\nHello\n",
+		"ends too early":  "1\n00:00:02,000 --> 00:00:01,000\nHello\n",
+		"no cues":         " \r\n",
+		"plain text file": "just some notes",
+	} {
+		if _, err := toWebVTT([]byte(bad)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestSubtitleMediaPlaylist(t *testing.T) {
+	got := string(subtitleMediaPlaylist("pt-br", 4500*time.Millisecond))
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:5\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXTINF:4.500,\nsubtitles-pt-br.vtt\n#EXT-X-ENDLIST\n"
+	if got != want {
+		t.Errorf("playlist =\n%s\nwant\n%s", got, want)
+	}
+	if got := string(subtitleMediaPlaylist("en", 0)); !strings.Contains(got, "#EXT-X-TARGETDURATION:1\n") {
+		t.Errorf("playlist of a video without duration:\n%s", got)
+	}
+}
+
+// putSubtitles uploads body as the subtitles of videoId in language.
+func putSubtitles(t *testing.T, handler http.Handler, videoId, language, token, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest("PUT", "/api/v1/videos/"+videoId+"/subtitles/"+language, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestSubtitlesInServedManifests(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	owner := signIn(t, s, "owner", security.RoleViewer)
+	stranger := signIn(t, s, "stranger", security.RoleViewer)
+	storeVideo(t, s, "secret", userOf(t, s, owner).Id, VisibilityPrivate)
+	storeHLS(t, s, "secret")
+	srt := "1\n00:00:00,500 --> 00:00:01,500\nHello\n"
+
+	if w := putSubtitles(t, handler, "secret", "EN", owner, srt); w.Code != http.StatusCreated {
+		t.Fatalf("first upload: %d %s", w.Code, w.Body)
+	}
+	if w := putSubtitles(t, handler, "secret", "en", owner, srt); w.Code != http.StatusOK {
+		t.Errorf("second upload: %d %s", w.Code, w.Body)
+	}
+	if w := putSubtitles(t, handler, "secret", "pt-br", owner, "WEBVTT\n\n00:00.500 --> 00:01.500\nOlá\n"); w.Code != http.StatusCreated {
+		t.Errorf("WebVTT upload: %d %s", w.Code, w.Body)
+	}
+	if w := putSubtitles(t, handler, "secret", "english", owner, srt); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid language: %d", w.Code)
+	}
+	if w := putSubtitles(t, handler, "secret", "de", owner, "not subtitles"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid subtitles: %d", w.Code)
+	}
+	if w := putSubtitles(t, handler, "secret", "de", stranger, srt); w.Code != http.StatusNotFound {
+		t.Errorf("upload by a stranger: %d", w.Code)
+	}
+
+	var video VideoAPIResponse
+	doJSON(t, handler, "GET", "/api/v1/videos/secret", owner, nil, &video)
+	query := "?token=" + video.PlaybackToken
+	if len(video.Subtitles) != 2 || video.Subtitles[0].Language != "en" ||
+		!strings.HasSuffix(video.Subtitles[0].URL, "/content/secret/subtitles-en.vtt"+query) {
+		t.Errorf("subtitles of the video = %+v", video.Subtitles)
+	}
+	get := func(name string) string {
+		t.Helper()
+		w := doJSON(t, handler, "GET", "/api/v1/content/secret/"+name+query, "", nil, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: %d", name, w.Code)
+		}
+		return w.Body.String()
+	}
+
+	if got := get("subtitles-en.vtt"); got != "WEBVTT\n\n00:00:00.500 --> 00:00:01.500\nHello\n" {
+		t.Errorf("converted subtitles:\n%s", got)
+	}
+	mpd := get("manifest.mpd")
+	for _, want := range []string{
+		`<AdaptationSet contentType="text" mimeType="text/vtt" lang="en">`,
+		`<BaseURL>subtitles-pt-br.vtt` + query + `</BaseURL>`,
+	} {
+		if !strings.Contains(mpd, want) {
+			t.Errorf("manifest lacks %q:\n%s", want, mpd)
+		}
+	}
+	master := get("master.m3u8")
+	for _, want := range []string{
+		`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subtitles",NAME="en",LANGUAGE="en",DEFAULT=NO,AUTOSELECT=YES,URI="subtitles-en.m3u8` + query + `"`,
+		`#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subtitles",NAME="pt-br",LANGUAGE="pt-br",DEFAULT=NO,AUTOSELECT=YES,URI="subtitles-pt-br.m3u8` + query + `"`,
+		`,SUBTITLES="subtitles"` + "\n",
+	} {
+		if !strings.Contains(master, want) {
+			t.Errorf("master playlist lacks %q:\n%s", want, master)
+		}
+	}
+	if playlist := get("subtitles-en.m3u8"); !strings.Contains(playlist, "\nsubtitles-en.vtt"+query+"\n") {
+		t.Errorf("subtitle playlist:\n%s", playlist)
+	}
+
+	w := doJSON(t, handler, "DELETE", "/api/v1/videos/secret/subtitles/en", owner, nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete: %d %s", w.Code, w.Body)
+	}
+	if master := get("master.m3u8"); strings.Contains(master, `NAME="en"`) || !strings.Contains(master, `NAME="pt-br"`) {
+		t.Errorf("master playlist after deleting en:\n%s", master)
+	}
+	if w := doJSON(t, handler, "DELETE", "/api/v1/videos/secret/subtitles/en", owner, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("second delete: %d", w.Code)
+	}
+	var subtitles []SubtitleAPIResponse
+	doJSON(t, handler, "GET", "/api/v1/videos/secret/subtitles", owner, nil, &subtitles)
+	if len(subtitles) != 1 || subtitles[0].Language != "pt-br" {
+		t.Errorf("subtitles after the delete = %+v", subtitles)
+	}
+}
+
+func TestReplaceSubtitlesOnStorageNodes(t *testing.T) {
+	addr, _ := startStorageNode(t)
+	metadata := newTestMetadata(t)
+	content := NewNetworkVideoContentService([]string{addr}, metadata, nil)
+	s := NewServer(metadata, content, metadata, metadata)
+	handler := newTestServer(t, s)
+	owner := signIn(t, s, "owner", security.RoleViewer)
+	storeVideo(t, s, "v1", userOf(t, s, owner).Id, VisibilityPublic)
+	stored := func(name string) string {
+		t.Helper()
+		data, err := content.Read(context.Background(), "v1", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	recorded := func(name string) VideoFile {
+		t.Helper()
+		files, err := metadata.Files("v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			if f.Filename == name {
+				return f
+			}
+		}
+		return VideoFile{}
+	}
+
+	first := "1\n00:00:00,500 --> 00:00:01,500\nHello\n"
+	second := "WEBVTT\n\n00:00:00.500 --> 00:00:01.500\nHi\n"
+	if w := putSubtitles(t, handler, "v1", "en", owner, first); w.Code != http.StatusCreated {
+		t.Fatalf("first upload: %d %s", w.Code, w.Body)
+	}
+	if w := putSubtitles(t, handler, "v1", "en", owner, second); w.Code != http.StatusOK {
+		t.Fatalf("replacement: %d %s", w.Code, w.Body)
+	}
+	if got := stored("subtitles-en.vtt"); got != second {
+		t.Errorf("replaced subtitles = %q", got)
+	}
+	if want := newVideoFile("subtitles-en.vtt", []byte(second)); recorded("subtitles-en.vtt") != want {
+		t.Errorf("recorded %+v, want %+v", recorded("subtitles-en.vtt"), want)
+	}
+
+	// When the file manifest cannot be saved, the stored files are put back
+	// as it records them.
+	failing := newTestServer(t, NewServer(failingFiles{metadata}, content, metadata, metadata))
+	if w := putSubtitles(t, failing, "v1", "en", owner, first); w.Code != http.StatusInternalServerError {
+		t.Fatalf("replacement without a file manifest: %d %s", w.Code, w.Body)
+	}
+	if got := stored("subtitles-en.vtt"); got != second {
+		t.Errorf("subtitles after the failed replacement = %q", got)
+	}
+	if w := putSubtitles(t, failing, "v1", "de", owner, first); w.Code != http.StatusInternalServerError {
+		t.Fatalf("new subtitles without a file manifest: %d %s", w.Code, w.Body)
+	}
+	names, err := content.ListFiles(context.Background(), "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(names, "subtitles-de.vtt") || slices.Contains(names, "subtitles-de.m3u8") {
+		t.Errorf("files of the failed upload left behind: %v", names)
+	}
+}
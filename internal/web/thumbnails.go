@@ -0,0 +1,110 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	posterFile = "thumbnail.jpg"
+	// thumbnailsTrack is the WebVTT track of scrub preview thumbnails.
+	thumbnailsTrack = "thumbnails.vtt"
+	// spriteSheetPattern names the sprite sheets, numbered from 1.
+	spriteSheetPattern = "thumbnails-%03d.jpg"
+)
+
+// writeImages writes the poster frame and the scrub preview thumbnails of
+// input to dir, which already holds the DASH output of input. The poster is
+// taken at PosterPosition percent of the duration the manifest declares, so
+// videos shorter than a second get one too.
+func (e Encoding) writeImages(ctx context.Context, input, dir string) error {
+	mpd, err := os.ReadFile(filepath.Join(dir, "manifest.mpd"))
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+	duration, err := mpdDuration(mpd)
+	if err != nil {
+		return err
+	}
+
+	position := duration * time.Duration(e.PosterPosition) / 100
+	posterCmd := exec.Command(
+		"ffmpeg",
+		"-ss", seconds(position), // Seek before opening the input, which is faster
+		"-i", input,
+		"-frames:v", "1",
+		"-q:v", "2", // High quality
+		"-y",
+		filepath.Join(dir, posterFile),
+	)
+	if err := runFFmpeg(ctx, "thumbnail", posterCmd); err != nil {
+		return fmt.Errorf("failed to generate poster: %w", err)
+	}
+
+	t := e.Thumbnails
+	if t.Interval <= 0 || duration <= 0 {
+		return nil
+	}
+	count := int(math.Ceil(duration.Seconds() / float64(t.Interval)))
+	// Short videos get a sheet no larger than they need.
+	columns := min(t.Columns, count)
+	rows := min(t.Columns, (count+columns-1)/columns)
+	filter := fmt.Sprintf(
+		"fps=1/%d,scale=%d:%d:force_original_aspect_ratio=decrease,pad=%[2]d:%[3]d:(ow-iw)/2:(oh-ih)/2,tile=%dx%d",
+		t.Interval, t.Width, t.Height, columns, rows)
+	spriteCmd := exec.Command(
+		"ffmpeg",
+		"-i", input,
+		"-an",
+		"-vf", filter,
+		"-q:v", "5",
+		"-start_number", "1",
+		"-y",
+		filepath.Join(dir, spriteSheetPattern),
+	)
+	if err := runFFmpeg(ctx, "sprites", spriteCmd); err != nil {
+		return fmt.Errorf("failed to generate sprite sheets: %w", err)
+	}
+
+	track := t.track(duration, count, columns, rows)
+	if err := os.WriteFile(filepath.Join(dir, thumbnailsTrack), track, 0644); err != nil {
+		return fmt.Errorf("failed to write thumbnails track: %w", err)
+	}
+	return nil
+}
+
+// track returns the WebVTT track pointing each interval of a video at its
+// thumbnail, with a media fragment selecting it from the sprite sheet.
+func (t Thumbnails) track(duration time.Duration, count, columns, rows int) []byte {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	interval := time.Duration(t.Interval) * time.Second
+	perSheet := columns * rows
+	for i := range count {
+		start := time.Duration(i) * interval
+		end := min(start+interval, duration)
+		tile := i % perSheet
+		fmt.Fprintf(&b, "\n%s --> %s\n", vttTimestamp(start), vttTimestamp(end))
+		fmt.Fprintf(&b, spriteSheetPattern+"#xywh=%d,%d,%d,%d\n",
+			i/perSheet+1, tile%columns*t.Width, tile/columns*t.Height, t.Width, t.Height)
+	}
+	return []byte(b.String())
+}
+
+// vttTimestamp formats d as a WebVTT timestamp, hh:mm:ss.ttt.
+func vttTimestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// seconds formats d for ffmpeg time options.
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
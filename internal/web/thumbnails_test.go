@@ -0,0 +1,120 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tritontube/internal/security"
+)
+
+func TestVTTTimestamp(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		0:                                 "00:00:00.000",
+		1500 * time.Millisecond:           "00:00:01.500",
+		61*time.Second + time.Millisecond: "00:01:01.001",
+		3*time.Hour + 25*time.Minute + 999*time.Millisecond + 500*time.Microsecond: "03:25:00.999",
+	} {
+		if got := vttTimestamp(d); got != want {
+			t.Errorf("vttTimestamp(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
+
+func TestThumbnailsTrack(t *testing.T) {
+	thumbnails := Thumbnails{Interval: 10, Width: 160, Height: 90, Columns: 2}
+	// Five thumbnails on sheets of 2x2; the last cue ends with the video.
+	got := string(thumbnails.track(45*time.Second, 5, 2, 2))
+	want := `WEBVTT
+
+00:00:00.000 --> 00:00:10.000
+thumbnails-001.jpg#xywh=0,0,160,90
+
+00:00:10.000 --> 00:00:20.000
+thumbnails-001.jpg#xywh=160,0,160,90
+
+00:00:20.000 --> 00:00:30.000
+thumbnails-001.jpg#xywh=0,90,160,90
+
+00:00:30.000 --> 00:00:40.000
+thumbnails-001.jpg#xywh=160,90,160,90
+
+00:00:40.000 --> 00:00:45.000
+thumbnails-002.jpg#xywh=0,0,160,90
+`
+	if got != want {
+		t.Errorf("track =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestThumbnailsTrackOfPrivateVideo(t *testing.T) {
+	s, handler := newSQLiteServer(t)
+	owner := signIn(t, s, "owner", security.RoleViewer)
+	storeVideo(t, s, "secret", userOf(t, s, owner).Id, VisibilityPrivate)
+	track := Thumbnails{Interval: 10, Width: 160, Height: 90, Columns: 2}.track(15*time.Second, 2, 2, 1)
+	if err := s.contentService.(FileWriter).WriteFile(context.Background(), "secret", thumbnailsTrack, track); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.metadataService.SetFiles("secret", []VideoFile{newVideoFile(thumbnailsTrack, track)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var video VideoAPIResponse
+	doJSON(t, handler, "GET", "/api/v1/videos/secret", owner, nil, &video)
+	if !strings.HasSuffix(video.Thumbnails, "/content/secret/thumbnails.vtt?token="+video.PlaybackToken) {
+		t.Fatalf("thumbnails = %q", video.Thumbnails)
+	}
+	if !strings.Contains(video.Poster, "/content/secret/thumbnail.jpg") {
+		t.Errorf("poster = %q", video.Poster)
+	}
+
+	query := "?token=" + video.PlaybackToken
+	w := doJSON(t, handler, "GET", "/api/v1/content/secret/thumbnails.vtt"+query, "", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("track: %d", w.Code)
+	}
+	// Players fetch the sheets without the token of the track otherwise.
+	if want := "\nthumbnails-001.jpg" + query + "#xywh=160,0,160,90\n"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("track lacks %q:\n%s", want, w.Body)
+	}
+	if w := doJSON(t, handler, "GET", "/api/v1/content/secret/thumbnails.vtt", "", nil, nil); w.Code != http.StatusForbidden {
+		t.Errorf("track without a token: %d", w.Code)
+	}
+}
+
+// TestWriteImagesWithFFmpeg makes the poster and sprite sheets of a
+// generated clip with the local ffmpeg.
+func TestWriteImagesWithFFmpeg(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.mp4")
+	generate := exec.Command("ffmpeg", "-f", "lavfi", "-i", "testsrc=duration=5:size=320x240:rate=30", "-y", input)
+	if out, err := generate.CombinedOutput(); err != nil {
+		t.Fatalf("failed to generate input: %v\n%s", err, out)
+	}
+	mpd := strings.Replace(testMPD, "PT2.0S", "PT5.0S", 1)
+	if err := os.WriteFile(filepath.Join(dir, "manifest.mpd"), []byte(mpd), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := DefaultEncoding
+	e.Thumbnails = Thumbnails{Interval: 2, Width: 80, Height: 45, Columns: 2}
+	if err := e.writeImages(context.Background(), input, dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{posterFile, "thumbnails-001.jpg", thumbnailsTrack} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	track, _ := os.ReadFile(filepath.Join(dir, thumbnailsTrack))
+	if !strings.Contains(string(track), "00:00:04.000 --> 00:00:05.000\nthumbnails-001.jpg#xywh=0,45,80,45\n") {
+		t.Errorf("track:\n%s", track)
+	}
+}
@@ -0,0 +1,80 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"tritontube/internal/tracing"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestContentRequestTraceReachesStorageNode(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown := tracing.Install(exporter, "test")
+	t.Cleanup(func() { shutdown(context.Background()) })
+
+	addr, _ := startStorageNode(t)
+	metadata := newTestMetadata(t)
+	content := NewNetworkVideoContentService([]string{addr}, metadata, nil)
+	createVideo(t, metadata, "video")
+	if err := content.WriteFile(context.Background(), "video", "chunk-0-00001.m4s", []byte("segment")); err != nil {
+		t.Fatal(err)
+	}
+	exporter.Reset()
+
+	handler := newTestServer(t, NewServer(metadata, content, metadata, metadata))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/content/video/chunk-0-00001.m4s", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	spans := make(map[string]tracetest.SpanStub)
+	byID := make(map[trace.SpanID]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		byID[span.SpanContext.SpanID()] = span
+		// The client and server spans of an RPC share its name.
+		name := span.Name
+		if span.SpanKind == trace.SpanKindServer && name != "GET /api/v1/content/{videoId}/{filename}" {
+			name = "server " + name
+		}
+		spans[name] = span
+	}
+
+	parentOf := func(child, parent string) {
+		t.Helper()
+		c, ok := spans[child]
+		if !ok {
+			t.Fatalf("no %q span among %v", child, spanNames(spans))
+		}
+		p, ok := spans[parent]
+		if !ok {
+			t.Fatalf("no %q span among %v", parent, spanNames(spans))
+		}
+		if c.SpanContext.TraceID() != p.SpanContext.TraceID() {
+			t.Errorf("%q is in another trace than %q", child, parent)
+		}
+		if c.Parent.SpanID() != p.SpanContext.SpanID() {
+			t.Errorf("parent of %q is %q, want %q", child, byID[c.Parent.SpanID()].Name, parent)
+		}
+	}
+
+	httpSpan := spans["GET /api/v1/content/{videoId}/{filename}"]
+	if httpSpan.Parent.IsValid() {
+		t.Errorf("HTTP span has a parent")
+	}
+	const rpc = "tritontube.VideoContentStorageService/Read"
+	parentOf(rpc, "GET /api/v1/content/{videoId}/{filename}")
+	parentOf("server "+rpc, rpc)
+}
+
+func spanNames(spans map[string]tracetest.SpanStub) []string {
+	names := make([]string, 0, len(spans))
+	for name := range spans {
+		names = append(names, name)
+	}
+	return names
+}
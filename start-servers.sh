@@ -19,7 +19,7 @@ STORAGE3_PID=$!
 sleep 2
 
 # Start the web server
-go run ./cmd/web \
+go run -tags sqlite_fts5 ./cmd/web \
     sqlite "./metadata.db" \
     nw "localhost:8081,localhost:8090,localhost:8091,localhost:8092" &
 WEB_PID=$!